@@ -0,0 +1,340 @@
+package graphqlws
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// AbsintheHandler returns an http.Handler serving clients speaking the
+// Absinthe flavour of the Phoenix channels protocol, e.g. @absinthe/socket,
+// with the same service and options as s, so that frontends written for an
+// Elixir backend can be moved to this one without rewriting their socket
+// layer. It's usually mounted at /socket/websocket, only the version 2 (i.e.
+// vsn=2.0.0) JSON serializer is supported.
+//
+// Documents are replied to with their subscription id right away and their
+// results are then pushed as subscription:data, except for queries and
+// mutations whose result is the reply.
+func (s *Server) AbsintheHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.shuttingDown() {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		release, ok := s.limitConnection(w, r)
+		if !ok {
+			return
+		}
+		ctx, err := s.checkAuth(r)
+		if err != nil {
+			release()
+			s.rejectAuth(w, err)
+			return
+		}
+
+		ws, err := s.h.upgradeWebSocket(w, r, "")
+		if err != nil {
+			release()
+			return
+		}
+
+		ctx, options, _ := s.track(ctx, release)
+		go connection.Connect(newAbsintheConn(ws), s.svc, ctx, append(options, noCoalescing)...)
+	})
+}
+
+const (
+	absintheControlTopic = "__absinthe__:control"
+	absintheDocPrefix    = "__absinthe__:doc:"
+	phoenixTopic         = "phoenix"
+)
+
+var errInvalidPhoenixMessage = errors.New("graphqlws: invalid phoenix message")
+
+// phoenixMessage is a message of the Phoenix channels protocol, serialized as
+// [join_ref, ref, topic, event, payload]
+type phoenixMessage struct {
+	JoinRef *string
+	Ref     *string
+	Topic   string
+	Event   string
+	Payload json.RawMessage
+}
+
+func (m *phoenixMessage) UnmarshalJSON(data []byte) error {
+	var fields []json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if len(fields) != 5 {
+		return errInvalidPhoenixMessage
+	}
+	for i, v := range []interface{}{&m.JoinRef, &m.Ref, &m.Topic, &m.Event} {
+		if err := json.Unmarshal(fields[i], v); err != nil {
+			return err
+		}
+	}
+	m.Payload = fields[4]
+	return nil
+}
+
+func (m *phoenixMessage) MarshalJSON() ([]byte, error) {
+	payload := m.Payload
+	if payload == nil {
+		payload = json.RawMessage("{}")
+	}
+	return json.Marshal([]interface{}{m.JoinRef, m.Ref, m.Topic, m.Event, payload})
+}
+
+// reply returns the phx_reply to m with the given status and response
+func (m *phoenixMessage) reply(status string, response interface{}) *phoenixMessage {
+	payload, _ := json.Marshal(struct {
+		Status   string      `json:"status"`
+		Response interface{} `json:"response"`
+	}{status, response})
+	return &phoenixMessage{
+		JoinRef: m.JoinRef,
+		Ref:     m.Ref,
+		Topic:   m.Topic,
+		Event:   "phx_reply",
+		Payload: payload,
+	}
+}
+
+// absintheConn translates between the Absinthe protocol spoken by the client
+// and the operation messages handled by the connection
+type absintheConn struct {
+	ws WebSocket
+
+	// writeMu serializes writes between the connection's writer and the
+	// replies sent by the reader, writeDeadline is the deadline set by the
+	// former
+	writeMu       sync.Mutex
+	writeDeadline time.Time
+
+	mu   sync.Mutex
+	join *phoenixMessage
+	// docs holds the doc messages of queries and mutations waiting for their
+	// result to be replied with, by operation id
+	docs    map[string]*phoenixMessage
+	nextDoc int
+}
+
+func newAbsintheConn(ws WebSocket) *absintheConn {
+	return &absintheConn{ws: ws, docs: map[string]*phoenixMessage{}}
+}
+
+// ReadMessage reads Phoenix messages until one translates to an operation
+// message, replying to the others right away
+func (c *absintheConn) ReadMessage() (int, []byte, error) {
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return 0, nil, err
+		}
+		var msg phoenixMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return 0, nil, err
+		}
+
+		om, err := c.translate(&msg)
+		if err != nil {
+			return 0, nil, err
+		}
+		if om != nil {
+			data, err := json.Marshal(om)
+			return websocket.TextMessage, data, err
+		}
+	}
+}
+
+// absintheMessage is an operation message translated from a Phoenix message
+type absintheMessage struct {
+	ID      string      `json:"id,omitempty"`
+	Type    string      `json:"type"`
+	Payload interface{} `json:"payload,omitempty"`
+}
+
+func (c *absintheConn) translate(msg *phoenixMessage) (*absintheMessage, error) {
+	switch {
+	case msg.Topic == phoenixTopic && msg.Event == "heartbeat":
+		return nil, c.respond(msg.reply("ok", struct{}{}))
+
+	case msg.Topic == absintheControlTopic && msg.Event == "phx_join":
+		c.mu.Lock()
+		c.join = msg
+		c.mu.Unlock()
+		return &absintheMessage{Type: "connection_init", Payload: msg.Payload}, nil
+
+	case msg.Topic == absintheControlTopic && msg.Event == "phx_leave":
+		return &absintheMessage{Type: "connection_terminate"}, nil
+
+	case msg.Topic == absintheControlTopic && msg.Event == "doc":
+		// the variables are left for the connection to decode, see
+		// WithVariablesDecoder
+		var doc struct {
+			Query         string          `json:"query"`
+			OperationName string          `json:"operationName,omitempty"`
+			Variables     json.RawMessage `json:"variables,omitempty"`
+			Extensions    json.RawMessage `json:"extensions,omitempty"`
+		}
+		if err := json.Unmarshal(msg.Payload, &doc); err != nil {
+			return nil, c.respond(msg.reply("error", map[string]string{"message": err.Error()}))
+		}
+
+		c.mu.Lock()
+		c.nextDoc++
+		id := absintheDocPrefix + strconv.Itoa(c.nextDoc)
+		subscription := isSubscription(doc.Query)
+		if !subscription {
+			c.docs[id] = msg
+		}
+		c.mu.Unlock()
+
+		if subscription {
+			if err := c.respond(msg.reply("ok", map[string]string{"subscriptionId": id})); err != nil {
+				return nil, err
+			}
+		}
+		return &absintheMessage{ID: id, Type: "start", Payload: doc}, nil
+
+	case msg.Topic == absintheControlTopic && msg.Event == "unsubscribe":
+		var unsubscribe struct {
+			SubscriptionID string `json:"subscriptionId"`
+		}
+		json.Unmarshal(msg.Payload, &unsubscribe)
+		if err := c.respond(msg.reply("ok", map[string]string{"subscriptionId": unsubscribe.SubscriptionID})); err != nil {
+			return nil, err
+		}
+		return &absintheMessage{ID: unsubscribe.SubscriptionID, Type: "stop"}, nil
+
+	default:
+		return nil, c.respond(msg.reply("error", map[string]string{"reason": "unmatched topic"}))
+	}
+}
+
+// WriteMessage translates an operation message to the Phoenix message, if
+// any, the client expects
+func (c *absintheConn) WriteMessage(messageType int, data []byte) error {
+	var om struct {
+		ID      string          `json:"id"`
+		Type    string          `json:"type"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &om); err != nil {
+		return err
+	}
+
+	// a query or mutation is replied to with its first result
+	c.mu.Lock()
+	join := c.join
+	doc, pending := c.docs[om.ID]
+	delete(c.docs, om.ID)
+	c.mu.Unlock()
+
+	switch om.Type {
+	case "connection_ack":
+		if join != nil {
+			return c.write(join.reply("ok", struct{}{}))
+		}
+	case "connection_error":
+		if join != nil {
+			return c.write(join.reply("error", om.Payload))
+		}
+	case "data", "error":
+		result := om.Payload
+		if om.Type == "error" {
+			result, _ = json.Marshal(map[string][]json.RawMessage{"errors": errorList(om.Payload)})
+		}
+		if pending {
+			status := "ok"
+			if om.Type == "error" {
+				status = "error"
+			}
+			return c.write(doc.reply(status, result))
+		}
+
+		payload, _ := json.Marshal(struct {
+			Result         json.RawMessage `json:"result"`
+			SubscriptionID string          `json:"subscriptionId"`
+		}{result, om.ID})
+		return c.write(&phoenixMessage{Topic: om.ID, Event: "subscription:data", Payload: payload})
+	case "complete":
+		if pending {
+			return c.write(doc.reply("ok", struct{}{}))
+		}
+	}
+
+	// ka and the other messages have no Absinthe counterpart
+	return nil
+}
+
+// absintheReplyTimeout bounds the writes of the replies sent by the reader
+const absintheReplyTimeout = time.Second
+
+// write writes msg for the connection's writer, before the deadline it set
+func (c *absintheConn) write(msg *phoenixMessage) error {
+	return c.writeBefore(msg, func() time.Time { return c.writeDeadline })
+}
+
+// respond writes msg for the reader, within absintheReplyTimeout
+func (c *absintheConn) respond(msg *phoenixMessage) error {
+	return c.writeBefore(msg, func() time.Time { return time.Now().Add(absintheReplyTimeout) })
+}
+
+// writeBefore writes msg before the deadline returned by deadline, which is
+// called with writeMu held
+func (c *absintheConn) writeBefore(msg *phoenixMessage, deadline func() time.Time) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.ws.SetWriteDeadline(deadline()); err != nil {
+		return err
+	}
+	return c.ws.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *absintheConn) SetReadLimit(limit int64) {
+	c.ws.SetReadLimit(limit)
+}
+
+func (c *absintheConn) SetWriteDeadline(t time.Time) error {
+	c.writeMu.Lock()
+	c.writeDeadline = t
+	c.writeMu.Unlock()
+	return nil
+}
+
+func (c *absintheConn) Close() error {
+	return c.ws.Close()
+}
+
+// isSubscription reports whether the first operation of query is a
+// subscription, skipping whitespace and comments
+func isSubscription(query string) bool {
+	for {
+		query = strings.TrimLeft(query, " \t\r\n,\ufeff")
+		if !strings.HasPrefix(query, "#") {
+			break
+		}
+		if i := strings.IndexAny(query, "\r\n"); i >= 0 {
+			query = query[i:]
+		} else {
+			query = ""
+		}
+	}
+	return strings.HasPrefix(query, "subscription")
+}
@@ -0,0 +1,126 @@
+package graphqlws_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+type absintheService struct{}
+
+func (absintheService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	c := make(chan interface{}, 1)
+	c <- map[string]interface{}{"data": map[string]interface{}{"operation": operationName}}
+	close(c)
+	return c, nil
+}
+
+func (absintheService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{Data: json.RawMessage(`{"operation":"` + operationName + `"}`)}
+}
+
+func TestAbsintheHandler(t *testing.T) {
+	s := graphqlws.NewServer(context.Background(), absintheService{}, http.NotFoundHandler(), authValidator{})
+	srv := httptest.NewServer(s.AbsintheHandler())
+	defer srv.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?vsn=2.0.0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	for _, step := range []struct {
+		send     string
+		expected []string
+	}{
+		{
+			`[null,"1","phoenix","heartbeat",{}]`,
+			[]string{`[null,"1","phoenix","phx_reply",{"status":"ok","response":{}}]`},
+		},
+		{
+			`["2","2","__absinthe__:control","phx_join",{}]`,
+			[]string{`["2","2","__absinthe__:control","phx_reply",{"status":"ok","response":{}}]`},
+		},
+		{
+			`["2","3","__absinthe__:control","doc",{"query":"subscription onMessage { message }","operationName":"onMessage"}]`,
+			[]string{
+				`["2","3","__absinthe__:control","phx_reply",{"status":"ok","response":{"subscriptionId":"__absinthe__:doc:1"}}]`,
+				`[null,null,"__absinthe__:doc:1","subscription:data",{"result":{"data":{"operation":"onMessage"}},"subscriptionId":"__absinthe__:doc:1"}]`,
+			},
+		},
+		{
+			`["2","4","__absinthe__:control","doc",{"query":"# a query\nquery message { message }","operationName":"message"}]`,
+			[]string{`["2","4","__absinthe__:control","phx_reply",{"status":"ok","response":{"data":{"operation":"message"}}}]`},
+		},
+		{
+			`["2","5","__absinthe__:control","unsubscribe",{"subscriptionId":"__absinthe__:doc:1"}]`,
+			[]string{`["2","5","__absinthe__:control","phx_reply",{"status":"ok","response":{"subscriptionId":"__absinthe__:doc:1"}}]`},
+		},
+		{
+			`["3","6","room:lobby","phx_join",{}]`,
+			[]string{`["3","6","room:lobby","phx_reply",{"status":"error","response":{"reason":"unmatched topic"}}]`},
+		},
+	} {
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(step.send)); err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range step.expected {
+			_, got, err := ws.ReadMessage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != expected {
+				t.Fatalf("expected [%s] but instead got [%s]", expected, got)
+			}
+		}
+	}
+}
+
+// recordingAbsintheService records the variables and extensions of the
+// subscriptions started
+type recordingAbsintheService struct {
+	absintheService
+	started chan string
+}
+
+func (s recordingAbsintheService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	extensions, _ := graphqlws.ExtensionsFromContext(ctx)
+	s.started <- fmt.Sprintf("%v %v", variableValues["id"], extensions["trace"])
+	return s.absintheService.Subscribe(ctx, document, operationName, variableValues)
+}
+
+func TestAbsintheHandlerVariables(t *testing.T) {
+	svc := recordingAbsintheService{started: make(chan string, 1)}
+	s := graphqlws.NewServer(context.Background(), svc, http.NotFoundHandler(), authValidator{}, graphqlws.WithNumberVariables())
+	srv := httptest.NewServer(s.AbsintheHandler())
+	defer srv.Close()
+
+	ws, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?vsn=2.0.0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	ws.WriteMessage(websocket.TextMessage, []byte(`["2","1","__absinthe__:control","phx_join",{}]`))
+	ws.WriteMessage(websocket.TextMessage, []byte(`["2","2","__absinthe__:control","doc",{"query":"subscription { message }","variables":{"id":9007199254740993},"extensions":{"trace":true}}]`))
+	select {
+	case got := <-svc.started:
+		if expected := "9007199254740993 true"; got != expected {
+			t.Fatalf("expected [%s] but instead got [%s]", expected, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the subscription to be started")
+	}
+}
@@ -0,0 +1,30 @@
+package graphqlws
+
+import (
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// AckConfig configures the acknowledgement of data messages, see
+// WithAcknowledgements
+type AckConfig = connection.AckConfig
+
+// ErrNotAcknowledged is the error of the operations whose data messages the
+// client didn't acknowledge despite being sent again, see WithAcknowledgements
+var ErrNotAcknowledged = connection.ErrNotAcknowledged
+
+// WithAcknowledgements lets clients opt in to acknowledging the data messages
+// of an operation with {"ack": true} in its start payload. Its data messages
+// then carry a sequence number, seq, which the client acknowledges along with
+// the ones before with {"type": "ack", "id": id, "payload": {"seq": n}}. Up to
+// config.Window messages are kept until acknowledged, and sent again every
+// config.RetryAfter up to config.MaxRetries times before the operation fails
+// with ErrNotAcknowledged.
+//
+// The Delivered function of a Delivery is then only called once its message is
+// acknowledged, so that e.g. the events of the pubsub package are only marked
+// processed upstream by then.
+func WithAcknowledgements(config AckConfig) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.Acknowledge(config))
+	}
+}
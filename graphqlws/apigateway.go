@@ -0,0 +1,451 @@
+package graphqlws
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// APIGatewayPoster sends messages to and closes the connections of an AWS API
+// Gateway WebSocket API through its management API, see the apigateway package
+// for an implementation.
+type APIGatewayPoster interface {
+	PostToConnection(ctx context.Context, connectionID string, data []byte) error
+	DeleteConnection(ctx context.Context, connectionID string) error
+}
+
+// APIGatewayConnection is the state of a connection of an API Gateway
+// WebSocket API, as kept in an APIGatewayStore
+type APIGatewayConnection struct {
+	// Header is the header of the $connect request, checked again by the
+	// AuthValidator when the connection is restored
+	Header http.Header `json:"header,omitempty"`
+	// InitPayload is the payload of the connection_init once acknowledged
+	InitPayload json.RawMessage `json:"initPayload,omitempty"`
+	// Operations are the payloads of the start messages of the running
+	// operations by ID
+	Operations map[string]json.RawMessage `json:"operations,omitempty"`
+}
+
+// APIGatewayStore keeps the state of the connections of an API Gateway
+// WebSocket API by connection ID outside of the process, e.g. in DynamoDB, see
+// WithAPIGatewayStore
+type APIGatewayStore interface {
+	SaveConnectionState(ctx context.Context, connectionID string, state APIGatewayConnection) error
+	LoadConnectionState(ctx context.Context, connectionID string) (APIGatewayConnection, bool, error)
+	DeleteConnectionState(ctx context.Context, connectionID string) error
+}
+
+// WithAPIGatewayStore keeps the state of the connections served by
+// Server.APIGatewayHandler in store, so that their events can be delivered to
+// any instance of the server.
+func WithAPIGatewayStore(store APIGatewayStore) Option {
+	return func(h *handler) {
+		h.gatewayStore = store
+	}
+}
+
+// The request headers the $connect, $disconnect and $default routes of the
+// WebSocket API must map the context.connectionId and context.eventType
+// variables to in their HTTP integration requests.
+const (
+	APIGatewayConnectionIDHeader = "X-Connection-Id"
+	APIGatewayEventTypeHeader    = "X-Event-Type"
+)
+
+// APIGatewayHandler returns an http.Handler serving the connections of an AWS
+// API Gateway WebSocket API, which terminates the websockets and delivers their
+// events over HTTP, with the same service and options as s. Incoming messages
+// are handled as they are delivered and outgoing ones are posted with poster.
+//
+// With WithAPIGatewayStore, an instance handling an event of a connection it
+// doesn't hold, e.g. connected through another instance, restores it from the
+// store: its connection_init is handled again, without the client being sent
+// another connection_ack, and its running operations are started again, their
+// events being posted from that instance. Without a store, all the events of a
+// connection must be delivered to the same instance and the messages of the
+// connections it doesn't hold are answered with 410 (gone).
+func (s *Server) APIGatewayHandler(poster APIGatewayPoster) http.Handler {
+	return &apiGatewayHandler{server: s, poster: poster}
+}
+
+type apiGatewayHandler struct {
+	server *Server
+	poster APIGatewayPoster
+	conns  sync.Map // connection id -> *apiGatewayConn
+	// restoreMu keeps a connection from being restored twice
+	restoreMu sync.Mutex
+}
+
+func (h *apiGatewayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(APIGatewayConnectionIDHeader)
+	if id == "" {
+		http.Error(w, "missing connection id", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Header.Get(APIGatewayEventTypeHeader) {
+	case "CONNECT":
+		if h.server.shuttingDown() {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		c, ok := h.connect(w, r, id)
+		if !ok {
+			return
+		}
+		c.save(APIGatewayConnection{Header: r.Header.Clone()})
+
+	case "MESSAGE":
+		c, ok := h.load(w, r, id)
+		if !ok {
+			return
+		}
+
+		frame, err := io.ReadAll(io.LimitReader(r.Body, c.readLimit+1))
+		if err != nil {
+			return
+		}
+		if int64(len(frame)) > c.readLimit {
+			c.closeWith(fmt.Errorf("%w: read limit exceeded", connection.ErrClientGone))
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
+		}
+		// API Gateway may deliver the messages of a connection concurrently
+		c.frameMu.Lock()
+		c.received(frame)
+		c.handleFrame(frame)
+		c.frameMu.Unlock()
+
+	case "DISCONNECT":
+		if v, ok := h.conns.Load(id); ok {
+			c := v.(*apiGatewayConn)
+			c.disconnect()
+			c.closeWith(connection.ErrClientGone)
+		}
+		if store := h.server.h.gatewayStore; store != nil {
+			if err := store.DeleteConnectionState(r.Context(), id); err != nil {
+				h.server.h.reportError(r.Context(), err)
+			}
+		}
+
+	default:
+		http.Error(w, "unknown event type", http.StatusBadRequest)
+	}
+}
+
+// connect attaches the connection id authenticated with r, within the
+// connection limits of the server
+func (h *apiGatewayHandler) connect(w http.ResponseWriter, r *http.Request, id string) (*apiGatewayConn, bool) {
+	release, ok := h.server.limitConnection(w, r)
+	if !ok {
+		return nil, false
+	}
+	ctx, err := h.server.checkAuth(r)
+	if err != nil {
+		release()
+		h.server.rejectAuth(w, err)
+		return nil, false
+	}
+
+	c := &apiGatewayConn{id: id, poster: h.poster, store: h.server.h.gatewayStore}
+	ctx, options, _ := h.server.track(ctx, release)
+	c.report = func(err error) { h.server.h.reportError(ctx, err) }
+	options = append(options, connection.OnClose(func() {
+		h.conns.Delete(id)
+		c.forget()
+	}))
+	c.handleFrame, c.closeWith = connection.Attach(c, h.server.svc, ctx, options...)
+	h.conns.Store(id, c)
+	if ctx.Err() != nil {
+		// closed before being stored
+		h.conns.Delete(id)
+	}
+	return c, true
+}
+
+// load returns the connection id, restored from the store if it's not held by
+// this instance
+func (h *apiGatewayHandler) load(w http.ResponseWriter, r *http.Request, id string) (*apiGatewayConn, bool) {
+	if v, ok := h.conns.Load(id); ok {
+		return v.(*apiGatewayConn), true
+	}
+	store := h.server.h.gatewayStore
+	if store == nil {
+		http.Error(w, "unknown connection", http.StatusGone)
+		return nil, false
+	}
+
+	h.restoreMu.Lock()
+	defer h.restoreMu.Unlock()
+	if v, ok := h.conns.Load(id); ok {
+		return v.(*apiGatewayConn), true
+	}
+	state, ok, err := store.LoadConnectionState(r.Context(), id)
+	if err != nil {
+		h.server.h.reportError(r.Context(), err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil, false
+	}
+	if !ok || h.server.shuttingDown() {
+		http.Error(w, "unknown connection", http.StatusGone)
+		return nil, false
+	}
+
+	restored := r.Clone(r.Context())
+	restored.Header = state.Header.Clone()
+	c, ok := h.connect(w, restored, id)
+	if !ok {
+		return nil, false
+	}
+	c.restore(state)
+	return c, true
+}
+
+var errAPIGatewayRead = errors.New("graphqlws: API Gateway messages are delivered over HTTP")
+
+// apiGatewayConn adapts a connection of an API Gateway WebSocket API to the
+// interface used by the connection package
+type apiGatewayConn struct {
+	id          string
+	poster      APIGatewayPoster
+	handleFrame func(frame json.RawMessage) bool
+	closeWith   func(reason error)
+	readLimit   int64
+	frameMu     sync.Mutex
+
+	mu            sync.Mutex
+	writeDeadline time.Time
+	disconnected  bool
+	closeOnce     sync.Once
+
+	// store is nil unless the state of the connection is kept in one, the
+	// updates of state being serialized with their saves by stateMu
+	store       APIGatewayStore
+	report      func(err error)
+	stateMu     sync.Mutex
+	state       APIGatewayConnection
+	pendingInit json.RawMessage
+	// restoring is set while the connection_ack of the replayed
+	// connection_init is to be dropped
+	restoring bool
+}
+
+// apiGatewayMessage is the part of operation messages the state of a
+// connection is tracked with
+type apiGatewayMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// apiGatewayMessages decodes the operation messages of frame, be it a single
+// one or a batch
+func apiGatewayMessages(frame []byte) []apiGatewayMessage {
+	var msgs []apiGatewayMessage
+	if err := json.Unmarshal(frame, &msgs); err == nil {
+		return msgs
+	}
+	var msg apiGatewayMessage
+	if err := json.Unmarshal(frame, &msg); err != nil {
+		return nil
+	}
+	return []apiGatewayMessage{msg}
+}
+
+// save replaces the state of the connection
+func (c *apiGatewayConn) save(state APIGatewayConnection) {
+	if c.store == nil {
+		return
+	}
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.state = state
+	c.saveLocked()
+}
+
+func (c *apiGatewayConn) saveLocked() {
+	if err := c.store.SaveConnectionState(context.Background(), c.id, c.state); err != nil {
+		c.report(err)
+	}
+}
+
+// forget deletes the state of the connection once it's closed
+func (c *apiGatewayConn) forget() {
+	if c.store == nil {
+		return
+	}
+	if err := c.store.DeleteConnectionState(context.Background(), c.id); err != nil {
+		c.report(err)
+	}
+}
+
+// received tracks the connection_init and the operations started and stopped
+// by frame
+func (c *apiGatewayConn) received(frame []byte) {
+	if c.store == nil {
+		return
+	}
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	changed := false
+	for _, msg := range apiGatewayMessages(frame) {
+		switch msg.Type {
+		case "connection_init":
+			// saved once acknowledged
+			c.pendingInit = append(json.RawMessage(nil), msg.Payload...)
+		case "start":
+			if c.state.Operations == nil {
+				c.state.Operations = map[string]json.RawMessage{}
+			}
+			c.state.Operations[msg.ID] = append(json.RawMessage(nil), msg.Payload...)
+			changed = true
+		case "stop":
+			delete(c.state.Operations, msg.ID)
+			changed = true
+		}
+	}
+	if changed {
+		c.saveLocked()
+	}
+}
+
+// sent tracks the acknowledgement of the connection_init and the operations
+// completed by data, it returns false if data isn't to be posted
+func (c *apiGatewayConn) sent(data []byte) bool {
+	if c.store == nil || (!bytes.Contains(data, []byte(`"connection_ack"`)) && !bytes.Contains(data, []byte(`"complete"`))) {
+		return true
+	}
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	msgs := apiGatewayMessages(data)
+	changed := false
+	for _, msg := range msgs {
+		switch msg.Type {
+		case "connection_ack":
+			c.state.InitPayload, c.pendingInit = c.pendingInit, nil
+			changed = true
+		case "complete":
+			if _, ok := c.state.Operations[msg.ID]; ok {
+				delete(c.state.Operations, msg.ID)
+				changed = true
+			}
+		}
+	}
+	if changed {
+		c.saveLocked()
+	}
+	// the connection_ack is sent on its own
+	if c.restoring && len(msgs) == 1 && msgs[0].Type == "connection_ack" {
+		c.restoring = false
+		return false
+	}
+	return true
+}
+
+// restore replays the connection_init and the start messages of state
+func (c *apiGatewayConn) restore(state APIGatewayConnection) {
+	c.frameMu.Lock()
+	defer c.frameMu.Unlock()
+
+	c.stateMu.Lock()
+	c.state = APIGatewayConnection{Header: state.Header}
+	c.restoring = state.InitPayload != nil
+	c.stateMu.Unlock()
+	if state.InitPayload == nil {
+		return
+	}
+
+	frame, _ := json.Marshal(apiGatewayMessage{Type: "connection_init", Payload: state.InitPayload})
+	c.received(frame)
+	if !c.handleFrame(frame) {
+		return
+	}
+	ids := make([]string, 0, len(state.Operations))
+	for id := range state.Operations {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		frame, _ := json.Marshal(apiGatewayMessage{ID: id, Type: "start", Payload: state.Operations[id]})
+		c.received(frame)
+		if !c.handleFrame(frame) {
+			return
+		}
+	}
+}
+
+// disconnect marks the connection as closed by the client, so it's not deleted
+// again when closed
+func (c *apiGatewayConn) disconnect() {
+	c.mu.Lock()
+	c.disconnected = true
+	c.mu.Unlock()
+}
+
+func (c *apiGatewayConn) ReadMessage() (int, []byte, error) {
+	return 0, nil, errAPIGatewayRead
+}
+
+func (c *apiGatewayConn) WriteMessage(messageType int, data []byte) error {
+	if !c.sent(data) {
+		return nil
+	}
+	c.mu.Lock()
+	deadline := c.writeDeadline
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	return c.poster.PostToConnection(ctx, c.id, data)
+}
+
+// WriteMessageContext implements ContextWriter, the post being cancelled once
+// ctx is done
+func (c *apiGatewayConn) WriteMessageContext(ctx context.Context, messageType int, data []byte) error {
+	if !c.sent(data) {
+		return nil
+	}
+	return c.poster.PostToConnection(ctx, c.id, data)
+}
+
+func (c *apiGatewayConn) SetReadLimit(limit int64) {
+	c.readLimit = limit
+}
+
+func (c *apiGatewayConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *apiGatewayConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		disconnected := c.disconnected
+		deadline := c.writeDeadline
+		c.mu.Unlock()
+		if disconnected {
+			return
+		}
+
+		if deadline.IsZero() || deadline.Before(time.Now()) {
+			deadline = time.Now().Add(time.Second)
+		}
+		ctx, cancel := context.WithDeadline(context.Background(), deadline)
+		defer cancel()
+		err = c.poster.DeleteConnection(ctx, c.id)
+	})
+	return err
+}
@@ -0,0 +1,48 @@
+//go:build apigateway
+// +build apigateway
+
+// Package apigateway provides a graphqlws.APIGatewayPoster using the AWS SDK.
+// It's only built with the apigateway build tag, so that depending on
+// graphqlws doesn't pull in the SDK.
+package apigateway
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+// ManagementAPI is the part of *apigatewaymanagementapi.Client used by Poster
+type ManagementAPI interface {
+	PostToConnection(ctx context.Context, params *apigatewaymanagementapi.PostToConnectionInput, optFns ...func(*apigatewaymanagementapi.Options)) (*apigatewaymanagementapi.PostToConnectionOutput, error)
+	DeleteConnection(ctx context.Context, params *apigatewaymanagementapi.DeleteConnectionInput, optFns ...func(*apigatewaymanagementapi.Options)) (*apigatewaymanagementapi.DeleteConnectionOutput, error)
+}
+
+type poster struct {
+	api ManagementAPI
+}
+
+// Poster returns a graphqlws.APIGatewayPoster using api, usually a client
+// created with the endpoint of the WebSocket API's stage, e.g.
+// https://{api-id}.execute-api.{region}.amazonaws.com/{stage}.
+func Poster(api ManagementAPI) graphqlws.APIGatewayPoster {
+	return &poster{api: api}
+}
+
+func (p *poster) PostToConnection(ctx context.Context, connectionID string, data []byte) error {
+	_, err := p.api.PostToConnection(ctx, &apigatewaymanagementapi.PostToConnectionInput{
+		ConnectionId: aws.String(connectionID),
+		Data:         data,
+	})
+	return err
+}
+
+func (p *poster) DeleteConnection(ctx context.Context, connectionID string) error {
+	_, err := p.api.DeleteConnection(ctx, &apigatewaymanagementapi.DeleteConnectionInput{
+		ConnectionId: aws.String(connectionID),
+	})
+	return err
+}
@@ -0,0 +1,51 @@
+//go:build apigateway
+// +build apigateway
+
+package apigateway_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/apigatewaymanagementapi"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/apigateway"
+)
+
+type managementAPI struct {
+	posted  *apigatewaymanagementapi.PostToConnectionInput
+	deleted *apigatewaymanagementapi.DeleteConnectionInput
+}
+
+func (api *managementAPI) PostToConnection(ctx context.Context, params *apigatewaymanagementapi.PostToConnectionInput, optFns ...func(*apigatewaymanagementapi.Options)) (*apigatewaymanagementapi.PostToConnectionOutput, error) {
+	api.posted = params
+	return &apigatewaymanagementapi.PostToConnectionOutput{}, nil
+}
+
+func (api *managementAPI) DeleteConnection(ctx context.Context, params *apigatewaymanagementapi.DeleteConnectionInput, optFns ...func(*apigatewaymanagementapi.Options)) (*apigatewaymanagementapi.DeleteConnectionOutput, error) {
+	api.deleted = params
+	return &apigatewaymanagementapi.DeleteConnectionOutput{}, nil
+}
+
+func TestPoster(t *testing.T) {
+	api := &managementAPI{}
+	p := apigateway.Poster(api)
+
+	if err := p.PostToConnection(context.Background(), "a-conn", []byte(`{"type":"ka"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if aws.ToString(api.posted.ConnectionId) != "a-conn" || string(api.posted.Data) != `{"type":"ka"}` {
+		t.Fatalf("unexpected post %+v", api.posted)
+	}
+
+	if err := p.DeleteConnection(context.Background(), "a-conn"); err != nil {
+		t.Fatal(err)
+	}
+	if aws.ToString(api.deleted.ConnectionId) != "a-conn" {
+		t.Fatalf("unexpected delete %+v", api.deleted)
+	}
+}
+
+// the SDK client must satisfy ManagementAPI
+var _ apigateway.ManagementAPI = (*apigatewaymanagementapi.Client)(nil)
@@ -0,0 +1,201 @@
+package graphqlws_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+type poster struct {
+	posted  chan string
+	deleted chan string
+}
+
+func (p *poster) PostToConnection(ctx context.Context, connectionID string, data []byte) error {
+	p.posted <- connectionID + " " + string(data)
+	return nil
+}
+
+func (p *poster) DeleteConnection(ctx context.Context, connectionID string) error {
+	p.deleted <- connectionID
+	return nil
+}
+
+func sendAPIGatewayEvent(t *testing.T, h http.Handler, eventType string, body string) {
+	t.Helper()
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set(graphqlws.APIGatewayConnectionIDHeader, "a-conn")
+	r.Header.Set(graphqlws.APIGatewayEventTypeHeader, eventType)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected %s to succeed but instead got %d", eventType, w.Code)
+	}
+}
+
+func expectPosted(t *testing.T, p *poster, expected string) {
+	t.Helper()
+	select {
+	case got := <-p.posted:
+		if got != expected {
+			t.Fatalf("expected [%s] but instead got [%s]", expected, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected [%s] but instead got nothing", expected)
+	}
+}
+
+func TestAPIGatewayHandler(t *testing.T) {
+	s := graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), authValidator{})
+	p := &poster{posted: make(chan string, 8), deleted: make(chan string, 1)}
+	h := s.APIGatewayHandler(p)
+
+	sendAPIGatewayEvent(t, h, "CONNECT", "")
+	if n := s.ConnectionCount(); n != 1 {
+		t.Fatalf("expected 1 connection but instead got %d", n)
+	}
+
+	sendAPIGatewayEvent(t, h, "MESSAGE", `{"type":"connection_init","payload":{}}`)
+	expectPosted(t, p, `a-conn {"payload":{"extensions":{"batching":true,"flowControl":true,"resume":true}},"type":"connection_ack"}`)
+
+	sendAPIGatewayEvent(t, h, "MESSAGE", `{"id":"a-id","type":"start","payload":{}}`)
+	expectPosted(t, p, `a-conn {"id":"a-id","type":"complete"}`)
+
+	sendAPIGatewayEvent(t, h, "DISCONNECT", "")
+	waitConnectionCount(t, s, 0)
+	select {
+	case id := <-p.deleted:
+		t.Fatalf("expected the disconnected connection %s not to be deleted", id)
+	default:
+	}
+}
+
+func TestAPIGatewayHandlerTerminate(t *testing.T) {
+	s := graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), authValidator{})
+	p := &poster{posted: make(chan string, 8), deleted: make(chan string, 1)}
+	h := s.APIGatewayHandler(p)
+
+	sendAPIGatewayEvent(t, h, "CONNECT", "")
+	sendAPIGatewayEvent(t, h, "MESSAGE", `{"type":"connection_terminate"}`)
+
+	select {
+	case id := <-p.deleted:
+		if id != "a-conn" {
+			t.Fatalf("expected a-conn to be deleted but instead got %s", id)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the connection to be deleted")
+	}
+	waitConnectionCount(t, s, 0)
+}
+
+func TestAPIGatewayHandlerUnknownConnection(t *testing.T) {
+	s := graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), authValidator{})
+	h := s.APIGatewayHandler(&poster{})
+
+	// e.g. connected through another process
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"type":"connection_init","payload":{}}`))
+	r.Header.Set(graphqlws.APIGatewayConnectionIDHeader, "a-conn")
+	r.Header.Set(graphqlws.APIGatewayEventTypeHeader, "MESSAGE")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusGone {
+		t.Fatalf("expected %d but instead got %d", http.StatusGone, w.Code)
+	}
+}
+
+type apiGatewayStore struct {
+	mu    sync.Mutex
+	conns map[string]graphqlws.APIGatewayConnection
+}
+
+func (s *apiGatewayStore) SaveConnectionState(ctx context.Context, connectionID string, state graphqlws.APIGatewayConnection) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// the state is copied as a store would serialize it
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	var saved graphqlws.APIGatewayConnection
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return err
+	}
+	s.conns[connectionID] = saved
+	return nil
+}
+
+func (s *apiGatewayStore) LoadConnectionState(ctx context.Context, connectionID string) (graphqlws.APIGatewayConnection, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.conns[connectionID]
+	return state, ok, nil
+}
+
+func (s *apiGatewayStore) DeleteConnectionState(ctx context.Context, connectionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, connectionID)
+	return nil
+}
+
+func TestAPIGatewayHandlerStore(t *testing.T) {
+	store := &apiGatewayStore{conns: map[string]graphqlws.APIGatewayConnection{}}
+	a := graphqlws.NewServer(context.Background(), blockingService{}, http.NotFoundHandler(), authValidator{}, graphqlws.WithAPIGatewayStore(store))
+	pa := &poster{posted: make(chan string, 8), deleted: make(chan string, 1)}
+	ha := a.APIGatewayHandler(pa)
+
+	sendAPIGatewayEvent(t, ha, "CONNECT", "")
+	sendAPIGatewayEvent(t, ha, "MESSAGE", `{"type":"connection_init","payload":{"token":"t"}}`)
+	expectPosted(t, pa, `a-conn {"payload":{"extensions":{"batching":true,"flowControl":true,"resume":true}},"type":"connection_ack"}`)
+	sendAPIGatewayEvent(t, ha, "MESSAGE", `{"id":"a-id","type":"start","payload":{"query":"subscription { a }"}}`)
+	sendAPIGatewayEvent(t, ha, "MESSAGE", `{"id":"b-id","type":"start","payload":{"query":"subscription { b }"}}`)
+
+	// the next messages are delivered to another instance
+	b := graphqlws.NewServer(context.Background(), blockingService{}, http.NotFoundHandler(), authValidator{}, graphqlws.WithAPIGatewayStore(store))
+	pb := &poster{posted: make(chan string, 8), deleted: make(chan string, 1)}
+	hb := b.APIGatewayHandler(pb)
+
+	sendAPIGatewayEvent(t, hb, "MESSAGE", `{"id":"a-id","type":"stop"}`)
+	expectPosted(t, pb, `a-conn {"id":"a-id","type":"complete"}`)
+	if n := b.ConnectionCount(); n != 1 {
+		t.Fatalf("expected the connection to be restored but instead got %d connections", n)
+	}
+	state, _, _ := store.LoadConnectionState(context.Background(), "a-conn")
+	if string(state.InitPayload) != `{"token":"t"}` || len(state.Operations) != 1 || state.Operations["b-id"] == nil {
+		t.Fatalf("expected the restored connection to run b-id but instead got %+v", state)
+	}
+
+	sendAPIGatewayEvent(t, hb, "DISCONNECT", "")
+	waitConnectionCount(t, b, 0)
+	if _, ok, _ := store.LoadConnectionState(context.Background(), "a-conn"); ok {
+		t.Fatal("expected the state of the disconnected connection to be deleted")
+	}
+	select {
+	case got := <-pb.posted:
+		t.Fatalf("expected nothing else to be posted but instead got [%s]", got)
+	default:
+	}
+}
+
+func TestAPIGatewayHandlerConnectionLimits(t *testing.T) {
+	s := graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), authValidator{}, graphqlws.WithMaxConnections(1))
+	h := s.APIGatewayHandler(&poster{})
+
+	sendAPIGatewayEvent(t, h, "CONNECT", "")
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set(graphqlws.APIGatewayConnectionIDHeader, "b-conn")
+	r.Header.Set(graphqlws.APIGatewayEventTypeHeader, "CONNECT")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected %d but instead got %d", http.StatusServiceUnavailable, w.Code)
+	}
+}
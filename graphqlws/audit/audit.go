@@ -0,0 +1,280 @@
+// Package audit provides a graphqlws.Observer emitting audit records of who
+// connected, from where, which operations they ran and when and why they
+// disconnected, delivered in batches to a pluggable Sink.
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+// The types of the records
+const (
+	Connected      = "connected"
+	OperationStart = "operation.start"
+	OperationEnd   = "operation.end"
+	Disconnected   = "disconnected"
+)
+
+// Record is an audit record
+type Record struct {
+	Type         string    `json:"type"`
+	Time         time.Time `json:"time"`
+	ConnectionID string    `json:"connectionId"`
+	// Subject is who the connection belongs to, as returned by the Subject
+	// function
+	Subject       string `json:"subject,omitempty"`
+	RemoteAddr    string `json:"remoteAddr,omitempty"`
+	OperationID   string `json:"operationId,omitempty"`
+	OperationName string `json:"operationName,omitempty"`
+	Query         string `json:"query,omitempty"`
+	// Reason is why an operation failed or a connection was closed
+	Reason string `json:"reason,omitempty"`
+}
+
+// Sink stores audit records, e.g. in a log pipeline or a database. WriteAudit
+// is called by a single goroutine with the records in the order they were
+// emitted.
+type Sink interface {
+	WriteAudit(ctx context.Context, records []Record) error
+}
+
+// SinkFunc is a function implementing Sink
+type SinkFunc func(ctx context.Context, records []Record) error
+
+// WriteAudit calls f
+func (f SinkFunc) WriteAudit(ctx context.Context, records []Record) error {
+	return f(ctx, records)
+}
+
+// Auditor is a graphqlws.Observer emitting a Record for each connection and
+// operation lifecycle change. Records are queued and written in batches, so
+// that a slow sink doesn't hold up connections; records are dropped when the
+// queue is full.
+type Auditor struct {
+	sink          Sink
+	subject       func(ctx context.Context) string
+	batchSize     int
+	flushInterval time.Duration
+	onError       func([]Record, error)
+	done          chan struct{}
+
+	// mu guards closing queue against emitting to it
+	mu     sync.RWMutex
+	queue  chan Record
+	closed bool
+}
+
+// Option configures an Auditor
+type Option func(a *Auditor)
+
+// Subject sets the function returning who a connection belongs to from its
+// context, i.e. the one returned by the AuthValidator
+func Subject(fn func(ctx context.Context) string) Option {
+	return func(a *Auditor) {
+		a.subject = fn
+	}
+}
+
+// Batch sets the maximum number of records written at once and how long a
+// record may wait for a batch to fill up, the defaults are 100 and a second
+func Batch(size int, interval time.Duration) Option {
+	return func(a *Auditor) {
+		a.batchSize = size
+		a.flushInterval = interval
+	}
+}
+
+// QueueSize sets how many records can wait to be written, the default is 4096
+func QueueSize(size int) Option {
+	return func(a *Auditor) {
+		a.queue = make(chan Record, size)
+	}
+}
+
+// OnError sets a function called with the records that were dropped, either
+// because the queue was full or because the sink failed to write them
+func OnError(fn func([]Record, error)) Option {
+	return func(a *Auditor) {
+		a.onError = fn
+	}
+}
+
+// ErrQueueFull is passed to the OnError function for records dropped because
+// too many were waiting to be written
+var ErrQueueFull = errors.New("audit: queue full")
+
+// ErrClosed is passed to the OnError function for records emitted after the
+// Auditor was closed
+var ErrClosed = errors.New("audit: auditor closed")
+
+// New returns an Auditor writing records to sink, it must be closed to flush
+// the records still queued.
+func New(sink Sink, options ...Option) *Auditor {
+	a := &Auditor{
+		sink:          sink,
+		subject:       func(context.Context) string { return "" },
+		batchSize:     100,
+		flushInterval: time.Second,
+		onError:       func([]Record, error) {},
+		done:          make(chan struct{}),
+	}
+	for _, opt := range options {
+		opt(a)
+	}
+	if a.queue == nil {
+		a.queue = make(chan Record, 4096)
+	}
+
+	go a.run()
+	return a
+}
+
+// Close stops the Auditor once the queued records have been written, records
+// emitted afterwards are dropped.
+func (a *Auditor) Close() {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.queue)
+	}
+	a.mu.Unlock()
+	<-a.done
+}
+
+func (a *Auditor) run() {
+	defer close(a.done)
+
+	ticker := time.NewTicker(a.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]Record, 0, a.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := a.sink.WriteAudit(context.Background(), batch); err != nil {
+			a.onError(batch, err)
+		}
+		batch = make([]Record, 0, a.batchSize)
+	}
+
+	for {
+		select {
+		case record, ok := <-a.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, record)
+			if len(batch) >= a.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// emit queues record without blocking
+func (a *Auditor) emit(record Record) {
+	record.Time = time.Now().UTC()
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		a.onError([]Record{record}, ErrClosed)
+		return
+	}
+	select {
+	case a.queue <- record:
+	default:
+		a.onError([]Record{record}, ErrQueueFull)
+	}
+}
+
+type connectionKey struct{}
+
+// connectionInfo is carried by the connection context, so that the records of
+// its operations can refer to it
+type connectionInfo struct {
+	id         string
+	subject    string
+	remoteAddr string
+}
+
+func (ci *connectionInfo) record(recordType string) Record {
+	return Record{Type: recordType, ConnectionID: ci.id, Subject: ci.subject, RemoteAddr: ci.remoteAddr}
+}
+
+func (a *Auditor) ConnectionStart(ctx context.Context, info graphqlws.ConnectionInfo) context.Context {
+	ci := &connectionInfo{id: connectionID(ctx), subject: a.subject(ctx)}
+	if info.RemoteAddr != nil {
+		ci.remoteAddr = info.RemoteAddr.String()
+	}
+	a.emit(ci.record(Connected))
+	return context.WithValue(ctx, connectionKey{}, ci)
+}
+
+func (a *Auditor) ConnectionEnd(ctx context.Context) {
+	ci, ok := ctx.Value(connectionKey{}).(*connectionInfo)
+	if !ok {
+		return
+	}
+	record := ci.record(Disconnected)
+	if reason := graphqlws.CloseReason(ctx); reason != nil {
+		record.Reason = reason.Error()
+	}
+	a.emit(record)
+}
+
+type operationKey struct{}
+
+func (a *Auditor) OperationStart(ctx context.Context, info graphqlws.OperationInfo) context.Context {
+	record := Record{Type: OperationStart}
+	if ci, ok := ctx.Value(connectionKey{}).(*connectionInfo); ok {
+		record = ci.record(OperationStart)
+	}
+	record.OperationID = info.ID
+	record.OperationName = info.OperationName
+	record.Query = info.Query
+	a.emit(record)
+	return context.WithValue(ctx, operationKey{}, record)
+}
+
+func (a *Auditor) OperationEnd(ctx context.Context, err error) {
+	record, ok := ctx.Value(operationKey{}).(Record)
+	if !ok {
+		return
+	}
+	record.Type = OperationEnd
+	record.Query = ""
+	if err != nil {
+		record.Reason = err.Error()
+	}
+	a.emit(record)
+}
+
+// connectionID returns the id of the connection ctx belongs to, a random one
+// if it doesn't belong to one
+func connectionID(ctx context.Context) string {
+	if id, ok := graphqlws.ConnectionIDFromContext(ctx); ok {
+		return string(id)
+	}
+	return newID()
+}
+
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,118 @@
+package audit_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/audit"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+)
+
+type gqlService struct{}
+
+func (gqlService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	c := make(chan interface{})
+	close(c)
+	return c, nil
+}
+
+func (gqlService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+type subjectKey struct{}
+
+type authValidator struct{}
+
+func (authValidator) CheckAuth(r *http.Request, ctx context.Context) (context.Context, error) {
+	return context.WithValue(ctx, subjectKey{}, r.URL.Query().Get("user")), nil
+}
+
+func TestAuditor(t *testing.T) {
+	var batches [][]audit.Record
+	a := audit.New(
+		audit.SinkFunc(func(ctx context.Context, records []audit.Record) error {
+			batches = append(batches, records)
+			return nil
+		}),
+		audit.Subject(func(ctx context.Context) string {
+			subject, _ := ctx.Value(subjectKey{}).(string)
+			return subject
+		}),
+		audit.Batch(2, time.Hour),
+	)
+
+	s := graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), authValidator{}, graphqlws.WithObserver(a))
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+	ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"?user=alice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []string{
+		`{"type":"connection_init","payload":{}}`,
+		`{"id":"1","type":"start","payload":{"query":"subscription onMessage { message }","operationName":"onMessage"}}`,
+	} {
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the ack and the completion of the operation
+	for i := 0; i < 2; i++ {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ws.Close()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.ConnectionCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the connection to be closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	a.Close()
+
+	if len(batches) != 2 {
+		t.Fatalf("expected 2 batches but instead got %d", len(batches))
+	}
+	records := append(batches[0], batches[1]...)
+	for i, expected := range []audit.Record{
+		{Type: audit.Connected},
+		{Type: audit.OperationStart, OperationID: "1", OperationName: "onMessage", Query: "subscription onMessage { message }"},
+		{Type: audit.OperationEnd, OperationID: "1", OperationName: "onMessage"},
+		{Type: audit.Disconnected, Reason: records[3].Reason},
+	} {
+		got := records[i]
+		expected.Time = got.Time
+		expected.ConnectionID = records[0].ConnectionID
+		expected.Subject = "alice"
+		expected.RemoteAddr = got.RemoteAddr
+		if got != expected || got.ConnectionID == "" || !strings.HasPrefix(got.RemoteAddr, "127.0.0.1:") {
+			t.Errorf("expected %+v but instead got %+v", expected, got)
+		}
+	}
+	if !strings.HasPrefix(records[3].Reason, graphqlws.ErrClientGone.Error()) {
+		t.Errorf("expected the client to be gone but instead got %s", records[3].Reason)
+	}
+}
+
+func TestAuditorContract(t *testing.T) {
+	a := audit.New(audit.SinkFunc(func(ctx context.Context, records []audit.Record) error {
+		return nil
+	}))
+	defer a.Close()
+
+	graphqlwstest.TestObserver(t, a)
+}
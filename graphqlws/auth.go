@@ -0,0 +1,66 @@
+package graphqlws
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// AuthError is an error an AuthValidator may return to reject a request with
+// a given HTTP status and body, instead of the status set with
+// WithAuthFailureStatus
+type AuthError struct {
+	// StatusCode is the HTTP status of the response
+	StatusCode int
+	// Body is the body of the response, the text of StatusCode if empty
+	Body string
+	// Err is the reason the request was rejected for, if any
+	Err error
+}
+
+func (e *AuthError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("graphqlws: auth failed with %d", e.StatusCode)
+	}
+	return fmt.Sprintf("graphqlws: auth failed with %d: %v", e.StatusCode, e.Err)
+}
+
+func (e *AuthError) Unwrap() error {
+	return e.Err
+}
+
+// WithAuthFailureStatus sets the HTTP status of the responses to the requests
+// rejected by the AuthValidator, 401 (unauthorized) by default, e.g. 403
+// (forbidden). Errors of type *AuthError set their own status.
+func WithAuthFailureStatus(code int) Option {
+	return func(h *handler) {
+		h.authStatus = code
+	}
+}
+
+// checkAuth checks r with the AuthValidator of the server, requests are
+// accepted as is without one, e.g. for public endpoints
+func (s *Server) checkAuth(r *http.Request) (context.Context, error) {
+	ctx := withRequest(s.rootCtx, r)
+	if s.authValidator == nil {
+		return ctx, nil
+	}
+	return s.authValidator.CheckAuth(r, ctx)
+}
+
+// rejectAuth responds to a request rejected by the AuthValidator with err
+func (s *Server) rejectAuth(w http.ResponseWriter, err error) {
+	code, body := s.h.authStatus, ""
+	var ae *AuthError
+	if errors.As(err, &ae) && ae.StatusCode != 0 {
+		code, body = ae.StatusCode, ae.Body
+	}
+	if code == 0 {
+		code = http.StatusUnauthorized
+	}
+	if body == "" {
+		body = http.StatusText(code)
+	}
+	http.Error(w, body, code)
+}
@@ -0,0 +1,128 @@
+package graphqlws
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ErrMissingToken is the error the built-in auth strategies reject the
+// requests without a token with
+var ErrMissingToken = errors.New("graphqlws: missing token")
+
+// TokenVerifier verifies a token found by an auth strategy, it returns the
+// context the connection runs with, e.g. carrying the claims of the token for
+// the resolvers, or an error to reject it
+type TokenVerifier func(ctx context.Context, token string) (context.Context, error)
+
+// AuthValidatorFunc is an AuthValidator calling a function
+type AuthValidatorFunc func(r *http.Request, ctx context.Context) (context.Context, error)
+
+// CheckAuth calls fn
+func (fn AuthValidatorFunc) CheckAuth(r *http.Request, ctx context.Context) (context.Context, error) {
+	return fn(r, ctx)
+}
+
+// WithAuthValidator sets the AuthValidator checking the requests to upgrade
+// to a websocket, replacing the one passed to NewServer or NewHandlerFunc,
+// which may then be nil
+func WithAuthValidator(v AuthValidator) Option {
+	return func(h *handler) {
+		h.authValidator = v
+	}
+}
+
+type tokenKey struct{}
+
+// TokenFromContext returns the token a built-in auth strategy authenticated
+// the connection ctx belongs to with
+func TokenFromContext(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(tokenKey{}).(string)
+	return token, ok
+}
+
+// verifyToken verifies token with verify, once put in ctx
+func verifyToken(ctx context.Context, token string, verify TokenVerifier) (context.Context, error) {
+	if token == "" {
+		return nil, &AuthError{StatusCode: http.StatusUnauthorized, Err: ErrMissingToken}
+	}
+	return verify(context.WithValue(ctx, tokenKey{}, token), token)
+}
+
+// BearerToken authenticates requests with the bearer token of their
+// Authorization header, as verified by verify
+func BearerToken(verify TokenVerifier) AuthValidator {
+	return AuthValidatorFunc(func(r *http.Request, ctx context.Context) (context.Context, error) {
+		var token string
+		if scheme, credentials, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+			token = strings.TrimSpace(credentials)
+		}
+		return verifyToken(ctx, token, verify)
+	})
+}
+
+// CookieToken authenticates requests with the token held by their cookie
+// name, as verified by verify
+func CookieToken(name string, verify TokenVerifier) AuthValidator {
+	return AuthValidatorFunc(func(r *http.Request, ctx context.Context) (context.Context, error) {
+		var token string
+		if cookie, err := r.Cookie(name); err == nil {
+			token = cookie.Value
+		}
+		return verifyToken(ctx, token, verify)
+	})
+}
+
+// QueryToken authenticates requests with the token of their query parameter
+// param, as verified by verify, e.g. for browsers which can't set headers on
+// websockets. Query parameters tend to be logged, the tokens should be short
+// lived.
+func QueryToken(param string, verify TokenVerifier) AuthValidator {
+	return AuthValidatorFunc(func(r *http.Request, ctx context.Context) (context.Context, error) {
+		return verifyToken(ctx, r.URL.Query().Get(param), verify)
+	})
+}
+
+// AnyAuth authenticates requests with the first of validators accepting them,
+// e.g. with a bearer token or else a cookie. Requests accepted by none of
+// them are rejected with the first error other than ErrMissingToken, if any.
+func AnyAuth(validators ...AuthValidator) AuthValidator {
+	return AuthValidatorFunc(func(r *http.Request, ctx context.Context) (context.Context, error) {
+		err := error(&AuthError{StatusCode: http.StatusUnauthorized, Err: ErrMissingToken})
+		missing := true
+		for _, v := range validators {
+			authCtx, verr := v.CheckAuth(r, ctx)
+			if verr == nil {
+				return authCtx, nil
+			}
+			if missing && !errors.Is(verr, ErrMissingToken) {
+				err, missing = verr, false
+			}
+		}
+		return nil, err
+	})
+}
+
+// InitPayloadToken authenticates connections with the token of the field of
+// their connection_init payload, as verified by verify, it's meant to be
+// passed to WithConnectionInitHandler
+func InitPayloadToken(field string, verify TokenVerifier) InitHandler {
+	return func(ctx context.Context, payload json.RawMessage) (context.Context, error) {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(payload, &fields); err != nil {
+			return nil, err
+		}
+		var token string
+		if raw, ok := fields[field]; ok {
+			if err := json.Unmarshal(raw, &token); err != nil {
+				return nil, err
+			}
+		}
+		if token == "" {
+			return nil, ErrMissingToken
+		}
+		return verify(context.WithValue(ctx, tokenKey{}, token), token)
+	}
+}
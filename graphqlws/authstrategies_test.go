@@ -0,0 +1,75 @@
+package graphqlws_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+var errInvalidToken = errors.New("invalid token")
+
+type userKey struct{}
+
+// verifyToken accepts the token "secret" as alice
+func verifyToken(ctx context.Context, token string) (context.Context, error) {
+	if token != "secret" {
+		return nil, errInvalidToken
+	}
+	return context.WithValue(ctx, userKey{}, "alice"), nil
+}
+
+func TestAuthStrategies(t *testing.T) {
+	validator := graphqlws.AnyAuth(
+		graphqlws.BearerToken(verifyToken),
+		graphqlws.CookieToken("token", verifyToken),
+		graphqlws.QueryToken("token", verifyToken),
+	)
+	for name, tc := range map[string]struct {
+		request func(r *http.Request)
+		err     error
+	}{
+		"bearer token":  {request: func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") }},
+		"cookie":        {request: func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "token", Value: "secret"}) }},
+		"query":         {request: func(r *http.Request) { r.URL.RawQuery = "token=secret" }},
+		"invalid token": {request: func(r *http.Request) { r.Header.Set("Authorization", "Bearer guess") }, err: errInvalidToken},
+		"no token":      {request: func(r *http.Request) {}, err: graphqlws.ErrMissingToken},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/graphql", nil)
+			tc.request(r)
+			ctx, err := validator.CheckAuth(r, context.Background())
+			if tc.err != nil {
+				if !errors.Is(err, tc.err) {
+					t.Fatalf("expected %v but instead got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token, _ := graphqlws.TokenFromContext(ctx); token != "secret" || ctx.Value(userKey{}) != "alice" {
+				t.Fatalf("expected the token and user in the context but instead got %q and %v", token, ctx.Value(userKey{}))
+			}
+		})
+	}
+}
+
+func TestInitPayloadToken(t *testing.T) {
+	handle := graphqlws.InitPayloadToken("authToken", verifyToken)
+	ctx, err := handle(context.Background(), json.RawMessage(`{"authToken":"secret"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, _ := graphqlws.TokenFromContext(ctx); token != "secret" || ctx.Value(userKey{}) != "alice" {
+		t.Fatalf("expected the token and user in the context but instead got %q and %v", token, ctx.Value(userKey{}))
+	}
+
+	if _, err := handle(context.Background(), json.RawMessage(`{}`)); !errors.Is(err, graphqlws.ErrMissingToken) {
+		t.Fatalf("expected %v but instead got %v", graphqlws.ErrMissingToken, err)
+	}
+}
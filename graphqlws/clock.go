@@ -0,0 +1,28 @@
+package graphqlws
+
+import (
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// Clock tells the time and makes the timers and tickers of connections, see
+// the graphqlwstest package for a fake one
+type Clock = connection.Clock
+
+// Timer is a time.Timer made by a Clock
+type Timer = connection.Timer
+
+// Ticker is a time.Ticker made by a Clock
+type Ticker = connection.Ticker
+
+// RealClock is the Clock backed by the time package, used by default
+var RealClock = connection.RealClock
+
+// WithClock sets the Clock of every connection, so that keepalives, timeouts
+// and write deadlines can be tested without sleeping. Fake clocks are meant to
+// be used with fake transports served with Server.Serve, since the write
+// deadlines set on the transport are computed with them.
+func WithClock(c Clock) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.UseClock(c))
+	}
+}
@@ -0,0 +1,135 @@
+package graphqlws
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// WithCloseGracePeriod makes the handler send a close frame when closing a
+// connection and wait up to d for the client to acknowledge it before closing
+// the underlying TCP connection, for clients reporting abrupt resets as
+// errors. It doesn't apply to connections served by an event loop.
+func WithCloseGracePeriod(d time.Duration) Option {
+	return func(h *handler) {
+		h.closeGrace = d
+	}
+}
+
+// CloseCode is a websocket close code
+type CloseCode = connection.CloseCode
+
+// The close codes defined by ProtocolGraphQLTransportWS, the server closes
+// connections with them on protocol violations
+const (
+	CloseBadRequest       = connection.CloseBadRequest
+	CloseUnauthorized     = connection.CloseUnauthorized
+	CloseForbidden        = connection.CloseForbidden
+	CloseInitTimeout      = connection.CloseInitTimeout
+	CloseSubscriberExists = connection.CloseSubscriberExists
+	CloseTooManyInits     = connection.CloseTooManyInits
+	CloseTooManyRequests  = connection.CloseTooManyRequests
+)
+
+// CloseError is the close reason of the connections closed with a close code
+// and reason, either by Close or on protocol violations. It's wrapped by
+// ErrClientGone in the latter case.
+type CloseError = connection.CloseError
+
+// Close closes the connection ctx belongs to, e.g. the context passed to an
+// Observer or to the service, with code and reason, instead of dropping the
+// socket. The close frame is only sent where the transport supports it and
+// the reason is truncated to the 123 bytes it holds. It returns false if ctx
+// doesn't belong to a connection.
+func Close(ctx context.Context, code CloseCode, reason string) bool {
+	return connection.Close(ctx, code, reason)
+}
+
+var errClosing = errors.New("graphqlws: connection closing")
+
+// gracefulConn is a websocket connection performing the close handshake when
+// closed, see WithCloseGracePeriod
+type gracefulConn struct {
+	*websocket.Conn
+	grace time.Duration
+
+	mu      sync.Mutex
+	reading bool
+	closing bool
+	// readFailed is closed once a read failed, e.g. because the client
+	// acknowledged the close frame
+	readFailed chan struct{}
+	failOnce   sync.Once
+}
+
+func newGracefulConn(ws *websocket.Conn, grace time.Duration) *gracefulConn {
+	return &gracefulConn{Conn: ws, grace: grace, readFailed: make(chan struct{})}
+}
+
+func (c *gracefulConn) ReadMessage() (int, []byte, error) {
+	c.mu.Lock()
+	if c.closing {
+		c.mu.Unlock()
+		return 0, nil, errClosing
+	}
+	c.reading = true
+	c.mu.Unlock()
+
+	messageType, p, err := c.Conn.ReadMessage()
+
+	c.mu.Lock()
+	c.reading = false
+	c.mu.Unlock()
+	if err != nil {
+		c.failOnce.Do(func() { close(c.readFailed) })
+	}
+	return messageType, p, err
+}
+
+// Close sends a close frame and waits for the client to acknowledge it, or
+// for the grace period to expire, before closing the connection. The
+// acknowledgment is read by the pending ReadMessage call if any, otherwise
+// by Close itself.
+func (c *gracefulConn) Close() error {
+	deadline := time.Now().Add(c.grace)
+	c.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), deadline)
+
+	c.mu.Lock()
+	c.closing = true
+	reading := c.reading
+	c.mu.Unlock()
+
+	select {
+	case <-c.readFailed:
+		// the client is gone or has already closed its side
+	default:
+		c.awaitClose(reading, deadline)
+	}
+	return c.Conn.Close()
+}
+
+// awaitClose waits until deadline for the client to acknowledge the close
+// frame, as read by the pending ReadMessage call if reading
+func (c *gracefulConn) awaitClose(reading bool, deadline time.Time) {
+	if reading {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		select {
+		case <-c.readFailed:
+		case <-timer.C:
+		}
+		return
+	}
+
+	c.Conn.SetReadDeadline(deadline)
+	for {
+		if _, _, err := c.Conn.NextReader(); err != nil {
+			return
+		}
+	}
+}
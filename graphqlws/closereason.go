@@ -0,0 +1,41 @@
+package graphqlws
+
+import (
+	"context"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// The reasons a connection is closed for, as returned by CloseReason, besides
+// the error of its context when it's closed by the server
+var (
+	ErrClientGone       = connection.ErrClientGone
+	ErrClientTerminated = connection.ErrClientTerminated
+	ErrMalformedFrame   = connection.ErrMalformedFrame
+	ErrWriteFailed      = connection.ErrWriteFailed
+	ErrNoOperation      = connection.ErrNoOperation
+	ErrInitRejected     = connection.ErrInitRejected
+	ErrServerShutdown   = connection.ErrServerShutdown
+	ErrInitTimeout      = connection.ErrInitTimeout
+	ErrQueueOverflow    = connection.ErrQueueOverflow
+	ErrPongTimeout      = connection.ErrPongTimeout
+	ErrRefreshRejected  = connection.ErrRefreshRejected
+	ErrAuthExpired      = connection.ErrAuthExpired
+	ErrRateLimited      = connection.ErrRateLimited
+)
+
+// CloseReason returns the reason the connection ctx belongs to was closed for,
+// it's meant to be called by Observer.ConnectionEnd
+func CloseReason(ctx context.Context) error {
+	return connection.CloseReason(ctx)
+}
+
+// Done returns a channel closed as soon as the connection ctx belongs to
+// starts closing, e.g. because the client is gone, for payload producers to
+// stop right away rather than when they next check their context. The
+// contexts of the operations of the connection are all done right after, even
+// when they aren't derived from the one of the connection. It returns nil if
+// ctx doesn't belong to a connection.
+func Done(ctx context.Context) <-chan struct{} {
+	return connection.Done(ctx)
+}
@@ -0,0 +1,287 @@
+// Package cluster makes the connection management API of graphqlws servers,
+// see graphqlws.ConnectionManager, work across the nodes of a cluster: a
+// Directory shared by the nodes records which node holds each connection and
+// the connections of each subject, and the commands closing or pushing to
+// connections are carried to the nodes holding them over the control topics
+// of an event bridge, see the pubsub package. See cluster/redis for a
+// Directory kept in Redis.
+//
+// Clients reconnecting should be routed to the node they were connected to,
+// e.g. to resume their session, the Steering method returns steering hints
+// naming it for them to present to the load balancer.
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/pubsub"
+)
+
+// ErrUnknownConnection is returned by the commands targeting a connection no
+// node holds
+var ErrUnknownConnection = errors.New("cluster: unknown connection")
+
+// Directory records which node holds which connection, it's shared by all the
+// nodes of a cluster
+type Directory interface {
+	// Add records that node holds the connection id, belonging to subject
+	// if not empty
+	Add(ctx context.Context, node string, id graphqlws.ConnectionID, subject string) error
+	// Remove forgets the connection id of node
+	Remove(ctx context.Context, node string, id graphqlws.ConnectionID, subject string) error
+	// Node returns the node holding the connection id, empty if none
+	Node(ctx context.Context, id graphqlws.ConnectionID) (string, error)
+	// SubjectNodes returns the nodes holding connections belonging to
+	// subject
+	SubjectNodes(ctx context.Context, subject string) ([]string, error)
+}
+
+// Cluster registers the connections of the server of a node in a Directory, as
+// a graphqlws.Observer, and runs the commands sent to the node, see Run
+type Cluster struct {
+	node    string
+	dir     Directory
+	ps      pubsub.PubSub
+	prefix  string
+	subject func(ctx context.Context) string
+	onError func(err error)
+}
+
+// Option configures a Cluster
+type Option func(c *Cluster)
+
+// Subject sets the function returning who a connection belongs to from its
+// context, i.e. the one returned by the AuthValidator, as set with
+// graphqlws.WithConnectionSubject
+func Subject(fn func(ctx context.Context) string) Option {
+	return func(c *Cluster) {
+		c.subject = fn
+	}
+}
+
+// TopicPrefix sets the prefix of the control topics, graphqlws.control. by
+// default
+func TopicPrefix(prefix string) Option {
+	return func(c *Cluster) {
+		c.prefix = prefix
+	}
+}
+
+// OnError sets the function the errors of the Directory and of the commands
+// received are passed to, e.g. to log them
+func OnError(fn func(err error)) Option {
+	return func(c *Cluster) {
+		c.onError = fn
+	}
+}
+
+// New returns the Cluster of node, the unique name of this instance, e.g. its
+// host name, recording its connections in dir and exchanging commands with
+// the other nodes over ps. It has to be added to the server with
+// graphqlws.WithObserver, and run with Run.
+func New(node string, dir Directory, ps pubsub.PubSub, options ...Option) *Cluster {
+	c := &Cluster{
+		node:    node,
+		dir:     dir,
+		ps:      ps,
+		prefix:  "graphqlws.control.",
+		subject: func(context.Context) string { return "" },
+		onError: func(error) {},
+	}
+	for _, opt := range options {
+		opt(c)
+	}
+	return c
+}
+
+// Node returns the name of the node
+func (c *Cluster) Node() string {
+	return c.node
+}
+
+// Steering returns steering hints naming the node as the instance clients
+// should reconnect to, to be set with graphqlws.WithSteeringHints
+func (c *Cluster) Steering(ctx context.Context) *graphqlws.SteeringHints {
+	return &graphqlws.SteeringHints{Instance: c.node}
+}
+
+// The commands run by the nodes
+const (
+	opClose        = "close"
+	opCloseSubject = "closeSubject"
+	opPush         = "push"
+	opPushSubject  = "pushSubject"
+	opPushTopic    = "pushTopic"
+)
+
+// command is sent over the control topics
+type command struct {
+	Op           string          `json:"op"`
+	ConnectionID string          `json:"connectionId,omitempty"`
+	Subject      string          `json:"subject,omitempty"`
+	Topic        string          `json:"topic,omitempty"`
+	ID           string          `json:"id,omitempty"`
+	Code         int             `json:"code,omitempty"`
+	Reason       string          `json:"reason,omitempty"`
+	Payload      json.RawMessage `json:"payload,omitempty"`
+}
+
+// Close closes the connection id, on whichever node holds it, with code and
+// reason, see graphqlws.ConnectionManager.Close
+func (c *Cluster) Close(ctx context.Context, id graphqlws.ConnectionID, code graphqlws.CloseCode, reason string) error {
+	return c.sendToConnection(ctx, id, command{Op: opClose, ConnectionID: string(id), Code: int(code), Reason: reason})
+}
+
+// CloseSubject closes all the connections belonging to subject, on all the
+// nodes, with code and reason, e.g. once its access tokens are revoked
+func (c *Cluster) CloseSubject(ctx context.Context, subject string, code graphqlws.CloseCode, reason string) error {
+	return c.sendToSubject(ctx, subject, command{Op: opCloseSubject, Subject: subject, Code: int(code), Reason: reason})
+}
+
+// Push pushes a data message with id and payload to the connection connID, on
+// whichever node holds it, see graphqlws.ConnectionManager.Push
+func (c *Cluster) Push(ctx context.Context, connID graphqlws.ConnectionID, id string, payload json.RawMessage) error {
+	return c.sendToConnection(ctx, connID, command{Op: opPush, ConnectionID: string(connID), ID: id, Payload: payload})
+}
+
+// PushSubject pushes a data message with id and payload to all the
+// connections belonging to subject, on all the nodes
+func (c *Cluster) PushSubject(ctx context.Context, subject string, id string, payload json.RawMessage) error {
+	return c.sendToSubject(ctx, subject, command{Op: opPushSubject, Subject: subject, ID: id, Payload: payload})
+}
+
+// PushTopic pushes a data message with payload to the operations of all the
+// nodes which joined topic, see graphqlws.JoinTopic. Topics aren't recorded
+// in the Directory, so the command is sent to every node.
+func (c *Cluster) PushTopic(ctx context.Context, topic string, payload json.RawMessage) error {
+	return c.send(ctx, c.prefix+"broadcast", command{Op: opPushTopic, Topic: topic, Payload: payload})
+}
+
+func (c *Cluster) sendToConnection(ctx context.Context, id graphqlws.ConnectionID, cmd command) error {
+	node, err := c.dir.Node(ctx, id)
+	if err != nil {
+		return err
+	}
+	if node == "" {
+		return ErrUnknownConnection
+	}
+	return c.send(ctx, c.nodeTopic(node), cmd)
+}
+
+func (c *Cluster) sendToSubject(ctx context.Context, subject string, cmd command) error {
+	nodes, err := c.dir.SubjectNodes(ctx, subject)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, node := range nodes {
+		errs = append(errs, c.send(ctx, c.nodeTopic(node), cmd))
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Cluster) send(ctx context.Context, topic string, cmd command) error {
+	payload, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	return c.ps.Publish(ctx, topic, payload)
+}
+
+func (c *Cluster) nodeTopic(node string) string {
+	return c.prefix + "node." + node
+}
+
+// Run runs the commands sent to the node on the connections of s, until ctx is
+// done. The commands sent while it's not running are lost.
+func (c *Cluster) Run(ctx context.Context, s *graphqlws.Server) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, topic := range []string{c.nodeTopic(c.node), c.prefix + "broadcast"} {
+		messages, err := c.ps.Subscribe(ctx, topic)
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for msg := range messages {
+				c.run(s.Connections(), msg.Payload)
+				if msg.Ack != nil {
+					msg.Ack()
+				}
+			}
+		}()
+	}
+	<-ctx.Done()
+	return nil
+}
+
+// run runs the command encoded in payload on m
+func (c *Cluster) run(m *graphqlws.ConnectionManager, payload []byte) {
+	var cmd command
+	if err := json.Unmarshal(payload, &cmd); err != nil {
+		c.onError(err)
+		return
+	}
+	switch cmd.Op {
+	case opClose:
+		m.Close(graphqlws.ConnectionID(cmd.ConnectionID), graphqlws.CloseCode(cmd.Code), cmd.Reason)
+	case opCloseSubject:
+		m.CloseSubject(cmd.Subject, graphqlws.CloseCode(cmd.Code), cmd.Reason)
+	case opPush:
+		m.Push(graphqlws.ConnectionID(cmd.ConnectionID), cmd.ID, cmd.Payload)
+	case opPushSubject:
+		m.PushSubject(cmd.Subject, cmd.ID, cmd.Payload)
+	case opPushTopic:
+		m.PushTopic(cmd.Topic, cmd.Payload)
+	default:
+		c.onError(errors.New("cluster: unknown command " + cmd.Op))
+	}
+}
+
+type connectionKey struct{}
+
+// registration is carried by the connection context, so that the connection
+// is removed from the Directory as it was added
+type registration struct {
+	id      graphqlws.ConnectionID
+	subject string
+}
+
+// ConnectionStart adds the connection to the Directory
+func (c *Cluster) ConnectionStart(ctx context.Context, info graphqlws.ConnectionInfo) context.Context {
+	id, ok := graphqlws.ConnectionIDFromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	reg := &registration{id: id, subject: c.subject(ctx)}
+	if err := c.dir.Add(ctx, c.node, reg.id, reg.subject); err != nil {
+		c.onError(err)
+	}
+	return context.WithValue(ctx, connectionKey{}, reg)
+}
+
+// ConnectionEnd removes the connection from the Directory
+func (c *Cluster) ConnectionEnd(ctx context.Context) {
+	reg, ok := ctx.Value(connectionKey{}).(*registration)
+	if !ok {
+		return
+	}
+	if err := c.dir.Remove(context.WithoutCancel(ctx), c.node, reg.id, reg.subject); err != nil {
+		c.onError(err)
+	}
+}
+
+func (c *Cluster) OperationStart(ctx context.Context, info graphqlws.OperationInfo) context.Context {
+	return ctx
+}
+
+func (c *Cluster) OperationEnd(ctx context.Context, err error) {}
@@ -0,0 +1,145 @@
+package cluster_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/cluster"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/pubsub"
+)
+
+type gqlService struct{}
+
+func (gqlService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	c := make(chan interface{})
+	close(c)
+	return c, nil
+}
+
+func (gqlService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+// memoryPubSub is a pubsub.PubSub over a pubsub.Memory, subscribed sends the
+// topics subscribed to
+type memoryPubSub struct {
+	m          *pubsub.Memory[pubsub.Message]
+	subscribed chan string
+}
+
+func (p memoryPubSub) Publish(ctx context.Context, topic string, payload []byte) error {
+	return p.m.Publish(ctx, topic, pubsub.Message{Topic: topic, Payload: payload})
+}
+
+func (p memoryPubSub) Subscribe(ctx context.Context, topic string) (<-chan pubsub.Message, error) {
+	c := p.m.Subscribe(ctx, topic)
+	p.subscribed <- topic
+	return c, nil
+}
+
+type userKey struct{}
+
+func user(ctx context.Context) string {
+	u, _ := ctx.Value(userKey{}).(string)
+	return u
+}
+
+// node is a server of the cluster
+type node struct {
+	cluster *cluster.Cluster
+	server  *graphqlws.Server
+	url     string
+}
+
+func TestCluster(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := cluster.NewMemoryDirectory()
+	ps := memoryPubSub{m: pubsub.NewMemory[pubsub.Message](), subscribed: make(chan string, 4)}
+	validator := graphqlws.AuthValidatorFunc(func(r *http.Request, ctx context.Context) (context.Context, error) {
+		return context.WithValue(ctx, userKey{}, r.Header.Get("X-User")), nil
+	})
+
+	nodes := map[string]*node{}
+	for _, name := range []string{"node-1", "node-2"} {
+		c := cluster.New(name, dir, ps, cluster.Subject(user))
+		s := graphqlws.NewServer(ctx, gqlService{}, http.NotFoundHandler(), validator,
+			graphqlws.WithObserver(c),
+			graphqlws.WithConnectionSubject(user),
+			graphqlws.WithSteeringHints(c.Steering),
+		)
+		srv := httptest.NewServer(s)
+		defer srv.Close()
+		go c.Run(ctx, s)
+		nodes[name] = &node{cluster: c, server: s, url: "ws" + strings.TrimPrefix(srv.URL, "http")}
+	}
+	for i := 0; i < 4; i++ {
+		<-ps.subscribed
+	}
+
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+	dial := func(n *node, user string) *websocket.Conn {
+		ws, _, err := dialer.Dial(n.url, http.Header{"X-User": {user}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"connection_init","payload":{}}`))
+		_, ack, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(ack), `"instance":"`+n.cluster.Node()+`"`) {
+			t.Fatalf("expected the node to be named in [%s]", ack)
+		}
+		return ws
+	}
+	alice := dial(nodes["node-1"], "alice")
+	defer alice.Close()
+	bob := dial(nodes["node-2"], "bob")
+	defer bob.Close()
+
+	bobID := nodes["node-2"].server.Connections().List()[0].ID
+	if node, _ := dir.Node(ctx, bobID); node != "node-2" {
+		t.Fatalf("expected bob to be connected to node-2 but instead got %q", node)
+	}
+
+	if err := nodes["node-1"].cluster.Push(ctx, bobID, "notices", []byte(`{"data":{}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, got, err := bob.ReadMessage(); err != nil || string(got) != `{"id":"notices","payload":{"data":{}},"type":"data"}` {
+		t.Fatalf("expected the notice to be pushed but instead got [%s], %v", got, err)
+	}
+
+	if err := nodes["node-2"].cluster.CloseSubject(ctx, "alice", graphqlws.CloseForbidden, "token revoked"); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := alice.ReadMessage()
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) || ce.Code != int(graphqlws.CloseForbidden) {
+		t.Fatalf("expected alice to be closed with %d but instead got %v", graphqlws.CloseForbidden, err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for nodes["node-1"].server.ConnectionCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected alice's connection to be closed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if nodes, _ := dir.SubjectNodes(ctx, "alice"); len(nodes) != 0 {
+		t.Fatalf("expected alice's connection to be removed but instead got %v", nodes)
+	}
+	if err := nodes["node-1"].cluster.Close(ctx, "unknown", graphqlws.CloseForbidden, ""); !errors.Is(err, cluster.ErrUnknownConnection) {
+		t.Fatalf("expected %v but instead got %v", cluster.ErrUnknownConnection, err)
+	}
+}
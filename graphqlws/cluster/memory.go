@@ -0,0 +1,77 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+// memoryDirectory is a Directory kept in memory
+type memoryDirectory struct {
+	mu       sync.Mutex
+	nodes    map[graphqlws.ConnectionID]string
+	subjects map[string]map[graphqlws.ConnectionID]string
+}
+
+// NewMemoryDirectory returns a Directory kept in memory, shared by the nodes
+// of a single process, e.g. for tests
+func NewMemoryDirectory() Directory {
+	return &memoryDirectory{
+		nodes:    map[graphqlws.ConnectionID]string{},
+		subjects: map[string]map[graphqlws.ConnectionID]string{},
+	}
+}
+
+func (d *memoryDirectory) Add(ctx context.Context, node string, id graphqlws.ConnectionID, subject string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.nodes[id] = node
+	if subject != "" {
+		if d.subjects[subject] == nil {
+			d.subjects[subject] = map[graphqlws.ConnectionID]string{}
+		}
+		d.subjects[subject][id] = node
+	}
+	return nil
+}
+
+func (d *memoryDirectory) Remove(ctx context.Context, node string, id graphqlws.ConnectionID, subject string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.nodes[id] == node {
+		delete(d.nodes, id)
+	}
+	if conns := d.subjects[subject]; conns[id] == node {
+		delete(conns, id)
+		if len(conns) == 0 {
+			delete(d.subjects, subject)
+		}
+	}
+	return nil
+}
+
+func (d *memoryDirectory) Node(ctx context.Context, id graphqlws.ConnectionID) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.nodes[id], nil
+}
+
+func (d *memoryDirectory) SubjectNodes(ctx context.Context, subject string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return distinctNodes(d.subjects[subject]), nil
+}
+
+// distinctNodes returns the nodes holding conns, each once
+func distinctNodes(conns map[graphqlws.ConnectionID]string) []string {
+	seen := map[string]bool{}
+	var nodes []string
+	for _, node := range conns {
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
@@ -0,0 +1,99 @@
+//go:build redis
+// +build redis
+
+// Package redis is a cluster.Directory kept in Redis, see the cluster package.
+// It's only built with the redis build tag, so that depending on graphqlws
+// doesn't pull in the Redis client.
+package redis
+
+import (
+	"context"
+	"errors"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/cluster"
+)
+
+type directory struct {
+	client goredis.UniversalClient
+	prefix string
+}
+
+// Option configures a directory
+type Option func(d *directory)
+
+// Prefix sets the prefix of the keys of the directory, graphqlws:cluster: by
+// default
+func Prefix(prefix string) Option {
+	return func(d *directory) {
+		d.prefix = prefix
+	}
+}
+
+// New returns a Directory keeping the node of each connection under the key
+// made of the prefix, conn: and its id, and the connections of each subject
+// in a hash under the key made of the prefix, subject: and the subject, from
+// their ids to their nodes
+func New(client goredis.UniversalClient, options ...Option) cluster.Directory {
+	d := &directory{client: client, prefix: "graphqlws:cluster:"}
+	for _, opt := range options {
+		opt(d)
+	}
+	return d
+}
+
+func (d *directory) Add(ctx context.Context, node string, id graphqlws.ConnectionID, subject string) error {
+	_, err := d.client.Pipelined(ctx, func(p goredis.Pipeliner) error {
+		p.Set(ctx, d.connKey(id), node, 0)
+		if subject != "" {
+			p.HSet(ctx, d.subjectKey(subject), string(id), node)
+		}
+		return nil
+	})
+	return err
+}
+
+func (d *directory) Remove(ctx context.Context, node string, id graphqlws.ConnectionID, subject string) error {
+	_, err := d.client.Pipelined(ctx, func(p goredis.Pipeliner) error {
+		p.Del(ctx, d.connKey(id))
+		if subject != "" {
+			p.HDel(ctx, d.subjectKey(subject), string(id))
+		}
+		return nil
+	})
+	return err
+}
+
+func (d *directory) Node(ctx context.Context, id graphqlws.ConnectionID) (string, error) {
+	node, err := d.client.Get(ctx, d.connKey(id)).Result()
+	if errors.Is(err, goredis.Nil) {
+		return "", nil
+	}
+	return node, err
+}
+
+func (d *directory) SubjectNodes(ctx context.Context, subject string) ([]string, error) {
+	nodes, err := d.client.HVals(ctx, d.subjectKey(subject)).Result()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	distinct := nodes[:0]
+	for _, node := range nodes {
+		if !seen[node] {
+			seen[node] = true
+			distinct = append(distinct, node)
+		}
+	}
+	return distinct, nil
+}
+
+func (d *directory) connKey(id graphqlws.ConnectionID) string {
+	return d.prefix + "conn:" + string(id)
+}
+
+func (d *directory) subjectKey(subject string) string {
+	return d.prefix + "subject:" + subject
+}
@@ -0,0 +1,65 @@
+//go:build redis
+// +build redis
+
+package redis_test
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/cluster"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/cluster/redis"
+)
+
+func TestDirectory(t *testing.T) {
+	s := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	defer client.Close()
+	dir := redis.New(client)
+
+	ctx := context.Background()
+	for _, c := range []struct{ node, id, subject string }{
+		{"node-1", "a", "alice"},
+		{"node-1", "b", "alice"},
+		{"node-2", "c", "alice"},
+		{"node-2", "d", ""},
+	} {
+		if err := dir.Add(ctx, c.node, graphqlws.ConnectionID(c.id), c.subject); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if node, err := dir.Node(ctx, "c"); err != nil || node != "node-2" {
+		t.Fatalf("expected node-2 but instead got %q, %v", node, err)
+	}
+	if node, err := dir.Node(ctx, "unknown"); err != nil || node != "" {
+		t.Fatalf("expected no node but instead got %q, %v", node, err)
+	}
+	requireNodes(t, dir, "alice", "node-1", "node-2")
+
+	if err := dir.Remove(ctx, "node-2", "c", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if node, _ := dir.Node(ctx, "c"); node != "" {
+		t.Fatalf("expected the connection to be removed but instead got %q", node)
+	}
+	requireNodes(t, dir, "alice", "node-1")
+}
+
+func requireNodes(t *testing.T, dir cluster.Directory, subject string, expected ...string) {
+	t.Helper()
+	nodes, err := dir.SubjectNodes(context.Background(), subject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(nodes)
+	if !reflect.DeepEqual(nodes, expected) {
+		t.Fatalf("expected %v but instead got %v", expected, nodes)
+	}
+}
@@ -0,0 +1,20 @@
+package graphqlws
+
+import (
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// Compressor is a payload compression codec, see the compression package for
+// the available ones.
+type Compressor = connection.Compressor
+
+// WithCompression enables compression of data payloads of at least minSize
+// bytes with the given codecs. Clients opt in by listing the codecs they
+// support in the connection_init payload, e.g. {"compression":["zstd"]}, and
+// the selected one is confirmed in the connection_ack payload. Compressed
+// payloads are sent as base64 encoded JSON strings.
+func WithCompression(minSize int, codecs ...Compressor) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.Compression(minSize, codecs...))
+	}
+}
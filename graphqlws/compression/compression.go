@@ -0,0 +1,62 @@
+// Package compression provides the payload compression codecs that can be
+// enabled with graphqlws.WithCompression.
+package compression
+
+import (
+	"bytes"
+	"compress/flate"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+type deflate struct {
+	level int
+}
+
+// Deflate returns a codec compressing payloads with DEFLATE (RFC 1951) at the
+// given compress/flate level.
+func Deflate(level int) graphqlws.Compressor {
+	return &deflate{level: level}
+}
+
+func (d *deflate) Name() string {
+	return "deflate"
+}
+
+func (d *deflate) Compress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, d.level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+type zstandard struct {
+	encoder *zstd.Encoder
+}
+
+// Zstd returns a codec compressing payloads with Zstandard (RFC 8878).
+func Zstd(opts ...zstd.EOption) (graphqlws.Compressor, error) {
+	encoder, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &zstandard{encoder: encoder}, nil
+}
+
+func (z *zstandard) Name() string {
+	return "zstd"
+}
+
+func (z *zstandard) Compress(data []byte) ([]byte, error) {
+	return z.encoder.EncodeAll(data, nil), nil
+}
@@ -0,0 +1,53 @@
+package compression_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/compression"
+)
+
+const payload = `{"data":{"messages":["hello","hello","hello","hello"]},"errors":null}`
+
+func TestDeflate(t *testing.T) {
+	data, err := compression.Deflate(flate.BestSpeed).Compress([]byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ioutil.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != payload {
+		t.Fatalf("expected [%s] but instead got [%s]", payload, got)
+	}
+}
+
+func TestZstd(t *testing.T) {
+	codec, err := compression.Zstd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := codec.Compress([]byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decoder.DecodeAll(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != payload {
+		t.Fatalf("expected [%s] but instead got [%s]", payload, got)
+	}
+}
@@ -0,0 +1,150 @@
+package graphqlws
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ConnectionKeyFunc returns the key the connection requested by r is counted
+// under, e.g. the address of the client, an API key or a tenant, see
+// WithMaxConnectionsPerKey. Requests with an empty key aren't limited.
+type ConnectionKeyFunc func(r *http.Request) string
+
+// RemoteIP is the ConnectionKeyFunc returning the IP address the request was
+// sent from
+func RemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ForwardedFor returns a ConnectionKeyFunc returning the address of the client
+// as seen by the first of the trustedProxies proxies the requests go through,
+// e.g. 1 behind a single load balancer, from the X-Forwarded-For header. The
+// addresses before it are set by the client and can't be trusted. Requests
+// whose header holds fewer addresses than there are proxies, e.g. sent around
+// them, are keyed by RemoteIP.
+func ForwardedFor(trustedProxies int) ConnectionKeyFunc {
+	return func(r *http.Request) string {
+		var addrs []string
+		for _, h := range r.Header.Values("X-Forwarded-For") {
+			for _, addr := range strings.Split(h, ",") {
+				if addr = strings.TrimSpace(addr); addr != "" {
+					addrs = append(addrs, addr)
+				}
+			}
+		}
+		if trustedProxies <= 0 || trustedProxies > len(addrs) {
+			return RemoteIP(r)
+		}
+		return addrs[len(addrs)-trustedProxies]
+	}
+}
+
+// WithMaxConnections limits to n the websocket connections the server serves
+// at the same time, requests to open more are refused with 503 Service
+// Unavailable, see WithConnectionLimitStatus
+func WithMaxConnections(n int) Option {
+	return func(h *handler) {
+		h.connLimits.max = n
+	}
+}
+
+// WithMaxConnectionsPerKey limits to n the websocket connections with the same
+// key the server serves at the same time, requests to open more are refused
+// with 429 Too Many Requests, see WithConnectionLimitStatus. With a nil key
+// connections are keyed by RemoteIP, behind proxies ForwardedFor should be
+// used instead.
+func WithMaxConnectionsPerKey(n int, key ConnectionKeyFunc) Option {
+	return func(h *handler) {
+		if key == nil {
+			key = RemoteIP
+		}
+		h.connLimits.maxPerKey = n
+		h.connLimits.key = key
+	}
+}
+
+// WithConnectionLimitStatus sets the HTTP status of the responses to the
+// requests refused by WithMaxConnections and WithMaxConnectionsPerKey, by
+// default 503 (service unavailable) and 429 (too many requests) respectively
+func WithConnectionLimitStatus(code int) Option {
+	return func(h *handler) {
+		h.connLimits.status = code
+	}
+}
+
+// connLimits are the limits of the number of connections of a handler
+type connLimits struct {
+	key       ConnectionKeyFunc
+	max       int
+	maxPerKey int
+	status    int
+}
+
+// connCounter counts the connections of a Server against its connLimits
+type connCounter struct {
+	mu    sync.Mutex
+	total int
+	byKey map[string]int
+}
+
+// limitConnection counts the connection requested by r, it returns the func
+// to call once it's closed, or refuses r and returns false if it's beyond the
+// limits
+func (s *Server) limitConnection(w http.ResponseWriter, r *http.Request) (func(), bool) {
+	l := s.h.connLimits
+	if l.max <= 0 && l.maxPerKey <= 0 {
+		return func() {}, true
+	}
+	var key string
+	if l.maxPerKey > 0 {
+		key = l.key(r)
+	}
+
+	c := &s.connCount
+	c.mu.Lock()
+	status := 0
+	switch {
+	case l.max > 0 && c.total >= l.max:
+		status = http.StatusServiceUnavailable
+	case key != "" && c.byKey[key] >= l.maxPerKey:
+		status = http.StatusTooManyRequests
+	}
+	if status == 0 {
+		c.total++
+		if key != "" {
+			if c.byKey == nil {
+				c.byKey = map[string]int{}
+			}
+			c.byKey[key]++
+		}
+	}
+	c.mu.Unlock()
+
+	if status != 0 {
+		if l.status != 0 {
+			status = l.status
+		}
+		http.Error(w, http.StatusText(status), status)
+		return nil, false
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			c.total--
+			if key != "" {
+				if c.byKey[key]--; c.byKey[key] == 0 {
+					delete(c.byKey, key)
+				}
+			}
+			c.mu.Unlock()
+		})
+	}, true
+}
@@ -0,0 +1,117 @@
+package graphqlws
+
+import (
+	"context"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// WithConnectionSubject sets the function returning who a connection belongs
+// to, e.g. the user id of the claims of its token, from the context returned
+// by the AuthValidator, for ConnectionManager.CloseSubject
+func WithConnectionSubject(fn func(ctx context.Context) string) Option {
+	return func(h *handler) {
+		h.subject = fn
+	}
+}
+
+// LiveConnection describes a live connection of a Server, see ConnectionManager
+type LiveConnection struct {
+	ID ConnectionID
+	// RemoteAddr is the address of the client, empty for the connections
+	// served with Server.Serve
+	RemoteAddr  string
+	ConnectedAt time.Time
+	// Subject is who the connection belongs to, see WithConnectionSubject
+	Subject string
+	// Subscriptions is the number of live operations of the connection
+	Subscriptions int
+}
+
+// ConnectionManager lets operators list the live connections of a Server and
+// close them, e.g. those of a user whose access tokens were revoked
+type ConnectionManager struct {
+	s *Server
+}
+
+// Connections returns the ConnectionManager of the server
+func (s *Server) Connections() *ConnectionManager {
+	return &ConnectionManager{s: s}
+}
+
+// List returns the live connections, in no particular order
+func (m *ConnectionManager) List() []LiveConnection {
+	var infos []LiveConnection
+	m.each(func(c *serverConn, ctx context.Context) bool {
+		infos = append(infos, c.info(ctx))
+		return true
+	})
+	return infos
+}
+
+// Get returns the live connection id
+func (m *ConnectionManager) Get(id ConnectionID) (LiveConnection, bool) {
+	c, ctx, ok := m.lookup(id)
+	if !ok {
+		return LiveConnection{}, false
+	}
+	return c.info(ctx), true
+}
+
+// Close closes the live connection id with code and reason, see Close, it
+// returns false if there's no such connection
+func (m *ConnectionManager) Close(id ConnectionID, code CloseCode, reason string) bool {
+	_, ctx, ok := m.lookup(id)
+	return ok && connection.Close(ctx, code, reason)
+}
+
+// CloseSubject closes all the live connections belonging to subject with code
+// and reason, e.g. CloseForbidden once its access tokens are revoked, and
+// returns how many there were
+func (m *ConnectionManager) CloseSubject(subject string, code CloseCode, reason string) int {
+	n := 0
+	m.each(func(c *serverConn, ctx context.Context) bool {
+		if c.subject == subject && connection.Close(ctx, code, reason) {
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// each calls fn for every opened connection with its context until fn returns
+// false
+func (m *ConnectionManager) each(fn func(c *serverConn, ctx context.Context) bool) {
+	done := false
+	m.s.conns.each(func(c *serverConn) {
+		if done {
+			return
+		}
+		if ctx, ok := c.ctx.Load().(context.Context); ok {
+			done = !fn(c, ctx)
+		}
+	})
+}
+
+// lookup returns the opened connection id with its context
+func (m *ConnectionManager) lookup(id ConnectionID) (*serverConn, context.Context, bool) {
+	c, ok := m.s.conns.lookup(id)
+	if !ok {
+		return nil, nil, false
+	}
+	ctx, ok := c.ctx.Load().(context.Context)
+	return c, ctx, ok
+}
+
+// info describes c, ctx being its context
+func (c *serverConn) info(ctx context.Context) LiveConnection {
+	id, _ := connection.ConnectionIDFromContext(ctx)
+	return LiveConnection{
+		ID:            id,
+		RemoteAddr:    c.remoteAddr,
+		ConnectedAt:   c.connectedAt,
+		Subject:       c.subject,
+		Subscriptions: connection.OperationCount(ctx),
+	}
+}
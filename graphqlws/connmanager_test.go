@@ -0,0 +1,168 @@
+package graphqlws_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+func TestConnectionManager(t *testing.T) {
+	validator := graphqlws.AuthValidatorFunc(func(r *http.Request, ctx context.Context) (context.Context, error) {
+		return context.WithValue(ctx, userKey{}, r.Header.Get("X-User")), nil
+	})
+	s := graphqlws.NewServer(context.Background(), blockingService{}, http.NotFoundHandler(), validator,
+		graphqlws.WithConnectionSubject(func(ctx context.Context) string {
+			user, _ := ctx.Value(userKey{}).(string)
+			return user
+		}),
+	)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	m := s.Connections()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+	dial := func(user string) *websocket.Conn {
+		ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), http.Header{"X-User": {user}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ws
+	}
+	alice1, alice2, bob := dial("alice"), dial("alice"), dial("bob")
+	defer alice1.Close()
+	defer alice2.Close()
+	defer bob.Close()
+
+	bob.WriteMessage(websocket.TextMessage, []byte(`{"type":"connection_init","payload":{}}`))
+	bob.WriteMessage(websocket.TextMessage, []byte(`{"id":"a","type":"start","payload":{}}`))
+	var bobInfo graphqlws.LiveConnection
+	deadline := time.Now().Add(5 * time.Second)
+	for bobInfo.Subscriptions != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected bob's subscription to be listed but instead got %+v", m.List())
+		}
+		time.Sleep(10 * time.Millisecond)
+		for _, info := range m.List() {
+			if info.Subject == "bob" {
+				bobInfo = info
+			}
+		}
+	}
+	if len(m.List()) != 3 {
+		t.Fatalf("expected 3 connections but instead got %+v", m.List())
+	}
+	if bobInfo.RemoteAddr == "" || bobInfo.ConnectedAt.IsZero() {
+		t.Fatalf("expected the address and connection time of bob but instead got %+v", bobInfo)
+	}
+	if info, ok := m.Get(bobInfo.ID); !ok || info.Subject != "bob" {
+		t.Fatalf("expected to get bob's connection but instead got %+v", info)
+	}
+
+	if n := m.CloseSubject("alice", graphqlws.CloseForbidden, "token revoked"); n != 2 {
+		t.Fatalf("expected 2 connections to be closed but instead got %d", n)
+	}
+	for _, ws := range []*websocket.Conn{alice1, alice2} {
+		requireCloseCode(t, ws, int(graphqlws.CloseForbidden))
+	}
+	waitConnectionCount(t, s, 1)
+
+	if !m.Close(bobInfo.ID, graphqlws.CloseForbidden, "token revoked") {
+		t.Fatal("expected bob's connection to be closed")
+	}
+	waitConnectionCount(t, s, 0)
+	if m.Close(bobInfo.ID, graphqlws.CloseForbidden, "token revoked") {
+		t.Fatal("expected bob's connection to be gone")
+	}
+}
+
+// requireCloseCode reads from ws until it's closed, with code
+func requireCloseCode(t *testing.T, ws *websocket.Conn, code int) {
+	t.Helper()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := ws.ReadMessage()
+		if err == nil {
+			continue
+		}
+		var ce *websocket.CloseError
+		if !errors.As(err, &ce) || ce.Code != code {
+			t.Fatalf("expected to be closed with %d but instead got %v", code, err)
+		}
+		return
+	}
+}
+
+// newsService serves subscriptions which join the news topic and send nothing
+// until their context is done
+type newsService struct {
+	gqlService
+}
+
+func (newsService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	graphqlws.JoinTopic(ctx, "news")
+	c := make(chan interface{})
+	go func() {
+		<-ctx.Done()
+		close(c)
+	}()
+	return c, nil
+}
+
+func TestConnectionManagerPush(t *testing.T) {
+	s := graphqlws.NewServer(context.Background(), newsService{}, http.NotFoundHandler(), authValidator{},
+		graphqlws.WithConnectionSubject(func(ctx context.Context) string { return "alice" }),
+	)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	m := s.Connections()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+	ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"connection_init","payload":{}}`))
+	ws.ReadMessage()
+	ws.WriteMessage(websocket.TextMessage, []byte(`{"id":"a","type":"start","payload":{}}`))
+	waitOperationCount(t, s, 1)
+
+	expectPushed := func(expected string) {
+		t.Helper()
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, got, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != expected {
+			t.Fatalf("expected [%s] but instead got [%s]", expected, got)
+		}
+	}
+
+	if n := m.PushSubject("alice", "notices", []byte(`{"data":{"notice":"logged out elsewhere"}}`)); n != 1 {
+		t.Fatalf("expected 1 connection to be pushed to but instead got %d", n)
+	}
+	expectPushed(`{"id":"notices","payload":{"data":{"notice":"logged out elsewhere"}},"type":"data"}`)
+
+	if n := m.PushTopic("news", []byte(`{"data":{"headline":"hello"}}`)); n != 1 {
+		t.Fatalf("expected 1 operation to be pushed to but instead got %d", n)
+	}
+	expectPushed(`{"id":"a","payload":{"data":{"headline":"hello"}},"type":"data"}`)
+
+	id := m.List()[0].ID
+	if !m.Push(id, "notices", []byte(`{"data":{}}`)) {
+		t.Fatal("expected the connection to be pushed to")
+	}
+	expectPushed(`{"id":"notices","payload":{"data":{}},"type":"data"}`)
+	if m.Push("unknown", "notices", []byte(`{"data":{}}`)) {
+		t.Fatal("expected no connection to be pushed to")
+	}
+}
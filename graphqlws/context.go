@@ -0,0 +1,65 @@
+package graphqlws
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// SocketIDFromContext returns the socket id of the operation ctx belongs to,
+// as generated by the IDGenerator, see WithIDGenerator
+func SocketIDFromContext(ctx context.Context) (string, bool) {
+	return connection.SocketIDFromContext(ctx)
+}
+
+// ContextWithSocketID returns a copy of ctx carrying the socket id id, e.g. to
+// test an Observer or a service outside of a connection
+func ContextWithSocketID(ctx context.Context, id string) context.Context {
+	return connection.ContextWithSocketID(ctx, id)
+}
+
+// OperationIDFromContext returns the id of the operation ctx belongs to, as
+// chosen by the client when starting it
+func OperationIDFromContext(ctx context.Context) (string, bool) {
+	return connection.OperationIDFromContext(ctx)
+}
+
+// InitPayloadFromContext returns the connection_init payload of the connection
+// ctx belongs to, e.g. to read a token sent by the client from Subscribe
+func InitPayloadFromContext(ctx context.Context) (json.RawMessage, bool) {
+	return connection.InitPayloadFromContext(ctx)
+}
+
+// ExtensionsFromContext returns the extensions of the start payload of the
+// operation ctx belongs to, e.g. the tracing or custom metadata sent by Apollo
+// clients, from Subscribe or the SubscribeHook
+func ExtensionsFromContext(ctx context.Context) (map[string]interface{}, bool) {
+	return connection.ExtensionsFromContext(ctx)
+}
+
+// ContextWithAuthExpiry returns a copy of ctx telling the connection its
+// authentication expires at t, e.g. when its token does, it's meant to be
+// returned by the InitHandler or the refresh handler. Unless refreshed by
+// then, see WithRefreshHandler, the connection is closed with ErrAuthExpired
+// and the 4403 close code, ending its subscriptions.
+func ContextWithAuthExpiry(ctx context.Context, t time.Time) context.Context {
+	return connection.ContextWithAuthExpiry(ctx, t)
+}
+
+type requestKey struct{}
+
+// RequestFromContext returns the HTTP request which opened the connection ctx
+// belongs to, e.g. to read its headers or cookies. Its body is no longer
+// readable once the connection is upgraded.
+func RequestFromContext(ctx context.Context) (*http.Request, bool) {
+	r, ok := ctx.Value(requestKey{}).(*http.Request)
+	return r, ok
+}
+
+// withRequest returns a copy of ctx carrying r, see RequestFromContext
+func withRequest(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, requestKey{}, r)
+}
@@ -0,0 +1,75 @@
+package graphqlws_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+)
+
+// contextService sends the values carried by the context of its operations
+type contextService struct{}
+
+func (contextService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	values := map[string]interface{}{}
+	if r, ok := graphqlws.RequestFromContext(ctx); ok {
+		values["client"] = r.URL.Query().Get("client")
+	}
+	if payload, ok := graphqlws.InitPayloadFromContext(ctx); ok {
+		values["init"] = payload
+	}
+	if id, ok := graphqlws.OperationIDFromContext(ctx); ok {
+		values["operation"] = id
+	}
+	if id, ok := graphqlws.SocketIDFromContext(ctx); ok {
+		values["socket"] = id
+	}
+	if extensions, ok := graphqlws.ExtensionsFromContext(ctx); ok {
+		values["extensions"] = extensions
+	}
+
+	c := make(chan interface{}, 1)
+	c <- values
+	close(c)
+	return c, nil
+}
+
+func (contextService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+func TestContextAccessors(t *testing.T) {
+	srv := httptest.NewServer(graphqlws.NewServer(context.Background(), contextService{}, http.NotFoundHandler(), authValidator{},
+		graphqlws.WithIDGenerator(graphqlwstest.SequentialIDs("socket-")),
+	))
+	defer srv.Close()
+
+	ws := dialProtocols(t, srv.URL+"?client=test", graphqlws.ProtocolGraphQLTransportWS)
+	defer ws.Close()
+	exchange(t, ws, `{"type":"connection_init","payload":{"token":"secret"}}`, transportWSAck)
+	exchange(t, ws, `{"id":"a","type":"subscribe","payload":{"query":"subscription { tick }"}}`,
+		`{"id":"a","type":"next","payload":{"client":"test","init":{"token":"secret"},"operation":"a","socket":"socket-1"}}`,
+		`{"id":"a","type":"complete"}`,
+	)
+	exchange(t, ws, `{"id":"b","type":"subscribe","payload":{"query":"subscription { tick }","extensions":{"tracing":{"traceId":"abc"}}}}`,
+		`{"id":"b","type":"next","payload":{"client":"test","extensions":{"tracing":{"traceId":"abc"}},"init":{"token":"secret"},"operation":"b","socket":"socket-2"}}`,
+		`{"id":"b","type":"complete"}`,
+	)
+
+	for name, fn := range map[string]func(ctx context.Context) bool{
+		"request":    func(ctx context.Context) bool { _, ok := graphqlws.RequestFromContext(ctx); return ok },
+		"init":       func(ctx context.Context) bool { _, ok := graphqlws.InitPayloadFromContext(ctx); return ok },
+		"operation":  func(ctx context.Context) bool { _, ok := graphqlws.OperationIDFromContext(ctx); return ok },
+		"socket":     func(ctx context.Context) bool { _, ok := graphqlws.SocketIDFromContext(ctx); return ok },
+		"extensions": func(ctx context.Context) bool { _, ok := graphqlws.ExtensionsFromContext(ctx); return ok },
+	} {
+		if fn(context.Background()) {
+			t.Fatalf("expected no %s in a bare context", name)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+//go:build datadog
+// +build datadog
+
+// Package datadog provides a graphqlws.Observer tracing connections and
+// operations with dd-trace-go. It's only built with the datadog build tag, so
+// that depending on graphqlws doesn't pull in the tracer.
+package datadog
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+const (
+	connectionSpan = "graphqlws.connection"
+	operationSpan  = "graphqlws.operation"
+
+	// the log attributes Datadog correlates logs with traces by
+	logKeyTraceID = "dd.trace_id"
+	logKeySpanID  = "dd.span_id"
+)
+
+type observer struct {
+	service string
+}
+
+// Observer returns a graphqlws.Observer starting a span for each connection,
+// with a child span for each of its operations, using the global tracer. The
+// operation spans are carried by the operation contexts passed to the
+// GraphQLService, so the spans of resolvers are children of them.
+func Observer(service string) graphqlws.Observer {
+	return &observer{service: service}
+}
+
+func (o *observer) ConnectionStart(ctx context.Context, info graphqlws.ConnectionInfo) context.Context {
+	opts := []tracer.StartSpanOption{
+		tracer.ServiceName(o.service),
+		tracer.SpanType(ext.SpanTypeWeb),
+		tracer.ResourceName(connectionSpan),
+	}
+	if info.RemoteAddr != nil {
+		opts = append(opts, tracer.Tag("network.client.ip", info.RemoteAddr.String()))
+	}
+	if id, ok := graphqlws.ConnectionIDFromContext(ctx); ok {
+		opts = append(opts, tracer.Tag("graphqlws.connection_id", string(id)))
+	}
+
+	span, ctx := tracer.StartSpanFromContext(ctx, connectionSpan, opts...)
+	return withLogFields(ctx, span)
+}
+
+func (o *observer) ConnectionEnd(ctx context.Context) {
+	if span, ok := tracer.SpanFromContext(ctx); ok {
+		span.Finish()
+	}
+}
+
+func (o *observer) OperationStart(ctx context.Context, info graphqlws.OperationInfo) context.Context {
+	resource := info.OperationName
+	if resource == "" {
+		resource = operationSpan
+	}
+
+	opts := []tracer.StartSpanOption{
+		tracer.ServiceName(o.service),
+		tracer.SpanType(ext.SpanTypeWeb),
+		tracer.ResourceName(resource),
+		tracer.Tag("graphql.operation.id", info.ID),
+		tracer.Tag("graphql.operation.name", info.OperationName),
+		tracer.Tag("graphql.query", info.Query),
+	}
+	if socketID, ok := graphqlws.SocketIDFromContext(ctx); ok {
+		opts = append(opts, tracer.Tag("graphqlws.socket_id", socketID))
+	}
+
+	span, ctx := tracer.StartSpanFromContext(ctx, operationSpan, opts...)
+	return withLogFields(ctx, span)
+}
+
+// withLogFields adds the trace and span ids of span to the log fields of ctx
+func withLogFields(ctx context.Context, span ddtrace.Span) context.Context {
+	return graphqlws.ContextWithLogFields(ctx,
+		logKeyTraceID, strconv.FormatUint(span.Context().TraceID(), 10),
+		logKeySpanID, strconv.FormatUint(span.Context().SpanID(), 10),
+	)
+}
+
+func (o *observer) OperationEnd(ctx context.Context, err error) {
+	span, ok := tracer.SpanFromContext(ctx)
+	if !ok {
+		return
+	}
+
+	// operations stopped by the client or closed with their connection aren't
+	// failures
+	if err != nil && !errors.Is(err, context.Canceled) {
+		span.Finish(tracer.WithError(err))
+		return
+	}
+	span.Finish()
+}
@@ -0,0 +1,68 @@
+//go:build datadog
+// +build datadog
+
+package datadog_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/ext"
+	"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/mocktracer"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/datadog"
+)
+
+func TestObserver(t *testing.T) {
+	mt := mocktracer.Start()
+	defer mt.Stop()
+
+	o := datadog.Observer("graphql")
+	connCtx := o.ConnectionStart(context.Background(), graphqlws.ConnectionInfo{})
+	opCtx := o.OperationStart(graphqlws.ContextWithSocketID(connCtx, "a-socket"), graphqlws.OperationInfo{
+		ID:            "a-id",
+		OperationName: "onMessage",
+		Query:         "subscription onMessage { message }",
+	})
+	o.OperationEnd(opCtx, errors.New("failed"))
+	o.ConnectionEnd(connCtx)
+
+	spans := mt.FinishedSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans but instead got %d", len(spans))
+	}
+
+	op, conn := spans[0], spans[1]
+	if op.ParentID() != conn.SpanID() {
+		t.Fatalf("expected the operation span to be a child of the connection span")
+	}
+	for tag, expected := range map[string]interface{}{
+		ext.ServiceName:          "graphql",
+		ext.ResourceName:         "onMessage",
+		"graphql.operation.id":   "a-id",
+		"graphqlws.socket_id":    "a-socket",
+		"graphql.operation.name": "onMessage",
+	} {
+		if got := op.Tag(tag); got != expected {
+			t.Fatalf("expected tag %s to be [%v] but instead got [%v]", tag, expected, got)
+		}
+	}
+	if err, _ := op.Tag(ext.Error).(error); err == nil || err.Error() != "failed" {
+		t.Fatalf("expected the operation span to have failed but instead got [%v]", op.Tag(ext.Error))
+	}
+	if got := conn.Tag(ext.Error); got != nil {
+		t.Fatalf("expected no error on the connection span but instead got [%v]", got)
+	}
+
+	expected := []interface{}{
+		"dd.trace_id", strconv.FormatUint(op.TraceID(), 10),
+		"dd.span_id", strconv.FormatUint(op.SpanID(), 10),
+	}
+	if got := graphqlws.LogFieldsFromContext(opCtx); !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected log fields %v but instead got %v", expected, got)
+	}
+}
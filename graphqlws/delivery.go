@@ -0,0 +1,11 @@
+package graphqlws
+
+import (
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// Delivery wraps a subscription payload, or an Event, with a callback called
+// once it's written to the client. Sources acknowledging messages upstream,
+// e.g. the pubsub package, use it to only do so once they're delivered. Its
+// Deadline, if set, drops payloads which went stale before they're written.
+type Delivery = connection.Delivery
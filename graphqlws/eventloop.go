@@ -0,0 +1,26 @@
+package graphqlws
+
+import (
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/eventloop"
+)
+
+// EventLoop serves websocket connections without a dedicated read goroutine
+// per connection, see WithEventLoop.
+type EventLoop = eventloop.Loop
+
+// NewEventLoop starts an event loop handling incoming frames on the given
+// number of workers. It's only supported on systems with epoll (Linux) or
+// kqueue (BSDs, macOS).
+func NewEventLoop(workers int) (*EventLoop, error) {
+	return eventloop.New(workers)
+}
+
+// WithEventLoop makes the handler upgrade connections with gobwas/ws and poll
+// them from l, so that idle connections don't hold any goroutine. This targets
+// instances serving 100k+ mostly idle subscriptions, where the default
+// goroutine-per-connection model dominates memory usage.
+func WithEventLoop(l *EventLoop) Option {
+	return func(h *handler) {
+		h.eventLoop = l
+	}
+}
@@ -0,0 +1,134 @@
+//go:build redis
+// +build redis
+
+// Package redis is an EventStore keeping the latest events of each stream in
+// Redis, see graphqlws.WithEventStore. It's only built with the redis build
+// tag, so that depending on graphqlws doesn't pull in the Redis client.
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+// appendScript appends the event ARGV[1] with the payload ARGV[2] to the
+// stream of the list of IDs KEYS[1] and the hash of payloads KEYS[2], unless
+// it already holds it, keeping the latest ARGV[3] events for ARGV[4]ms
+var appendScript = goredis.NewScript(`
+if redis.call('HSETNX', KEYS[2], ARGV[1], ARGV[2]) == 0 then
+	return 0
+end
+redis.call('RPUSH', KEYS[1], ARGV[1])
+while redis.call('LLEN', KEYS[1]) > tonumber(ARGV[3]) do
+	redis.call('HDEL', KEYS[2], redis.call('LPOP', KEYS[1]))
+end
+if tonumber(ARGV[4]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[4])
+	redis.call('PEXPIRE', KEYS[2], ARGV[4])
+end
+return 1
+`)
+
+type store struct {
+	client goredis.UniversalClient
+	prefix string
+	limit  int
+	ttl    time.Duration
+}
+
+// Option configures a store
+type Option func(s *store)
+
+// Prefix sets the prefix of the keys of the streams, graphqlws:events: by
+// default
+func Prefix(prefix string) Option {
+	return func(s *store) {
+		s.prefix = prefix
+	}
+}
+
+// Limit sets how many of the latest events of each stream are kept, 1000 by
+// default
+func Limit(n int) Option {
+	return func(s *store) {
+		s.limit = n
+	}
+}
+
+// TTL makes the streams expire once no event was appended to them for d, by
+// default they don't
+func TTL(d time.Duration) Option {
+	return func(s *store) {
+		s.ttl = d
+	}
+}
+
+// New returns an EventStore keeping the events of each stream in a list of
+// their IDs and a hash of their payloads. Both keys of a stream share a hash
+// tag, so that the store works with Redis Cluster too.
+func New(client goredis.UniversalClient, options ...Option) graphqlws.EventStore {
+	s := &store{client: client, prefix: "graphqlws:events:", limit: 1000}
+	for _, opt := range options {
+		opt(s)
+	}
+	return s
+}
+
+func (s *store) keys(stream string) []string {
+	return []string{
+		fmt.Sprintf("%s{%s}:ids", s.prefix, stream),
+		fmt.Sprintf("%s{%s}:payloads", s.prefix, stream),
+	}
+}
+
+func (s *store) Append(ctx context.Context, stream string, ev graphqlws.Event) error {
+	payload, err := json.Marshal(ev.Payload)
+	if err != nil {
+		return err
+	}
+	return appendScript.Run(ctx, s.client, s.keys(stream), ev.ID, payload, s.limit, s.ttl.Milliseconds()).Err()
+}
+
+func (s *store) Since(ctx context.Context, stream string, lastEventID string) ([]graphqlws.Event, bool, error) {
+	keys := s.keys(stream)
+	ids, err := s.client.LRange(ctx, keys[0], 0, -1).Result()
+	if err != nil {
+		return nil, false, err
+	}
+
+	found := -1
+	for i, id := range ids {
+		if id == lastEventID {
+			found = i
+			break
+		}
+	}
+	if found < 0 {
+		return nil, false, nil
+	}
+	after := ids[found+1:]
+	if len(after) == 0 {
+		return nil, true, nil
+	}
+
+	payloads, err := s.client.HMGet(ctx, keys[1], after...).Result()
+	if err != nil {
+		return nil, false, err
+	}
+	events := make([]graphqlws.Event, 0, len(after))
+	for i, p := range payloads {
+		// trimmed in the meantime
+		payload, ok := p.(string)
+		if !ok {
+			continue
+		}
+		events = append(events, graphqlws.Event{ID: after[i], Payload: json.RawMessage(payload)})
+	}
+	return events, true, nil
+}
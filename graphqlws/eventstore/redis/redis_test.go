@@ -0,0 +1,70 @@
+//go:build redis
+// +build redis
+
+package redis_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/eventstore/redis"
+)
+
+func TestStore(t *testing.T) {
+	s := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	defer client.Close()
+	store := redis.New(client, redis.Limit(3))
+
+	ctx := context.Background()
+	for _, id := range []string{"1", "2", "2", "3", "4"} {
+		ev := graphqlws.Event{ID: id, Payload: json.RawMessage(`{"data":{"id":"` + id + `"}}`)}
+		if err := store.Append(ctx, "rooms", ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	evs, ok, err := store.Since(ctx, "rooms", "2")
+	if err != nil || !ok {
+		t.Fatalf("expected the events after 2 but instead got %v, %v", ok, err)
+	}
+	if len(evs) != 2 || evs[0].ID != "3" || evs[1].ID != "4" {
+		t.Fatalf("expected the events 3 and 4 but instead got %v", evs)
+	}
+	if payload, _ := evs[1].Payload.(json.RawMessage); string(payload) != `{"data":{"id":"4"}}` {
+		t.Fatalf("expected the payload of the event 4 but instead got %s", payload)
+	}
+	if evs, ok, _ := store.Since(ctx, "rooms", "4"); !ok || len(evs) > 0 {
+		t.Fatalf("expected no events after the latest one but instead got %v, %v", evs, ok)
+	}
+
+	// the oldest events are dropped
+	if _, ok, _ := store.Since(ctx, "rooms", "1"); ok {
+		t.Fatal("expected the event 1 to be dropped")
+	}
+	if _, ok, _ := store.Since(ctx, "other", "2"); ok {
+		t.Fatal("expected the event 2 not to be found in another stream")
+	}
+}
+
+func TestStoreTTL(t *testing.T) {
+	s := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	defer client.Close()
+	store := redis.New(client, redis.TTL(time.Minute))
+
+	ctx := context.Background()
+	if err := store.Append(ctx, "rooms", graphqlws.Event{ID: "1", Payload: json.RawMessage(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+	s.FastForward(2 * time.Minute)
+	if _, ok, _ := store.Since(ctx, "rooms", "1"); ok {
+		t.Fatal("expected the stream to expire")
+	}
+}
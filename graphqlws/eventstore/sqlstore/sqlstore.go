@@ -0,0 +1,130 @@
+// Package sqlstore is an EventStore keeping the events of each stream in a SQL
+// table, see graphqlws.WithEventStore. The table is expected to be created
+// beforehand, e.g. for PostgreSQL:
+//
+//	CREATE TABLE graphqlws_events (
+//		seq     BIGSERIAL PRIMARY KEY,
+//		stream  TEXT NOT NULL,
+//		id      TEXT NOT NULL,
+//		payload TEXT NOT NULL,
+//		UNIQUE (stream, id)
+//	)
+//
+// where seq orders the events. Rows are never deleted by the store, they
+// should be, e.g. periodically, once old enough for clients not to resume
+// from them anymore.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+type store struct {
+	db     *sql.DB
+	dollar bool
+
+	insert, selectSeq, selectSince string
+}
+
+// Option configures a store
+type Option func(s *store)
+
+// DollarPlaceholders makes the queries use $1, $2... placeholders instead of
+// ?, e.g. for PostgreSQL
+func DollarPlaceholders() Option {
+	return func(s *store) {
+		s.dollar = true
+	}
+}
+
+// New returns an EventStore keeping the events in table, see the package
+// documentation for its schema
+func New(db *sql.DB, table string, options ...Option) graphqlws.EventStore {
+	s := &store{db: db}
+	for _, opt := range options {
+		opt(s)
+	}
+	s.insert = s.query("INSERT INTO %s (stream, id, payload) VALUES (?, ?, ?)", table)
+	s.selectSeq = s.query("SELECT seq FROM %s WHERE stream = ? AND id = ?", table)
+	s.selectSince = s.query("SELECT id, payload FROM %s WHERE stream = ? AND seq > ? ORDER BY seq", table)
+	return s
+}
+
+// query formats q with table, replacing its ? placeholders with the ones of
+// the database
+func (s *store) query(q string, table string) string {
+	q = fmt.Sprintf(q, table)
+	if !s.dollar {
+		return q
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, c := range q {
+		if c == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+func (s *store) Append(ctx context.Context, stream string, ev graphqlws.Event) error {
+	payload, err := json.Marshal(ev.Payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, s.insert, stream, ev.ID, string(payload))
+	if err == nil {
+		return nil
+	}
+	// the error of a concurrent insertion of the same event violating the
+	// unique constraint depends on the driver
+	if _, serr := s.seq(ctx, stream, ev.ID); serr == nil {
+		return nil
+	}
+	return err
+}
+
+// seq returns the sequence number of the event id of stream
+func (s *store) seq(ctx context.Context, stream string, id string) (int64, error) {
+	var seq int64
+	err := s.db.QueryRowContext(ctx, s.selectSeq, stream, id).Scan(&seq)
+	return seq, err
+}
+
+func (s *store) Since(ctx context.Context, stream string, lastEventID string) ([]graphqlws.Event, bool, error) {
+	seq, err := s.seq(ctx, stream, lastEventID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.selectSince, stream, seq)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var events []graphqlws.Event
+	for rows.Next() {
+		var id, payload string
+		if err := rows.Scan(&id, &payload); err != nil {
+			return nil, false, err
+		}
+		events = append(events, graphqlws.Event{ID: id, Payload: json.RawMessage(payload)})
+	}
+	return events, true, rows.Err()
+}
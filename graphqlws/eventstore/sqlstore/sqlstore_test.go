@@ -0,0 +1,65 @@
+//go:build sqlite
+// +build sqlite
+
+// The tests are only built with the sqlite build tag, so that depending on
+// graphqlws doesn't pull in a SQL driver.
+
+package sqlstore_test
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/eventstore/sqlstore"
+)
+
+const schema = `CREATE TABLE graphqlws_events (
+	seq     INTEGER PRIMARY KEY AUTOINCREMENT,
+	stream  TEXT NOT NULL,
+	id      TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	UNIQUE (stream, id)
+)`
+
+func TestStore(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+	store := sqlstore.New(db, "graphqlws_events")
+
+	ctx := context.Background()
+	for _, id := range []string{"1", "2", "2", "3"} {
+		ev := graphqlws.Event{ID: id, Payload: json.RawMessage(`{"data":{"id":"` + id + `"}}`)}
+		if err := store.Append(ctx, "rooms", ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Append(ctx, "other", graphqlws.Event{ID: "4", Payload: json.RawMessage(`{}`)}); err != nil {
+		t.Fatal(err)
+	}
+
+	evs, ok, err := store.Since(ctx, "rooms", "1")
+	if err != nil || !ok {
+		t.Fatalf("expected the events after 1 but instead got %v, %v", ok, err)
+	}
+	if len(evs) != 2 || evs[0].ID != "2" || evs[1].ID != "3" {
+		t.Fatalf("expected the events 2 and 3 once but instead got %v", evs)
+	}
+	if payload, _ := evs[1].Payload.(json.RawMessage); string(payload) != `{"data":{"id":"3"}}` {
+		t.Fatalf("expected the payload of the event 3 but instead got %s", payload)
+	}
+	if _, ok, _ := store.Since(ctx, "rooms", "4"); ok {
+		t.Fatal("expected the event 4 not to be found in another stream")
+	}
+}
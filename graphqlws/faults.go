@@ -0,0 +1,24 @@
+package graphqlws
+
+import (
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// Faults holds failures to inject into the connections running given
+// operations, keyed by their socket id, e.g. to test the reconnect and resume
+// logic of clients
+type Faults = connection.Faults
+
+// NewFaults returns Faults without any armed
+var NewFaults = connection.NewFaults
+
+// ErrInjectedFault is the error of the writes failed by Faults
+var ErrInjectedFault = connection.ErrInjectedFault
+
+// WithFaults makes connections inject the faults armed in f, it's meant for
+// tests only
+func WithFaults(f *Faults) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.InjectFaults(f))
+	}
+}
@@ -0,0 +1,119 @@
+//go:build gcppubsub
+// +build gcppubsub
+
+// Package gcppubsub maps Google Cloud Pub/Sub subscriptions to the channels
+// returned by GraphQLService.Subscribe. It's only built with the gcppubsub
+// build tag, so that depending on graphqlws doesn't pull in the client.
+package gcppubsub
+
+import (
+	"context"
+	"encoding/json"
+
+	"cloud.google.com/go/pubsub"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+// DecodeFunc maps a Pub/Sub message to the payload of a data message
+type DecodeFunc func(ctx context.Context, msg *pubsub.Message) (interface{}, error)
+
+type source struct {
+	ackOnDelivery bool
+	decode        DecodeFunc
+}
+
+// Option configures Subscribe
+type Option func(s *source)
+
+// AckOnDelivery only acknowledges messages once their payloads have been
+// written to the client, messages which aren't by the time the operation is
+// done are nacked so that Pub/Sub redelivers them. By default messages are
+// acknowledged as soon as their payloads are handed to the connection.
+//
+// Each message then holds a goroutine of sub.Receive until it's delivered, so
+// the subscription's ReceiveSettings.MaxOutstandingMessages bounds how many
+// payloads may be waiting for slow clients.
+func AckOnDelivery() Option {
+	return func(s *source) {
+		s.ackOnDelivery = true
+	}
+}
+
+// Decode sets the function mapping messages to payloads. By default the data
+// of messages is forwarded as is, i.e. it's expected to be a JSON encoded
+// GraphQL response. Messages failing to decode are nacked.
+func Decode(fn DecodeFunc) Option {
+	return func(s *source) {
+		s.decode = fn
+	}
+}
+
+func decodeData(ctx context.Context, msg *pubsub.Message) (interface{}, error) {
+	return json.RawMessage(msg.Data), nil
+}
+
+// Subscribe receives the messages of sub until ctx, usually the one passed to
+// GraphQLService.Subscribe, is done and returns a channel of their payloads.
+// The channel is closed once receiving stops, which completes the operation.
+//
+// Messages are received concurrently, as configured by sub.ReceiveSettings,
+// so their payloads are only forwarded in order if NumGoroutines and
+// MaxOutstandingMessages are set to 1.
+func Subscribe(ctx context.Context, sub *pubsub.Subscription, options ...Option) <-chan interface{} {
+	s := &source{decode: decodeData}
+	for _, opt := range options {
+		opt(s)
+	}
+
+	c := make(chan interface{})
+	go func() {
+		defer close(c)
+		sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+			s.forward(ctx, c, msg)
+		})
+	}()
+	return c
+}
+
+func (s *source) forward(ctx context.Context, c chan<- interface{}, msg *pubsub.Message) {
+	payload, err := s.decode(ctx, msg)
+	if err != nil {
+		msg.Nack()
+		return
+	}
+
+	if !s.ackOnDelivery {
+		select {
+		case c <- payload:
+			msg.Ack()
+		case <-ctx.Done():
+			msg.Nack()
+		}
+		return
+	}
+
+	delivered := make(chan struct{})
+	d := graphqlws.Delivery{
+		Payload: payload,
+		Delivered: func() {
+			msg.Ack()
+			close(delivered)
+		},
+	}
+
+	select {
+	case c <- d:
+	case <-ctx.Done():
+		msg.Nack()
+		return
+	}
+
+	// acking after nacking is a no-op, so a message delivered while the
+	// operation is being stopped is redelivered
+	select {
+	case <-delivered:
+	case <-ctx.Done():
+		msg.Nack()
+	}
+}
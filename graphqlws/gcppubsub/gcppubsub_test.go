@@ -0,0 +1,106 @@
+//go:build gcppubsub
+// +build gcppubsub
+
+package gcppubsub_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/pstest"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/gcppubsub"
+)
+
+const payload = `{"data":{"message":"hello"}}`
+
+func newSubscription(t *testing.T, ctx context.Context) (*pstest.Server, *pubsub.Subscription) {
+	srv := pstest.NewServer()
+	t.Cleanup(func() { srv.Close() })
+
+	conn, err := grpc.Dial(srv.Addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := pubsub.NewClient(ctx, "project", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := client.CreateSubscription(ctx, "sub", pubsub.SubscriptionConfig{Topic: topic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := topic.Publish(ctx, &pubsub.Message{Data: []byte(payload)}).Get(ctx); err != nil {
+		t.Fatal(err)
+	}
+	topic.Stop()
+
+	return srv, sub
+}
+
+func waitAcks(t *testing.T, srv *pstest.Server, expected int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for srv.Messages()[0].Acks != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d acks but instead got %d", expected, srv.Messages()[0].Acks)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, sub := newSubscription(t, ctx)
+
+	c := gcppubsub.Subscribe(ctx, sub)
+	got, ok := (<-c).(json.RawMessage)
+	if !ok || string(got) != payload {
+		t.Fatalf("expected [%s] but instead got [%s]", payload, got)
+	}
+	waitAcks(t, srv, 1)
+
+	cancel()
+	for range c {
+	}
+}
+
+func TestSubscribeAckOnDelivery(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	srv, sub := newSubscription(t, ctx)
+
+	c := gcppubsub.Subscribe(ctx, sub, gcppubsub.AckOnDelivery())
+	d, ok := (<-c).(graphqlws.Delivery)
+	if !ok {
+		t.Fatal("expected a delivery")
+	}
+	if got, _ := d.Payload.(json.RawMessage); string(got) != payload {
+		t.Fatalf("expected [%s] but instead got [%s]", payload, got)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	if acks := srv.Messages()[0].Acks; acks != 0 {
+		t.Fatalf("expected no ack before delivery but instead got %d", acks)
+	}
+	d.Delivered()
+	waitAcks(t, srv, 1)
+
+	cancel()
+	for range c {
+	}
+}
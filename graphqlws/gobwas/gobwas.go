@@ -0,0 +1,164 @@
+// Package gobwas upgrades websocket connections with gobwas/ws, whose
+// upgrades don't allocate and whose connections are read without per message
+// buffers beyond the payload, see graphqlws.WithWebSocketBackend.
+package gobwas
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+var errSubprotocol = errors.New("gobwas: subprotocol not negotiated")
+
+type backend struct {
+	upgrader ws.HTTPUpgrader
+}
+
+// Backend returns a graphqlws.WebSocketBackend upgrading the requests with u,
+// which may be nil, e.g. to set a handshake timeout or the response headers.
+// Its Protocol is ignored in favor of graphqlws.WithProtocols.
+func Backend(u *ws.HTTPUpgrader) graphqlws.WebSocketBackend {
+	b := &backend{}
+	if u != nil {
+		b.upgrader = *u
+	}
+	return b
+}
+
+func (b *backend) Upgrade(w http.ResponseWriter, r *http.Request, protocol string) (graphqlws.WebSocket, error) {
+	upgrader := b.upgrader
+	upgrader.Protocol = func(p string) bool { return p == protocol }
+
+	conn, rw, hs, err := upgrader.Upgrade(r, w)
+	if err != nil {
+		// the rejection was written to the hijacked connection
+		if conn != nil {
+			conn.Close()
+		}
+		return nil, err
+	}
+	if hs.Protocol != protocol {
+		conn.Close()
+		return nil, errSubprotocol
+	}
+	return &wsConn{conn: conn, rd: rw.Reader}, nil
+}
+
+// wsConn adapts a gobwas/ws server side connection to graphqlws.WebSocket
+type wsConn struct {
+	conn net.Conn
+	// rd holds what the client may have sent right after the handshake
+	rd *bufio.Reader
+
+	readLimit int64
+	onPong    func(appData string) error
+
+	// writeMu serializes frame writes between the connection's writer, the
+	// control frames and the replies to those of the client, writeDeadline
+	// is the deadline set by the writer
+	writeMu       sync.Mutex
+	writeDeadline time.Time
+}
+
+// readFrame reads the next data frame, handling control frames in between. It
+// returns a nil frame if there was only a control frame to read.
+func (c *wsConn) readFrame() ([]byte, error) {
+	rd := wsutil.Reader{
+		Source:       c.rd,
+		State:        ws.StateServerSide,
+		CheckUTF8:    true,
+		MaxFrameSize: c.readLimit,
+	}
+
+	hdr, err := rd.NextFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	if hdr.OpCode == ws.OpPong {
+		payload, err := ioutil.ReadAll(&rd)
+		if err != nil || c.onPong == nil {
+			return nil, err
+		}
+		return nil, c.onPong(string(payload))
+	}
+	if hdr.OpCode.IsControl() {
+		var reply bytes.Buffer
+		handleErr := wsutil.ControlFrameHandler(&reply, ws.StateServerSide)(hdr, &rd)
+		if reply.Len() > 0 {
+			c.writeMu.Lock()
+			_, err = c.conn.Write(reply.Bytes())
+			c.writeMu.Unlock()
+		}
+		if handleErr != nil {
+			return nil, handleErr
+		}
+		return nil, err
+	}
+
+	return ioutil.ReadAll(&rd)
+}
+
+func (c *wsConn) ReadMessage() (int, []byte, error) {
+	for {
+		frame, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		if frame != nil {
+			return int(ws.OpText), frame, nil
+		}
+	}
+}
+
+func (c *wsConn) WriteMessage(messageType int, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return wsutil.WriteServerMessage(c.conn, ws.OpCode(messageType), data)
+}
+
+// WriteControl writes the control frame before deadline, the deadline of the
+// writer being restored afterwards
+func (c *wsConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	defer c.conn.SetWriteDeadline(c.writeDeadline)
+	return wsutil.WriteServerMessage(c.conn, ws.OpCode(messageType), data)
+}
+
+func (c *wsConn) SetReadLimit(limit int64) {
+	c.readLimit = limit
+}
+
+func (c *wsConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *wsConn) SetPongHandler(h func(appData string) error) {
+	c.onPong = h
+}
+
+func (c *wsConn) SetWriteDeadline(t time.Time) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.writeDeadline = t
+	return c.conn.SetWriteDeadline(t)
+}
+
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
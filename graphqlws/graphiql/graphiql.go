@@ -0,0 +1,163 @@
+// Package graphiql serves GraphiQL preconfigured to run subscriptions over
+// graphqlws, so that they can be tried out without building a frontend.
+package graphiql
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+)
+
+// The websocket subprotocols GraphiQL can speak
+const (
+	// ProtocolGraphQLWS is the Apollo subscriptions-transport-ws protocol
+	// served by graphqlws, with the subscriptions-transport-ws client
+	ProtocolGraphQLWS = "graphql-ws"
+	// ProtocolGraphQLTransportWS is the protocol of the graphql-ws library,
+	// with its client
+	ProtocolGraphQLTransportWS = "graphql-transport-ws"
+)
+
+type config struct {
+	Title           string `json:"title"`
+	URL             string `json:"url"`
+	SubscriptionURL string `json:"subscriptionUrl"`
+	Protocol        string `json:"protocol"`
+	TokenParam      string `json:"tokenParam"`
+}
+
+// Option configures the handler
+type Option func(c *config)
+
+// Title sets the title of the page, the default is GraphiQL
+func Title(title string) Option {
+	return func(c *config) {
+		c.Title = title
+	}
+}
+
+// URL sets the URL queries and mutations are posted to, the default is
+// /graphql
+func URL(url string) Option {
+	return func(c *config) {
+		c.URL = url
+	}
+}
+
+// SubscriptionURL sets the websocket URL subscriptions are run over, the
+// default is URL resolved against the page with a ws or wss scheme
+func SubscriptionURL(url string) Option {
+	return func(c *config) {
+		c.SubscriptionURL = url
+	}
+}
+
+// Protocol sets the websocket subprotocol spoken by GraphiQL, the default is
+// ProtocolGraphQLWS
+func Protocol(protocol string) Option {
+	return func(c *config) {
+		c.Protocol = protocol
+	}
+}
+
+// TokenParam sets the name the auth token entered in the page is sent as,
+// the default is token. Since browsers can't set the headers of websocket
+// requests, it's sent both as a query parameter of the subscription URL, for
+// the AuthValidator to check, and in the connection_init payload, while
+// queries and mutations carry it as a bearer token in the Authorization
+// header.
+func TokenParam(name string) Option {
+	return func(c *config) {
+		c.TokenParam = name
+	}
+}
+
+// Handler returns an http.Handler serving GraphiQL, loaded from unpkg.com,
+// with an auth token prompt
+func Handler(options ...Option) http.Handler {
+	c := config{
+		Title:      "GraphiQL",
+		URL:        "/graphql",
+		Protocol:   ProtocolGraphQLWS,
+		TokenParam: "token",
+	}
+	for _, opt := range options {
+		opt(&c)
+	}
+
+	var page bytes.Buffer
+	if err := pageTemplate.Execute(&page, c); err != nil {
+		panic(err)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page.Bytes())
+	})
+}
+
+var pageTemplate = template.Must(template.New("graphiql").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<title>{{.Title}}</title>
+	<style>
+		body { height: 100vh; margin: 0; display: flex; flex-direction: column; }
+		#token { display: flex; gap: 8px; padding: 8px; font-family: sans-serif; font-size: 14px; align-items: center; }
+		#token input { flex: 1; }
+		#graphiql { flex: 1; }
+	</style>
+	<link rel="stylesheet" href="https://unpkg.com/graphiql@3.0.6/graphiql.min.css">
+	<script src="https://unpkg.com/react@18.2.0/umd/react.production.min.js" crossorigin></script>
+	<script src="https://unpkg.com/react-dom@18.2.0/umd/react-dom.production.min.js" crossorigin></script>
+	<script src="https://unpkg.com/graphiql@3.0.6/graphiql.min.js" crossorigin></script>
+	<script src="https://unpkg.com/subscriptions-transport-ws@0.9.18/browser/client.js" crossorigin></script>
+	<script src="https://unpkg.com/graphql-ws@5.14.0/umd/graphql-ws.min.js" crossorigin></script>
+</head>
+<body>
+	<form id="token">
+		<label for="token-input">Auth token</label>
+		<input id="token-input" type="password" autocomplete="off">
+		<button type="submit">Reconnect</button>
+	</form>
+	<div id="graphiql"></div>
+	<script>
+		const config = {{.}};
+		const storageKey = "graphqlws:" + config.tokenParam;
+		const token = localStorage.getItem(storageKey) || "";
+
+		const input = document.getElementById("token-input");
+		input.value = token;
+		document.getElementById("token").addEventListener("submit", (event) => {
+			event.preventDefault();
+			localStorage.setItem(storageKey, input.value);
+			location.reload();
+		});
+
+		const subscriptionURL = new URL(config.subscriptionUrl || config.url, location.href);
+		if (subscriptionURL.protocol === "http:" || subscriptionURL.protocol === "https:") {
+			subscriptionURL.protocol = subscriptionURL.protocol === "https:" ? "wss:" : "ws:";
+		}
+		const connectionParams = {};
+		if (token) {
+			subscriptionURL.searchParams.set(config.tokenParam, token);
+			connectionParams[config.tokenParam] = token;
+		}
+
+		const options = {
+			url: config.url,
+			headers: token ? { Authorization: "Bearer " + token } : {},
+		};
+		if (config.protocol === "graphql-transport-ws") {
+			options.wsClient = graphqlWs.createClient({ url: subscriptionURL.href, connectionParams });
+		} else {
+			options.legacyWsClient = new SubscriptionsTransportWs.SubscriptionClient(subscriptionURL.href, { reconnect: true, connectionParams });
+		}
+
+		ReactDOM.createRoot(document.getElementById("graphiql")).render(
+			React.createElement(GraphiQL, { fetcher: GraphiQL.createFetcher(options) }),
+		);
+	</script>
+</body>
+</html>
+`))
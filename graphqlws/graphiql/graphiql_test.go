@@ -0,0 +1,32 @@
+package graphiql_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphiql"
+)
+
+func TestHandler(t *testing.T) {
+	h := graphiql.Handler(
+		graphiql.Title("Messages"),
+		graphiql.SubscriptionURL("wss://example.com/graphql"),
+		graphiql.Protocol(graphiql.ProtocolGraphQLTransportWS),
+	)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/graphiql", nil))
+
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Fatalf("expected an HTML page but instead got %s", ct)
+	}
+	body := w.Body.String()
+	for _, expected := range []string{
+		`<title>Messages</title>`,
+		`const config = {"title":"Messages","url":"/graphql","subscriptionUrl":"wss://example.com/graphql","protocol":"graphql-transport-ws","tokenParam":"token"};`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected the page to contain [%s]", expected)
+		}
+	}
+}
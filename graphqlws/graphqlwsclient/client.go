@@ -0,0 +1,599 @@
+// Package graphqlwsclient is a client of GraphQL over WebSocket servers,
+// speaking both the graphql-ws and the graphql-transport-ws subprotocols, e.g.
+// for Go consumers of subscriptions and integration tests.
+package graphqlwsclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+// ErrClosed is the error of the operations still running when the Client is
+// closed
+var ErrClosed = errors.New("graphqlwsclient: connection closed")
+
+// closeTimeout bounds the write of the close frame sent by Close
+const closeTimeout = time.Second
+
+// Client is a connection to a GraphQL over WebSocket server, acknowledged by
+// the server once Dial returns. It's safe for concurrent use.
+type Client struct {
+	url         string
+	dialer      *websocket.Dialer
+	header      http.Header
+	protocols   []string
+	initPayload interface{}
+	reconnect   *backoff
+	events      chan<- Event
+
+	nextID uint64
+
+	// ctx is cancelled once the Client is closed
+	ctx    context.Context
+	cancel func()
+
+	// writeMu serializes the writes to ws and guards replacing it, ws is nil
+	// while reconnecting
+	writeMu    sync.Mutex
+	ws         *websocket.Conn
+	protocol   string
+	extensions Extensions
+
+	mu   sync.Mutex
+	subs map[string]*Subscription
+	// err is the error the connection was closed with
+	err error
+}
+
+// Option configures a Client
+type Option func(c *Client)
+
+// Dialer sets the dialer the connection is opened with, the default is
+// websocket.DefaultDialer. Its subprotocols are replaced by the ones set with
+// Protocols.
+func Dialer(d *websocket.Dialer) Option {
+	return func(c *Client) {
+		c.dialer = d
+	}
+}
+
+// Header sets the header of the HTTP request opening the connection, e.g. to
+// authenticate it with a cookie
+func Header(header http.Header) Option {
+	return func(c *Client) {
+		c.header = header
+	}
+}
+
+// Protocols sets the subprotocols offered to the server in order of
+// preference, by default graphqlws.ProtocolGraphQLWS, with which the server
+// advertises its protocol extensions, then graphqlws.ProtocolGraphQLTransportWS
+func Protocols(protocols ...string) Option {
+	return func(c *Client) {
+		c.protocols = protocols
+	}
+}
+
+// InitPayload sets the payload of the connection_init message, marshaled to
+// JSON, e.g. to authenticate the connection with a token. The default is an
+// empty object.
+func InitPayload(payload interface{}) Option {
+	return func(c *Client) {
+		c.initPayload = payload
+	}
+}
+
+// Dial opens a connection to the server at url, a ws or wss URL, and waits
+// until the server acknowledges its connection_init. The returned error is an
+// *Error if the server rejected it with a connection_error.
+func Dial(ctx context.Context, url string, options ...Option) (*Client, error) {
+	c := &Client{
+		url:       url,
+		dialer:    websocket.DefaultDialer,
+		protocols: []string{graphqlws.ProtocolGraphQLWS, graphqlws.ProtocolGraphQLTransportWS},
+		subs:      map[string]*Subscription{},
+	}
+	for _, option := range options {
+		option(c)
+	}
+
+	ws, protocol, ext, err := c.connect(ctx, c.url)
+	if err != nil {
+		return nil, err
+	}
+	c.ws, c.protocol, c.extensions = ws, protocol, ext
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	go c.read(ws)
+	return c, nil
+}
+
+// Protocol returns the subprotocol spoken with the server
+func (c *Client) Protocol() string {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.protocol
+}
+
+// Extensions returns the protocol extensions the server advertised when the
+// connection was last acknowledged, servers only advertise them with
+// graphqlws.ProtocolGraphQLWS
+func (c *Client) Extensions() Extensions {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.extensions
+}
+
+// Extensions are the protocol extensions advertised by a server in the payload
+// of its connection_ack
+type Extensions struct {
+	// AckWindow is how many data messages may be unacknowledged, 0 if the
+	// server doesn't ask for acknowledgements
+	AckWindow int `json:"ackWindow,omitempty"`
+	// Batching tells that frames may carry arrays of messages
+	Batching bool `json:"batching"`
+	// Coalesce is the write coalescing window, in milliseconds
+	Coalesce int64 `json:"coalesce,omitempty"`
+	// Compression is the payload compression codec chosen by the server
+	Compression string `json:"compression,omitempty"`
+	// FlowControl tells that operations may be started with credits
+	FlowControl bool `json:"flowControl"`
+	// KeepAlive is the interval of the ka messages sent by the server, in
+	// milliseconds. The connection is deemed dropped once no message was
+	// received for twice that.
+	KeepAlive int64 `json:"keepAlive,omitempty"`
+	// PersistedQueries tells that operations may be started with the hash of
+	// their document
+	PersistedQueries bool `json:"persistedQueries,omitempty"`
+	// Resume tells that operations may be resumed from the last event received
+	Resume bool `json:"resume"`
+	// RTT is the interval of the round-trip time measurements, in milliseconds
+	RTT int64 `json:"rtt,omitempty"`
+	// Session is the token of the session the connection was saved as
+	Session string `json:"session,omitempty"`
+	// Steering tells where the client should connect
+	Steering *graphqlws.SteeringHints `json:"steering,omitempty"`
+}
+
+// keepAliveTolerance is how many keepalive intervals the connection may stay
+// silent before it's deemed dropped
+const keepAliveTolerance = 2
+
+// readTimeout returns how long the connection may stay silent, 0 if the server
+// doesn't send keepalive messages
+func (e Extensions) readTimeout() time.Duration {
+	return keepAliveTolerance * time.Duration(e.KeepAlive) * time.Millisecond
+}
+
+// message is a message of either subprotocol
+type message struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// connect opens a connection to url and waits until its connection_init is
+// acknowledged, it returns the subprotocol it speaks and the extensions
+// advertised by the server
+func (c *Client) connect(ctx context.Context, url string) (*websocket.Conn, string, Extensions, error) {
+	dialer := *c.dialer
+	dialer.Subprotocols = c.protocols
+	ws, _, err := dialer.DialContext(ctx, url, c.header)
+	if err != nil {
+		return nil, "", Extensions{}, err
+	}
+
+	protocol := ws.Subprotocol()
+	if protocol == "" {
+		// servers predating subprotocol negotiation only speak the legacy one
+		protocol = graphqlws.ProtocolGraphQLWS
+	}
+	ext, err := c.init(ctx, ws)
+	if err != nil {
+		ws.Close()
+		return nil, "", Extensions{}, err
+	}
+	return ws, protocol, ext, nil
+}
+
+// init sends the connection_init message on ws and reads messages until it's
+// acknowledged or ctx is done, it returns the extensions of the ack
+func (c *Client) init(ctx context.Context, ws *websocket.Conn) (Extensions, error) {
+	payload := c.initPayload
+	if payload == nil {
+		payload = struct{}{}
+	}
+	if err := writeMessage(ws, "", "connection_init", payload); err != nil {
+		return Extensions{}, err
+	}
+
+	// reads are interrupted once ctx is done
+	done, watched := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(watched)
+		select {
+		case <-ctx.Done():
+			ws.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	defer func() {
+		close(done)
+		<-watched
+		ws.SetReadDeadline(time.Time{})
+	}()
+
+	for {
+		msgs, err := readFrame(ws)
+		if err != nil {
+			if ctx.Err() != nil {
+				return Extensions{}, ctx.Err()
+			}
+			return Extensions{}, err
+		}
+
+		for _, msg := range msgs {
+			switch msg.Type {
+			case "connection_ack":
+				var ack struct {
+					Extensions Extensions `json:"extensions"`
+				}
+				// acks without extensions, or with a payload of another
+				// shape, advertise none
+				_ = json.Unmarshal(msg.Payload, &ack)
+				return ack.Extensions, nil
+			case "connection_error":
+				return Extensions{}, &Error{Payload: msg.Payload}
+			case "ping":
+				if err := writeMessage(ws, "", "pong", msg.Payload); err != nil {
+					return Extensions{}, err
+				}
+			}
+		}
+	}
+}
+
+// read dispatches the messages of the server to the subscriptions until the
+// connection is closed, or reestablishes it when it drops if the Client is
+// reconnecting. Connections silent for longer than the keepalive interval
+// allows are deemed dropped. Frames may carry arrays of messages, and data
+// payloads may be compressed, once the server was asked to in the payload of
+// the connection_init.
+func (c *Client) read(ws *websocket.Conn) {
+	ext := c.Extensions()
+	for {
+		if timeout := ext.readTimeout(); timeout > 0 {
+			ws.SetReadDeadline(time.Now().Add(timeout))
+		}
+		msgs, err := readFrame(ws)
+		if err != nil {
+			if c.reconnect == nil || c.ctx.Err() != nil {
+				c.closeWith(err)
+				return
+			}
+			if ws = c.reestablish(ws, err); ws == nil {
+				return
+			}
+			ext = c.Extensions()
+			continue
+		}
+
+		for _, msg := range msgs {
+			c.handle(ext, msg)
+		}
+	}
+}
+
+// handle dispatches a message of the server to its subscription
+func (c *Client) handle(ext Extensions, msg message) {
+	switch msg.Type {
+	case "data", "next":
+		s := c.subscription(msg.ID)
+		if s == nil {
+			return
+		}
+		payload, err := decompress(ext.Compression, msg.Payload)
+		if err != nil {
+			// the operation fails with the payloads it can't read
+			if c.remove(msg.ID) != nil {
+				c.send(msg.ID, "stop", nil)
+			}
+			s.finish(err)
+			return
+		}
+		s.deliver(payload)
+	case "error":
+		// with graphql-ws the error is followed by a complete message, which
+		// is ignored once the subscription is removed
+		if s := c.remove(msg.ID); s != nil {
+			s.finish(&Error{Payload: msg.Payload})
+		}
+	case "complete":
+		if s := c.remove(msg.ID); s != nil {
+			s.finish(nil)
+		}
+	case "ping":
+		c.send("", "pong", msg.Payload)
+	}
+}
+
+// errDisconnected is the error of the messages sent while reconnecting
+var errDisconnected = errors.New("graphqlwsclient: disconnected")
+
+// transportTypes are the types of the graphql-transport-ws messages sent for
+// the graphql-ws ones, the messages without a counterpart aren't sent
+var transportTypes = map[string]string{
+	"start": "subscribe",
+	"stop":  "complete",
+	"pong":  "pong",
+}
+
+// send sends a message of the graphql-ws type msgType, translated to the
+// subprotocol spoken with the server
+func (c *Client) send(id string, msgType string, payload interface{}) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.write(id, msgType, payload)
+}
+
+// write is send with writeMu held
+func (c *Client) write(id string, msgType string, payload interface{}) error {
+	if c.ws == nil {
+		return errDisconnected
+	}
+	if c.protocol == graphqlws.ProtocolGraphQLTransportWS {
+		var ok bool
+		if msgType, ok = transportTypes[msgType]; !ok {
+			return nil
+		}
+	}
+	return writeMessage(c.ws, id, msgType, payload)
+}
+
+func writeMessage(ws *websocket.Conn, id string, msgType string, payload interface{}) error {
+	msg := message{ID: id, Type: msgType}
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		msg.Payload = b
+	}
+	return ws.WriteJSON(&msg)
+}
+
+// Request is a GraphQL request
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+// Subscribe starts an operation, usually a subscription. It's stopped when
+// ctx is done.
+func (c *Client) Subscribe(ctx context.Context, req Request) (*Subscription, error) {
+	payloads := make(chan json.RawMessage)
+	s := &Subscription{
+		C:        payloads,
+		c:        c,
+		id:       strconv.FormatUint(atomic.AddUint64(&c.nextID, 1), 10),
+		req:      req,
+		payloads: payloads,
+		done:     make(chan struct{}),
+	}
+
+	// the operation is registered and started under writeMu, so that it's
+	// started exactly once when the connection is reestablished meanwhile
+	c.writeMu.Lock()
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		c.writeMu.Unlock()
+		return nil, c.err
+	}
+	c.subs[s.id] = s
+	c.mu.Unlock()
+
+	// while reconnecting, the operation is started once reconnected
+	err := c.write(s.id, "start", req)
+	c.writeMu.Unlock()
+	if err != nil && c.reconnect == nil {
+		c.remove(s.id)
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.Stop()
+		case <-s.done:
+		}
+	}()
+	return s, nil
+}
+
+// Execute runs a query or a mutation over the connection, it returns the
+// payload of its result, e.g. {"data":{...}}
+func (c *Client) Execute(ctx context.Context, req Request) (json.RawMessage, error) {
+	s, err := c.Subscribe(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Stop()
+
+	var result json.RawMessage
+	for payload := range s.C {
+		result = payload
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Close closes the connection, the running operations end with ErrClosed.
+// A reconnecting Client stops reconnecting.
+func (c *Client) Close() error {
+	if !c.closeWith(ErrClosed) {
+		return nil
+	}
+
+	c.cancel()
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.ws == nil {
+		return nil
+	}
+	c.write("", "connection_terminate", nil)
+	c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(closeTimeout))
+	return c.ws.Close()
+}
+
+// closeWith ends the running operations with err, it returns false if the
+// connection already was closed
+func (c *Client) closeWith(err error) bool {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return false
+	}
+	c.err = err
+	subs := c.subs
+	c.subs = nil
+	c.mu.Unlock()
+
+	for _, s := range subs {
+		s.finish(err)
+	}
+	return true
+}
+
+func (c *Client) subscription(id string) *Subscription {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.subs[id]
+}
+
+// remove unregisters the subscription id, it returns nil if it isn't running
+func (c *Client) remove(id string) *Subscription {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.subs[id]
+	delete(c.subs, id)
+	return s
+}
+
+// Subscription is an operation started with Subscribe
+type Subscription struct {
+	// C receives the payloads of the results of the operation, e.g.
+	// {"data":{...}}, it's closed once the operation is done. The connection
+	// isn't read while a payload isn't received.
+	C <-chan json.RawMessage
+
+	c        *Client
+	id       string
+	req      Request
+	payloads chan json.RawMessage
+	done     chan struct{}
+	// sendMu guards closing payloads against the reader sending on it
+	sendMu sync.Mutex
+
+	once sync.Once
+	err  error
+}
+
+// ID returns the id of the operation
+func (s *Subscription) ID() string {
+	return s.id
+}
+
+// Stop stops the operation, C is closed without an error
+func (s *Subscription) Stop() {
+	if s.c.remove(s.id) != nil {
+		s.c.send(s.id, "stop", nil)
+	}
+	s.finish(nil)
+}
+
+// Err returns the error the operation failed with once C is closed, an *Error
+// if the server reported one, nil if it completed or was stopped
+func (s *Subscription) Err() error {
+	select {
+	case <-s.done:
+		return s.err
+	default:
+		return nil
+	}
+}
+
+func (s *Subscription) deliver(payload json.RawMessage) {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	select {
+	case s.payloads <- payload:
+	case <-s.done:
+	}
+}
+
+func (s *Subscription) finish(err error) {
+	s.once.Do(func() {
+		s.err = err
+		close(s.done)
+
+		// done unblocks the reader if it's delivering a payload
+		s.sendMu.Lock()
+		close(s.payloads)
+		s.sendMu.Unlock()
+	})
+}
+
+// Error is an error reported by the server, either the error of an operation
+// or the connection_error rejecting the connection
+type Error struct {
+	// Payload is the payload of the message, an error object or, with
+	// graphql-transport-ws, a list of them
+	Payload json.RawMessage
+}
+
+func (e *Error) Error() string {
+	var errs []struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(e.Payload, &errs) != nil {
+		var one struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(e.Payload, &one) == nil && one.Message != "" {
+			errs = append(errs, one)
+		}
+	}
+
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, err.Message)
+	}
+	if len(messages) == 0 {
+		return "graphqlwsclient: " + string(e.Payload)
+	}
+	return "graphqlwsclient: " + strings.Join(messages, "; ")
+}
@@ -0,0 +1,247 @@
+package graphqlwsclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/compression"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwsclient"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+)
+
+type authValidator struct{}
+
+func (authValidator) CheckAuth(r *http.Request, ctx context.Context) (context.Context, error) {
+	return ctx, nil
+}
+
+func newServer(t *testing.T, options ...graphqlws.Option) string {
+	svc := graphqlwstest.NewMockService().
+		On("ticks", graphqlwstest.Data(1), graphqlwstest.Data(2), graphqlwstest.Complete()).
+		On("forever", graphqlwstest.Data(1)).
+		On("query", graphqlwstest.Data(map[string]int{"answer": 42}), graphqlwstest.Complete()).
+		FailSubscribe("fails", errors.New("boom"))
+	srv := httptest.NewServer(graphqlws.NewServer(context.Background(), svc, http.NotFoundHandler(), authValidator{}, options...))
+	t.Cleanup(srv.Close)
+	return "ws" + strings.TrimPrefix(srv.URL, "http")
+}
+
+func dial(t *testing.T, url string, protocol string, options ...graphqlwsclient.Option) *graphqlwsclient.Client {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c, err := graphqlwsclient.Dial(ctx, url, append(options, graphqlwsclient.Protocols(protocol))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	if c.Protocol() != protocol {
+		t.Fatalf("expected %s but instead got %s", protocol, c.Protocol())
+	}
+	return c
+}
+
+// receive returns the payloads of s until C is closed
+func receive(t *testing.T, s *graphqlwsclient.Subscription) []string {
+	t.Helper()
+	var got []string
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case payload, ok := <-s.C:
+			if !ok {
+				return got
+			}
+			got = append(got, string(payload))
+		case <-timeout:
+			t.Fatalf("expected the subscription to be done but instead got %v", got)
+		}
+	}
+}
+
+var protocols = []string{graphqlws.ProtocolGraphQLWS, graphqlws.ProtocolGraphQLTransportWS}
+
+func TestClient(t *testing.T) {
+	url := newServer(t)
+	for _, protocol := range protocols {
+		t.Run(protocol, func(t *testing.T) {
+			c := dial(t, url, protocol)
+
+			s, err := c.Subscribe(context.Background(), graphqlwsclient.Request{Query: "subscription ticks { tick }", OperationName: "ticks"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.Join(receive(t, s), ","); got != `{"data":1},{"data":2}` {
+				t.Fatalf("expected the two ticks but instead got %s", got)
+			}
+			if err := s.Err(); err != nil {
+				t.Fatalf("expected no error but instead got %v", err)
+			}
+
+			result, err := c.Execute(context.Background(), graphqlwsclient.Request{Query: "query { answer }", OperationName: "query"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(result) != `{"data":{"answer":42}}` {
+				t.Fatalf("expected the answer but instead got %s", result)
+			}
+
+			s, err = c.Subscribe(context.Background(), graphqlwsclient.Request{Query: "subscription fails { tick }", OperationName: "fails"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := receive(t, s); len(got) != 0 {
+				t.Fatalf("expected no payload but instead got %v", got)
+			}
+			var gqlErr *graphqlwsclient.Error
+			if !errors.As(s.Err(), &gqlErr) || gqlErr.Error() != "graphqlwsclient: boom" {
+				t.Fatalf("expected boom but instead got %v", s.Err())
+			}
+		})
+	}
+}
+
+func TestClientStop(t *testing.T) {
+	url := newServer(t)
+	for _, protocol := range protocols {
+		t.Run(protocol, func(t *testing.T) {
+			c := dial(t, url, protocol)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			s, err := c.Subscribe(ctx, graphqlwsclient.Request{Query: "subscription forever { tick }", OperationName: "forever"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if payload := <-s.C; string(payload) != `{"data":1}` {
+				t.Fatalf("expected a tick but instead got %s", payload)
+			}
+			cancel()
+			receive(t, s)
+			if err := s.Err(); err != nil {
+				t.Fatalf("expected no error but instead got %v", err)
+			}
+
+			// the connection is still usable
+			if _, err := c.Execute(context.Background(), graphqlwsclient.Request{Query: "query { answer }", OperationName: "query"}); err != nil {
+				t.Fatal(err)
+			}
+
+			s, err = c.Subscribe(context.Background(), graphqlwsclient.Request{Query: "subscription forever { tick }", OperationName: "forever"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			<-s.C
+			c.Close()
+			receive(t, s)
+			if err := s.Err(); err != graphqlwsclient.ErrClosed {
+				t.Fatalf("expected %v but instead got %v", graphqlwsclient.ErrClosed, err)
+			}
+			if _, err := c.Subscribe(context.Background(), graphqlwsclient.Request{Query: "subscription forever { tick }"}); err != graphqlwsclient.ErrClosed {
+				t.Fatalf("expected %v but instead got %v", graphqlwsclient.ErrClosed, err)
+			}
+		})
+	}
+}
+
+func TestClientInitPayload(t *testing.T) {
+	url := newServer(t, graphqlws.WithConnectionInitHandler(func(ctx context.Context, payload json.RawMessage) (context.Context, error) {
+		if string(payload) != `{"token":"secret"}` {
+			return nil, errors.New("invalid token")
+		}
+		return ctx, nil
+	}))
+
+	dial(t, url, graphqlws.ProtocolGraphQLWS, graphqlwsclient.InitPayload(map[string]string{"token": "secret"}))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := graphqlwsclient.Dial(ctx, url, graphqlwsclient.Protocols(graphqlws.ProtocolGraphQLWS), graphqlwsclient.InitPayload(map[string]string{"token": "guess"}))
+	var gqlErr *graphqlwsclient.Error
+	if !errors.As(err, &gqlErr) || gqlErr.Error() != "graphqlwsclient: invalid token" {
+		t.Fatalf("expected invalid token but instead got %v", err)
+	}
+}
+
+func TestClientExtensions(t *testing.T) {
+	url := newServer(t, graphqlws.WithKeepAlive(time.Hour))
+
+	ext := dial(t, url, graphqlws.ProtocolGraphQLWS).Extensions()
+	if !ext.Batching || !ext.FlowControl || ext.KeepAlive != time.Hour.Milliseconds() {
+		t.Fatalf("expected the extensions of the server but instead got %+v", ext)
+	}
+	// they're only advertised with graphql-ws
+	if ext := dial(t, url, graphqlws.ProtocolGraphQLTransportWS).Extensions(); ext != (graphqlwsclient.Extensions{}) {
+		t.Fatalf("expected no extension but instead got %+v", ext)
+	}
+}
+
+func TestClientFrames(t *testing.T) {
+	codec, err := compression.Zstd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := newServer(t, graphqlws.WithWriteCoalescing(100*time.Millisecond), graphqlws.WithCompression(0, codec))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// the server only batches and compresses with graphql-ws, spoken by default
+	c, err := graphqlwsclient.Dial(ctx, url, graphqlwsclient.InitPayload(map[string]interface{}{"coalesce": true, "compression": []string{"zstd"}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if ext := c.Extensions(); c.Protocol() != graphqlws.ProtocolGraphQLWS || ext.Coalesce != 100 || ext.Compression != "zstd" {
+		t.Fatalf("expected coalescing and compression with graphql-ws but instead got %s %+v", c.Protocol(), ext)
+	}
+
+	s, err := c.Subscribe(ctx, graphqlwsclient.Request{Query: "subscription ticks { tick }", OperationName: "ticks"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(receive(t, s), ","); got != `{"data":1},{"data":2}` {
+		t.Fatalf("expected the two ticks but instead got %s", got)
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("expected no error but instead got %v", err)
+	}
+}
+
+func TestClientKeepAlive(t *testing.T) {
+	// the server advertises a keepalive interval, but then goes silent
+	upgrader := websocket.Upgrader{Subprotocols: []string{graphqlws.ProtocolGraphQLWS}}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		ws.ReadMessage()
+		ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"connection_ack","payload":{"extensions":{"keepAlive":20}}}`))
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	c := dial(t, "ws"+strings.TrimPrefix(srv.URL, "http"), graphqlws.ProtocolGraphQLWS)
+	s, err := c.Subscribe(context.Background(), graphqlwsclient.Request{Query: "subscription { tick }"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	receive(t, s)
+	if s.Err() == nil {
+		t.Fatal("expected the connection to be deemed dropped")
+	}
+}
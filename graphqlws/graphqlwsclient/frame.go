@@ -0,0 +1,81 @@
+package graphqlwsclient
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/klauspost/compress/zstd"
+)
+
+// readFrame reads a frame from ws, it returns the messages it carries: a
+// single one, or an array of them once the server coalesces its writes
+func readFrame(ws *websocket.Conn) ([]message, error) {
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+
+	data = bytes.TrimLeft(data, " \t\r\n")
+	if len(data) > 0 && data[0] == '[' {
+		var msgs []message
+		if err := json.Unmarshal(data, &msgs); err != nil {
+			return nil, err
+		}
+		return msgs, nil
+	}
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	return []message{msg}, nil
+}
+
+// decompress returns the payload of a data message sent by a server
+// compressing them with codec, compressed payloads being base64 encoded JSON
+// strings while the others are sent as they are
+func decompress(codec string, payload json.RawMessage) (json.RawMessage, error) {
+	if codec == "" || len(payload) == 0 || payload[0] != '"' {
+		return payload, nil
+	}
+
+	var encoded string
+	if err := json.Unmarshal(payload, &encoded); err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	switch codec {
+	case "deflate":
+		return io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	case "zstd":
+		decoder, err := zstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+		return decoder.DecodeAll(data, nil)
+	}
+	return nil, fmt.Errorf("graphqlwsclient: unsupported compression %q", codec)
+}
+
+var (
+	zstdOnce sync.Once
+	zstdDec  *zstd.Decoder
+	zstdErr  error
+)
+
+// zstdDecoder returns the decoder shared by the clients, created once needed
+func zstdDecoder() (*zstd.Decoder, error) {
+	zstdOnce.Do(func() {
+		zstdDec, zstdErr = zstd.NewReader(nil)
+	})
+	return zstdDec, zstdErr
+}
@@ -0,0 +1,180 @@
+package graphqlwsclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+// reconnectTimeout bounds each attempt to reestablish the connection, from
+// dialing until the connection_init is acknowledged
+const reconnectTimeout = 10 * time.Second
+
+// Reconnect makes the Client reestablish the connection when it drops: it
+// redials the server, or the reconnect URL of the steering hints the server
+// sent, sends the connection_init again and restarts the running operations,
+// whose C channels stay open meanwhile. Attempts are delayed by an
+// exponential backoff from min to max, with jitter so that the clients of a
+// restarting server don't all reconnect at once. The Client gives up if the
+// server rejects the connection_init.
+func Reconnect(min, max time.Duration) Option {
+	return func(c *Client) {
+		c.reconnect = &backoff{min: min, max: max}
+	}
+}
+
+// Events sets the channel a reconnecting Client sends an Event on whenever
+// the connection drops or is reestablished, e.g. to show its connectivity.
+// Events aren't sent while the channel is full.
+func Events(events chan<- Event) Option {
+	return func(c *Client) {
+		c.events = events
+	}
+}
+
+// Event is a change of the connectivity of a reconnecting Client
+type Event struct {
+	// Connected is false when the connection dropped or an attempt to
+	// reestablish it failed, true once it's reestablished
+	Connected bool
+	// Attempt counts the attempts to reestablish the connection since it
+	// dropped, 0 when it just dropped
+	Attempt int
+	// Err is the error the connection dropped with or the attempt failed with
+	Err error
+}
+
+// backoff is the delay between the attempts to reestablish the connection
+type backoff struct {
+	min, max time.Duration
+}
+
+// delay returns the delay before attempt, a random one between half and all of
+// min doubled at each attempt, up to max
+func (b *backoff) delay(attempt int) time.Duration {
+	d := b.max
+	if attempt < 32 && b.min<<uint(attempt-1) < b.max {
+		d = b.min << uint(attempt-1)
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// reestablish reconnects once ws dropped with err, it returns the new
+// connection or nil once the Client is closed or gave up. The first attempt
+// honors the steering hints of the server, if any, see steeredURL.
+func (c *Client) reestablish(ws *websocket.Conn, err error) *websocket.Conn {
+	url := c.steeredURL(err)
+	c.writeMu.Lock()
+	c.ws = nil
+	c.writeMu.Unlock()
+	ws.Close()
+	c.emit(Event{Err: err})
+
+	for attempt := 1; ; attempt++ {
+		timer := time.NewTimer(c.reconnect.delay(attempt))
+		select {
+		case <-timer.C:
+		case <-c.ctx.Done():
+			timer.Stop()
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(c.ctx, reconnectTimeout)
+		ws, protocol, ext, err := c.connect(ctx, url)
+		cancel()
+		if c.ctx.Err() != nil {
+			if ws != nil {
+				ws.Close()
+			}
+			return nil
+		}
+		if err != nil {
+			c.emit(Event{Attempt: attempt, Err: err})
+			// the steered URL may not be reachable
+			url = c.url
+			var rejected *Error
+			if errors.As(err, &rejected) {
+				c.closeWith(err)
+				return nil
+			}
+			continue
+		}
+
+		if !c.resubscribe(ws, protocol, ext) {
+			ws.Close()
+			return nil
+		}
+		c.emit(Event{Connected: true, Attempt: attempt})
+		return ws
+	}
+}
+
+// steeredURL returns the URL to reconnect to once the connection dropped with
+// err: the reconnect URL of the steering hints sent by the server in the 1012
+// (service restart) close frame, or else in the connection_ack, if any, the URL
+// the Client was dialed with otherwise
+func (c *Client) steeredURL(err error) string {
+	hints := c.Extensions().Steering
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) && closeErr.Code == websocket.CloseServiceRestart {
+		var closeHints graphqlws.SteeringHints
+		if json.Unmarshal([]byte(closeErr.Text), &closeHints) == nil {
+			hints = &closeHints
+		}
+	}
+	if hints != nil && hints.ReconnectURL != "" {
+		return hints.ReconnectURL
+	}
+	return c.url
+}
+
+// resubscribe makes ws the connection of the Client and restarts the running
+// operations on it, it returns false if the Client was closed meanwhile
+func (c *Client) resubscribe(ws *websocket.Conn, protocol string, ext Extensions) bool {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.ctx.Err() != nil {
+		return false
+	}
+	c.ws, c.protocol, c.extensions = ws, protocol, ext
+
+	c.mu.Lock()
+	subs := make([]*Subscription, 0, len(c.subs))
+	for _, s := range c.subs {
+		subs = append(subs, s)
+	}
+	c.mu.Unlock()
+
+	// operations are restarted in the order they were started
+	sort.Slice(subs, func(i, j int) bool {
+		a, _ := strconv.ParseUint(subs[i].id, 10, 64)
+		b, _ := strconv.ParseUint(subs[j].id, 10, 64)
+		return a < b
+	})
+	for _, s := range subs {
+		// a failed write drops the connection, which is then reestablished
+		// again
+		if c.write(s.id, "start", s.req) != nil {
+			break
+		}
+	}
+	return true
+}
+
+func (c *Client) emit(e Event) {
+	if c.events == nil {
+		return
+	}
+	select {
+	case c.events <- e:
+	default:
+	}
+}
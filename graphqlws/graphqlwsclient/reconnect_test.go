@@ -0,0 +1,217 @@
+package graphqlwsclient_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwsclient"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+)
+
+// droppingListener records the connections it accepts so that they can be
+// dropped
+type droppingListener struct {
+	net.Listener
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (l *droppingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.conns = append(l.conns, conn)
+		l.mu.Unlock()
+	}
+	return conn, err
+}
+
+func (l *droppingListener) drop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, conn := range l.conns {
+		conn.Close()
+	}
+	l.conns = nil
+}
+
+// nextEvent returns the next event sent on events
+func nextEvent(t *testing.T, events <-chan graphqlwsclient.Event) graphqlwsclient.Event {
+	t.Helper()
+	select {
+	case e := <-events:
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an event")
+		return graphqlwsclient.Event{}
+	}
+}
+
+func TestClientReconnect(t *testing.T) {
+	svc := graphqlwstest.NewMockService().On("forever", graphqlwstest.Data(1))
+	srv := httptest.NewUnstartedServer(graphqlws.NewServer(context.Background(), svc, http.NotFoundHandler(), authValidator{}))
+	l := &droppingListener{Listener: srv.Listener}
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	for _, protocol := range protocols {
+		t.Run(protocol, func(t *testing.T) {
+			events := make(chan graphqlwsclient.Event, 8)
+			c := dial(t, url, protocol,
+				graphqlwsclient.Reconnect(time.Millisecond, 10*time.Millisecond),
+				graphqlwsclient.Events(events),
+			)
+
+			s, err := c.Subscribe(context.Background(), graphqlwsclient.Request{Query: "subscription forever { tick }", OperationName: "forever"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if payload := <-s.C; string(payload) != `{"data":1}` {
+				t.Fatalf("expected a tick but instead got %s", payload)
+			}
+
+			l.drop()
+			if e := nextEvent(t, events); e.Connected || e.Attempt != 0 || e.Err == nil {
+				t.Fatalf("expected a disconnection but instead got %+v", e)
+			}
+			if e := nextEvent(t, events); !e.Connected || e.Attempt != 1 {
+				t.Fatalf("expected a reconnection but instead got %+v", e)
+			}
+
+			// the subscription is restarted on the new connection
+			select {
+			case payload := <-s.C:
+				if string(payload) != `{"data":1}` {
+					t.Fatalf("expected a tick but instead got %s", payload)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("expected the subscription to be restarted")
+			}
+			if _, err := c.Subscribe(context.Background(), graphqlwsclient.Request{Query: "subscription forever { tick }", OperationName: "forever"}); err != nil {
+				t.Fatal(err)
+			}
+
+			c.Close()
+			receive(t, s)
+			if err := s.Err(); err != graphqlwsclient.ErrClosed {
+				t.Fatalf("expected %v but instead got %v", graphqlwsclient.ErrClosed, err)
+			}
+		})
+	}
+}
+
+func TestClientReconnectRejected(t *testing.T) {
+	var mu sync.Mutex
+	rejected := false
+	svc := graphqlwstest.NewMockService().On("forever", graphqlwstest.Data(1))
+	srv := httptest.NewUnstartedServer(graphqlws.NewServer(context.Background(), svc, http.NotFoundHandler(), authValidator{},
+		graphqlws.WithConnectionInitHandler(func(ctx context.Context, payload json.RawMessage) (context.Context, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if rejected {
+				return nil, errors.New("token expired")
+			}
+			return ctx, nil
+		}),
+	))
+	l := &droppingListener{Listener: srv.Listener}
+	srv.Listener = l
+	srv.Start()
+	defer srv.Close()
+
+	events := make(chan graphqlwsclient.Event, 8)
+	c := dial(t, "ws"+strings.TrimPrefix(srv.URL, "http"), graphqlws.ProtocolGraphQLWS,
+		graphqlwsclient.Reconnect(time.Millisecond, 10*time.Millisecond),
+		graphqlwsclient.Events(events),
+	)
+	s, err := c.Subscribe(context.Background(), graphqlwsclient.Request{Query: "subscription forever { tick }", OperationName: "forever"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-s.C
+
+	mu.Lock()
+	rejected = true
+	mu.Unlock()
+	l.drop()
+
+	nextEvent(t, events)
+	var gqlErr *graphqlwsclient.Error
+	if e := nextEvent(t, events); e.Connected || !errors.As(e.Err, &gqlErr) {
+		t.Fatalf("expected the reconnection to be rejected but instead got %+v", e)
+	}
+	receive(t, s)
+	if !errors.As(s.Err(), &gqlErr) {
+		t.Fatalf("expected the subscription to end with the rejection but instead got %v", s.Err())
+	}
+}
+
+func TestClientReconnectSteering(t *testing.T) {
+	svc := graphqlwstest.NewMockService().On("forever", graphqlwstest.Data(1))
+	target := graphqlws.NewServer(context.Background(), svc, http.NotFoundHandler(), authValidator{})
+	targetSrv := httptest.NewServer(target)
+	defer targetSrv.Close()
+	hints := &graphqlws.SteeringHints{ReconnectURL: "ws" + strings.TrimPrefix(targetSrv.URL, "http")}
+
+	for _, protocol := range protocols {
+		t.Run(protocol, func(t *testing.T) {
+			shutdownCtx, shutdown := context.WithCancel(context.Background())
+			defer shutdown()
+			srv := httptest.NewServer(graphqlws.NewServer(shutdownCtx, svc, http.NotFoundHandler(), authValidator{},
+				graphqlws.WithSteeringHints(func(ctx context.Context) *graphqlws.SteeringHints { return hints }),
+			))
+			defer srv.Close()
+
+			events := make(chan graphqlwsclient.Event, 8)
+			c := dial(t, "ws"+strings.TrimPrefix(srv.URL, "http"), protocol,
+				graphqlwsclient.Reconnect(time.Millisecond, 10*time.Millisecond),
+				graphqlwsclient.Events(events),
+			)
+			s, err := c.Subscribe(context.Background(), graphqlwsclient.Request{Query: "subscription forever { tick }", OperationName: "forever"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			<-s.C
+
+			// the hints are sent in the close frame with both protocols
+			shutdown()
+			nextEvent(t, events)
+			if e := nextEvent(t, events); !e.Connected {
+				t.Fatalf("expected a reconnection but instead got %+v", e)
+			}
+			select {
+			case <-s.C:
+			case <-time.After(5 * time.Second):
+				t.Fatal("expected the subscription to be restarted")
+			}
+			if n := target.ConnectionCount(); n != 1 {
+				t.Fatalf("expected the client to reconnect to the target but instead got %d connections", n)
+			}
+			c.Close()
+			waitConnectionCount(t, target, 0)
+		})
+	}
+}
+
+func waitConnectionCount(t *testing.T, s *graphqlws.Server, expected int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.ConnectionCount() != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d connections but instead got %d", expected, s.ConnectionCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,284 @@
+package graphqlwstest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+// Received is an operation message received by a Client
+type Received struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Client is a graphql-ws client for tests, recording the messages it receives
+// by operation id and failing the test when an assertion isn't met in time
+type Client struct {
+	tb  testing.TB
+	ws  *websocket.Conn
+	url string
+
+	mu       sync.Mutex
+	received map[string][]Received
+	closeErr error
+	// changed is closed and replaced whenever a message is received or the
+	// connection closed
+	changed chan struct{}
+}
+
+// Dial connects a Client to the graphql-ws endpoint at url, an http or ws URL,
+// it's closed when the test ends
+func Dial(tb testing.TB, url string, header http.Header) *Client {
+	tb.Helper()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+	ws, _, err := dialer.Dial("ws"+trimScheme(url), header)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	c := &Client{
+		tb:       tb,
+		ws:       ws,
+		url:      url,
+		received: map[string][]Received{},
+		changed:  make(chan struct{}),
+	}
+	tb.Cleanup(func() { ws.Close() })
+	go c.read()
+	return c
+}
+
+// trimScheme returns url without its http or ws prefix
+func trimScheme(url string) string {
+	for _, scheme := range []string{"http", "ws"} {
+		if len(url) > len(scheme) && url[:len(scheme)] == scheme {
+			return url[len(scheme):]
+		}
+	}
+	return url
+}
+
+func (c *Client) read() {
+	for {
+		_, data, err := c.ws.ReadMessage()
+
+		c.mu.Lock()
+		if err != nil {
+			c.closeErr = err
+		} else {
+			var msg Received
+			if json.Unmarshal(data, &msg) == nil {
+				c.received[msg.ID] = append(c.received[msg.ID], msg)
+			}
+		}
+		close(c.changed)
+		c.changed = make(chan struct{})
+		c.mu.Unlock()
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Send sends an operation message
+func (c *Client) Send(id string, msgType string, payload interface{}) {
+	c.tb.Helper()
+
+	msg := map[string]interface{}{"type": msgType}
+	if id != "" {
+		msg["id"] = id
+	}
+	if payload != nil {
+		msg["payload"] = payload
+	}
+	if err := c.ws.WriteJSON(msg); err != nil {
+		c.tb.Fatal(err)
+	}
+}
+
+// Init sends connection_init with payload and waits for the connection_ack
+func (c *Client) Init(payload interface{}) {
+	c.tb.Helper()
+
+	if payload == nil {
+		payload = struct{}{}
+	}
+	c.Send("", "connection_init", payload)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.wait(ctx, "connection_ack", func() bool {
+		for _, msg := range c.received[""] {
+			if msg.Type == "connection_ack" {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Start starts the operation id
+func (c *Client) Start(id string, query string, operationName string, variables map[string]interface{}) {
+	c.tb.Helper()
+	c.Send(id, "start", map[string]interface{}{
+		"query":         query,
+		"operationName": operationName,
+		"variables":     variables,
+	})
+}
+
+// Stop stops the operation id
+func (c *Client) Stop(id string) {
+	c.tb.Helper()
+	c.Send(id, "stop", nil)
+}
+
+// Messages returns the messages received so far for the operation id, "" for
+// the ones of the connection, e.g. connection_ack or ka
+func (c *Client) Messages(id string) []Received {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Received(nil), c.received[id]...)
+}
+
+// JSONEq returns a matcher of payloads equal to expected as JSON values, for
+// ReceivedDataMatching
+func JSONEq(expected string) func(payload json.RawMessage) bool {
+	return func(payload json.RawMessage) bool {
+		return equalJSON([]byte(expected), payload)
+	}
+}
+
+// ReceivedDataMatching waits until a data message matching match is received
+// for the operation id and returns it, failing the test if ctx is done first
+func (c *Client) ReceivedDataMatching(ctx context.Context, id string, match func(payload json.RawMessage) bool) Received {
+	c.tb.Helper()
+
+	var found Received
+	c.wait(ctx, "data matching for operation "+id, func() bool {
+		for _, msg := range c.received[id] {
+			if msg.Type == "data" && match(msg.Payload) {
+				found = msg
+				return true
+			}
+		}
+		return false
+	})
+	return found
+}
+
+// CompletedWithin waits up to d for the operation id to complete, failing
+// the test otherwise
+func (c *Client) CompletedWithin(id string, d time.Duration) {
+	c.tb.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	c.wait(ctx, "completion of operation "+id, func() bool {
+		for _, msg := range c.received[id] {
+			if msg.Type == "complete" {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// ClosedWithCode waits for the server to close the connection with the
+// websocket close code, failing the test if ctx is done first or it's closed
+// with another one
+func (c *Client) ClosedWithCode(ctx context.Context, code int) {
+	c.tb.Helper()
+
+	c.wait(ctx, "close", func() bool {
+		return c.closeErr != nil
+	})
+
+	c.mu.Lock()
+	err := c.closeErr
+	c.mu.Unlock()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != code {
+		c.tb.Fatalf("expected the connection to be closed with code %d but instead got %v", code, err)
+	}
+}
+
+// wait waits until done, called with mu held, returns true, failing the test
+// if ctx is done first
+func (c *Client) wait(ctx context.Context, what string, done func() bool) {
+	c.tb.Helper()
+
+	for {
+		c.mu.Lock()
+		ok := done()
+		changed := c.changed
+		closed := c.closeErr != nil
+		c.mu.Unlock()
+		if ok {
+			return
+		}
+		if closed {
+			c.tb.Fatalf("expected %s but instead the connection was closed", what)
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			c.tb.Fatalf("expected %s but instead got %v", what, ctx.Err())
+		}
+	}
+}
+
+// SteeringHints returns the steering hints sent by the server, in the close
+// frame if the connection was closed with them or else in the connection_ack
+// payload, false if there are none
+func (c *Client) SteeringHints() (graphqlws.SteeringHints, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var hints graphqlws.SteeringHints
+	var closeErr *websocket.CloseError
+	if errors.As(c.closeErr, &closeErr) && closeErr.Code == websocket.CloseServiceRestart && json.Unmarshal([]byte(closeErr.Text), &hints) == nil {
+		return hints, true
+	}
+
+	for _, msg := range c.received[""] {
+		if msg.Type != "connection_ack" {
+			continue
+		}
+		var ack struct {
+			Extensions struct {
+				Steering *graphqlws.SteeringHints `json:"steering"`
+			} `json:"extensions"`
+		}
+		if json.Unmarshal(msg.Payload, &ack) == nil && ack.Extensions.Steering != nil {
+			return *ack.Extensions.Steering, true
+		}
+	}
+	return hints, false
+}
+
+// Reconnect dials a new Client, honoring the steering hints of the server: it
+// connects to their reconnect URL if any, to the URL c was dialed with
+// otherwise
+func (c *Client) Reconnect(header http.Header) *Client {
+	c.tb.Helper()
+
+	url := c.url
+	if hints, ok := c.SteeringHints(); ok && hints.ReconnectURL != "" {
+		url = hints.ReconnectURL
+	}
+	return Dial(c.tb, url, header)
+}
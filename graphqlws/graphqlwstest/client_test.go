@@ -0,0 +1,73 @@
+package graphqlwstest_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+)
+
+func TestClient(t *testing.T) {
+	svc := graphqlwstest.NewMockService().On("onMessage",
+		graphqlwstest.Data(map[string]string{"message": "a"}),
+		graphqlwstest.Data(map[string]string{"message": "b"}),
+		graphqlwstest.Complete(),
+	)
+	srv := httptest.NewServer(graphqlws.NewServer(context.Background(), svc, http.NotFoundHandler(), authValidator{}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c := graphqlwstest.Dial(t, srv.URL, nil)
+	c.Init(nil)
+	c.Start("1", "subscription onMessage { message }", "onMessage", nil)
+	c.ReceivedDataMatching(ctx, "1", graphqlwstest.JSONEq(`{"data":{"message":"b"}}`))
+	c.CompletedWithin("1", 5*time.Second)
+	if n := len(c.Messages("1")); n != 3 {
+		t.Fatalf("expected 3 messages but instead got %d", n)
+	}
+
+	c.Send("", "connection_terminate", nil)
+	c.ClosedWithCode(ctx, websocket.CloseAbnormalClosure)
+}
+
+func TestClientReconnectSteering(t *testing.T) {
+	target := graphqlws.NewServer(context.Background(), graphqlwstest.NewMockService(), http.NotFoundHandler(), authValidator{})
+	targetSrv := httptest.NewServer(target)
+	defer targetSrv.Close()
+
+	shutdownCtx, shutdown := context.WithCancel(context.Background())
+	defer shutdown()
+	hints := &graphqlws.SteeringHints{Region: "eu-west-1", ReconnectURL: targetSrv.URL}
+	srv := httptest.NewServer(graphqlws.NewServer(shutdownCtx, graphqlwstest.NewMockService(), http.NotFoundHandler(), authValidator{},
+		graphqlws.WithSteeringHints(func(ctx context.Context) *graphqlws.SteeringHints { return hints }),
+	))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	c := graphqlwstest.Dial(t, srv.URL, nil)
+	c.Init(nil)
+	if got, ok := c.SteeringHints(); !ok || got != *hints {
+		t.Fatalf("expected the ack to carry %+v but instead got %+v", *hints, got)
+	}
+
+	shutdown()
+	c.ClosedWithCode(ctx, websocket.CloseServiceRestart)
+	if got, ok := c.SteeringHints(); !ok || got != *hints {
+		t.Fatalf("expected the close frame to carry %+v but instead got %+v", *hints, got)
+	}
+
+	c.Reconnect(nil).Init(nil)
+	if n := target.ConnectionCount(); n != 1 {
+		t.Fatalf("expected the client to reconnect to the target but instead got %d connections", n)
+	}
+}
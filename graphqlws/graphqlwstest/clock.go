@@ -0,0 +1,129 @@
+package graphqlwstest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+// FakeClock is a graphqlws.Clock whose time only passes when advanced, firing
+// the timers and tickers that are due
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeTimer
+}
+
+// NewFakeClock returns a FakeClock set to now
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the time of the clock
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer returns a timer firing once the clock is advanced by d
+func (c *FakeClock) NewTimer(d time.Duration) graphqlws.Timer {
+	return c.add(d, 0)
+}
+
+// NewTicker returns a ticker firing every time the clock is advanced by d
+func (c *FakeClock) NewTicker(d time.Duration) graphqlws.Ticker {
+	if d <= 0 {
+		panic("graphqlwstest: non-positive interval for NewTicker")
+	}
+	return fakeTicker{c.add(d, d)}
+}
+
+func (c *FakeClock) add(d, period time.Duration) *fakeTimer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{clock: c, when: c.now.Add(d), period: period, c: make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, t)
+	c.cond.Broadcast()
+	return t
+}
+
+// Advance moves the clock forward by d, firing the timers and tickers due by
+// then in order. Like the ones of the time package, their channels hold a
+// single tick and the others are dropped while it's not received.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	end := c.now.Add(d)
+	for {
+		sort.SliceStable(c.waiters, func(i, j int) bool {
+			return c.waiters[i].when.Before(c.waiters[j].when)
+		})
+		if len(c.waiters) == 0 || c.waiters[0].when.After(end) {
+			break
+		}
+
+		t := c.waiters[0]
+		c.now = t.when
+		select {
+		case t.c <- c.now:
+		default:
+		}
+		if t.period > 0 {
+			t.when = t.when.Add(t.period)
+		} else {
+			c.waiters = c.waiters[1:]
+		}
+	}
+	c.now = end
+}
+
+// BlockUntil blocks until n timers and tickers are waiting for the clock to
+// be advanced, so that a test can be sure the code under test started them
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
+
+type fakeTimer struct {
+	clock  *FakeClock
+	when   time.Time
+	period time.Duration
+	c      chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+// Stop removes t from the waiters of the clock
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	for i, w := range t.clock.waiters {
+		if w == t {
+			t.clock.waiters = append(t.clock.waiters[:i], t.clock.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeTicker struct {
+	*fakeTimer
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
@@ -0,0 +1,88 @@
+package graphqlwstest_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := graphqlwstest.NewFakeClock(start)
+	timer := c.NewTimer(2 * time.Second)
+	ticker := c.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	c.Advance(time.Second)
+	if got := <-ticker.C(); !got.Equal(start.Add(time.Second)) {
+		t.Fatalf("expected a tick at 1s but instead got %s", got.Sub(start))
+	}
+	select {
+	case <-timer.C():
+		t.Fatal("expected the timer not to fire yet")
+	default:
+	}
+
+	c.Advance(time.Second)
+	if got := <-timer.C(); !got.Equal(start.Add(2 * time.Second)) {
+		t.Fatalf("expected the timer to fire at 2s but instead got %s", got.Sub(start))
+	}
+	if timer.Stop() {
+		t.Fatal("expected the timer to have fired")
+	}
+	if got := c.Now(); !got.Equal(start.Add(2 * time.Second)) {
+		t.Fatalf("expected the clock to be at 2s but instead got %s", got.Sub(start))
+	}
+}
+
+// chanTransport is a graphqlws.Transport reading from in and writing to out
+type chanTransport struct {
+	in  chan []byte
+	out chan []byte
+}
+
+func (t *chanTransport) ReadMessage() (int, []byte, error) {
+	data, ok := <-t.in
+	if !ok {
+		return 0, nil, context.Canceled
+	}
+	return 1, data, nil
+}
+
+func (t *chanTransport) WriteMessage(messageType int, data []byte) error {
+	t.out <- append([]byte(nil), data...)
+	return nil
+}
+
+func (t *chanTransport) SetReadLimit(limit int64) {}
+
+func (t *chanTransport) SetWriteDeadline(deadline time.Time) error {
+	return nil
+}
+
+func (t *chanTransport) Close() error {
+	return nil
+}
+
+func TestFakeClockKeepAlive(t *testing.T) {
+	c := graphqlwstest.NewFakeClock(time.Now())
+	s := graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), authValidator{},
+		graphqlws.WithClock(c),
+		graphqlws.WithKeepAliveRange(time.Second, time.Minute),
+	)
+	tr := &chanTransport{in: make(chan []byte, 1), out: make(chan []byte, 1)}
+	tr.in <- []byte(`{"type":"connection_init","payload":{"keepAlive":30000}}`)
+	go s.Serve(context.Background(), tr)
+	defer close(tr.in)
+
+	<-tr.out // connection_ack
+	c.BlockUntil(1)
+	c.Advance(30 * time.Second)
+	if got := string(<-tr.out); got != `{"type":"ka"}` {
+		t.Fatalf("expected a keepalive but instead got [%s]", got)
+	}
+}
@@ -0,0 +1,158 @@
+package graphqlwstest
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+// AuthContract describes the requests an AuthValidator is checked against by
+// TestAuthValidator
+type AuthContract struct {
+	// Valid returns a new upgrade request the validator must accept
+	Valid func() *http.Request
+	// Invalid returns, by name, requests the validator must reject, e.g. an
+	// expired token or a bad signature
+	Invalid map[string]func() *http.Request
+	// AllowAnonymous is set when the validator accepts requests without
+	// credentials, i.e. without the Authorization and Cookie headers and
+	// without query parameters
+	AllowAnonymous bool
+	// Check, if not nil, checks the context returned for a valid request,
+	// e.g. that it carries the user
+	Check func(t *testing.T, ctx context.Context)
+}
+
+type contractKey struct{}
+
+// TestAuthValidator checks that v accepts the valid request of c and rejects
+// the invalid ones, as well as the valid one stripped of its credentials
+// unless anonymous requests are allowed. It also checks that the contexts
+// returned are derived from the ones v is passed, keeping their values and
+// cancellation, and that v can be called concurrently.
+func TestAuthValidator(t *testing.T, v graphqlws.AuthValidator, c AuthContract) {
+	t.Helper()
+
+	t.Run("valid", func(t *testing.T) {
+		ctx, err := v.CheckAuth(c.Valid(), context.Background())
+		if err != nil {
+			t.Fatalf("expected the valid request to be accepted but instead got %v", err)
+		}
+		if ctx == nil {
+			t.Fatal("expected a context for the valid request")
+		}
+		if c.Check != nil {
+			c.Check(t, ctx)
+		}
+	})
+
+	for name, invalid := range c.Invalid {
+		invalid := invalid
+		t.Run(name, func(t *testing.T) {
+			if _, err := v.CheckAuth(invalid(), context.Background()); err == nil {
+				t.Fatal("expected the request to be rejected")
+			}
+		})
+	}
+
+	t.Run("missing credentials", func(t *testing.T) {
+		r := c.Valid()
+		r.Header.Del("Authorization")
+		r.Header.Del("Cookie")
+		r.URL.RawQuery = ""
+
+		_, err := v.CheckAuth(r, context.Background())
+		switch {
+		case c.AllowAnonymous && err != nil:
+			t.Fatalf("expected the anonymous request to be accepted but instead got %v", err)
+		case !c.AllowAnonymous && err == nil:
+			t.Fatal("expected the request without credentials to be rejected")
+		}
+	})
+
+	t.Run("context propagation", func(t *testing.T) {
+		parent, cancel := context.WithCancel(context.WithValue(context.Background(), contractKey{}, "value"))
+		ctx, err := v.CheckAuth(c.Valid(), parent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ctx.Value(contractKey{}) != "value" {
+			t.Fatal("expected the context to carry the values of the one passed")
+		}
+
+		cancel()
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Fatal("expected the context to be cancelled with the one passed")
+		}
+	})
+
+	t.Run("concurrency", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := v.CheckAuth(c.Valid(), context.Background()); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+// TestObserver checks that o returns contexts derived from the ones it's
+// passed, keeping their values and cancellation, that it tolerates ends
+// without starts, e.g. contexts it didn't return, and that it can be called
+// concurrently.
+func TestObserver(t *testing.T, o graphqlws.Observer) {
+	t.Helper()
+
+	t.Run("context propagation", func(t *testing.T) {
+		parent, cancel := context.WithCancel(context.WithValue(context.Background(), contractKey{}, "value"))
+		defer cancel()
+
+		connCtx := o.ConnectionStart(parent, graphqlws.ConnectionInfo{})
+		opCtx := o.OperationStart(connCtx, graphqlws.OperationInfo{ID: "1", OperationName: "contract"})
+		for name, ctx := range map[string]context.Context{"connection": connCtx, "operation": opCtx} {
+			if ctx == nil || ctx.Value(contractKey{}) != "value" {
+				t.Fatalf("expected the %s context to carry the values of the one passed", name)
+			}
+		}
+
+		cancel()
+		select {
+		case <-opCtx.Done():
+		case <-time.After(time.Second):
+			t.Fatal("expected the operation context to be cancelled with the connection one")
+		}
+		o.OperationEnd(opCtx, opCtx.Err())
+		o.ConnectionEnd(connCtx)
+	})
+
+	t.Run("ends without starts", func(t *testing.T) {
+		o.OperationEnd(context.Background(), nil)
+		o.ConnectionEnd(context.Background())
+	})
+
+	t.Run("concurrency", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				connCtx := o.ConnectionStart(context.Background(), graphqlws.ConnectionInfo{})
+				opCtx := o.OperationStart(connCtx, graphqlws.OperationInfo{ID: "1"})
+				o.OperationEnd(opCtx, nil)
+				o.ConnectionEnd(connCtx)
+			}()
+		}
+		wg.Wait()
+	})
+}
@@ -0,0 +1,72 @@
+package graphqlwstest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+)
+
+type userKey struct{}
+
+// tokenValidator accepts bearer tokens of the form <user>:<expired|valid>
+type tokenValidator struct{}
+
+func (tokenValidator) CheckAuth(r *http.Request, ctx context.Context) (context.Context, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	user, state, _ := strings.Cut(token, ":")
+	switch {
+	case user == "":
+		return nil, errors.New("missing token")
+	case state != "valid":
+		return nil, errors.New("expired token")
+	}
+	return context.WithValue(ctx, userKey{}, user), nil
+}
+
+func request(token string) func() *http.Request {
+	return func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/graphql", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		return r
+	}
+}
+
+func TestAuthValidatorContract(t *testing.T) {
+	graphqlwstest.TestAuthValidator(t, tokenValidator{}, graphqlwstest.AuthContract{
+		Valid: request("alice:valid"),
+		Invalid: map[string]func() *http.Request{
+			"expired": request("alice:expired"),
+		},
+		Check: func(t *testing.T, ctx context.Context) {
+			if user := ctx.Value(userKey{}); user != "alice" {
+				t.Fatalf("expected alice but instead got %v", user)
+			}
+		},
+	})
+}
+
+type spanKey struct{}
+
+type spanObserver struct{}
+
+func (spanObserver) ConnectionStart(ctx context.Context, info graphqlws.ConnectionInfo) context.Context {
+	return context.WithValue(ctx, spanKey{}, "connection")
+}
+
+func (spanObserver) ConnectionEnd(ctx context.Context) {}
+
+func (spanObserver) OperationStart(ctx context.Context, info graphqlws.OperationInfo) context.Context {
+	return context.WithValue(ctx, spanKey{}, info.ID)
+}
+
+func (spanObserver) OperationEnd(ctx context.Context, err error) {}
+
+func TestObserverContract(t *testing.T) {
+	graphqlwstest.TestObserver(t, spanObserver{})
+}
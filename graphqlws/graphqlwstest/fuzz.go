@@ -0,0 +1,109 @@
+package graphqlwstest
+
+import (
+	"context"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// Message is an operation message as decoded by the server, which only
+// decodes the id and type of messages and leaves their payload to the
+// handler of their type
+type Message = connection.DecodedMessage
+
+// DecodeFrame decodes an incoming frame, i.e. an operation message or an
+// array of them, the way the server does. It's an entry point for fuzzing the
+// decoder, e.g.
+//
+//	func FuzzDecodeFrame(f *testing.F) {
+//		for _, frame := range graphqlwstest.Corpus() {
+//			f.Add(frame)
+//		}
+//		f.Fuzz(func(t *testing.T, frame []byte) {
+//			graphqlwstest.DecodeFrame(frame)
+//		})
+//	}
+func DecodeFrame(frame []byte) ([]Message, error) {
+	return connection.DecodeFrame(frame)
+}
+
+// HandleFrame handles frame on a new connection to a fake service, after an
+// empty connection_init, and returns the frames written in response until the
+// connection was closed, which it is right after. The service answers every
+// operation with a single result. It's an entry point for fuzzing the
+// handling of messages, see DecodeFrame.
+func HandleFrame(frame []byte) [][]byte {
+	return connection.HandleFrames(fakeService{}, [][]byte{[]byte(`{"type":"connection_init","payload":{}}`), frame})
+}
+
+type fakeService struct{}
+
+func (fakeService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	c := make(chan interface{}, 1)
+	c <- &graphql.Response{Data: []byte(`{}`)}
+	close(c)
+	return c, nil
+}
+
+func (fakeService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{Data: []byte(`{}`)}
+}
+
+// corpus holds frames exercising the edge cases of decoding and handling
+// messages
+var corpus = []string{
+	``,
+	` `,
+	`null`,
+	`{}`,
+	`[]`,
+	`[[]]`,
+	`[{}]`,
+	`"start"`,
+	`{"type":"start"}`,
+	`{"type":"start","id":""}`,
+	`{"type":"start","id":"1","payload":null}`,
+	`{"type":"start","id":"1","payload":"query"}`,
+	`{"type":"start","id":"1","payload":{"query":"subscription { a }","variables":{"a":1e400}}}`,
+	`{"type":"start","id":"1","payload":{"query":"subscription { a }","credits":-1}}`,
+	`{"type":"start","id":"1","payload":{"query":"subscription { a }","credits":0}}`,
+	`{"type":"start","id":"1","payload":{"query":"subscription { a }","lastEventId":"\u0000"}}`,
+	`{"type":"start","id":"1","payload":{}}{"type":"stop","id":"1"}`,
+	`[{"type":"start","id":"1","payload":{}},{"type":"stop","id":"1"}]`,
+	`[{"type":"start","id":"1","payload":{}},{"type":"start","id":"1","payload":{}}]`,
+	`[{"type":"start","id":"1","payload":{}},]`,
+	`{"type":"stop","id":"unknown"}`,
+	`{"type":"credit","id":"1","payload":{"credits":9223372036854775808}}`,
+	`{"type":"credit","id":"1","payload":{"credits":-9223372036854775808}}`,
+	`{"type":"ack","id":"1","payload":{"seq":-1}}`,
+	`[{"type":"start","id":"1","payload":{"ack":true}},{"type":"ack","id":"1","payload":{"seq":18446744073709551615}}]`,
+	`{"TYPE":"start","Id":"1","payload":{}}`,
+	`{"type":"stop","type":"start","id":"1","payload":{}}`,
+	`{"type":"start","id":"\ud800","payload":{}}`,
+	`{"type":"start","id":"` + "\xff\xfe" + `","payload":{}}`,
+	`{"type":"start","id":1,"payload":{}}`,
+	`{"type":"start","id":"1","payload":{"query":"subscription { a }"` + "\x00" + `}}`,
+	"\ufeff" + `{"type":"connection_terminate"}`,
+	`{"type":"connection_init","payload":{"compression":["zstd","deflate","zstd"],"keepAlive":-1}}`,
+	`{"type":"connection_init","payload":{"keepAlive":1e300}}`,
+	`{"type":"ping","id":"1","payload":[]}`,
+	`{"type":"receive","payload":{"id":null}}`,
+	`{"type":"unknown","id":"1"}`,
+	`{"type":"start","id":"1","payload":{"query":"` + "subscription { a }" + `","variables":[[[[[[[[[[[[[[[[]]]]]]]]]]]]]]]]}}`,
+	`{"type":"start","id":"1","payload":{"query":"subscription { a }"}`,
+	`{"type":"start","id":"1","payload":{"query":"subscription { a }"}}}`,
+	`{"type":"start","id":"1","payload":{"query":"\`,
+}
+
+// Corpus returns a seed corpus of frames exercising the edge cases of
+// decoding and handling messages, e.g. batches, duplicate and differently
+// cased keys, invalid UTF-8 and out of range numbers
+func Corpus() [][]byte {
+	frames := make([][]byte, len(corpus))
+	for i, frame := range corpus {
+		frames[i] = []byte(frame)
+	}
+	return frames
+}
@@ -0,0 +1,65 @@
+package graphqlwstest_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+)
+
+// FuzzDecodeFrame checks that frames encoding/json can decode are routed the
+// same way by the server
+func FuzzDecodeFrame(f *testing.F) {
+	for _, frame := range graphqlwstest.Corpus() {
+		f.Add(frame)
+	}
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		got, err := graphqlwstest.DecodeFrame(frame)
+
+		type message struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+		}
+		// frames are either an object or an array of objects
+		objects := []json.RawMessage{frame}
+		if trimmed := bytes.TrimLeft(frame, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '[' {
+			if json.Unmarshal(frame, &objects) != nil {
+				return
+			}
+		}
+		var expected []message
+		for _, object := range objects {
+			var msg message
+			if trimmed := bytes.TrimLeft(object, " \t\r\n"); len(trimmed) == 0 || trimmed[0] != '{' || json.Unmarshal(object, &msg) != nil {
+				return
+			}
+			expected = append(expected, msg)
+		}
+
+		if err != nil {
+			t.Fatalf("failed to decode [%s]: %v", frame, err)
+		}
+		if len(got) != len(expected) {
+			t.Fatalf("expected %d messages in [%s] but instead got %d", len(expected), frame, len(got))
+		}
+		for i, msg := range got {
+			if msg.ID != expected[i].ID || msg.Type != expected[i].Type {
+				t.Fatalf("expected %+v in [%s] but instead got %+v", expected[i], frame, msg)
+			}
+		}
+	})
+}
+
+func FuzzHandleFrame(f *testing.F) {
+	for _, frame := range graphqlwstest.Corpus() {
+		f.Add(frame)
+	}
+	f.Fuzz(func(t *testing.T, frame []byte) {
+		for _, written := range graphqlwstest.HandleFrame(frame) {
+			if !json.Valid(written) {
+				t.Fatalf("invalid frame [%s] written in response to [%s]", written, frame)
+			}
+		}
+	})
+}
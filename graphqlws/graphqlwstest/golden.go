@@ -0,0 +1,192 @@
+// Package graphqlwstest provides utilities for testing graphqlws servers.
+package graphqlwstest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// update makes Golden record the responses of the server instead of checking
+// them, e.g. go test ./... -graphqlws.update
+var update = flag.Bool("graphqlws.update", false, "record the server responses of graphqlwstest golden transcripts")
+
+// RecordIdle is how long Golden waits for more responses to a client message
+// when recording, the server is considered done with it after that much idle
+// time
+var RecordIdle = 200 * time.Millisecond
+
+// Step is a frame of a transcript, sent either by the client or by the server
+type Step struct {
+	Client json.RawMessage `json:"client,omitempty"`
+	Server json.RawMessage `json:"server,omitempty"`
+}
+
+// Transcript is a protocol session, as the frames exchanged in order
+type Transcript []Step
+
+// Load reads the transcript in file
+func Load(file string) (Transcript, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var tr Transcript
+	err = json.Unmarshal(data, &tr)
+	return tr, err
+}
+
+// Save writes tr to file, indented so that it reads and diffs well
+func (tr Transcript) Save(file string) error {
+	data, err := json.MarshalIndent(tr, "", "\t")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, append(data, '\n'), 0644)
+}
+
+// Golden replays the client side of the transcript in file against h, which
+// must serve the graphql-ws protocol, failing t when the responses of the
+// server don't match the recorded ones. With the -graphqlws.update flag the
+// client frames are sent the same way but the responses are recorded to file
+// instead, so a transcript can be written with only client frames and then
+// filled in.
+func Golden(t *testing.T, h http.Handler, file string) {
+	t.Helper()
+
+	tr, err := Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	if *update {
+		tr, err = Record(srv.URL, tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tr.Save(file); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	Replay(t, srv.URL, tr)
+}
+
+// dial connects to the graphql-ws endpoint at url, an http or ws URL
+func dial(url string) (*websocket.Conn, error) {
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+	ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+	return ws, err
+}
+
+// Replay sends the client frames of tr to the endpoint at url in order,
+// failing t unless the server responds with the frames recorded after each of
+// them, compared as JSON values.
+func Replay(t *testing.T, url string, tr Transcript) {
+	t.Helper()
+
+	ws, err := dial(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	for i, step := range tr {
+		if step.Client != nil {
+			if err := ws.WriteMessage(websocket.TextMessage, step.Client); err != nil {
+				t.Fatalf("step %d: %v", i, err)
+			}
+			continue
+		}
+
+		ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, got, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("step %d: expected [%s] but instead got %v", i, step.Server, err)
+		}
+		if !equalJSON(step.Server, got) {
+			t.Fatalf("step %d: expected [%s] but instead got [%s]", i, step.Server, got)
+		}
+	}
+}
+
+// Record sends the client frames of tr to the endpoint at url in order and
+// returns them along with the responses of the server, the ones recorded in
+// tr are dropped. Each client frame is followed by the responses received
+// until the connection is idle for RecordIdle.
+func Record(url string, tr Transcript) (Transcript, error) {
+	ws, err := dial(url)
+	if err != nil {
+		return nil, err
+	}
+	defer ws.Close()
+
+	// a read timing out breaks the connection, so frames are read by a
+	// goroutine and waited for with a timer instead
+	frames := make(chan []byte)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(frames)
+		for {
+			_, frame, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			select {
+			case frames <- frame:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var recorded Transcript
+	for _, step := range tr {
+		if step.Client == nil {
+			continue
+		}
+		recorded = append(recorded, step)
+		if err := ws.WriteMessage(websocket.TextMessage, step.Client); err != nil {
+			return nil, err
+		}
+
+	responses:
+		for {
+			select {
+			case frame, ok := <-frames:
+				if !ok {
+					// the server closed the connection
+					return recorded, nil
+				}
+				recorded = append(recorded, Step{Server: frame})
+			case <-time.After(RecordIdle):
+				break responses
+			}
+		}
+	}
+	return recorded, nil
+}
+
+func equalJSON(expected, got []byte) bool {
+	var e, g interface{}
+	if err := json.Unmarshal(expected, &e); err != nil {
+		return bytes.Equal(expected, got)
+	}
+	if err := json.Unmarshal(got, &g); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(e, g)
+}
@@ -0,0 +1,35 @@
+package graphqlwstest_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+)
+
+type gqlService struct{}
+
+func (gqlService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	c := make(chan interface{}, 1)
+	c <- map[string]interface{}{"data": map[string]interface{}{"message": operationName}}
+	return c, nil
+}
+
+func (gqlService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+type authValidator struct{}
+
+func (authValidator) CheckAuth(r *http.Request, ctx context.Context) (context.Context, error) {
+	return ctx, nil
+}
+
+func TestGolden(t *testing.T) {
+	s := graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), authValidator{})
+	graphqlwstest.Golden(t, s, "testdata/session.json")
+}
@@ -0,0 +1,25 @@
+package graphqlwstest
+
+import (
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+// SequentialIDs returns a graphqlws.IDGenerator of prefix followed by 1, 2,
+// 3 and so on
+func SequentialIDs(prefix string) graphqlws.IDGenerator {
+	var n int64
+	return graphqlws.IDGeneratorFunc(func() string {
+		return prefix + strconv.FormatInt(atomic.AddInt64(&n, 1), 10)
+	})
+}
+
+// SeededIDs returns a graphqlws.IDGenerator of ids looking like the default
+// random ones but drawn from a source seeded with seed, so that they're the
+// same every run
+func SeededIDs(seed int64) graphqlws.IDGenerator {
+	return graphqlws.RandomIDs(rand.NewSource(seed))
+}
@@ -0,0 +1,22 @@
+package graphqlwstest_test
+
+import (
+	"testing"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+)
+
+func TestSequentialIDs(t *testing.T) {
+	ids := graphqlwstest.SequentialIDs("socket-")
+	for _, expected := range []string{"socket-1", "socket-2"} {
+		if got := ids.NewID(); got != expected {
+			t.Fatalf("expected %s but instead got %s", expected, got)
+		}
+	}
+}
+
+func TestSeededIDs(t *testing.T) {
+	if a, b := graphqlwstest.SeededIDs(42).NewID(), graphqlwstest.SeededIDs(42).NewID(); a != b {
+		t.Fatalf("expected the same ids but instead got %s and %s", a, b)
+	}
+}
@@ -0,0 +1,184 @@
+package graphqlwstest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	qerrors "github.com/graph-gophers/graphql-go/errors"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+// Action is a step of the script of an operation, see MockService.On
+type Action struct {
+	// run performs the action, it returns false when the script is over
+	run func(ctx context.Context, s *MockService, c chan<- interface{}) bool
+}
+
+// Send sends payload on the subscription channel, e.g. a *graphql.Response
+// or a graphqlws.Event
+func Send(payload interface{}) Action {
+	return Action{func(ctx context.Context, s *MockService, c chan<- interface{}) bool {
+		select {
+		case c <- payload:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}}
+}
+
+// Data sends a response with data, marshaled to JSON
+func Data(data interface{}) Action {
+	b, err := json.Marshal(data)
+	if err != nil {
+		panic(err)
+	}
+	return Send(&graphql.Response{Data: b})
+}
+
+// Error sends a response with an error with message
+func Error(message string) Action {
+	return Send(&graphql.Response{Errors: []*qerrors.QueryError{{Message: message}}})
+}
+
+// Wait waits for d on the clock of the service
+func Wait(d time.Duration) Action {
+	return Action{func(ctx context.Context, s *MockService, c chan<- interface{}) bool {
+		timer := s.clock().NewTimer(d)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C():
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}}
+}
+
+// Complete closes the subscription channel. Scripts that don't end with it
+// keep the channel open until the operation is stopped.
+func Complete() Action {
+	return Action{func(ctx context.Context, s *MockService, c chan<- interface{}) bool {
+		return false
+	}}
+}
+
+// Call is a call to Subscribe or Exec recorded by a MockService
+type Call struct {
+	Query         string
+	OperationName string
+	Variables     map[string]interface{}
+}
+
+// MockService is a GraphQL service whose operations follow the scripts tests
+// declare by operation name, so that the handling of their events, delays,
+// errors and completion can be tested without a schema.
+type MockService struct {
+	// Clock is the clock Wait waits on, the real one if nil
+	Clock graphqlws.Clock
+
+	mu            sync.Mutex
+	scripts       map[string][]Action
+	subscribeErrs map[string]error
+	calls         []Call
+}
+
+// NewMockService returns a MockService without scripts
+func NewMockService() *MockService {
+	return &MockService{
+		scripts:       map[string][]Action{},
+		subscribeErrs: map[string]error{},
+	}
+}
+
+// On sets the script of the operations named operationName, which are run
+// one goroutine each
+func (s *MockService) On(operationName string, actions ...Action) *MockService {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scripts[operationName] = actions
+	return s
+}
+
+// FailSubscribe makes Subscribe return err for the operations named
+// operationName
+func (s *MockService) FailSubscribe(operationName string, err error) *MockService {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribeErrs[operationName] = err
+	return s
+}
+
+// Calls returns the calls made to the service so far, in order
+func (s *MockService) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Call(nil), s.calls...)
+}
+
+func (s *MockService) clock() graphqlws.Clock {
+	if s.Clock == nil {
+		return graphqlws.RealClock
+	}
+	return s.Clock
+}
+
+// script records the call and returns the script of the operation
+func (s *MockService) script(query string, operationName string, variables map[string]interface{}) ([]Action, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = append(s.calls, Call{Query: query, OperationName: operationName, Variables: variables})
+	if err := s.subscribeErrs[operationName]; err != nil {
+		return nil, err
+	}
+	actions, ok := s.scripts[operationName]
+	if !ok {
+		return nil, fmt.Errorf("graphqlwstest: no script for operation %q", operationName)
+	}
+	return actions, nil
+}
+
+// Subscribe runs the script of the operation, sending its payloads on the
+// returned channel
+func (s *MockService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	actions, err := s.script(document, operationName, variableValues)
+	if err != nil {
+		return nil, err
+	}
+
+	c := make(chan interface{})
+	go func() {
+		defer close(c)
+		for _, action := range actions {
+			if !action.run(ctx, s, c) {
+				return
+			}
+		}
+		<-ctx.Done()
+	}()
+	return c, nil
+}
+
+// Exec runs the script of the operation until its first payload, which is
+// returned, it must be a *graphql.Response
+func (s *MockService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	// the script is stopped once it sent its result
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c, err := s.Subscribe(ctx, queryString, operationName, variables)
+	if err != nil {
+		return &graphql.Response{Errors: []*qerrors.QueryError{qerrors.Errorf("%s", err)}}
+	}
+	if resp, ok := (<-c).(*graphql.Response); ok {
+		return resp
+	}
+	return &graphql.Response{}
+}
@@ -0,0 +1,54 @@
+package graphqlwstest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+)
+
+func TestMockService(t *testing.T) {
+	clock := graphqlwstest.NewFakeClock(time.Now())
+	svc := graphqlwstest.NewMockService()
+	svc.Clock = clock
+	svc.On("onMessage",
+		graphqlwstest.Data(map[string]string{"message": "a"}),
+		graphqlwstest.Wait(time.Minute),
+		graphqlwstest.Error("b"),
+		graphqlwstest.Complete(),
+	).FailSubscribe("denied", errors.New("denied"))
+
+	s := graphqlws.NewServer(context.Background(), svc, http.NotFoundHandler(), authValidator{})
+	tr := &chanTransport{in: make(chan []byte, 3), out: make(chan []byte, 8)}
+	tr.in <- []byte(`{"type":"connection_init","payload":{}}`)
+	tr.in <- []byte(`{"id":"1","type":"start","payload":{"query":"subscription onMessage { message }","operationName":"onMessage"}}`)
+	go s.Serve(context.Background(), tr)
+	defer close(tr.in)
+
+	expect := func(expected string) {
+		t.Helper()
+		if got := string(<-tr.out); got != expected {
+			t.Fatalf("expected [%s] but instead got [%s]", expected, got)
+		}
+	}
+	expect(`{"payload":{"extensions":{"batching":true,"flowControl":true,"resume":true}},"type":"connection_ack"}`)
+	expect(`{"id":"1","payload":{"data":{"message":"a"}},"type":"data"}`)
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Minute)
+	expect(`{"id":"1","payload":{"errors":[{"message":"b"}]},"type":"data"}`)
+	expect(`{"id":"1","type":"complete"}`)
+
+	tr.in <- []byte(`{"id":"2","type":"start","payload":{"operationName":"denied"}}`)
+	expect(`{"id":"2","payload":{"message":"denied"},"type":"error"}`)
+	expect(`{"id":"2","type":"complete"}`)
+
+	calls := svc.Calls()
+	if len(calls) != 2 || calls[0].Query != "subscription onMessage { message }" || calls[1].OperationName != "denied" {
+		t.Fatalf("unexpected calls %+v", calls)
+	}
+}
@@ -0,0 +1,385 @@
+package graphqlws
+
+import (
+	"context"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// Conn is the handle to the connection passed to a MessageHandler
+type Conn = connection.Conn
+
+// MessageHandler handles incoming operation messages of a custom type, the
+// error it returns, if any, is sent to the client in an error message
+type MessageHandler = connection.MessageHandler
+
+// WithMessageHandler registers handler for operation messages of type msgType,
+// allowing applications to extend the protocol with their own message types.
+//
+// Handlers for the ping and receive message types are registered by default and
+// can be replaced this way, while the message types defined by the protocol
+// (connection_init, start, stop, ...) can't be overridden.
+func WithMessageHandler(msgType string, mh MessageHandler) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.HandleMessage(msgType, mh))
+	}
+}
+
+// PingHandler returns the payload of the pong answering a ping message, see
+// WithPingHandler
+type PingHandler = connection.PingHandler
+
+// ReceiveHandler is told that the client received an event, see
+// WithReceiveHandler
+type ReceiveHandler = connection.ReceiveHandler
+
+// WithPingHandler sets the handler of ping messages, which by default are
+// answered with a pong echoing their payload
+func WithPingHandler(fn PingHandler) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.OnPing(fn))
+	}
+}
+
+// WithReceiveHandler sets the handler of the receive messages by which
+// clients tell they received the event whose ID is in their payload, by
+// default they're ignored
+func WithReceiveHandler(fn ReceiveHandler) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.OnReceive(fn))
+	}
+}
+
+// WithPingQuery answers ping messages with the response to query executed by
+// the service, with the fields of the payload of the ping as variables, e.g.
+// {check_subscription}
+func WithPingQuery(query string) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.PingQuery(query))
+	}
+}
+
+// WithReceiveMutation handles receive messages by executing mutation with the
+// service, the ID of the event received being passed as its $id variable, e.g.
+// mutation($id: ID!) { receive_socket_event(id: $id) }
+func WithReceiveMutation(mutation string) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.ReceiveMutation(mutation))
+	}
+}
+
+// InitHandler handles the connection_init payload of a connection before it's
+// acknowledged, see WithConnectionInitHandler
+type InitHandler = connection.InitHandler
+
+// WithConnectionInitHandler sets the handler of connection_init payloads, e.g.
+// to authenticate connections with a token sent in the payload rather than
+// with the HTTP request. All the operations of the connection run with the
+// context it returns, if it returns an error the client is sent a
+// connection_error with it instead of the connection_ack and the connection is
+// closed with ErrInitRejected.
+func WithConnectionInitHandler(fn InitHandler) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.HandleInit(fn))
+	}
+}
+
+// WithRefreshHandler lets clients refresh the authentication of their
+// connection, e.g. with a new token once theirs is about to expire, by sending
+// a connection_refresh message whose payload is handled by fn like a
+// connection_init payload by the InitHandler. The operations started from then
+// on run with the context it returns and the client is sent
+// connection_refreshed, if it returns an error the client is sent a
+// connection_error and the connection is closed with ErrRefreshRejected.
+func WithRefreshHandler(fn InitHandler) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.HandleRefresh(fn))
+	}
+}
+
+// SubscribeHook is called before an operation is passed to the service, see
+// WithSubscribeHook
+type SubscribeHook = connection.SubscribeHook
+
+// WithSubscribeHook sets the hook called before operations are passed to the
+// service, e.g. to enforce per-operation authorization, an allow-list of
+// queries or complexity limits. The service is called with the context it
+// returns, if it returns an error the operation fails with it, along with
+// the extensions of errors implementing Extensions() map[string]interface{}.
+func WithSubscribeHook(fn SubscribeHook) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.OnSubscribe(fn))
+	}
+}
+
+// WithKeepAlive makes the server send ka messages every interval once
+// connections are acknowledged, so that idle proxies and load balancers don't
+// drop connections running long-lived subscriptions.
+func WithKeepAlive(interval time.Duration) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.KeepAlive(interval))
+	}
+}
+
+// WithKeepAliveRange lets clients request a keepalive interval by sending
+// {"keepAlive": milliseconds} in the connection_init payload, the server then
+// sends ka messages at the requested interval clamped to [min, max] and
+// confirms it in the connection_ack payload.
+func WithKeepAliveRange(min, max time.Duration) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.KeepAliveRange(min, max))
+	}
+}
+
+// WithKeepAlivePayload sets the function returning the payload of the ka
+// messages sent to a connection, evaluated at every tick with the context of
+// the connection, e.g. so that clients can piggyback the server time or the
+// remaining lifetime of their session without a dedicated subscription.
+func WithKeepAlivePayload(fn func(ctx context.Context) interface{}) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.KeepAlivePayload(fn))
+	}
+}
+
+// WithWriteCoalescing lets clients opt in with {"coalesce": true} in the
+// connection_init payload to receive the messages queued within window after a
+// data message along with it, as a single frame holding an array of operation
+// messages, which saves frames and syscalls for high-frequency subscriptions.
+// The window is confirmed in milliseconds in the connection_ack payload. It
+// doesn't apply to the connections speaking ProtocolGraphQLTransportWS or
+// served by Server.AbsintheHandler, whose protocols have no batches.
+func WithWriteCoalescing(window time.Duration) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.CoalesceWrites(window))
+	}
+}
+
+// noCoalescing disables write coalescing for the connections whose protocol
+// has no batches
+var noCoalescing = connection.CoalesceWrites(0)
+
+// WithStartConcurrency sets how many operations may be starting at the same
+// time on a connection. The default of 1 serializes the calls to Subscribe,
+// n > 1 allows up to n parallel calls and n <= 0 doesn't limit them.
+func WithStartConcurrency(n int) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.StartConcurrency(n))
+	}
+}
+
+// ErrSubscribeTimeout is the error of the operations whose call to
+// GraphQLService didn't return in time, see WithSubscribeTimeout
+var ErrSubscribeTimeout = connection.ErrSubscribeTimeout
+
+// WithSubscribeTimeout bounds to d the calls to GraphQLService.Subscribe, or
+// Exec for queries and mutations. Operations whose call doesn't return in time
+// are cancelled and fail with an error wrapping ErrSubscribeTimeout, with the
+// extensions code SUBSCRIBE_TIMEOUT. Subscriptions may wait as long as needed
+// for their events once Subscribe returned.
+func WithSubscribeTimeout(d time.Duration) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.SubscribeTimeout(d))
+	}
+}
+
+// PriorityFunc assigns a priority to an operation from its start payload
+type PriorityFunc = connection.PriorityFunc
+
+// WithPriority sets the function assigning priorities to operations, when a
+// client can't keep up messages of operations with a higher priority are
+// delivered first.
+func WithPriority(fn PriorityFunc) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.Prioritize(fn))
+	}
+}
+
+// WithOperationBudget limits to size the number of operations running at the
+// same time across all the connections served by the handler. Once exhausted,
+// new operations wait up to wait for a slot and are then rejected with an
+// error whose extensions code is CAPACITY_EXCEEDED. It panics if size isn't
+// positive.
+func WithOperationBudget(size int, wait time.Duration) Option {
+	budget := connection.NewBudget(size, wait)
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.OperationBudget(budget))
+	}
+}
+
+// WithMaxSubscriptionsPerConnection limits to n the number of operations
+// running at the same time on each connection, so that a single client can't
+// exhaust the memory of the server. Operations started beyond it are rejected
+// with an error whose extensions code is OPERATION_LIMIT_EXCEEDED, along with
+// the limit and a scope of "connection".
+func WithMaxSubscriptionsPerConnection(n int) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.MaxOperations(n))
+	}
+}
+
+// WithMaxTotalSubscriptions limits to n the number of operations running at
+// the same time across all the connections served by the handler. Unlike with
+// WithOperationBudget, operations started beyond it are rejected right away,
+// with an error whose extensions code is OPERATION_LIMIT_EXCEEDED, along with
+// the limit and a scope of "server".
+func WithMaxTotalSubscriptions(n int) Option {
+	limit := connection.NewOperationLimit(n)
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.LimitOperations(limit))
+	}
+}
+
+// WithMaxConcurrentSubscribes limits to n the number of Subscribe calls in
+// flight at the same time across all the connections served by the handler,
+// e.g. to protect the resolvers when thousands of clients reconnect at once.
+// The limit is shared by all the handlers the returned Option is passed to. It
+// panics if n isn't positive.
+func WithMaxConcurrentSubscribes(n int) Option {
+	limiter := connection.NewLimiter(n)
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.SubscribeLimiter(limiter))
+	}
+}
+
+// WithFirstOperationTimeout closes connections which don't start an operation
+// within d of their connection_init, e.g. bots and misconfigured clients
+// parking idle authenticated sockets. Their close reason is ErrNoOperation
+// and websocket clients are sent the 1008 (policy violation) close code.
+func WithFirstOperationTimeout(d time.Duration) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.FirstOperationTimeout(d))
+	}
+}
+
+// WithConnectionInitTimeout closes connections which don't send their
+// connection_init within d of being opened, so that unauthenticated clients
+// can't hold sockets open. Their close reason is ErrInitTimeout and websocket
+// clients are sent the 4408 close code of graphql-transport-ws.
+func WithConnectionInitTimeout(d time.Duration) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.ConnectionInitTimeout(d))
+	}
+}
+
+// WithPongWait makes the handler send websocket pings and close connections
+// from which nothing, be it a pong or a message, is read within d, so that
+// half-open connections don't linger until the OS gives up on them. Their
+// close reason is ErrPongTimeout. Connections served by an event loop, see
+// WithEventLoop, are closed at the first ping sent past d.
+func WithPongWait(d time.Duration) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.PongWait(d))
+	}
+}
+
+// WithPingPeriod sets the interval at which pings are sent, which has to be
+// shorter than the pong wait and defaults to 9/10 of it, see WithPongWait
+func WithPingPeriod(d time.Duration) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.PingPeriod(d))
+	}
+}
+
+// OverflowPolicy is what happens to the data messages of an operation sent
+// while its outgoing queue is full, see WithSendQueue
+type OverflowPolicy = connection.OverflowPolicy
+
+// The overflow policies
+const (
+	OverflowBlock      = connection.OverflowBlock
+	OverflowDropOldest = connection.OverflowDropOldest
+	OverflowDropNewest = connection.OverflowDropNewest
+	OverflowClose      = connection.OverflowClose
+)
+
+// WithSendQueue lets each operation queue up to capacity messages for its
+// client, 1 by default, and sets what happens to the data messages it sends
+// while its queue is full: by default the operation blocks until the client
+// catches up, it may instead drop the oldest or the newest data message, or
+// close the connection with ErrQueueOverflow and the 1013 (try again later)
+// close code, so that slow clients don't back up the subscriptions feeding
+// them. The depth of the queues is reported to the QueueObservers.
+func WithSendQueue(capacity int, policy OverflowPolicy) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.SendQueue(capacity, policy))
+	}
+}
+
+// CapacityCheck reports whether the server is over capacity and when clients
+// should retry, see WithCapacity
+type CapacityCheck = connection.CapacityCheck
+
+// The built-in capacity checks, against the number of goroutines and the size
+// of the heap
+var (
+	MaxGoroutines = connection.MaxGoroutines
+	MaxHeapBytes  = connection.MaxHeapBytes
+)
+
+// WithCapacity rejects new operations while any of checks reports the server
+// is over capacity, with an error whose extensions code is CAPACITY_EXCEEDED
+// and whose retryAfter extension is the delay in milliseconds the client
+// should retry after, as for operations rejected by WithOperationBudget.
+func WithCapacity(checks ...CapacityCheck) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.Capacity(checks...))
+	}
+}
+
+// WithResultCache caches the results of queries for ttl across all the
+// connections served by the handler, so that bursts of identical queries,
+// e.g. from dashboards reconnecting, don't all hit the service. Results are
+// keyed by the normalized query, operation name and variables, and scope, if
+// not nil, returns a key they're additionally scoped by, e.g. the user from
+// the context returned by the AuthValidator when results depend on it.
+// Mutations and subscriptions aren't cached.
+func WithResultCache(ttl time.Duration, scope func(ctx context.Context) string) Option {
+	cache := connection.NewResultCache(ttl, scope)
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.CacheResults(cache))
+	}
+}
+
+// WithSubscriptionDedup runs identical subscriptions once across all the
+// connections served by the handler and fans their payloads out to every
+// subscriber, so that N clients subscribing to the same events don't call the
+// service N times. Subscriptions are keyed by the normalized query, operation
+// name and variables, and scope, if not nil, returns a key they're
+// additionally scoped by, e.g. the user from the context returned by the
+// AuthValidator when events depend on it. The subscription is cancelled once
+// its last subscriber stops, and the slowest subscriber paces the others.
+func WithSubscriptionDedup(scope func(ctx context.Context) string) Option {
+	m := connection.NewMultiplexer(scope)
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.Multiplex(m))
+	}
+}
+
+// WithMessageSizeLimits limits the size in bytes of the payloads of incoming
+// messages by type, e.g. {"connection_init": 1024, "start": 65536}, instead of
+// the single 4096 bytes limit of frames. Messages over their limit are
+// rejected with an error whose extensions code is MESSAGE_TOO_LARGE, a
+// connection_error for connection_init, and frames may be as large as the
+// largest payload allowed.
+func WithMessageSizeLimits(limits map[string]int64) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.MessageSizeLimits(limits))
+	}
+}
+
+// DataHook returns the payload of a data message to send, and extensions to
+// add to it, see WithDataHook
+type DataHook = connection.DataHook
+
+// WithDataHook sets the hook called with the payload of each data message, a
+// JSON encoded GraphQL response, before it's sent. The extensions it returns,
+// e.g. timing info, sequence numbers or the region of the server, are added
+// to the extensions object of the payload it returns, replacing those with the
+// same keys. A payload which isn't a JSON object isn't sent, an error message
+// is sent instead and the operation keeps forwarding the data that follows.
+func WithDataHook(fn DataHook) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.OnData(fn))
+	}
+}
@@ -2,49 +2,47 @@ package graphqlws
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gorilla/websocket"
 
 	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/eventloop"
 	"context"
 )
 
+// AuthValidator checks the requests to upgrade to a websocket, it returns the
+// context the connection runs with or an error to reject the request, see
+// AuthError. It may be nil for public endpoints.
 type AuthValidator interface {
 	CheckAuth(r *http.Request, ctx context.Context) (context.Context, error)
 }
 
-const protocolGraphQLWS = "graphql-ws"
-
+// upgrader speaks the subprotocol set as the Sec-Websocket-Protocol response
+// header, see handler.negotiate
 var upgrader = websocket.Upgrader{
 	CheckOrigin:  func(r *http.Request) bool { return true },
-	Subprotocols: []string{protocolGraphQLWS},
 }
 
+type handler struct {
+	authStatus    int
+	authValidator AuthValidator
+	closeGrace    time.Duration
+	connLimits    connLimits
+	connOptions   []connection.Option
+	errorReporter ErrorReporter
+	eventLoop     *eventloop.Loop
+	gatewayStore  APIGatewayStore
+	protocols     []string
+	subject       func(ctx context.Context) string
+	upgrader      *websocket.Upgrader
+	wsBackend     WebSocketBackend
+}
+
+// Option configures a Server or the handler returned by NewHandlerFunc
+type Option func(h *handler)
+
 // NewHandlerFunc returns an http.HandlerFunc that supports GraphQL over websockets
-func NewHandlerFunc(rootCtx context.Context, svc connection.GraphQLService, httpHandler http.Handler, authValidator AuthValidator) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		for _, subprotocol := range websocket.Subprotocols(r) {
-			if subprotocol == "graphql-ws" {
-				ctx, err := authValidator.CheckAuth(r, rootCtx)
-				if err != nil {
-					return
-				}
-				ws, err := upgrader.Upgrade(w, r, nil)
-				if err != nil {
-					return
-				}
-
-				if ws.Subprotocol() != protocolGraphQLWS {
-					ws.Close()
-					return
-				}
-
-				go connection.Connect(ws, svc, ctx)
-				return
-			}
-		}
-
-		// Fallback to HTTP
-		httpHandler.ServeHTTP(w, r)
-	}
+func NewHandlerFunc(rootCtx context.Context, svc connection.GraphQLService, httpHandler http.Handler, authValidator AuthValidator, options ...Option) http.HandlerFunc {
+	return NewServer(rootCtx, svc, httpHandler, authValidator, options...).ServeHTTP
 }
@@ -0,0 +1,47 @@
+package graphqlws
+
+import (
+	"context"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// IDGenerator generates the socket ids of operations, see the graphqlwstest
+// package for deterministic ones
+type IDGenerator = connection.IDGenerator
+
+// IDGeneratorFunc is a function implementing IDGenerator
+type IDGeneratorFunc = connection.IDGeneratorFunc
+
+// RandomIDs returns the IDGenerator used by default, drawing ids from source
+var RandomIDs = connection.RandomIDs
+
+// WithIDGenerator sets the generator of the socket ids of operations, e.g. to
+// make golden tests and transcripts reproducible
+func WithIDGenerator(g IDGenerator) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.GenerateIDs(g))
+	}
+}
+
+// ConnectionID identifies a connection, it's logged as connection_id and
+// tags the traces and events of the connection
+type ConnectionID = connection.ConnectionID
+
+// ConnectionIDFromContext returns the id of the connection ctx belongs to,
+// e.g. the context of an operation, false if it doesn't belong to one
+func ConnectionIDFromContext(ctx context.Context) (ConnectionID, bool) {
+	return connection.ConnectionIDFromContext(ctx)
+}
+
+// UUIDs is the IDGenerator of the ids of connections used by default, which
+// generates random UUIDs
+var UUIDs = connection.UUIDs
+
+// WithConnectionIDGenerator sets the generator of the ids of connections, e.g.
+// to make them sortable or reproducible
+func WithConnectionIDGenerator(g IDGenerator) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.GenerateConnectionIDs(g))
+	}
+}
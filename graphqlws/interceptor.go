@@ -0,0 +1,19 @@
+package graphqlws
+
+import "github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+
+// Interceptor intercepts the protocol events of connections: their
+// connection_init, the start, data messages and completion of their
+// operations and their closing. Its callbacks may reject connections and
+// operations, rewrite operations and payloads or drop data messages, e.g. to
+// enforce quotas, audit or redact them. All of them are optional.
+type Interceptor = connection.Interceptor
+
+// WithInterceptor adds an Interceptor to every connection. Interceptors are
+// chained in the order they were added, and in reverse order when operations
+// and connections end.
+func WithInterceptor(i Interceptor) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.Intercept(i))
+	}
+}
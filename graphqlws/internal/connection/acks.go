@@ -0,0 +1,213 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// defaultAckWindow is how many data messages of an operation may await their
+// acknowledgement when AckConfig.Window isn't set
+const defaultAckWindow = 64
+
+// ErrNotAcknowledged is the error of the operations whose data messages the
+// client didn't acknowledge despite being sent again, see Acknowledge
+var ErrNotAcknowledged = errors.New("data not acknowledged")
+
+// AckConfig configures the acknowledgement extension, see Acknowledge
+type AckConfig struct {
+	// Window is how many data messages of an operation may await their
+	// acknowledgement, the operation then waits for the client before
+	// sending more. The default is 64.
+	Window int
+	// RetryAfter is how long a data message may await its acknowledgement
+	// before it's sent again. With the default of 0 messages are never sent
+	// again, only kept until acknowledged.
+	RetryAfter time.Duration
+	// MaxRetries is how many times a data message is sent again before the
+	// operation fails with ErrNotAcknowledged, 0 doesn't limit them.
+	MaxRetries int
+}
+
+// Acknowledge lets clients opt in to acknowledging the data messages of an
+// operation with "ack": true in its start payload. They then carry a sequence
+// number, seq, counting from 1, which the client acknowledges along with the
+// ones before with an ack message whose payload is {"seq": n}. Up to Window
+// messages are kept until acknowledged and sent again every RetryAfter.
+//
+// The Delivered function of a Delivery is only called once its message is
+// acknowledged, not written, and the ID of an Event is only recorded as the
+// last one of the session's operation by then, see PersistSessions. Messages
+// still awaiting their acknowledgement when the operation ends are dropped.
+func Acknowledge(config AckConfig) Option {
+	return func(conn *connection) {
+		if config.Window <= 0 {
+			config.Window = defaultAckWindow
+		}
+		conn.acks = config
+	}
+}
+
+// acknowledgePayload acknowledges the data messages of an operation up to Seq
+type acknowledgePayload struct {
+	Seq uint64 `json:"seq"`
+}
+
+// ackWindow tracks the data messages of an operation awaiting their
+// acknowledgement
+type ackWindow struct {
+	config AckConfig
+
+	mu      sync.Mutex
+	seq     uint64
+	pending []*unacked
+	// space is signaled when messages are acknowledged
+	space chan struct{}
+	// failed is closed once a message was sent again MaxRetries times
+	failed     chan struct{}
+	failedOnce sync.Once
+}
+
+// unacked is a data message awaiting its acknowledgement
+type unacked struct {
+	seq       uint64
+	payload   json.RawMessage
+	eventID   string
+	delivered func()
+	sent      time.Time
+	retries   int
+}
+
+func newAckWindow(config AckConfig) *ackWindow {
+	return &ackWindow{
+		config: config,
+		space:  make(chan struct{}, 1),
+		failed: make(chan struct{}),
+	}
+}
+
+// acquire waits until the window has room for a message. It returns false if
+// ctx is done or the window failed before that happens.
+func (w *ackWindow) acquire(ctx context.Context) bool {
+	for {
+		w.mu.Lock()
+		n := len(w.pending)
+		w.mu.Unlock()
+		if n < w.config.Window {
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-w.failed:
+			return false
+		case <-w.space:
+		}
+	}
+}
+
+// track numbers msg, sent at now, and keeps a copy of it until acknowledged.
+// Its delivered function is taken over, to be called on acknowledgement.
+func (w *ackWindow) track(msg *operationMessage, now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.seq++
+	msg.Seq = w.seq
+	w.pending = append(w.pending, &unacked{
+		seq:       w.seq,
+		payload:   append(json.RawMessage(nil), msg.Payload...),
+		eventID:   msg.EventID,
+		delivered: msg.delivered,
+		sent:      now,
+	})
+	msg.delivered = nil
+}
+
+// ack returns the messages acknowledged with seq, in order
+func (w *ackWindow) ack(seq uint64) []*unacked {
+	w.mu.Lock()
+	n := 0
+	for n < len(w.pending) && w.pending[n].seq <= seq {
+		n++
+	}
+	acked := w.pending[:n:n]
+	w.pending = w.pending[n:]
+	w.mu.Unlock()
+
+	if n > 0 {
+		select {
+		case w.space <- struct{}{}:
+		default:
+		}
+	}
+	return acked
+}
+
+// due returns the messages to send again at now, or false once one of them
+// was sent again MaxRetries times, in which case the window fails
+func (w *ackWindow) due(now time.Time) ([]*unacked, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var resend []*unacked
+	for _, u := range w.pending {
+		if now.Sub(u.sent) < w.config.RetryAfter {
+			continue
+		}
+		if w.config.MaxRetries > 0 && u.retries == w.config.MaxRetries {
+			w.failedOnce.Do(func() { close(w.failed) })
+			return nil, false
+		}
+		u.retries++
+		u.sent = now
+		resend = append(resend, u)
+	}
+	return resend, true
+}
+
+// resendUnacked sends the data messages of op again every RetryAfter until
+// they are acknowledged or ctx is done
+func (conn *connection) resendUnacked(ctx context.Context, sendMessage sendMessageFunc, op *operation) {
+	ticker := conn.clock.NewTicker(conn.acks.RetryAfter)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+
+		resend, ok := op.acks.due(conn.clock.Now())
+		if !ok {
+			return
+		}
+		for _, u := range resend {
+			op.send(sendMessage, &operationMessage{Type: typeData, Payload: u.payload, EventID: u.eventID, Seq: u.seq})
+		}
+	}
+}
+
+// acknowledged handles the acknowledgement of the data messages of op up to
+// seq
+func (conn *connection) acknowledged(op *operation, seq uint64) {
+	for _, u := range op.acks.ack(seq) {
+		if u.eventID != "" {
+			conn.session.advance(op.id, u.eventID)
+		}
+		if u.delivered != nil {
+			u.delivered()
+		}
+	}
+}
+
+// operationUnacknowledged fails op once a data message wasn't acknowledged
+// despite being sent again MaxRetries times
+func (conn *connection) operationUnacknowledged(sendMessage sendMessageFunc, op *operation) {
+	conn.session.remove(op.id)
+	conn.ops.remove(op)
+	op.send(sendMessage, &operationMessage{Type: typeError, Payload: errPayload(ErrNotAcknowledged)})
+	op.send(sendMessage, &operationMessage{Type: typeComplete})
+}
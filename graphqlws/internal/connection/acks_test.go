@@ -0,0 +1,104 @@
+package connection_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+const ackedConnectionACK = `{
+	"type": "connection_ack",
+	"payload": {
+		"extensions": {
+			"ackWindow": 1,
+			"batching": true,
+			"flowControl": true,
+			"resume": true
+		}
+	}
+}`
+
+func TestAcknowledge(t *testing.T) {
+	delivered := make(chan struct{})
+	svc := newGQLServiceWithPayloads(
+		connection.Delivery{Payload: json.RawMessage(`{"data":{"n":1}}`), Delivered: func() { close(delivered) }},
+		json.RawMessage(`{"data":{"n":2}}`),
+	)
+	clock := graphqlwstest.NewFakeClock(time.Now())
+	ws := newConnection()
+	go connection.Connect(ws, svc, context.Background(),
+		connection.UseClock(clock),
+		connection.Acknowledge(connection.AckConfig{Window: 1, RetryAfter: time.Second}),
+	)
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: ackedConnectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{"ack":true}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"data","payload":{"data":{"n":1}},"seq":1}`},
+	})
+
+	// not acknowledged in time
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	ws.test(t, []message{
+		{intention: expectation, operationMessage: `{"id":"a","type":"data","payload":{"data":{"n":1}},"seq":1}`},
+	})
+	select {
+	case <-delivered:
+		t.Fatal("expected the payload not to be delivered before it's acknowledged")
+	default:
+	}
+
+	// the window is full until then
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"id":"a","type":"ack","payload":{"seq":1}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"data","payload":{"data":{"n":2}},"seq":2}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+	})
+	select {
+	case <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the payload to be delivered")
+	}
+	ws.in <- []byte(`{"type":"connection_terminate"}`)
+}
+
+func TestAcknowledgeRetries(t *testing.T) {
+	payloads := make(chan interface{}, 1)
+	payloads <- json.RawMessage(`{"data":{"n":1}}`)
+	svc := &gqlService{payloads: payloads}
+	clock := graphqlwstest.NewFakeClock(time.Now())
+	ws := newConnection()
+	go connection.Connect(ws, svc, context.Background(),
+		connection.UseClock(clock),
+		connection.Acknowledge(connection.AckConfig{Window: 1, RetryAfter: time.Second, MaxRetries: 1}),
+	)
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: ackedConnectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{"ack":true}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"data","payload":{"data":{"n":1}},"seq":1}`},
+	})
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	ws.test(t, []message{
+		{intention: expectation, operationMessage: `{"id":"a","type":"data","payload":{"data":{"n":1}},"seq":1}`},
+	})
+	clock.Advance(time.Second)
+	ws.test(t, []message{
+		{intention: expectation, operationMessage: `{"id":"a","type":"error","payload":{"message":"data not acknowledged"}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+		// the acknowledgements of operations which are over are ignored
+		{intention: clientSends, operationMessage: `{"id":"a","type":"ack","payload":{"seq":1}}`},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"ack","payload":{}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"error","payload":{"message":"invalid payload for type: ack"}}`},
+	})
+	ws.in <- []byte(`{"type":"connection_terminate"}`)
+}
@@ -0,0 +1,75 @@
+package connection
+
+import (
+	"context"
+	"time"
+)
+
+// Budget limits how many operations may be running at the same time across
+// all the connections sharing it, each operation accounting for its Subscribe
+// call and the goroutine forwarding its payloads.
+type Budget struct {
+	slots chan struct{}
+	wait  time.Duration
+}
+
+// NewBudget returns a budget of size operations, a start message received
+// while the budget is exhausted waits up to wait for an operation to finish
+// before being rejected. It panics if size isn't positive.
+func NewBudget(size int, wait time.Duration) *Budget {
+	if size <= 0 {
+		panic("connection: non-positive size for NewBudget")
+	}
+	return &Budget{
+		slots: make(chan struct{}, size),
+		wait:  wait,
+	}
+}
+
+// OperationBudget makes new operations count against b
+func OperationBudget(b *Budget) Option {
+	return func(conn *connection) {
+		conn.budget = b
+	}
+}
+
+// acquire reserves a slot for an operation, the returned func must be called
+// to release it once the operation is done.
+func (b *Budget) acquire(ctx context.Context, clock Clock) (func(), error) {
+	release := func() { <-b.slots }
+
+	select {
+	case b.slots <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	timer := clock.NewTimer(b.wait)
+	defer timer.Stop()
+
+	select {
+	case b.slots <- struct{}{}:
+		return release, nil
+	case <-timer.C():
+		return nil, &capacityError{retryAfter: defaultRetryAfter}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// capacityError is returned to clients starting an operation while the server
+// is at capacity, with a hint of when to retry in milliseconds
+type capacityError struct {
+	retryAfter time.Duration
+}
+
+func (e *capacityError) Error() string {
+	return "server is at capacity, retry later"
+}
+
+func (e *capacityError) Extensions() map[string]interface{} {
+	return map[string]interface{}{
+		"code":       "CAPACITY_EXCEEDED",
+		"retryAfter": int64(e.retryAfter / time.Millisecond),
+	}
+}
@@ -0,0 +1,80 @@
+package connection
+
+import (
+	"context"
+	"runtime"
+	"runtime/metrics"
+	"time"
+)
+
+// defaultRetryAfter is the delay clients are told to retry after when
+// rejected by the operation budget
+const defaultRetryAfter = time.Second
+
+// CapacityCheck reports whether the server is over capacity, in which case
+// new operations are rejected and clients told to retry after retryAfter
+type CapacityCheck func() (retryAfter time.Duration, over bool)
+
+// Capacity makes new operations be rejected while any of checks reports the
+// server is over capacity
+func Capacity(checks ...CapacityCheck) Option {
+	return func(conn *connection) {
+		conn.capacity = append(conn.capacity, checks...)
+	}
+}
+
+// MaxGoroutines reports the server over capacity while more than n goroutines
+// exist
+func MaxGoroutines(n int, retryAfter time.Duration) CapacityCheck {
+	return func() (time.Duration, bool) {
+		return retryAfter, runtime.NumGoroutine() > n
+	}
+}
+
+// heapMetric is the runtime metric of the memory occupied by heap objects
+const heapMetric = "/memory/classes/heap/objects:bytes"
+
+// MaxHeapBytes reports the server over capacity while heap objects occupy
+// more than n bytes, including unreachable ones not yet collected
+func MaxHeapBytes(n uint64, retryAfter time.Duration) CapacityCheck {
+	return func() (time.Duration, bool) {
+		sample := []metrics.Sample{{Name: heapMetric}}
+		metrics.Read(sample)
+		return retryAfter, sample[0].Value.Kind() == metrics.KindUint64 && sample[0].Value.Uint64() > n
+	}
+}
+
+// admit checks the connection isn't draining and the server is ready and has
+// capacity for a new operation, and counts it against the limits and the
+// budget if any. The returned func must be called to release its slots once
+// the operation is done.
+func (conn *connection) admit(ctx context.Context) (func(), error) {
+	if conn.isDraining() {
+		return nil, ErrServerShutdown
+	}
+	if conn.ready != nil && !conn.ready() {
+		return nil, errNotReady
+	}
+	for _, check := range conn.capacity {
+		if retryAfter, over := check(); over {
+			return nil, &capacityError{retryAfter: retryAfter}
+		}
+	}
+
+	release, err := conn.acquireLimits()
+	if err != nil {
+		return nil, err
+	}
+	if conn.budget == nil {
+		return release, nil
+	}
+	releaseBudget, err := conn.budget.acquire(ctx, conn.clock)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return func() {
+		releaseBudget()
+		release()
+	}, nil
+}
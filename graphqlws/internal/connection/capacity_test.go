@@ -0,0 +1,74 @@
+package connection_test
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestCapacity(t *testing.T) {
+	over := true
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(), context.Background(), connection.Capacity(func() (time.Duration, bool) {
+		return 5 * time.Second, over
+	}))
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"error","payload":{"message":"server is at capacity, retry later","extensions":{"code":"CAPACITY_EXCEEDED","retryAfter":5000}}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
+
+func TestCapacityChecks(t *testing.T) {
+	for name, tc := range map[string]struct {
+		check connection.CapacityCheck
+		over  bool
+	}{
+		"goroutines over":  {check: connection.MaxGoroutines(1, time.Second), over: true},
+		"goroutines under": {check: connection.MaxGoroutines(math.MaxInt32, time.Second)},
+		"heap over":        {check: connection.MaxHeapBytes(1, time.Second), over: true},
+		"heap under":       {check: connection.MaxHeapBytes(math.MaxUint64, time.Second)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			retryAfter, over := tc.check()
+			if over != tc.over || retryAfter != time.Second {
+				t.Fatalf("expected %t but instead got %t after %s", tc.over, over, retryAfter)
+			}
+		})
+	}
+}
+
+func TestBudgetWait(t *testing.T) {
+	svc := &gqlService{payloads: make(chan interface{})}
+	ws := newConnection()
+	go connection.Connect(ws, svc, context.Background(), connection.OperationBudget(connection.NewBudget(1, time.Hour)))
+
+	// b waits for the slot of a, stopping a is still read
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{}}`},
+		{intention: clientSends, operationMessage: `{"id":"b","type":"start","payload":{}}`},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"stop"}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"id":"b","type":"stop"}`},
+		{intention: expectation, operationMessage: `{"id":"b","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
+
+func TestNewBudgetSize(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected NewBudget to panic with a size of 0")
+		}
+	}()
+	connection.NewBudget(0, time.Second)
+}
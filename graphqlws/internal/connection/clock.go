@@ -0,0 +1,66 @@
+package connection
+
+import "time"
+
+// Clock tells the time and makes the timers and tickers of a connection, e.g.
+// for keepalives and write deadlines, so that tests can replace it with a fake
+// clock instead of sleeping
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a time.Timer made by a Clock
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// Ticker is a time.Ticker made by a Clock
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// UseClock sets the clock of the connection, the default is the real one.
+// Fake clocks are meant to be used with fake transports, since the write
+// deadlines set on the transport are computed with it.
+func UseClock(c Clock) Option {
+	return func(conn *connection) {
+		conn.clock = c
+	}
+}
+
+// RealClock is the Clock backed by the time package
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
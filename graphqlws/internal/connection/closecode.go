@@ -0,0 +1,71 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"unicode/utf8"
+)
+
+// CloseCode is a websocket close code
+type CloseCode int
+
+// The close codes defined by graphql-transport-ws
+const (
+	// CloseBadRequest means the client sent an invalid message
+	CloseBadRequest CloseCode = 4400
+	// CloseUnauthorized means the client started an operation before its
+	// connection was acknowledged
+	CloseUnauthorized CloseCode = 4401
+	// CloseForbidden means the client was rejected by the server
+	CloseForbidden CloseCode = 4403
+	// CloseInitTimeout means the client didn't send its connection_init in
+	// time
+	CloseInitTimeout CloseCode = 4408
+	// CloseSubscriberExists means the client started an operation with the
+	// id of a running one
+	CloseSubscriberExists CloseCode = 4409
+	// CloseTooManyInits means the client sent connection_init more than once
+	CloseTooManyInits CloseCode = 4429
+	// CloseTooManyRequests means the client sent messages beyond a rate
+	// limit, see RateLimitClose
+	CloseTooManyRequests CloseCode = 4429
+)
+
+// CloseError is the close reason of the connections closed with a close code
+// and reason, see Close
+type CloseError struct {
+	Code   CloseCode
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("closed with %d: %s", e.Code, e.Reason)
+}
+
+// Close closes the connection ctx belongs to, sending a close frame with code
+// and reason where the transport supports close frames. The reason is
+// truncated to the 123 bytes a close frame holds and the close reason of the
+// connection is a *CloseError. It returns false if ctx doesn't belong to a
+// connection.
+func Close(ctx context.Context, code CloseCode, reason string) bool {
+	conn, ok := ctx.Value(connectionKey).(*connection)
+	if !ok {
+		return false
+	}
+	reason = truncateCloseText(reason)
+	conn.closeWithText(int(code), reason, &CloseError{Code: code, Reason: reason})
+	return true
+}
+
+// truncateCloseText truncates text to what a close frame holds, on a rune
+// boundary
+func truncateCloseText(text string) string {
+	if len(text) <= maxCloseText {
+		return text
+	}
+	text = text[:maxCloseText]
+	for len(text) > 0 && !utf8.ValidString(text) {
+		text = text[:len(text)-1]
+	}
+	return text
+}
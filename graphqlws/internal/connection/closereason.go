@@ -0,0 +1,72 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// The reasons a connection is closed for, as returned by CloseReason. A
+// connection closed by the server, e.g. because its root context was
+// cancelled, has the error of that context as its reason.
+var (
+	// ErrClientGone means reading from the client failed, e.g. because it
+	// closed the websocket or went away, it wraps the read error
+	ErrClientGone = errors.New("client gone")
+	// ErrClientTerminated means the client sent connection_terminate
+	ErrClientTerminated = errors.New("connection terminated by the client")
+	// ErrMalformedFrame means the client sent a frame that isn't a valid
+	// operation message or batch of them
+	ErrMalformedFrame = errors.New("malformed frame")
+	// ErrWriteFailed means writing to the client failed, e.g. because it
+	// didn't read fast enough, it wraps the write error
+	ErrWriteFailed = errors.New("write failed")
+	// ErrNoOperation means the client didn't start an operation in time, see
+	// FirstOperationTimeout
+	ErrNoOperation = errors.New("no operation started")
+	// ErrInitRejected means the InitHandler rejected the connection_init
+	// payload, it wraps the error it returned
+	ErrInitRejected = errors.New("connection_init rejected")
+	// ErrServerShutdown means the connection was drained, see DrainOn
+	ErrServerShutdown = errors.New("server shutting down")
+	// ErrInitTimeout means the client didn't send its connection_init in
+	// time, see ConnectionInitTimeout
+	ErrInitTimeout = errors.New("connection_init timed out")
+)
+
+// CloseReason returns the reason the connection ctx belongs to was closed for,
+// it's meant to be called by Observer.ConnectionEnd and returns nil until the
+// connection is closed.
+func CloseReason(ctx context.Context) error {
+	conn, ok := ctx.Value(connectionKey).(*connection)
+	if !ok {
+		return nil
+	}
+	return conn.closeReason
+}
+
+// Done returns a channel closed as soon as the connection ctx belongs to
+// starts closing, e.g. because reading from the client failed. The contexts of
+// its operations are all done right after, before the transport is closed. It
+// returns nil if ctx doesn't belong to a connection.
+func Done(ctx context.Context) <-chan struct{} {
+	conn, ok := ctx.Value(connectionKey).(*connection)
+	if !ok {
+		return nil
+	}
+	return conn.ctx.Done()
+}
+
+// setCloseReason records err as the reason the connection is closed for,
+// unless one was already recorded
+func (conn *connection) setCloseReason(err error) {
+	conn.reasonOnce.Do(func() {
+		conn.closeReason = err
+	})
+}
+
+// wrapCloseReason wraps both reason and the error that caused it, so that
+// errors.Is matches either
+func wrapCloseReason(reason error, err error) error {
+	return fmt.Errorf("%w: %w", reason, err)
+}
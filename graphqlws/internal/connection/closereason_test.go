@@ -0,0 +1,62 @@
+package connection_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// reasonObserver records the close reasons of the connections it observes
+type reasonObserver chan error
+
+func (o reasonObserver) ConnectionStart(ctx context.Context, info connection.ConnectionInfo) context.Context {
+	return ctx
+}
+
+func (o reasonObserver) ConnectionEnd(ctx context.Context) {
+	o <- connection.CloseReason(ctx)
+}
+
+func (o reasonObserver) OperationStart(ctx context.Context, info connection.OperationInfo) context.Context {
+	return ctx
+}
+
+func (o reasonObserver) OperationEnd(ctx context.Context, err error) {}
+
+func TestCloseReason(t *testing.T) {
+	for name, tc := range map[string]struct {
+		frame    string
+		cancel   bool
+		expected error
+	}{
+		"terminated": {frame: `{"type":"connection_terminate"}`, expected: connection.ErrClientTerminated},
+		"malformed":  {frame: `{"type":`, expected: connection.ErrMalformedFrame},
+		"cancelled":  {cancel: true, expected: context.Canceled},
+	} {
+		t.Run(name, func(t *testing.T) {
+			o := make(reasonObserver, 1)
+			ws := newConnection()
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go connection.Connect(ws, newGQLService(), ctx, connection.Observe(o))
+
+			if tc.cancel {
+				cancel()
+			} else {
+				ws.in <- []byte(tc.frame)
+			}
+
+			select {
+			case got := <-o:
+				if !errors.Is(got, tc.expected) {
+					t.Fatalf("expected %v but instead got %v", tc.expected, got)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("expected the connection to be closed")
+			}
+		})
+	}
+}
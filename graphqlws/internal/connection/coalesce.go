@@ -0,0 +1,75 @@
+package connection
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// maxCoalesced bounds how many messages are written in a single frame
+const maxCoalesced = 64
+
+// coalescing writes the messages queued within a window after a data message
+// in a single frame
+type coalescing struct {
+	window time.Duration
+	// enabled is set when the client opted in, it's read by the writer
+	enabled int32
+}
+
+// CoalesceWrites lets clients opt in to write coalescing with "coalesce": true
+// in the connection_init payload, the window is then confirmed in milliseconds
+// in the connection_ack payload. Once a data message is to be written, the
+// messages queued within window after it are written along with it as a batch,
+// i.e. a single frame holding an array of operation messages, which saves
+// frames and syscalls for high-frequency subscriptions at the cost of up to
+// window of latency.
+func CoalesceWrites(window time.Duration) Option {
+	return func(conn *connection) {
+		conn.coalescing.window = window
+	}
+}
+
+// negotiate enables coalescing if both the client and the server opted in
+func (c *coalescing) negotiate(requested bool) {
+	var enabled int32
+	if requested && c.window > 0 {
+		enabled = 1
+	}
+	atomic.StoreInt32(&c.enabled, enabled)
+}
+
+// confirmed returns the window confirmed to the client, in milliseconds, 0
+// unless coalescing is enabled
+func (c *coalescing) confirmed() int64 {
+	if atomic.LoadInt32(&c.enabled) == 0 {
+		return 0
+	}
+	return int64(c.window / time.Millisecond)
+}
+
+// coalesce returns the messages to write along with msg in a single frame,
+// i.e. msg alone unless it's a data message and coalescing is enabled
+func (conn *connection) coalesce(ctx context.Context, msg *operationMessage, out *outbox, batch []*operationMessage) []*operationMessage {
+	batch = append(batch[:0], msg)
+	if msg.Type != typeData || atomic.LoadInt32(&conn.coalescing.enabled) == 0 {
+		return batch
+	}
+
+	timer := conn.clock.NewTimer(conn.coalescing.window)
+	defer timer.Stop()
+	for len(batch) < maxCoalesced {
+		if next := out.pop(); next != nil {
+			batch = append(batch, next)
+			continue
+		}
+		select {
+		case <-out.ready:
+		case <-timer.C():
+			return batch
+		case <-ctx.Done():
+			return batch
+		}
+	}
+	return batch
+}
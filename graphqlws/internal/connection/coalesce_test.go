@@ -0,0 +1,46 @@
+package connection_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestCoalesceWrites(t *testing.T) {
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(`{"data":1}`, `{"data":2}`, `{"data":3}`), context.Background(),
+		connection.CoalesceWrites(100*time.Millisecond),
+	)
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{"coalesce":true}}`},
+		{intention: expectation, operationMessage: `{"type":"connection_ack","payload":{"extensions":{"batching":true,"coalesce":100,"flowControl":true,"resume":true}}}`},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{}}`},
+		{intention: expectation, operationMessage: `[
+			{"id":"a","type":"data","payload":{"data":1}},
+			{"id":"a","type":"data","payload":{"data":2}},
+			{"id":"a","type":"data","payload":{"data":3}},
+			{"id":"a","type":"complete"}
+		]`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
+
+func TestCoalesceWritesNotRequested(t *testing.T) {
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(`{"data":1}`, `{"data":2}`), context.Background(),
+		connection.CoalesceWrites(100*time.Millisecond),
+	)
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"data","payload":{"data":1}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"data","payload":{"data":2}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
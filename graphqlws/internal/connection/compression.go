@@ -0,0 +1,61 @@
+package connection
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// Compressor compresses data payloads once negotiated with the client, Name is
+// the codec name used in the connection_init and connection_ack payloads.
+type Compressor interface {
+	Name() string
+	Compress(data []byte) ([]byte, error)
+}
+
+type compression struct {
+	codecs  []Compressor
+	minSize int
+}
+
+// Compression enables payload compression with the given codecs. Clients opt in
+// by listing the codecs they support in the connection_init payload, the first
+// one also supported by the server is then confirmed in the connection_ack
+// payload and used for data payloads of at least minSize bytes.
+//
+// This works independently of the permessage-deflate websocket extension, which
+// is often stripped by proxies.
+func Compression(minSize int, codecs ...Compressor) Option {
+	return func(conn *connection) {
+		conn.compression = compression{
+			codecs:  codecs,
+			minSize: minSize,
+		}
+	}
+}
+
+// negotiate returns the first codec requested by the client that is supported
+// by the server, or nil if there's none.
+func (c compression) negotiate(requested []string) Compressor {
+	for _, name := range requested {
+		for _, codec := range c.codecs {
+			if codec.Name() == name {
+				return codec
+			}
+		}
+	}
+	return nil
+}
+
+// compress returns the compressed payload as a base64 encoded JSON string, so
+// clients can tell it apart from uncompressed payloads which are JSON objects.
+func (c compression) compress(codec Compressor, payload json.RawMessage) (json.RawMessage, error) {
+	if len(payload) < c.minSize {
+		return payload, nil
+	}
+
+	data, err := codec.Compress(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(data))
+}
@@ -6,7 +6,9 @@ import (
 	"errors"
 	"fmt"
 	"github.com/graph-gophers/graphql-go"
-	"math/rand"
+	"log/slog"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -27,36 +29,104 @@ const (
 	typePing                operationMessageType = "ping"
 	typeReceive             operationMessageType = "receive"
 	typePong                operationMessageType = "pong"
+	typeCredit              operationMessageType = "credit"
+	typeAck                 operationMessageType = "ack"
 )
 
 type wsConnection interface {
 	Close() error
-	ReadJSON(v interface{}) error
+	ReadMessage() (messageType int, p []byte, err error)
 	SetReadLimit(limit int64)
 	SetWriteDeadline(t time.Time) error
-	WriteJSON(v interface{}) error
+	WriteMessage(messageType int, data []byte) error
 }
 
-type sendFunc func(id string, omType operationMessageType, payload json.RawMessage)
+type sendMessageFunc func(msg *operationMessage)
+
+func (sendMessage sendMessageFunc) send(id string, omType operationMessageType, payload json.RawMessage) {
+	sendMessage(&operationMessage{ID: id, Type: omType, Payload: payload})
+}
 
 // TODO?: omitempty?
 type operationMessage struct {
 	ID      string               `json:"id,omitempty"`
 	Payload json.RawMessage      `json:"payload,omitempty"`
 	Type    operationMessageType `json:"type"`
+	EventID string               `json:"eventId,omitempty"`
+	// Seq numbers the data messages to acknowledge, see Acknowledge
+	Seq uint64 `json:"seq,omitempty"`
+
+	// priority of the operation the message belongs to, see Prioritize
+	priority int
+	// payloadBuf holds Payload when marshaled by marshalPayload
+	payloadBuf *payloadBuffer
+	// delivered is called once the message is written, see Delivery
+	delivered func()
+	// deadline is when the message goes stale, see Delivery
+	deadline time.Time
 }
 
 type startMessagePayload struct {
 	OperationName string                 `json:"operationName"`
 	Query         string                 `json:"query"`
 	Variables     map[string]interface{} `json:"variables"`
+	// Credits opts the operation into flow control, see creditMessagePayload
+	Credits *int `json:"credits,omitempty"`
+	// LastEventID is the ID of the last event the client received before
+	// reconnecting, allowing the service to resume the stream after it
+	LastEventID string `json:"lastEventId,omitempty"`
+	// Ack opts the operation into acknowledgements, see Acknowledge
+	Ack bool `json:"ack,omitempty"`
+	// Extensions may hold the hash of the document, see PersistedQueries
+	Extensions *startExtensions `json:"extensions,omitempty"`
+}
+
+// creditMessagePayload grants an operation started with flow control
+// permission to push that many more data messages
+type creditMessagePayload struct {
+	Credits int `json:"credits"`
+}
+
+type receiveMessagePayload struct {
+	ID string `json:"id"`
 }
 
-type receiveMessagePayload struct{
-	ID	string	`json:"id"`
+type initMessagePayload struct {
+	// Coalesce opts in to write coalescing, see CoalesceWrites
+	Coalesce bool `json:"coalesce,omitempty"`
+	// Compression lists the payload compression codecs supported by the
+	// client, in order of preference
+	Compression []string `json:"compression,omitempty"`
+	// KeepAlive is the keepalive interval requested by the client, in
+	// milliseconds
+	KeepAlive int64 `json:"keepAlive,omitempty"`
+	// RTT opts in to round-trip time measurement
+	RTT bool `json:"rtt,omitempty"`
+	// Session opts in to a persisted session, see PersistSessions
+	Session bool `json:"session,omitempty"`
+	// SessionToken is the token of the session to restore
+	SessionToken string `json:"sessionToken,omitempty"`
 }
 
-type initMessagePayload struct{}
+// ackMessagePayload advertises the protocol extensions supported by the server
+// so clients can make use of them without out-of-band configuration
+type ackMessagePayload struct {
+	Extensions extensions `json:"extensions"`
+}
+
+type extensions struct {
+	AckWindow   int            `json:"ackWindow,omitempty"`
+	Batching    bool           `json:"batching"`
+	Coalesce    int64          `json:"coalesce,omitempty"`
+	Compression string         `json:"compression,omitempty"`
+	FlowControl bool           `json:"flowControl"`
+	KeepAlive   int64          `json:"keepAlive,omitempty"`
+	Persisted   bool           `json:"persistedQueries,omitempty"`
+	Resume      bool           `json:"resume"`
+	RTT         int64          `json:"rtt,omitempty"`
+	Session     string         `json:"session,omitempty"`
+	Steering    *SteeringHints `json:"steering,omitempty"`
+}
 
 // GraphQLService interface
 type GraphQLService interface {
@@ -64,236 +134,580 @@ type GraphQLService interface {
 	Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response
 }
 
+// errNotInitialized is the error of the operations started before the
+// connection_init of the connection is acknowledged
+var errNotInitialized = errors.New("connection not initialized")
+
 type connection struct {
-	cancel       func()
-	service      GraphQLService
-	writeTimeout time.Duration
-	ws           wsConnection
+	acceptPush    func(id string) bool
+	acked         int32
+	acks          AckConfig
+	authExpiry    func()
+	budget        *Budget
+	capacity      []CapacityCheck
+	cancel        context.CancelCauseFunc
+	clock         Clock
+	closeOnce     sync.Once
+	closeReason   error
+	coalescing    coalescing
+	compression   compression
+	compressor    Compressor
+	connIDs       IDGenerator
+	connLimit     *OperationLimit
+	ctx           context.Context
+	dataObservers []DataObserver
+	drain         context.Context
+	draining      int32
+	errorReporter ErrorReporter
+	events        eventReplay
+	failWrite     int32
+	faults        *Faults
+	firstOp       firstOperation
+	goroutines    sync.WaitGroup
+	handlers      map[operationMessageType]MessageHandler
+	id            ConnectionID
+	ids           IDGenerator
+	initCtx       context.Context
+	initErr       error
+	initTimer     initTimeout
+	interceptors  []Interceptor
+	keepAlive     keepAlive
+	logger        *slog.Logger
+	msgObservers  []MessageObserver
+	multiplexer   *Multiplexer
+	observers     []Observer
+	onClose       []func()
+	onData        DataHook
+	onInit        InitHandler
+	onOpen        []func(ctx context.Context)
+	onPanic       PanicHandler
+	onPing        PingHandler
+	onReceive     ReceiveHandler
+	onRefresh     InitHandler
+	onSubscribe   SubscribeHook
+	opLimit       *OperationLimit
+	ops           registry
+	overflow      OverflowPolicy
+	panicPolicy   PanicPolicy
+	persisted     persistedQueries
+	pingPong      pingPong
+	prioritize    PriorityFunc
+	queueObs      []QueueObserver
+	queueSize     int
+	rates         rateLimits
+	ready         func() bool
+	roundTrip     roundTrip
+	reasonOnce    sync.Once
+	recoverAll    bool
+	results       *ResultCache
+	sendMessage   sendMessageFunc
+	service       GraphQLService
+	session       session
+	sizeLimits    map[operationMessageType]int64
+	steer         func(ctx context.Context) *SteeringHints
+	subObservers  []SubscribeObserver
+	subTimeout    time.Duration
+	varDecoder    VariablesDecoder
+	// startConcurrency and startSem limit how many operations may be
+	// starting at the same time, see StartConcurrency. startQueue is closed
+	// once the last operation started off the read loop has started.
+	startConcurrency int
+	startSem         chan struct{}
+	startQueue       chan struct{}
+	subscribeLimiter *Limiter
+	validators       []QueryValidator
+	writeTimeout     time.Duration
+	ws               wsConnection
 }
 
+// Option configures a connection
+type Option func(conn *connection)
+
 // ReadLimit limits the maximum size of incoming messages
-func ReadLimit(limit int64) func(conn *connection) {
+func ReadLimit(limit int64) Option {
 	return func(conn *connection) {
 		conn.ws.SetReadLimit(limit)
 	}
 }
 
 // WriteTimeout sets a timeout for outgoing messages
-func WriteTimeout(d time.Duration) func(conn *connection) {
+func WriteTimeout(d time.Duration) Option {
 	return func(conn *connection) {
 		conn.writeTimeout = d
 	}
 }
 
+// OnClose registers fn to be called once the connection is closed, functions
+// are called in the order they were registered
+func OnClose(fn func()) Option {
+	return func(conn *connection) {
+		conn.onClose = append(conn.onClose, fn)
+	}
+}
+
 // Connect implements the apollographql subscriptions-transport-ws protocol@v0.9.4
 // https://github.com/apollographql/subscriptions-transport-ws/blob/v0.9.4/PROTOCOL.md
-func Connect(ws wsConnection, service GraphQLService, rootCtx context.Context, options ...func(conn *connection)) func() {
+func Connect(ws wsConnection, service GraphQLService, rootCtx context.Context, options ...Option) func() {
+	conn := newConnection(ws, service, options)
+
+	ctx, cancel := context.WithCancelCause(rootCtx)
+	conn.cancel = cancel
+	ctx = context.WithValue(ctx, connectionKey, conn)
+	ctx = conn.connectionStart(ctx)
+	conn.ctx = ctx
+	conn.logConnect(ctx)
+	conn.opened(ctx)
+	// the goroutine reading is tracked too, Wait returns once Connect does
+	conn.goroutines.Add(1)
+	defer conn.goroutines.Done()
+	sendMessage := conn.writeLoop(ctx)
+	conn.sendMessage = sendMessage
+	conn.watchDrain(ctx, sendMessage)
+	conn.watchInit(ctx)
+	conn.startPing(ctx)
+	conn.readLoop(ctx, sendMessage)
+
+	return func() { cancel(nil) }
+}
+
+// Attach is like Connect but doesn't read from ws: the caller reads frames,
+// e.g. when notified by an event loop that ws is readable, and passes them to
+// handleFrame, which returns false once the connection is closed, and closes
+// it with closeWith when reading fails, with the reason returned by
+// CloseReason, e.g. wrapping ErrClientGone. No goroutine is held by the
+// connection while it's idle, i.e. has no messages to write, except the one
+// sending pings if ws can and a PongWait is set.
+func Attach(ws wsConnection, service GraphQLService, rootCtx context.Context, options ...Option) (handleFrame func(frame json.RawMessage) bool, closeWith func(reason error)) {
+	conn := newConnection(ws, service, options)
+
+	ctx, cancel := context.WithCancelCause(rootCtx)
+	conn.cancel = cancel
+	ctx = context.WithValue(ctx, connectionKey, conn)
+	ctx = conn.connectionStart(ctx)
+	conn.ctx = ctx
+	conn.logConnect(ctx)
+	conn.opened(ctx)
+	sendMessage := conn.writeOnDemand(ctx)
+	conn.sendMessage = sendMessage
+	conn.watchDrain(ctx, sendMessage)
+	conn.watchInit(ctx)
+	conn.startAttachedPing(ctx)
+
+	handleFrame = func(frame json.RawMessage) bool {
+		defer conn.recoverPanic(ctx, "", conn.panicked)
+		if ctx.Err() != nil {
+			return false
+		}
+		conn.extendRead()
+		if !conn.handleFrame(ctx, sendMessage, frame) {
+			conn.close()
+			return false
+		}
+		return true
+	}
+
+	closeWith = func(reason error) {
+		if reason != nil {
+			conn.setCloseReason(reason)
+		}
+		conn.close()
+	}
+	return handleFrame, closeWith
+}
+
+func newConnection(ws wsConnection, service GraphQLService, options []Option) *connection {
 	conn := &connection{
-		service: service,
-		ws:      ws,
+		clock:            RealClock,
+		handlers:         map[operationMessageType]MessageHandler{},
+		connIDs:          UUIDs,
+		ids:              defaultIDs,
+		service:          service,
+		startConcurrency: 1,
+		ws:               ws,
 	}
 
-	defaultOpts := []func(conn *connection){
+	defaultOpts := []Option{
 		ReadLimit(4096),
 		WriteTimeout(time.Second),
+		HandleMessage(string(typePing), conn.handlePing),
+		HandleMessage(string(typeReceive), conn.handleReceive),
 	}
 
 	for _, opt := range append(defaultOpts, options...) {
 		opt(conn)
 	}
+	conn.id = ConnectionID(conn.connIDs.NewID())
 
-	ctx, cancel := context.WithCancel(rootCtx)
-	conn.cancel = cancel
-	conn.readLoop(ctx, conn.writeLoop(ctx))
-
-	return cancel
+	return conn
 }
 
-func (conn *connection) writeLoop(ctx context.Context) sendFunc {
+func (conn *connection) writeLoop(ctx context.Context) sendMessageFunc {
 	stop := make(chan struct{})
-	out := make(chan *operationMessage)
+	out := conn.newOutbox()
 
-	send := func(id string, omType operationMessageType, payload json.RawMessage) {
-		select {
-		case <-stop:
-			return
-		case out <- &operationMessage{ID: id, Type: omType, Payload: payload}:
-		}
+	send := func(msg *operationMessage) {
+		conn.queued(out.push(msg, stop))
 	}
 
-	go func() {
+	conn.spawn(func() {
 		defer close(stop)
 		defer conn.close()
+		defer conn.recoverPanic(ctx, "", conn.panicked)
 
+		w := &writer{conn: conn, out: out}
 		for {
-			select {
-			case <-ctx.Done():
-				return
-			case msg := <-out:
+			msg := out.pop()
+			if msg == nil {
 				select {
 				case <-ctx.Done():
 					return
-				default:
+				case <-out.ready:
 				}
+				continue
+			}
 
-				if err := conn.ws.SetWriteDeadline(time.Now().Add(conn.writeTimeout)); err != nil {
-					return
-				}
+			select {
+			case <-ctx.Done():
+				return
+			default:
+			}
+
+			if !w.writeFrom(ctx, msg) {
+				return
+			}
+		}
+	})
 
-				if err := conn.ws.WriteJSON(msg); err != nil {
+	return send
+}
+
+// writeOnDemand is like writeLoop but only runs a goroutine writing messages
+// while there are some queued.
+func (conn *connection) writeOnDemand(ctx context.Context) sendMessageFunc {
+	stop := make(chan struct{})
+	out := conn.newOutbox()
+
+	var stopOnce sync.Once
+	shutdown := func() {
+		stopOnce.Do(func() {
+			close(stop)
+			conn.close()
+		})
+	}
+	context.AfterFunc(ctx, shutdown)
+
+	var writing int32
+	drain := func() {
+		w := &writer{conn: conn, out: out}
+		for {
+			msg := out.pop()
+			if msg == nil {
+				atomic.StoreInt32(&writing, 0)
+				// a message may have been pushed after pop but before
+				// the store, in which case nobody else is writing it
+				if out.empty() || !atomic.CompareAndSwapInt32(&writing, 0, 1) {
 					return
 				}
+				continue
+			}
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			if !w.writeFrom(ctx, msg) {
+				shutdown()
+				return
 			}
 		}
-	}()
+	}
 
-	return send
+	return func(msg *operationMessage) {
+		dropped, depth := out.push(msg, stop)
+		if atomic.CompareAndSwapInt32(&writing, 0, 1) {
+			conn.spawn(drain)
+		}
+		conn.queued(dropped, depth)
+	}
 }
 
 // TODO?: export this instead of returning a simple func from Connect()
 func (conn *connection) close() {
-	conn.cancel()
-	conn.ws.Close()
+	// unless another reason was recorded, the connection is closed by the
+	// server
+	conn.setCloseReason(conn.ctx.Err())
+	conn.cancel(conn.closeReason)
+	// the operations may run with contexts which aren't derived from the one
+	// of the connection, e.g. returned by the InitHandler
+	conn.ops.each(func(op *operation) { op.cancel() })
+	conn.closeOnce.Do(func() {
+		if err := conn.session.save(context.WithoutCancel(conn.ctx), conn.closeReason, conn.clock.Now()); err != nil {
+			conn.reportError(conn.ctx, "", err)
+		}
+		conn.writeSteeringClose(conn.closeReason)
+		conn.log(conn.ctx, slog.LevelInfo, "close", "", "reason", errorString(conn.closeReason))
+		conn.ws.Close()
+		conn.connectionEnd(conn.ctx)
+		conn.interceptDisconnect(conn.ctx, conn.closeReason)
+		for _, fn := range conn.onClose {
+			fn()
+		}
+	})
 }
 
-func (conn *connection) readLoop(ctx context.Context, send sendFunc) {
+func (conn *connection) readLoop(ctx context.Context, sendMessage sendMessageFunc) {
 	defer conn.close()
+	defer conn.recoverPanic(ctx, "", conn.panicked)
 
-	opDone := map[string]func(){}
 	for {
-		var msg operationMessage
-		err := conn.ws.ReadJSON(&msg)
+		_, frame, err := conn.ws.ReadMessage()
 		if err != nil {
+			conn.setCloseReason(conn.readFailed(err))
 			return
 		}
+		conn.extendRead()
 
-		switch msg.Type {
-		case typeConnectionInit:
-			var initMsg initMessagePayload
-			if err := json.Unmarshal(msg.Payload, &initMsg); err != nil {
-				ep := errPayload(fmt.Errorf("invalid payload for type: %s", msg.Type))
-				send("", typeConnectionError, ep)
-				continue
-			}
-			send("", typeConnectionAck, nil)
+		if !conn.handleFrame(ctx, sendMessage, frame) {
+			return
+		}
+	}
+}
 
-		case typeStart:
-			// TODO: check an operation with the same ID hasn't been started already
-			if msg.ID == "" {
-				ep := errPayload(errors.New("missing ID for start operation"))
-				send("", typeConnectionError, ep)
-				continue
-			}
+// handleFrame handles the messages of an incoming frame, it returns false when
+// the connection should be terminated.
+func (conn *connection) handleFrame(ctx context.Context, sendMessage sendMessageFunc, frame json.RawMessage) bool {
+	msgs, err := decodeFrame(frame)
+	if err != nil {
+		conn.reportError(ctx, "", err)
+		conn.setCloseReason(ErrMalformedFrame)
+		return false
+	}
 
-			var osp startMessagePayload
-			if err := json.Unmarshal(msg.Payload, &osp); err != nil {
-				ep := errPayload(fmt.Errorf("invalid payload for type: %s", msg.Type))
-				send(msg.ID, typeConnectionError, ep)
-				continue
-			}
+	for _, msg := range msgs {
+		// operations run with the context of the connection_init, as
+		// returned by the InitHandler if any
+		if conn.initCtx != nil {
+			ctx = conn.initCtx
+		}
+		if !conn.handleMessage(ctx, sendMessage, msg) {
+			return false
+		}
+	}
+	return true
+}
 
-			opCtx, cancel := context.WithCancel(ctx)
-			uniqID := generateRandomString(64)
-			opCtx = context.WithValue(opCtx, "socket_id", uniqID)
-			// TODO: timeout this call, to guard against poor clients
-			c, err := conn.service.Subscribe(opCtx, osp.Query, osp.OperationName, osp.Variables)
+// handleMessage processes a single operation message, it returns false when the
+// connection should be terminated.
+func (conn *connection) handleMessage(ctx context.Context, sendMessage sendMessageFunc, msg operationMessage) bool {
+	send := sendMessage.send
+
+	if len(conn.msgObservers) > 0 {
+		conn.messageObserved(ctx, MessageInfo{Type: string(msg.Type), ID: msg.ID, PayloadSize: len(msg.Payload)})
+	}
+
+	// the client was told its connection_init was rejected
+	if conn.initErr != nil {
+		conn.setCloseReason(conn.initErr)
+		return false
+	}
+
+	if !conn.rates.allow(conn.clock.Now(), msg.Type) {
+		return conn.rateLimited(sendMessage, msg)
+	}
+
+	if err := conn.checkSize(msg); err != nil {
+		if msg.Type == typeConnectionInit {
+			send("", typeConnectionError, errPayload(err))
+		} else {
+			send(msg.ID, typeError, errPayload(err))
+		}
+		return true
+	}
+
+	switch msg.Type {
+	case typeConnectionInit:
+		conn.initReceived()
+		var initMsg initMessagePayload
+		if err := json.Unmarshal(msg.Payload, &initMsg); err != nil {
+			ep := errPayload(fmt.Errorf("invalid payload for type: %s", msg.Type))
+			send("", typeConnectionError, ep)
+			return true
+		}
+		ctx = context.WithValue(ctx, initPayloadKey, append(json.RawMessage(nil), msg.Payload...))
+		ctx, ok := conn.handleInit(ctx, sendMessage, msg.Payload)
+		if !ok {
+			return true
+		}
+		conn.compressor = conn.compression.negotiate(initMsg.Compression)
+		conn.keepAlive.negotiate(time.Duration(initMsg.KeepAlive) * time.Millisecond)
+		conn.roundTrip.negotiate(initMsg.RTT)
+		conn.coalescing.negotiate(initMsg.Coalesce)
+		restored, err := conn.session.open(ctx, initMsg.Session, initMsg.SessionToken, conn.clock.Now())
+		if err != nil {
+			conn.reportError(ctx, "", err)
+		}
+		conn.log(ctx, slog.LevelDebug, "init", "")
+		send("", typeConnectionAck, conn.ackPayload())
+		atomic.StoreInt32(&conn.acked, 1)
+		conn.keepAlive.start(ctx, conn.clock, conn.spawn, sendMessage)
+		conn.roundTrip.start(ctx, conn.clock, conn.spawn, sendMessage)
+		conn.armFirstOperation(ctx)
+		conn.armAuthExpiry(ctx)
+
+		// the restored operations are started like those the client starts
+		for _, op := range restored {
+			payload, err := json.Marshal(startMessagePayload{
+				OperationName: op.OperationName,
+				Query:         op.Query,
+				Variables:     op.Variables,
+				LastEventID:   op.LastEventID,
+			})
 			if err != nil {
-				cancel()
-				send(msg.ID, typeError, errPayload(err))
-				send(msg.ID, typeComplete, nil)
+				conn.reportError(ctx, op.ID, err)
 				continue
 			}
+			if !conn.handleMessage(ctx, sendMessage, operationMessage{ID: op.ID, Type: typeStart, Payload: payload}) {
+				return false
+			}
+		}
 
-			opDone[msg.ID] = cancel
-
-			go func() {
-				defer cancel()
-				for {
-					select {
-					case <-opCtx.Done():
-						return
-					case payload, more := <-c:
-						if !more {
-							send(msg.ID, typeComplete, nil)
-							return
-						}
-
-						jsonPayload, err := json.Marshal(payload)
-						if err != nil {
-							send(msg.ID, typeError, errPayload(err))
-							continue
-						}
-						send(msg.ID, typeData, jsonPayload)
-					}
-				}
-			}()
+	case typeStart:
+		if msg.ID == "" {
+			ep := errPayload(errors.New("missing ID for start operation"))
+			send("", typeConnectionError, ep)
+			return true
+		}
+		if atomic.LoadInt32(&conn.acked) == 0 {
+			send(msg.ID, typeError, errPayload(errNotInitialized))
+			return true
+		}
+		// the running operation is left alone
+		if _, ok := conn.ops.load(msg.ID); ok {
+			ep := errPayload(fmt.Errorf("operation %s is already running", msg.ID))
+			send(msg.ID, typeError, ep)
+			return true
+		}
 
-		case typeStop:
-			onDone, ok := opDone[msg.ID]
-			if ok {
-				delete(opDone, msg.ID)
-				onDone()
-			}
+		var osp startMessagePayload
+		if err := conn.decodeStart(msg.Payload, &osp); err != nil {
+			ep := errPayload(fmt.Errorf("invalid payload for type: %s", msg.Type))
+			send(msg.ID, typeConnectionError, ep)
+			return true
+		}
+		if osp.Credits != nil && *osp.Credits < 0 {
+			send(msg.ID, typeError, errPayload(errors.New("invalid credits")))
 			send(msg.ID, typeComplete, nil)
+			return true
+		}
 
-		case typePing:
-			response := conn.service.Exec(ctx, "{check_subscription}", "", nil)
-			responseJSON, err := json.Marshal(response)
-			if err != nil {
-				send(msg.ID, typeError, errPayload(err))
-				continue
-			}
-			send("", typePong, responseJSON)
+		if err := conn.persisted.resolve(ctx, &osp); err != nil {
+			send(msg.ID, typeError, errPayload(err))
+			send(msg.ID, typeComplete, nil)
+			return true
+		}
 
-		case typeReceive:
-			var rp receiveMessagePayload
-			if err := json.Unmarshal(msg.Payload, &rp); err != nil {
+		if len(conn.interceptors) > 0 {
+			var err error
+			if osp, err = conn.interceptOperation(ctx, msg.ID, osp); err != nil {
 				send(msg.ID, typeError, errPayload(err))
-				continue
+				send(msg.ID, typeComplete, nil)
+				return true
 			}
+		}
 
-			response := conn.service.Exec(ctx, fmt.Sprintf("mutation {receive_socket_event(id:%s)}", rp.ID), "", nil)
-			responseJSON, err := json.Marshal(response)
-			if err != nil {
-				send(msg.ID, typeError, errPayload(err))
-				continue
-			}
-			send("", typePong, responseJSON)
+		conn.log(ctx, slog.LevelDebug, "start", msg.ID, "operation_name", osp.OperationName)
+		return conn.start(ctx, sendMessage, msg.ID, osp)
 
-		case typeConnectionTerminate:
-			return
+	case typeStop:
+		conn.log(ctx, slog.LevelDebug, "stop", msg.ID)
+		op, ok := conn.ops.loadAndDelete(msg.ID)
+		conn.session.remove(msg.ID)
+		if !ok {
+			send(msg.ID, typeComplete, nil)
+			return true
+		}
+		op.cancel()
+		op.done()
+		// the data the operation is still forwarding is dropped
+		op.send(sendMessage, &operationMessage{Type: typeComplete})
+
+	case typeCredit:
+		var cp creditMessagePayload
+		if err := json.Unmarshal(msg.Payload, &cp); err != nil || cp.Credits <= 0 {
+			ep := errPayload(fmt.Errorf("invalid payload for type: %s", msg.Type))
+			send(msg.ID, typeError, ep)
+			return true
+		}
+
+		if op, ok := conn.ops.load(msg.ID); ok && op.credits != nil {
+			op.credits.grant(cp.Credits)
+		}
+
+	case typeAck:
+		if conn.acks.Window == 0 {
+			ep := errPayload(fmt.Errorf("unknown operation message of type: %s", msg.Type))
+			send(msg.ID, typeError, ep)
+			return true
+		}
+		var ap acknowledgePayload
+		if err := json.Unmarshal(msg.Payload, &ap); err != nil || ap.Seq == 0 {
+			ep := errPayload(fmt.Errorf("invalid payload for type: %s", msg.Type))
+			send(msg.ID, typeError, ep)
+			return true
+		}
+
+		if op, ok := conn.ops.load(msg.ID); ok && op.acks != nil {
+			conn.acknowledged(op, ap.Seq)
+		}
+
+	case typeConnectionTerminate:
+		conn.setCloseReason(ErrClientTerminated)
+		return false
+
+	case typeConnectionRefresh:
+		if conn.onRefresh == nil {
+			ep := errPayload(fmt.Errorf("unknown operation message of type: %s", msg.Type))
+			send(msg.ID, typeError, ep)
+			return true
+		}
+		return conn.handleRefresh(ctx, sendMessage, msg)
 
-		default:
+	default:
+		handler, ok := conn.handlers[msg.Type]
+		if !ok {
 			ep := errPayload(fmt.Errorf("unknown operation message of type: %s", msg.Type))
 			send(msg.ID, typeError, ep)
+			return true
+		}
+		if err := handler(ctx, messageConn{sendMessage: sendMessage}, msg.ID, msg.Payload); err != nil {
+			send(msg.ID, typeError, errPayload(err))
 		}
 	}
-}
 
-func errPayload(err error) json.RawMessage {
-	b, _ := json.Marshal(struct {
-		Message string `json:"message"`
-	}{
-		Message: err.Error(),
-	})
-	return b
+	return true
 }
 
-func generateRandomString(length int) string {
-	rand.Seed(time.Now().UnixNano())
-	digits := "0123456789"
-	all := "ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
-		"abcdefghijklmnopqrstuvwxyz" +
-		digits
-	buf := make([]byte, length)
-	buf[0] = all[rand.Intn(len(digits))]
-	for i := 1; i < length; i++ {
-		buf[i] = all[rand.Intn(len(all))]
+func (conn *connection) ackPayload() json.RawMessage {
+	ext := extensions{
+		Batching:    true,
+		FlowControl: true,
+		Resume:      true,
 	}
-	rand.Shuffle(len(buf), func(i, j int) {
-		buf[i], buf[j] = buf[j], buf[i]
-	})
-	str := string(buf)
+	if conn.compressor != nil {
+		ext.Compression = conn.compressor.Name()
+	}
+	if conn.keepAlive.interval > 0 {
+		ext.KeepAlive = int64(conn.keepAlive.interval / time.Millisecond)
+	}
+	if conn.roundTrip.enabled {
+		ext.RTT = int64(conn.roundTrip.interval / time.Millisecond)
+	}
+	ext.AckWindow = conn.acks.Window
+	ext.Persisted = conn.persisted.store != nil && !conn.persisted.strict
+	ext.Coalesce = conn.coalescing.confirmed()
+	ext.Session = conn.session.currentToken()
+	ext.Steering = conn.steeringHints()
 
-	return str
+	b, _ := json.Marshal(ackMessagePayload{Extensions: ext})
+	return b
 }
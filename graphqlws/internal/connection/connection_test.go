@@ -1,6 +1,7 @@
 package connection_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -8,7 +9,9 @@ import (
 	"testing"
 	"time"
 
-	"github.com/graph-gophers/graphql-transport-ws/graphqlws/internal/connection"
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
 )
 
 type messageIntention int
@@ -19,7 +22,16 @@ const (
 )
 
 const (
-	connectionACK = `{"type":"connection_ack"}`
+	connectionACK = `{
+		"type": "connection_ack",
+		"payload": {
+			"extensions": {
+				"batching": true,
+				"flowControl": true,
+				"resume": true
+			}
+		}
+	}`
 )
 
 type message struct {
@@ -31,6 +43,7 @@ func TestConnect(t *testing.T) {
 	testTable := []struct {
 		name     string
 		svc      *gqlService
+		options  []connection.Option
 		messages []message
 	}{
 		{
@@ -70,10 +83,20 @@ func TestConnect(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "start_before_init_error",
+			svc:  newGQLService(`{"data":{},"errors":null}`),
+			messages: []message{
+				{intention: clientSends, operationMessage: `{"id":"a-id","type":"start","payload":{}}`},
+				{intention: expectation, operationMessage: `{"id":"a-id","type":"error","payload":{"message":"connection not initialized"}}`},
+			},
+		},
 		{
 			name: "start_ok",
 			svc:  newGQLService(`{"data":{},"errors":null}`),
 			messages: []message{
+				{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+				{intention: expectation, operationMessage: connectionACK},
 				{
 					intention: clientSends,
 					operationMessage: `{
@@ -106,6 +129,8 @@ func TestConnect(t *testing.T) {
 			name: "start_query_data_error",
 			svc:  newGQLService(`{"data":null,"errors":[{"message":"a error"}]}`),
 			messages: []message{
+				{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+				{intention: expectation, operationMessage: connectionACK},
 				{
 					intention: clientSends,
 					// TODO?: this payload should fail?
@@ -141,6 +166,8 @@ func TestConnect(t *testing.T) {
 				err: errors.New("some error"),
 			},
 			messages: []message{
+				{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+				{intention: expectation, operationMessage: connectionACK},
 				{
 					intention: clientSends,
 					operationMessage: `{
@@ -168,11 +195,489 @@ func TestConnect(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "batched_init_and_start_ok",
+			svc:  newGQLService(`{"data":{},"errors":null}`),
+			messages: []message{
+				{
+					intention: clientSends,
+					operationMessage: `[
+						{
+							"type": "connection_init",
+							"payload": {}
+						},
+						{
+							"type": "start",
+							"id": "a-id",
+							"payload": {}
+						}
+					]`,
+				},
+				{
+					intention:        expectation,
+					operationMessage: connectionACK,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type": "data",
+						"id": "a-id",
+						"payload": {
+							"data": {},
+							"errors": null
+						}
+					}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type":"complete",
+						"id": "a-id"
+					}`,
+				},
+			},
+		},
+		{
+			name: "start_flow_control_ok",
+			svc:  newGQLService(`{"data":{},"errors":null}`),
+			messages: []message{
+				{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+				{intention: expectation, operationMessage: connectionACK},
+				{
+					intention: clientSends,
+					operationMessage: `{
+						"type": "start",
+						"id": "a-id",
+						"payload": {
+							"credits": 0
+						}
+					}`,
+				},
+				{
+					intention: clientSends,
+					operationMessage: `{
+						"type": "credit",
+						"id": "a-id",
+						"payload": {
+							"credits": 1
+						}
+					}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type": "data",
+						"id": "a-id",
+						"payload": {
+							"data": {},
+							"errors": null
+						}
+					}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type":"complete",
+						"id": "a-id"
+					}`,
+				},
+			},
+		},
+		{
+			name: "start_flow_control_error",
+			svc:  newGQLService(`{"data":{},"errors":null}`),
+			messages: []message{
+				{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+				{intention: expectation, operationMessage: connectionACK},
+				{intention: clientSends, operationMessage: `{"type":"start","id":"a-id","payload":{"credits":-1}}`},
+				{intention: expectation, operationMessage: `{"type":"error","id":"a-id","payload":{"message":"invalid credits"}}`},
+				{intention: expectation, operationMessage: `{"type":"complete","id":"a-id"}`},
+			},
+		},
+		{
+			name: "credit_error",
+			messages: []message{
+				{
+					intention: clientSends,
+					operationMessage: `{
+						"type": "credit",
+						"id": "a-id",
+						"payload": {
+							"credits": 0
+						}
+					}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type": "error",
+						"id": "a-id",
+						"payload": {
+							"message": "invalid payload for type: credit"
+						}
+					}`,
+				},
+			},
+		},
+		{
+			name: "start_event_id_ok",
+			svc: newGQLServiceWithPayloads(connection.Event{
+				ID:      "event-1",
+				Payload: json.RawMessage(`{"data":{},"errors":null}`),
+			}),
+			messages: []message{
+				{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+				{intention: expectation, operationMessage: connectionACK},
+				{
+					intention: clientSends,
+					operationMessage: `{
+						"type": "start",
+						"id": "a-id",
+						"payload": {
+							"lastEventId": "event-0"
+						}
+					}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type": "data",
+						"id": "a-id",
+						"eventId": "event-1",
+						"payload": {
+							"data": {},
+							"errors": null
+						}
+					}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type":"complete",
+						"id": "a-id"
+					}`,
+				},
+			},
+		},
+		{
+			name: "ping_ok",
+			svc:  newGQLService(),
+			messages: []message{
+				{
+					intention:        clientSends,
+					operationMessage: `{"type": "ping", "payload": {"at": 1}}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type": "pong",
+						"payload": {"at": 1}
+					}`,
+				},
+			},
+		},
+		{
+			name: "custom_message_ok",
+			options: []connection.Option{
+				connection.HandleMessage("echo", func(ctx context.Context, conn connection.Conn, id string, payload json.RawMessage) error {
+					conn.Send(id, "echo", payload)
+					return nil
+				}),
+			},
+			messages: []message{
+				{
+					intention: clientSends,
+					operationMessage: `{
+						"type": "echo",
+						"id": "a-id",
+						"payload": {"hello": "world"}
+					}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type": "echo",
+						"id": "a-id",
+						"payload": {"hello": "world"}
+					}`,
+				},
+			},
+		},
+		{
+			name: "custom_message_error",
+			options: []connection.Option{
+				connection.HandleMessage("presence", func(ctx context.Context, conn connection.Conn, id string, payload json.RawMessage) error {
+					var p struct {
+						Status string `json:"status"`
+					}
+					if err := json.Unmarshal(payload, &p); err != nil || p.Status == "" {
+						return errors.New("invalid presence")
+					}
+					conn.Send(id, "presence", payload)
+					return nil
+				}),
+			},
+			messages: []message{
+				{
+					intention:        clientSends,
+					operationMessage: `{"type": "presence", "id": "a-id", "payload": {"status": "away"}}`,
+				},
+				{
+					intention:        expectation,
+					operationMessage: `{"type": "presence", "id": "a-id", "payload": {"status": "away"}}`,
+				},
+				{
+					intention:        clientSends,
+					operationMessage: `{"type": "presence", "id": "b-id", "payload": {}}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type": "error",
+						"id": "b-id",
+						"payload": {
+							"message": "invalid presence"
+						}
+					}`,
+				},
+			},
+		},
+		{
+			name: "unknown_message_error",
+			messages: []message{
+				{
+					intention:        clientSends,
+					operationMessage: `{"type": "echo", "id": "a-id"}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type": "error",
+						"id": "a-id",
+						"payload": {
+							"message": "unknown operation message of type: echo"
+						}
+					}`,
+				},
+			},
+		},
+		{
+			name: "start_compression_ok",
+			svc:  newGQLService(`{"data":{},"errors":null}`),
+			options: []connection.Option{
+				connection.Compression(0, identityCompressor{}),
+			},
+			messages: []message{
+				{
+					intention: clientSends,
+					operationMessage: `{
+						"type": "connection_init",
+						"payload": {
+							"compression": ["zstd", "identity"]
+						}
+					}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type": "connection_ack",
+						"payload": {
+							"extensions": {
+								"batching": true,
+								"compression": "identity",
+								"flowControl": true,
+								"resume": true
+							}
+						}
+					}`,
+				},
+				{
+					intention: clientSends,
+					operationMessage: `{
+						"type": "start",
+						"id": "a-id",
+						"payload": {}
+					}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type": "data",
+						"id": "a-id",
+						"payload": "eyJkYXRhIjp7fSwiZXJyb3JzIjpudWxsfQ=="
+					}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type":"complete",
+						"id": "a-id"
+					}`,
+				},
+			},
+		},
+		{
+			name: "connection_init_keep_alive_ok",
+			options: []connection.Option{
+				connection.KeepAliveRange(10*time.Millisecond, time.Second),
+			},
+			messages: []message{
+				{
+					intention: clientSends,
+					operationMessage: `{
+						"type": "connection_init",
+						"payload": {
+							"keepAlive": 1
+						}
+					}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type": "connection_ack",
+						"payload": {
+							"extensions": {
+								"batching": true,
+								"flowControl": true,
+								"keepAlive": 10,
+								"resume": true
+							}
+						}
+					}`,
+				},
+				{
+					intention:        expectation,
+					operationMessage: `{"type": "ka"}`,
+				},
+			},
+		},
+		{
+			name: "start_parallel_ok",
+			svc:  newGQLService(`{"data":{},"errors":null}`),
+			options: []connection.Option{
+				connection.StartConcurrency(0),
+			},
+			messages: []message{
+				{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+				{intention: expectation, operationMessage: connectionACK},
+				{
+					intention: clientSends,
+					operationMessage: `{
+						"type": "start",
+						"id": "a-id",
+						"payload": {}
+					}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type": "data",
+						"id": "a-id",
+						"payload": {
+							"data": {},
+							"errors": null
+						}
+					}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type":"complete",
+						"id": "a-id"
+					}`,
+				},
+			},
+		},
+		{
+			name: "start_budget_error",
+			svc:  &gqlService{payloads: make(chan interface{})},
+			options: []connection.Option{
+				connection.OperationBudget(connection.NewBudget(1, time.Millisecond)),
+			},
+			messages: []message{
+				{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+				{intention: expectation, operationMessage: connectionACK},
+				{
+					intention: clientSends,
+					operationMessage: `{
+						"type": "start",
+						"id": "a-id",
+						"payload": {}
+					}`,
+				},
+				{
+					intention: clientSends,
+					operationMessage: `{
+						"type": "start",
+						"id": "b-id",
+						"payload": {}
+					}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type": "error",
+						"id": "b-id",
+						"payload": {
+							"message": "server is at capacity, retry later",
+							"extensions": {
+								"code": "CAPACITY_EXCEEDED",
+								"retryAfter": 1000
+							}
+						}
+					}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type":"complete",
+						"id": "b-id"
+					}`,
+				},
+			},
+		},
+		{
+			name: "start_subscribe_limiter_ok",
+			svc:  newGQLService(`{"data":{},"errors":null}`),
+			options: []connection.Option{
+				connection.SubscribeLimiter(connection.NewLimiter(1)),
+			},
+			messages: []message{
+				{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+				{intention: expectation, operationMessage: connectionACK},
+				{
+					intention: clientSends,
+					operationMessage: `{
+						"type": "start",
+						"id": "a-id",
+						"payload": {}
+					}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type": "data",
+						"id": "a-id",
+						"payload": {
+							"data": {},
+							"errors": null
+						}
+					}`,
+				},
+				{
+					intention: expectation,
+					operationMessage: `{
+						"type":"complete",
+						"id": "a-id"
+					}`,
+				},
+			},
+		},
 	}
 	for _, tt := range testTable {
 		t.Run(tt.name, func(t *testing.T) {
 			ws := newConnection()
-			go connection.Connect(ws, tt.svc, context.Background())
+			go connection.Connect(ws, tt.svc, context.Background(), tt.options...)
 			ws.test(t, tt.messages)
 		})
 	}
@@ -184,9 +689,18 @@ type gqlService struct {
 }
 
 func newGQLService(pp ...string) *gqlService {
+	payloads := make([]interface{}, 0, len(pp))
+	for _, p := range pp {
+		payloads = append(payloads, json.RawMessage(p))
+	}
+
+	return newGQLServiceWithPayloads(payloads...)
+}
+
+func newGQLServiceWithPayloads(pp ...interface{}) *gqlService {
 	c := make(chan interface{}, len(pp))
 	for _, p := range pp {
-		c <- json.RawMessage(p)
+		c <- p
 	}
 	close(c)
 
@@ -197,6 +711,20 @@ func (h *gqlService) Subscribe(ctx context.Context, document string, operationNa
 	return h.payloads, h.err
 }
 
+func (h *gqlService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+type identityCompressor struct{}
+
+func (identityCompressor) Name() string {
+	return "identity"
+}
+
+func (identityCompressor) Compress(data []byte) ([]byte, error) {
+	return data, nil
+}
+
 func newConnection() *wsConnection {
 	return &wsConnection{
 		in:  make(chan json.RawMessage),
@@ -220,21 +748,16 @@ func (ws *wsConnection) test(t *testing.T, messages []message) {
 	}
 }
 
-func (ws *wsConnection) ReadJSON(v interface{}) error {
-	msg := <-ws.in
-	data, err := json.Marshal(msg)
-	if err != nil {
-		return err
+func (ws *wsConnection) ReadMessage() (int, []byte, error) {
+	msg, ok := <-ws.in
+	if !ok {
+		return 0, nil, errors.New("closed")
 	}
-	return json.Unmarshal(data, v)
+	return 1, msg, nil
 }
 
-func (ws *wsConnection) WriteJSON(v interface{}) error {
-	data, err := json.Marshal(v)
-	if err != nil {
-		return err
-	}
-	ws.out <- json.RawMessage(data)
+func (ws *wsConnection) WriteMessage(messageType int, data []byte) error {
+	ws.out <- json.RawMessage(append([]byte(nil), data...))
 	return nil
 }
 
@@ -272,3 +795,135 @@ func requireEqualJSON(t *testing.T, expected string, got json.RawMessage) {
 		t.Fatalf("expected [%s] but instead got [%s]", normalizedExp, got)
 	}
 }
+
+// discardConnection is a wsConnection that reads a single start message and
+// discards the messages written, closing done when the operation completes.
+type discardConnection struct {
+	in   chan json.RawMessage
+	done chan struct{}
+}
+
+func (ws *discardConnection) ReadMessage() (int, []byte, error) {
+	msg, ok := <-ws.in
+	if !ok {
+		return 0, nil, errors.New("closed")
+	}
+	return 1, msg, nil
+}
+
+func (ws *discardConnection) WriteMessage(messageType int, data []byte) error {
+	if bytes.Contains(data, []byte(`"complete"`)) {
+		close(ws.done)
+	}
+	return nil
+}
+
+func (ws *discardConnection) SetReadLimit(limit int64) {}
+
+func (ws *discardConnection) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (ws *discardConnection) Close() error {
+	return nil
+}
+
+func BenchmarkDataForwarding(b *testing.B) {
+	payload := json.RawMessage(`{"data":{"message":{"id":"1","text":"hello world"}}}`)
+	c := make(chan interface{})
+	svc := &gqlService{payloads: c}
+
+	ws := &discardConnection{
+		in:   make(chan json.RawMessage, 1),
+		done: make(chan struct{}),
+	}
+	ws.in <- json.RawMessage(`{"type":"start","id":"a-id","payload":{}}`)
+	go connection.Connect(ws, svc, context.Background())
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c <- payload
+	}
+	close(c)
+	<-ws.done
+}
+
+func TestDuplicateOperationID(t *testing.T) {
+	ws := newConnection()
+	go connection.Connect(ws, &gqlService{payloads: make(chan interface{})}, context.Background())
+
+	ws.test(t, []message{
+		{
+			intention: clientSends,
+			operationMessage: `{
+				"type": "connection_init",
+				"payload": {}
+			}`,
+		},
+		{
+			intention:        expectation,
+			operationMessage: connectionACK,
+		},
+		{
+			intention: clientSends,
+			operationMessage: `{
+				"id": "a",
+				"type": "start",
+				"payload": {}
+			}`,
+		},
+		{
+			intention: clientSends,
+			operationMessage: `{
+				"id": "a",
+				"type": "start",
+				"payload": {}
+			}`,
+		},
+		{
+			intention: expectation,
+			operationMessage: `{
+				"id": "a",
+				"type": "error",
+				"payload": {"message": "operation a is already running"}
+			}`,
+		},
+		{
+			intention: clientSends,
+			operationMessage: `{
+				"id": "a",
+				"type": "stop"
+			}`,
+		},
+		{
+			intention: expectation,
+			operationMessage: `{
+				"id": "a",
+				"type": "complete"
+			}`,
+		},
+		{
+			intention: clientSends,
+			operationMessage: `{
+				"id": "a",
+				"type": "start",
+				"payload": {}
+			}`,
+		},
+		{
+			intention: clientSends,
+			operationMessage: `{
+				"id": "a",
+				"type": "stop"
+			}`,
+		},
+		{
+			intention: expectation,
+			operationMessage: `{
+				"id": "a",
+				"type": "complete"
+			}`,
+		},
+	})
+}
@@ -0,0 +1,106 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// InitHandler handles the connection_init payload of a connection before it's
+// acknowledged. The context it returns is the one all the operations of the
+// connection run with, e.g. carrying the user authenticated with a token of
+// the payload. If it returns an error the client is sent a connection_error
+// with it and the connection is closed.
+type InitHandler func(ctx context.Context, payload json.RawMessage) (context.Context, error)
+
+// HandleInit sets the handler of connection_init payloads
+func HandleInit(fn InitHandler) Option {
+	return func(conn *connection) {
+		conn.onInit = fn
+	}
+}
+
+// handleInit calls the InitHandler and the OnConnect interceptors if any, it
+// returns the context the operations of the connection then run with. If the
+// payload is rejected the client is sent a connection_error, once it's written
+// the connection is closed.
+func (conn *connection) handleInit(ctx context.Context, sendMessage sendMessageFunc, payload json.RawMessage) (context.Context, bool) {
+	if conn.onInit == nil && len(conn.interceptors) == 0 {
+		conn.initCtx = ctx
+		return ctx, true
+	}
+
+	initCtx, err := ctx, error(nil)
+	if conn.onInit != nil {
+		initCtx, err = conn.onInit(ctx, payload)
+	}
+	if err == nil {
+		initCtx, err = conn.interceptConnect(initCtx, payload)
+	}
+	if err != nil {
+		conn.initErr = wrapCloseReason(ErrInitRejected, err)
+		sendMessage(&operationMessage{
+			Type:    typeConnectionError,
+			Payload: errPayload(err),
+			delivered: func() {
+				conn.setCloseReason(conn.initErr)
+				conn.close()
+			},
+		})
+		return ctx, false
+	}
+	conn.initCtx = initCtx
+	return initCtx, true
+}
+
+// initTimeout closes connections which don't send their connection_init in
+// time
+type initTimeout struct {
+	timeout  time.Duration
+	recvOnce sync.Once
+	received chan struct{}
+}
+
+// ConnectionInitTimeout closes connections which don't send a connection_init
+// within d of being opened, with the 4408 close code and ErrInitTimeout as the
+// close reason, so that unauthenticated clients can't hold sockets open.
+func ConnectionInitTimeout(d time.Duration) Option {
+	return func(conn *connection) {
+		conn.initTimer.timeout = d
+		conn.initTimer.received = make(chan struct{})
+	}
+}
+
+// watchInit starts the timeout
+func (conn *connection) watchInit(ctx context.Context) {
+	it := &conn.initTimer
+	if it.timeout <= 0 {
+		return
+	}
+
+	timer := conn.clock.NewTimer(it.timeout)
+	conn.spawn(func() {
+		defer timer.Stop()
+		select {
+		case <-timer.C():
+			// the connection_init may have been received as the timer fired
+			select {
+			case <-it.received:
+			default:
+				conn.closeWithText(int(CloseInitTimeout), "Connection initialisation timeout", ErrInitTimeout)
+			}
+		case <-it.received:
+		case <-ctx.Done():
+		}
+	})
+}
+
+// initReceived disarms the timeout
+func (conn *connection) initReceived() {
+	it := &conn.initTimer
+	if it.timeout <= 0 {
+		return
+	}
+	it.recvOnce.Do(func() { close(it.received) })
+}
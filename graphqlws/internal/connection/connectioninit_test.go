@@ -0,0 +1,145 @@
+package connection_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+type userKey struct{}
+
+// userService replies to subscriptions with the user of their context
+type userService struct{}
+
+func (userService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	c := make(chan interface{}, 1)
+	c <- map[string]interface{}{"user": ctx.Value(userKey{})}
+	close(c)
+	return c, nil
+}
+
+func (userService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+var errInvalidToken = errors.New("invalid token")
+
+func authenticate(ctx context.Context, payload json.RawMessage) (context.Context, error) {
+	var p struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(payload, &p); err != nil || p.Token != "secret" {
+		return nil, errInvalidToken
+	}
+	return context.WithValue(ctx, userKey{}, "alice"), nil
+}
+
+func TestHandleInit(t *testing.T) {
+	ws := newConnection()
+	go connection.Connect(ws, userService{}, context.Background(), connection.HandleInit(authenticate))
+
+	ws.test(t, []message{
+		{
+			intention: clientSends,
+			operationMessage: `{
+				"type": "connection_init",
+				"payload": {"token": "secret"}
+			}`,
+		},
+		{
+			intention:        expectation,
+			operationMessage: connectionACK,
+		},
+		{
+			intention: clientSends,
+			operationMessage: `{
+				"id": "a",
+				"type": "start",
+				"payload": {}
+			}`,
+		},
+		{
+			intention: expectation,
+			operationMessage: `{
+				"id": "a",
+				"type": "data",
+				"payload": {"user": "alice"}
+			}`,
+		},
+		{
+			intention: expectation,
+			operationMessage: `{
+				"id": "a",
+				"type": "complete"
+			}`,
+		},
+	})
+}
+
+func TestHandleInitRejected(t *testing.T) {
+	o := make(reasonObserver, 1)
+	ws := newConnection()
+	go connection.Connect(ws, userService{}, context.Background(),
+		connection.HandleInit(authenticate),
+		connection.Observe(o),
+	)
+
+	ws.in <- []byte(`{"type":"connection_init","payload":{"token":"guess"}}`)
+	requireEqualJSON(t, `{"type":"connection_error","payload":{"message":"invalid token"}}`, <-ws.out)
+
+	select {
+	case got := <-o:
+		if !errors.Is(got, connection.ErrInitRejected) || !errors.Is(got, errInvalidToken) {
+			t.Fatalf("expected %v but instead got %v", connection.ErrInitRejected, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the connection to be closed")
+	}
+}
+
+func TestConnectionInitTimeout(t *testing.T) {
+	for name, tc := range map[string]struct {
+		init     bool
+		expected error
+	}{
+		"idle":        {expected: connection.ErrInitTimeout},
+		"initialized": {init: true, expected: connection.ErrClientTerminated},
+	} {
+		t.Run(name, func(t *testing.T) {
+			clock := graphqlwstest.NewFakeClock(time.Now())
+			o := make(reasonObserver, 1)
+			ws := newConnection()
+			go connection.Connect(ws, newGQLService(), context.Background(),
+				connection.UseClock(clock),
+				connection.ConnectionInitTimeout(time.Minute),
+				connection.Observe(o),
+			)
+
+			clock.BlockUntil(1)
+			if tc.init {
+				ws.in <- []byte(`{"type":"connection_init","payload":{}}`)
+				requireEqualJSON(t, connectionACK, <-ws.out)
+				clock.Advance(time.Minute)
+				ws.in <- []byte(`{"type":"connection_terminate"}`)
+			} else {
+				clock.Advance(time.Minute)
+			}
+
+			select {
+			case got := <-o:
+				if !errors.Is(got, tc.expected) {
+					t.Fatalf("expected %v but instead got %v", tc.expected, got)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("expected the connection to be closed")
+			}
+		})
+	}
+}
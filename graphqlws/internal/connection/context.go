@@ -0,0 +1,41 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// SocketIDFromContext returns the socket id of the operation ctx belongs to,
+// as generated by the IDGenerator of the connection
+func SocketIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(socketIDKey).(string)
+	return id, ok
+}
+
+// ContextWithSocketID returns a copy of ctx carrying the socket id id, as the
+// contexts of operations do
+func ContextWithSocketID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, socketIDKey, id)
+}
+
+// OperationIDFromContext returns the id of the operation ctx belongs to, as
+// chosen by the client in its start message
+func OperationIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(operationIDKey).(string)
+	return id, ok
+}
+
+// InitPayloadFromContext returns the connection_init payload of the
+// connection ctx belongs to, once it's received
+func InitPayloadFromContext(ctx context.Context) (json.RawMessage, bool) {
+	payload, ok := ctx.Value(initPayloadKey).(json.RawMessage)
+	return payload, ok
+}
+
+// ExtensionsFromContext returns the extensions of the start payload of the
+// operation ctx belongs to, e.g. the tracing or custom metadata sent by Apollo
+// clients, if it had any
+func ExtensionsFromContext(ctx context.Context) (map[string]interface{}, bool) {
+	extensions, ok := ctx.Value(extensionsKey).(map[string]interface{})
+	return extensions, ok
+}
@@ -0,0 +1,63 @@
+package connection
+
+import (
+	"context"
+	"math"
+	"sync"
+)
+
+// maxCredits bounds the credits of an operation, so that grants don't
+// overflow
+const maxCredits = math.MaxInt32
+
+// credits implements the flow control extension: an operation started with
+// credits only pushes as many data messages as the client has granted, and
+// waits for further credit messages before pushing more.
+type credits struct {
+	mu     sync.Mutex
+	n      int
+	signal chan struct{}
+}
+
+func newCredits(n int) *credits {
+	return &credits{
+		n:      n,
+		signal: make(chan struct{}, 1),
+	}
+}
+
+// grant adds n credits, up to maxCredits, and wakes up a pending acquire
+func (c *credits) grant(n int) {
+	c.mu.Lock()
+	if n > maxCredits-c.n {
+		c.n = maxCredits
+	} else {
+		c.n += n
+	}
+	c.mu.Unlock()
+
+	select {
+	case c.signal <- struct{}{}:
+	default:
+	}
+}
+
+// acquire consumes a credit, blocking until one is granted. It returns false if
+// ctx is done before that happens.
+func (c *credits) acquire(ctx context.Context) bool {
+	for {
+		c.mu.Lock()
+		if c.n > 0 {
+			c.n--
+			c.mu.Unlock()
+			return true
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-c.signal:
+		}
+	}
+}
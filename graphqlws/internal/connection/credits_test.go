@@ -0,0 +1,19 @@
+package connection
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestCreditsGrantOverflow(t *testing.T) {
+	c := newCredits(0)
+	c.grant(math.MaxInt)
+	c.grant(math.MaxInt)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if !c.acquire(ctx) {
+		t.Fatal("expected a credit")
+	}
+}
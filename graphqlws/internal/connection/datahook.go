@@ -0,0 +1,66 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// DataHook is called with the payload of each data message, a JSON encoded
+// GraphQL response, before it's sent. It returns the payload to send instead,
+// usually payload itself, and the extensions to add to its extensions object,
+// e.g. timing info, sequence numbers or the region of the server, replacing
+// those it already has with the same keys. The payload is backed by a buffer
+// reused once the message is written, it must be copied to be kept after the
+// call.
+type DataHook func(ctx context.Context, payload json.RawMessage) (json.RawMessage, map[string]interface{})
+
+// OnData sets the hook called with the payload of each data message
+func OnData(fn DataHook) Option {
+	return func(conn *connection) {
+		conn.onData = fn
+	}
+}
+
+var errDataNotObject = errors.New("data payload or its extensions aren't JSON objects")
+
+// hookData calls the DataHook with payload, it returns the payload to send
+func (conn *connection) hookData(ctx context.Context, operationID string, payload json.RawMessage) (json.RawMessage, error) {
+	var extensions map[string]interface{}
+	if perr := conn.callService(ctx, operationID, func() {
+		payload, extensions = conn.onData(ctx, payload)
+	}); perr != nil {
+		return nil, perr
+	}
+	if len(extensions) == 0 {
+		return payload, nil
+	}
+	return mergeExtensions(payload, extensions)
+}
+
+// mergeExtensions adds extensions to the extensions object of response
+func mergeExtensions(response json.RawMessage, extensions map[string]interface{}) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(response, &fields); err != nil || fields == nil {
+		return nil, errDataNotObject
+	}
+	merged := map[string]json.RawMessage{}
+	if ext, ok := fields["extensions"]; ok {
+		if err := json.Unmarshal(ext, &merged); err != nil || merged == nil {
+			return nil, errDataNotObject
+		}
+	}
+	for k, v := range extensions {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		merged[k] = b
+	}
+	ext, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	fields["extensions"] = ext
+	return json.Marshal(fields)
+}
@@ -0,0 +1,40 @@
+package connection_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestOnData(t *testing.T) {
+	seq := 0
+	ws := newConnection()
+	go connection.Connect(ws, newGQLServiceWithPayloads(
+		json.RawMessage(`{"data":{"n":1}}`),
+		json.RawMessage(`{"data":{"n":2},"extensions":{"cost":3,"region":"us"}}`),
+		json.RawMessage(`"not an object"`),
+		json.RawMessage(`{"data":{"n":3}}`),
+	), context.Background(),
+		connection.OnData(func(ctx context.Context, payload json.RawMessage) (json.RawMessage, map[string]interface{}) {
+			seq++
+			id, _ := connection.OperationIDFromContext(ctx)
+			return payload, map[string]interface{}{"seq": seq, "operation": id, "region": "eu"}
+		}),
+	)
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"data","payload":{"data":{"n":1},"extensions":{"seq":1,"operation":"a","region":"eu"}}}`},
+		// the extensions of the payload are kept, but for those of the hook
+		{intention: expectation, operationMessage: `{"id":"a","type":"data","payload":{"data":{"n":2},"extensions":{"cost":3,"seq":2,"operation":"a","region":"eu"}}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"error","payload":{"message":"data payload or its extensions aren't JSON objects"}}`},
+		// the operation goes on once a payload failed
+		{intention: expectation, operationMessage: `{"id":"a","type":"data","payload":{"data":{"n":3},"extensions":{"seq":4,"operation":"a","region":"eu"}}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
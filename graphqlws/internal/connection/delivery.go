@@ -0,0 +1,22 @@
+package connection
+
+import "time"
+
+// Delivery can be sent on the channel returned by GraphQLService.Subscribe
+// instead of a bare payload, or an Event, to be told when it's delivered:
+// Delivered is called once the data message carrying Payload was written to
+// the client. It isn't called if the message is dropped, e.g. because the
+// operation was stopped or the connection closed first, so sources which need
+// to redeliver such payloads should do so once the operation's context is
+// done. For the operations whose data messages the client acknowledges,
+// Delivered is only called once acknowledged, see Acknowledge.
+//
+// Deadline, if set, is when Payload goes stale, e.g. a price superseded soon
+// after: its data message is dropped if it's still queued then, and its write
+// isn't allowed to last beyond it. It's ignored for the operations whose data
+// messages the client acknowledges.
+type Delivery struct {
+	Payload   interface{}
+	Delivered func()
+	Deadline  time.Time
+}
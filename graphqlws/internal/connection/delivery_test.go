@@ -0,0 +1,36 @@
+package connection_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestDelivery(t *testing.T) {
+	delivered := make(chan struct{})
+	svc := newGQLServiceWithPayloads(connection.Delivery{
+		Payload:   connection.Event{ID: "1", Payload: json.RawMessage(`{"data":{}}`)},
+		Delivered: func() { close(delivered) },
+	})
+
+	ws := newConnection()
+	go connection.Connect(ws, svc, context.Background())
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a-id","type":"start","payload":{}}`},
+		{intention: expectation, operationMessage: `{"id":"a-id","type":"data","payload":{"data":{}},"eventId":"1"}`},
+	})
+
+	select {
+	case <-delivered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the payload to be delivered")
+	}
+	ws.test(t, []message{
+		{intention: expectation, operationMessage: `{"id":"a-id","type":"complete"}`},
+	})
+}
@@ -0,0 +1,111 @@
+package connection_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// blockingService returns subscriptions sending nothing until their context
+// is done, which is then sent on done
+type blockingService struct {
+	done chan context.Context
+}
+
+func (s blockingService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	c := make(chan interface{})
+	go func() {
+		defer close(c)
+		<-ctx.Done()
+		s.done <- ctx
+	}()
+	return c, nil
+}
+
+func (blockingService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+// unreadableConnection is a wsConnection whose reads fail once fail is closed
+type unreadableConnection struct {
+	*wsConnection
+	fail chan struct{}
+}
+
+func (ws *unreadableConnection) ReadMessage() (int, []byte, error) {
+	select {
+	case msg := <-ws.in:
+		return 1, msg, nil
+	case <-ws.fail:
+		return 0, nil, errors.New("connection reset by peer")
+	}
+}
+
+// requireGoroutines waits for the number of goroutines to be back to n at
+// most, e.g. as counted before a connection was opened
+func requireGoroutines(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > n {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<20)
+			t.Fatalf("expected at most %d goroutines but instead got %d:\n%s", n, runtime.NumGoroutine(), buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientGone(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	svc := blockingService{done: make(chan context.Context, 2)}
+	connDone := make(chan (<-chan struct{}), 1)
+	ws := &unreadableConnection{wsConnection: newConnection(), fail: make(chan struct{})}
+	go connection.Connect(ws, svc, context.Background(),
+		// the operations don't run with a context derived from the one of
+		// the connection
+		connection.HandleInit(func(ctx context.Context, payload json.RawMessage) (context.Context, error) {
+			connDone <- connection.Done(ctx)
+			return context.WithValue(context.Background(), userKey{}, "user"), nil
+		}),
+	)
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{"query":"subscription { a }"}}`},
+		{intention: clientSends, operationMessage: `{"id":"b","type":"start","payload":{"query":"subscription { b }"}}`},
+	})
+	done := <-connDone
+	select {
+	case <-done:
+		t.Fatal("expected the connection not to be done yet")
+	default:
+	}
+
+	close(ws.fail)
+	for i := 0; i < 2; i++ {
+		select {
+		case ctx := <-svc.done:
+			if ctx.Err() == nil {
+				t.Fatal("expected the context of the operation to be done")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the operations to be cancelled")
+		}
+	}
+	select {
+	case <-done:
+	default:
+		t.Fatal("expected the connection to be done")
+	}
+	for range ws.out {
+	}
+	requireGoroutines(t, goroutines)
+}
@@ -0,0 +1,79 @@
+package connection
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// closeGoingAway is the close code of connections closed because the server
+// is going away
+const closeGoingAway = 1001
+
+// DrainOn makes the connection drain once drain is done, e.g. when a server
+// shuts down: new operations are rejected with ErrServerShutdown, the
+// running ones are stopped and the client told they're complete, and once
+// those messages are written the connection is closed with ErrServerShutdown
+// as reason. Where the transport supports close frames, it sends one with the
+// 1001 (going away) close code, or the steering hints if any. No goroutine
+// waits for drain meanwhile.
+func DrainOn(drain context.Context) Option {
+	return func(conn *connection) {
+		conn.drain = drain
+	}
+}
+
+// watchDrain drains the connection once conn.drain is done
+func (conn *connection) watchDrain(ctx context.Context, sendMessage sendMessageFunc) {
+	if conn.drain == nil {
+		return
+	}
+
+	stop := context.AfterFunc(conn.drain, func() {
+		if ctx.Err() == nil {
+			conn.spawn(func() { conn.drainNow(ctx, sendMessage) })
+		}
+	})
+	conn.onClose = append(conn.onClose, func() { stop() })
+}
+
+// drainNow stops the operations and closes the connection once the client was
+// told they're complete
+func (conn *connection) drainNow(ctx context.Context, sendMessage sendMessageFunc) {
+	atomic.StoreInt32(&conn.draining, 1)
+	ops := conn.ops.removeAll()
+	// flushed is closed once the last complete message is written, without
+	// a goroutine waiting for it in case the connection closes first
+	flushed := make(chan struct{})
+	pending := int32(len(ops))
+	if pending == 0 {
+		close(flushed)
+	}
+	delivered := func() {
+		if atomic.AddInt32(&pending, -1) == 0 {
+			close(flushed)
+		}
+	}
+	for _, op := range ops {
+		op.cancel()
+		op.send(sendMessage, &operationMessage{Type: typeComplete, delivered: delivered})
+	}
+
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		return
+	}
+
+	// the steering hints, if any, are sent by close
+	if conn.steeringHints() != nil {
+		conn.setCloseReason(ErrServerShutdown)
+		conn.close()
+		return
+	}
+	conn.closeWithCode(closeGoingAway, ErrServerShutdown)
+}
+
+// isDraining returns whether the connection is draining, see DrainOn
+func (conn *connection) isDraining() bool {
+	return atomic.LoadInt32(&conn.draining) == 1
+}
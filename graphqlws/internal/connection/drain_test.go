@@ -0,0 +1,67 @@
+package connection_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestDrainOn(t *testing.T) {
+	drain, shutdown := context.WithCancel(context.Background())
+	o := make(reasonObserver, 1)
+	ws := newConnection()
+	go connection.Connect(ws, &gqlService{payloads: make(chan interface{})}, context.Background(),
+		connection.DrainOn(drain),
+		connection.Observe(o),
+	)
+
+	ws.in <- []byte(`{"type":"connection_init","payload":{}}`)
+	requireEqualJSON(t, connectionACK, <-ws.out)
+	ws.in <- []byte(`{"id":"a","type":"start","payload":{}}`)
+	// the operation is running once a stop of another one is answered
+	ws.in <- []byte(`{"id":"b","type":"stop"}`)
+	requireEqualJSON(t, `{"id":"b","type":"complete"}`, <-ws.out)
+
+	shutdown()
+	requireEqualJSON(t, `{"id":"a","type":"complete"}`, <-ws.out)
+
+	select {
+	case got := <-o:
+		if !errors.Is(got, connection.ErrServerShutdown) {
+			t.Fatalf("expected %v but instead got %v", connection.ErrServerShutdown, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the connection to be closed")
+	}
+}
+
+func TestDrainOnIdle(t *testing.T) {
+	drain, shutdown := context.WithCancel(context.Background())
+	o := make(reasonObserver, 10)
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		connection.Attach(newConnection(), newGQLService(), context.Background(),
+			connection.DrainOn(drain),
+			connection.Observe(o),
+		)
+	}
+	if n := runtime.NumGoroutine() - before; n > 0 {
+		t.Fatalf("expected idle connections to hold no goroutine but instead they hold %d", n)
+	}
+
+	shutdown()
+	for i := 0; i < 10; i++ {
+		select {
+		case got := <-o:
+			if !errors.Is(got, connection.ErrServerShutdown) {
+				t.Fatalf("expected %v but instead got %v", connection.ErrServerShutdown, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the connections to be closed")
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package connection
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// EventStore records the events sent on subscriptions, so that those a client
+// missed are replayed when it resumes after the last one it received, see
+// ReplayEvents. The payloads of the events appended and returned are
+// json.RawMessage values.
+type EventStore interface {
+	// Append records ev as the latest event of stream, unless an event with
+	// its ID already was: every subscription to the stream appends it.
+	Append(ctx context.Context, stream string, ev Event) error
+	// Since returns the events of stream recorded after the one with the ID
+	// lastEventID, oldest first, or false if it isn't recorded, e.g. because
+	// it expired.
+	Since(ctx context.Context, stream string, lastEventID string) (events []Event, ok bool, err error)
+}
+
+// StreamFunc returns the stream of events of a subscription from its start
+// payload, or an empty string for its events not to be recorded
+type StreamFunc func(ctx context.Context, query string, operationName string, variables map[string]interface{}) string
+
+// ReplayEvents records the Event values sent on subscriptions to store, in the
+// stream returned by fn. Subscriptions resuming with a lastEventId are first
+// sent the events of their stream recorded after it, and then the events of
+// the service except the ones already replayed.
+//
+// With a nil fn subscriptions share a stream when they have the same document,
+// operation name and variables, which assumes that their events are the same
+// for every client, as with a Multiplexer without scope.
+func ReplayEvents(store EventStore, fn StreamFunc) Option {
+	return func(conn *connection) {
+		conn.events = eventReplay{store: store, stream: fn}
+	}
+}
+
+type eventReplay struct {
+	store  EventStore
+	stream StreamFunc
+}
+
+// streamOf returns the stream of the subscription started with osp, if any
+func (r eventReplay) streamOf(ctx context.Context, osp startMessagePayload) string {
+	if r.store == nil || operationType(osp.Query, osp.OperationName) != operationSubscription {
+		return ""
+	}
+	if r.stream != nil {
+		return r.stream(ctx, osp.Query, osp.OperationName, osp.Variables)
+	}
+
+	variables, err := json.Marshal(osp.Variables)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.Join([]string{osp.OperationName, normalizeDocument(osp.Query), string(variables)}, "\x00")))
+	return fmt.Sprintf("%x", sum)
+}
+
+// replay returns the events of stream recorded after lastEventID followed by
+// the payloads of live, recording its events along the way
+func (conn *connection) replay(ctx context.Context, operationID string, stream string, lastEventID string, live <-chan interface{}) <-chan interface{} {
+	c := make(chan interface{})
+	conn.spawn(func() {
+		defer close(c)
+
+		replayed := map[string]bool{}
+		if lastEventID != "" {
+			events, _, err := conn.events.store.Since(ctx, stream, lastEventID)
+			if err != nil {
+				conn.reportError(ctx, operationID, err)
+			}
+			for _, ev := range events {
+				replayed[ev.ID] = true
+				select {
+				case c <- ev:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+
+		for {
+			var payload interface{}
+			select {
+			case <-ctx.Done():
+				return
+			case p, more := <-live:
+				if !more {
+					return
+				}
+				payload = p
+			}
+
+			d, isDelivery := payload.(Delivery)
+			if isDelivery {
+				payload = d.Payload
+			}
+			if ev, ok := payload.(Event); ok {
+				if replayed[ev.ID] {
+					if d.Delivered != nil {
+						d.Delivered()
+					}
+					continue
+				}
+				payload = conn.record(ctx, operationID, stream, ev)
+			}
+			if isDelivery {
+				d.Payload, payload = payload, d
+			}
+
+			select {
+			case c <- payload:
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+	return c
+}
+
+// record appends ev to stream, it returns it with its payload marshaled
+func (conn *connection) record(ctx context.Context, operationID string, stream string, ev Event) Event {
+	raw, ok := ev.Payload.(json.RawMessage)
+	if !ok {
+		b, err := json.Marshal(ev.Payload)
+		if err != nil {
+			// left to the forwarding of the operation to report
+			return ev
+		}
+		raw = b
+	}
+
+	ev.Payload = raw
+	if err := conn.events.store.Append(ctx, stream, ev); err != nil {
+		conn.reportError(ctx, operationID, err)
+	}
+	return ev
+}
+
+// MemoryEventStore is an EventStore keeping the latest events of each stream
+// in memory, e.g. for a single instance or for tests
+type MemoryEventStore struct {
+	limit int
+
+	mu      sync.Mutex
+	streams map[string]*memoryStream
+}
+
+type memoryStream struct {
+	events []Event
+	ids    map[string]bool
+}
+
+// NewMemoryEventStore returns a MemoryEventStore keeping the latest limit
+// events of each stream
+func NewMemoryEventStore(limit int) *MemoryEventStore {
+	return &MemoryEventStore{limit: limit, streams: map[string]*memoryStream{}}
+}
+
+// Append implements EventStore
+func (s *MemoryEventStore) Append(ctx context.Context, stream string, ev Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms := s.streams[stream]
+	if ms == nil {
+		ms = &memoryStream{ids: map[string]bool{}}
+		s.streams[stream] = ms
+	}
+	if ms.ids[ev.ID] {
+		return nil
+	}
+	ms.ids[ev.ID] = true
+	ms.events = append(ms.events, ev)
+	if len(ms.events) > s.limit {
+		delete(ms.ids, ms.events[0].ID)
+		ms.events[0] = Event{}
+		ms.events = ms.events[1:]
+	}
+	return nil
+}
+
+// Since implements EventStore
+func (s *MemoryEventStore) Since(ctx context.Context, stream string, lastEventID string) ([]Event, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ms := s.streams[stream]
+	if ms == nil || !ms.ids[lastEventID] {
+		return nil, false, nil
+	}
+	for i, ev := range ms.events {
+		if ev.ID == lastEventID {
+			return append([]Event(nil), ms.events[i+1:]...), true, nil
+		}
+	}
+	return nil, false, nil
+}
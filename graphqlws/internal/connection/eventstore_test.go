@@ -0,0 +1,73 @@
+package connection_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func events(ids ...string) []interface{} {
+	evs := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		evs = append(evs, connection.Event{ID: id, Payload: map[string]interface{}{"data": map[string]string{"id": id}}})
+	}
+	return evs
+}
+
+func TestReplayEvents(t *testing.T) {
+	store := connection.NewMemoryEventStore(2)
+
+	ws := newConnection()
+	go connection.Connect(ws, newGQLServiceWithPayloads(events("1", "2", "3")...), context.Background(),
+		connection.ReplayEvents(store, nil),
+	)
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{"query":"subscription { events }"}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"data","payload":{"data":{"id":"1"}},"eventId":"1"}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"data","payload":{"data":{"id":"2"}},"eventId":"2"}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"data","payload":{"data":{"id":"3"}},"eventId":"3"}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+
+	// the client resumes after 2, missing 3 which the service doesn't send
+	// again
+	ws = newConnection()
+	go connection.Connect(ws, newGQLServiceWithPayloads(events("3", "4")...), context.Background(),
+		connection.ReplayEvents(store, nil),
+	)
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{"query":"subscription { events }","lastEventId":"2"}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"data","payload":{"data":{"id":"3"}},"eventId":"3"}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"data","payload":{"data":{"id":"4"}},"eventId":"4"}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
+
+func TestMemoryEventStore(t *testing.T) {
+	ctx := context.Background()
+	store := connection.NewMemoryEventStore(3)
+	for _, id := range []string{"1", "2", "2", "3"} {
+		if err := store.Append(ctx, "s", connection.Event{ID: id, Payload: json.RawMessage(id)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	evs, ok, err := store.Since(ctx, "s", "1")
+	if err != nil || !ok {
+		t.Fatalf("expected the events after 1 but instead got %v, %v", ok, err)
+	}
+	if len(evs) != 2 || evs[0].ID != "2" || evs[1].ID != "3" {
+		t.Fatalf("expected the events 2 and 3 once but instead got %v", evs)
+	}
+	if _, ok, _ := store.Since(ctx, "s", "4"); ok {
+		t.Fatal("expected the unknown event 4 not to be found")
+	}
+}
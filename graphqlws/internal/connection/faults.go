@@ -0,0 +1,95 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrInjectedFault is the error of the writes failed by Faults
+var ErrInjectedFault = errors.New("injected fault")
+
+// Faults holds failures to inject on demand into the connections running
+// given operations, keyed by the socket id of the operation, so that the
+// reconnect and resume logic of clients can be tested against a misbehaving
+// server. Faults are armed before the operation starts, e.g. with predictable
+// socket ids, and injected once when it does. It's safe for concurrent use.
+type Faults struct {
+	mu         sync.Mutex
+	writes     map[string]bool
+	subscribes map[string]error
+	keepAlives map[string]bool
+}
+
+// NewFaults returns Faults without any armed
+func NewFaults() *Faults {
+	return &Faults{
+		writes:     map[string]bool{},
+		subscribes: map[string]error{},
+		keepAlives: map[string]bool{},
+	}
+}
+
+// FailNextWrite makes the next write of the connection running the operation
+// socketID fail with ErrInjectedFault once it starts, which closes the
+// connection
+func (f *Faults) FailNextWrite(socketID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writes[socketID] = true
+}
+
+// FailSubscribe makes the operation socketID fail with err instead of calling
+// GraphQLService.Subscribe
+func (f *Faults) FailSubscribe(socketID string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subscribes[socketID] = err
+}
+
+// StopKeepAlive stops the ka messages of the connection running the operation
+// socketID once it starts, as if the server hung
+func (f *Faults) StopKeepAlive(socketID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keepAlives[socketID] = true
+}
+
+// take disarms and returns the faults of the operation socketID
+func (f *Faults) take(socketID string) (failWrite bool, subscribeErr error, stopKeepAlive bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	failWrite, subscribeErr, stopKeepAlive = f.writes[socketID], f.subscribes[socketID], f.keepAlives[socketID]
+	delete(f.writes, socketID)
+	delete(f.subscribes, socketID)
+	delete(f.keepAlives, socketID)
+	return failWrite, subscribeErr, stopKeepAlive
+}
+
+// InjectFaults makes the connection inject the faults armed in f into the
+// operations it runs, it's meant for tests only
+func InjectFaults(f *Faults) Option {
+	return func(conn *connection) {
+		conn.faults = f
+	}
+}
+
+// injectFaults injects the faults armed for the operation ctx belongs to, it
+// returns the error Subscribe should fail with if any
+func (conn *connection) injectFaults(ctx context.Context) error {
+	if conn.faults == nil {
+		return nil
+	}
+	socketID, _ := SocketIDFromContext(ctx)
+
+	failWrite, subscribeErr, stopKeepAlive := conn.faults.take(socketID)
+	if failWrite {
+		atomic.StoreInt32(&conn.failWrite, 1)
+	}
+	if stopKeepAlive {
+		atomic.StoreInt32(&conn.keepAlive.stopped, 1)
+	}
+	return subscribeErr
+}
@@ -0,0 +1,93 @@
+package connection_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestFaultsFailSubscribe(t *testing.T) {
+	faults := connection.NewFaults()
+	faults.FailSubscribe("op-2", errors.New("injected"))
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(), context.Background(),
+		connection.GenerateIDs(graphqlwstest.SequentialIDs("op-")),
+		connection.InjectFaults(faults),
+	)
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"id":"b","type":"start","payload":{}}`},
+		{intention: expectation, operationMessage: `{"id":"b","type":"error","payload":{"message":"injected"}}`},
+		{intention: expectation, operationMessage: `{"id":"b","type":"complete"}`},
+		// faults are only injected once
+		{intention: clientSends, operationMessage: `{"id":"b","type":"start","payload":{}}`},
+		{intention: expectation, operationMessage: `{"id":"b","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
+
+func TestFaultsFailNextWrite(t *testing.T) {
+	faults := connection.NewFaults()
+	faults.FailNextWrite("op-1")
+	o := make(reasonObserver, 1)
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(`{"data":{}}`), context.Background(),
+		connection.GenerateIDs(graphqlwstest.SequentialIDs("op-")),
+		connection.InjectFaults(faults),
+		connection.Observe(o),
+	)
+
+	ws.in <- []byte(`{"type":"connection_init","payload":{}}`)
+	requireEqualJSON(t, connectionACK, <-ws.out)
+	ws.in <- []byte(`{"id":"a","type":"start","payload":{}}`)
+
+	select {
+	case got := <-o:
+		if !errors.Is(got, connection.ErrWriteFailed) || !errors.Is(got, connection.ErrInjectedFault) {
+			t.Fatalf("expected an injected write failure but instead got %v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the connection to be closed")
+	}
+	if msg, ok := <-ws.out; ok {
+		t.Fatalf("expected no message but instead got %s", msg)
+	}
+}
+
+func TestFaultsStopKeepAlive(t *testing.T) {
+	clock := graphqlwstest.NewFakeClock(time.Now())
+	faults := connection.NewFaults()
+	faults.StopKeepAlive("op-1")
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(), context.Background(),
+		connection.UseClock(clock),
+		connection.KeepAliveRange(time.Second, time.Second),
+		connection.GenerateIDs(graphqlwstest.SequentialIDs("op-")),
+		connection.InjectFaults(faults),
+	)
+
+	ws.in <- []byte(`{"type":"connection_init","payload":{"keepAlive":1000}}`)
+	requireEqualJSON(t, `{"type":"connection_ack","payload":{"extensions":{"batching":true,"flowControl":true,"keepAlive":1000,"resume":true}}}`, <-ws.out)
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	requireEqualJSON(t, `{"type":"ka"}`, <-ws.out)
+
+	ws.in <- []byte(`{"id":"a","type":"start","payload":{}}`)
+	requireEqualJSON(t, `{"id":"a","type":"complete"}`, <-ws.out)
+	clock.Advance(time.Second)
+	select {
+	case msg := <-ws.out:
+		t.Fatalf("expected no keepalive but instead got %s", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	ws.in <- []byte(`{"type":"connection_terminate"}`)
+}
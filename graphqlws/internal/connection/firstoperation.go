@@ -0,0 +1,65 @@
+package connection
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// closePolicyViolation is the close code of connections closed for not
+// following the server's policy
+const closePolicyViolation = 1008
+
+// firstOperation closes connections which don't start an operation in time
+// after their connection_init
+type firstOperation struct {
+	timeout   time.Duration
+	armOnce   sync.Once
+	startOnce sync.Once
+	started   chan struct{}
+}
+
+// FirstOperationTimeout closes connections which don't start an operation
+// within d of their connection_init, with ErrNoOperation as the close reason,
+// e.g. to get rid of bots and misconfigured clients parking idle sockets.
+func FirstOperationTimeout(d time.Duration) Option {
+	return func(conn *connection) {
+		conn.firstOp.timeout = d
+		conn.firstOp.started = make(chan struct{})
+	}
+}
+
+// armFirstOperation starts the timeout, on the first connection_init only
+func (conn *connection) armFirstOperation(ctx context.Context) {
+	fo := &conn.firstOp
+	if fo.timeout <= 0 {
+		return
+	}
+
+	fo.armOnce.Do(func() {
+		timer := conn.clock.NewTimer(fo.timeout)
+		conn.spawn(func() {
+			defer timer.Stop()
+			select {
+			case <-timer.C():
+				// an operation may have started as the timer fired
+				select {
+				case <-fo.started:
+				default:
+					conn.closeWithCode(closePolicyViolation, ErrNoOperation)
+				}
+			case <-fo.started:
+			case <-ctx.Done():
+			}
+		})
+	})
+}
+
+// operationStarted disarms the timeout
+func (conn *connection) operationStarted() {
+	fo := &conn.firstOp
+	if fo.timeout <= 0 {
+		return
+	}
+	fo.startOnce.Do(func() { close(fo.started) })
+}
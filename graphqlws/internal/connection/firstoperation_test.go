@@ -0,0 +1,55 @@
+package connection_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestFirstOperationTimeout(t *testing.T) {
+	for name, tc := range map[string]struct {
+		start    bool
+		expected error
+	}{
+		"idle":    {expected: connection.ErrNoOperation},
+		"started": {start: true, expected: connection.ErrClientTerminated},
+	} {
+		t.Run(name, func(t *testing.T) {
+			clock := graphqlwstest.NewFakeClock(time.Now())
+			o := make(reasonObserver, 1)
+			ws := newConnection()
+			go connection.Connect(ws, newGQLService(), context.Background(),
+				connection.UseClock(clock),
+				connection.FirstOperationTimeout(time.Minute),
+				connection.Observe(o),
+			)
+
+			ws.in <- []byte(`{"type":"connection_init","payload":{}}`)
+			requireEqualJSON(t, connectionACK, <-ws.out)
+			if tc.start {
+				ws.in <- []byte(`{"id":"a","type":"start","payload":{}}`)
+				requireEqualJSON(t, `{"id":"a","type":"complete"}`, <-ws.out)
+			}
+			if tc.start {
+				clock.Advance(time.Minute)
+				ws.in <- []byte(`{"type":"connection_terminate"}`)
+			} else {
+				clock.BlockUntil(1)
+				clock.Advance(time.Minute)
+			}
+
+			select {
+			case got := <-o:
+				if !errors.Is(got, tc.expected) {
+					t.Fatalf("expected %v but instead got %v", tc.expected, got)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("expected the connection to be closed")
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package connection
+
+import (
+	"bytes"
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// decodeFrame decodes a single incoming frame. A frame usually carries one
+// operation message but, as an extension to the protocol, it may also carry
+// an array of them (e.g. many start messages right after connection_init, or
+// a batch of receive acknowledgements), which are then handled in order.
+//
+// Only the id and type of the messages are decoded, which is all that's needed
+// to route them. Their payloads are only validated and sliced out of frame as
+// they are, left to the handlers to parse, so that e.g. a stop message doesn't
+// pay for unmarshaling a large payload nobody looks at.
+func decodeFrame(frame json.RawMessage) ([]operationMessage, error) {
+	d := frameDecoder{data: frame}
+	d.skipSpace()
+
+	var msgs []operationMessage
+	if d.peek() == '[' {
+		d.pos++
+		for first := true; ; first = false {
+			d.skipSpace()
+			if d.peek() == ']' && first {
+				d.pos++
+				break
+			}
+
+			msg, err := d.message()
+			if err != nil {
+				return nil, err
+			}
+			msgs = append(msgs, msg)
+
+			d.skipSpace()
+			c := d.next()
+			if c == ']' {
+				break
+			}
+			if c != ',' {
+				return nil, ErrMalformedFrame
+			}
+		}
+	} else {
+		msg, err := d.message()
+		if err != nil {
+			return nil, err
+		}
+		msgs = []operationMessage{msg}
+	}
+
+	d.skipSpace()
+	if d.pos != len(d.data) {
+		return nil, ErrMalformedFrame
+	}
+	return msgs, nil
+}
+
+// frameDecoder scans the top level of a frame
+type frameDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *frameDecoder) peek() byte {
+	if d.pos < len(d.data) {
+		return d.data[d.pos]
+	}
+	return 0
+}
+
+func (d *frameDecoder) next() byte {
+	c := d.peek()
+	d.pos++
+	return c
+}
+
+func (d *frameDecoder) skipSpace() {
+	for d.pos < len(d.data) {
+		switch d.data[d.pos] {
+		case ' ', '\t', '\r', '\n':
+			d.pos++
+		default:
+			return
+		}
+	}
+}
+
+// message decodes an operation message object. Like encoding/json, keys are
+// matched case-insensitively and the last occurrence of a key wins.
+func (d *frameDecoder) message() (operationMessage, error) {
+	var msg operationMessage
+	if d.next() != '{' {
+		return msg, ErrMalformedFrame
+	}
+
+	for first := true; ; first = false {
+		d.skipSpace()
+		if d.peek() == '}' && first {
+			d.pos++
+			return msg, nil
+		}
+
+		key, err := d.string()
+		if err != nil {
+			return msg, err
+		}
+		d.skipSpace()
+		if d.next() != ':' {
+			return msg, ErrMalformedFrame
+		}
+		d.skipSpace()
+
+		switch {
+		case bytes.EqualFold(key, []byte("id")):
+			msg.ID, err = d.stringValue()
+		case bytes.EqualFold(key, []byte("type")):
+			var t string
+			t, err = d.stringValue()
+			msg.Type = operationMessageType(t)
+		case bytes.EqualFold(key, []byte("payload")):
+			start := d.pos
+			err = d.skipValue()
+			msg.Payload = json.RawMessage(d.data[start:d.pos])
+		default:
+			err = d.skipValue()
+		}
+		if err != nil {
+			return msg, err
+		}
+
+		d.skipSpace()
+		switch d.next() {
+		case '}':
+			return msg, nil
+		case ',':
+		default:
+			return msg, ErrMalformedFrame
+		}
+	}
+}
+
+// stringValue decodes a string value, null decodes to the empty string
+func (d *frameDecoder) stringValue() (string, error) {
+	if bytes.HasPrefix(d.data[d.pos:], []byte("null")) {
+		d.pos += len("null")
+		return "", nil
+	}
+
+	start := d.pos
+	raw, err := d.string()
+	if err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(raw, '\\') < 0 && utf8.Valid(raw) {
+		return string(raw), nil
+	}
+
+	// leave escapes and invalid UTF-8 to encoding/json
+	var s string
+	if err := json.Unmarshal(d.data[start:d.pos], &s); err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+// string skips over a string and returns its contents, still quoted
+func (d *frameDecoder) string() ([]byte, error) {
+	if d.next() != '"' {
+		return nil, ErrMalformedFrame
+	}
+
+	start := d.pos
+	for d.pos < len(d.data) {
+		switch c := d.data[d.pos]; {
+		case c == '"':
+			d.pos++
+			return d.data[start : d.pos-1], nil
+		case c == '\\':
+			d.pos += 2
+		case c < 0x20:
+			return nil, ErrMalformedFrame
+		default:
+			d.pos++
+		}
+	}
+	return nil, ErrMalformedFrame
+}
+
+// skipValue skips over a value, failing if it isn't valid JSON. Validating
+// the value is still cheaper than unmarshaling it.
+func (d *frameDecoder) skipValue() error {
+	start := d.pos
+	if err := d.scanValue(); err != nil {
+		return err
+	}
+	if !json.Valid(d.data[start:d.pos]) {
+		return ErrMalformedFrame
+	}
+	return nil
+}
+
+// scanValue skips over a value, balancing brackets but otherwise without
+// validating it
+func (d *frameDecoder) scanValue() error {
+	switch d.peek() {
+	case '"':
+		_, err := d.string()
+		return err
+	case '{', '[':
+		depth := 0
+		for d.pos < len(d.data) {
+			switch d.data[d.pos] {
+			case '"':
+				if _, err := d.string(); err != nil {
+					return err
+				}
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+			}
+			d.pos++
+			if depth == 0 {
+				return nil
+			}
+		}
+		return ErrMalformedFrame
+	default:
+		start := d.pos
+		for d.pos < len(d.data) {
+			switch d.data[d.pos] {
+			case ',', '}', ']', ' ', '\t', '\r', '\n':
+				if d.pos == start {
+					return ErrMalformedFrame
+				}
+				return nil
+			}
+			d.pos++
+		}
+		if d.pos == start {
+			return ErrMalformedFrame
+		}
+		return nil
+	}
+}
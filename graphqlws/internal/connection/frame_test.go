@@ -0,0 +1,80 @@
+package connection
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeFrame(t *testing.T) {
+	for _, frame := range []string{
+		`{"type":"connection_init","payload":{}}`,
+		` { "id" : "a-id" , "type" : "start" , "payload" : {"query":"{ a }","variables":{"b":[1,"]}"]}} } `,
+		`{"id":"a-id","type":"stop"}`,
+		`{"ID":"a-id","Type":"stop","unknown":[{"a":null},true,1.5e3]}`,
+		`{"id":"\"quoted\"é\n","type":"start","payload":"string"}`,
+		`{"id":null,"type":"ka","payload":null}`,
+		`{"type":"stop","type":"start"}`,
+		`[{"type":"connection_init"},{"id":"a-id","type":"start","payload":{}}]`,
+		`[]`,
+	} {
+		var expected []operationMessage
+		if frame[0] == '[' {
+			if err := json.Unmarshal([]byte(frame), &expected); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			var msg operationMessage
+			if err := json.Unmarshal([]byte(frame), &msg); err != nil {
+				t.Fatal(err)
+			}
+			expected = []operationMessage{msg}
+		}
+
+		got, err := decodeFrame(json.RawMessage(frame))
+		if err != nil {
+			t.Fatalf("%s: %s", frame, err)
+		}
+		if len(expected) == 0 && len(got) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(expected, got) {
+			t.Fatalf("%s: expected %+v but instead got %+v", frame, expected, got)
+		}
+	}
+}
+
+func TestDecodeFrameMalformed(t *testing.T) {
+	for _, frame := range []string{
+		``,
+		`null`,
+		`{"type":"stop"`,
+		`{"type":"stop",}`,
+		`{"type":1}`,
+		`{"type":"stop"} {}`,
+		`[{"type":"stop"},]`,
+		`{"type":"start","payload":{"query":"}`,
+		`{"type":"ping","payload":{]}`,
+		`{"type":"ping","payload":foo}`,
+		`{"type":"ping","unknown":[1,}`,
+		`{"type":"ping","payload":"\x"}`,
+	} {
+		if _, err := decodeFrame(json.RawMessage(frame)); err == nil {
+			t.Fatalf("%s: expected an error", frame)
+		}
+	}
+}
+
+func TestDecodeFrameLazyPayload(t *testing.T) {
+	// payloads are validated but only parsed by the handlers
+	msgs, err := decodeFrame(json.RawMessage(`{"id":"a-id","type":"stop","payload":{"a" : [true]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msgs[0].Type != typeStop || msgs[0].ID != "a-id" || string(msgs[0].Payload) != `{"a" : [true]}` {
+		t.Fatalf("unexpected message %+v", msgs[0])
+	}
+	if _, err := decodeFrame(json.RawMessage(`{"id":"a-id","type":"stop","payload":{"a":tru}}`)); err == nil {
+		t.Fatal("expected an error")
+	}
+}
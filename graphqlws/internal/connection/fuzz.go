@@ -0,0 +1,83 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DecodedMessage is an operation message as routed by the connection, its
+// payload left undecoded
+type DecodedMessage struct {
+	ID      string
+	Type    string
+	Payload json.RawMessage
+}
+
+// DecodeFrame decodes frame the way incoming frames are, it's exported as an
+// entry point for fuzzing, see the graphqlwstest package.
+func DecodeFrame(frame []byte) ([]DecodedMessage, error) {
+	msgs, err := decodeFrame(frame)
+	if err != nil {
+		return nil, err
+	}
+
+	decoded := make([]DecodedMessage, len(msgs))
+	for i, msg := range msgs {
+		decoded[i] = DecodedMessage{ID: msg.ID, Type: string(msg.Type), Payload: msg.Payload}
+	}
+	return decoded, nil
+}
+
+// HandleFrames handles frames in order on a new connection to service and
+// returns the frames written in response until the connection was closed,
+// which it is after the last one. It's exported as an entry point for
+// fuzzing, see the graphqlwstest package.
+func HandleFrames(service GraphQLService, frames [][]byte, options ...Option) [][]byte {
+	ws := &memoryConn{}
+	handleFrame, closeWith := Attach(ws, service, context.Background(), options...)
+	for _, frame := range frames {
+		if !handleFrame(frame) {
+			break
+		}
+	}
+	closeWith(nil)
+	return ws.written()
+}
+
+var errMemoryConnRead = errors.New("memory connections are read by their caller")
+
+// memoryConn records the frames written to it
+type memoryConn struct {
+	mu     sync.Mutex
+	frames [][]byte
+}
+
+func (c *memoryConn) ReadMessage() (int, []byte, error) {
+	return 0, nil, errMemoryConnRead
+}
+
+func (c *memoryConn) WriteMessage(messageType int, data []byte) error {
+	c.mu.Lock()
+	c.frames = append(c.frames, append([]byte(nil), data...))
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *memoryConn) written() [][]byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]byte(nil), c.frames...)
+}
+
+func (c *memoryConn) SetReadLimit(limit int64) {}
+
+func (c *memoryConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (c *memoryConn) Close() error {
+	return nil
+}
@@ -0,0 +1,65 @@
+package connection
+
+import (
+	"encoding/json"
+	"errors"
+
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+)
+
+// graphQLError is an error as sent to clients, in the format of the GraphQL
+// spec
+type graphQLError struct {
+	Message    string                 `json:"message"`
+	Locations  []gqlerrors.Location   `json:"locations,omitempty"`
+	Path       []interface{}          `json:"path,omitempty"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// newGraphQLError returns err in the format of the GraphQL spec. Besides the
+// errors of graphql-go, errors may carry extensions, a path and locations by
+// implementing Extensions() map[string]interface{}, Path() []interface{} and
+// Locations() []errors.Location.
+func newGraphQLError(err error) graphQLError {
+	if qe, ok := err.(*gqlerrors.QueryError); ok {
+		return graphQLError{
+			Message:    qe.Message,
+			Locations:  qe.Locations,
+			Path:       qe.Path,
+			Extensions: qe.Extensions,
+		}
+	}
+
+	e := graphQLError{Message: err.Error()}
+	var ext interface{ Extensions() map[string]interface{} }
+	if errors.As(err, &ext) {
+		e.Extensions = ext.Extensions()
+	}
+	var path interface{ Path() []interface{} }
+	if errors.As(err, &path) {
+		e.Path = path.Path()
+	}
+	var locations interface{ Locations() []gqlerrors.Location }
+	if errors.As(err, &locations) {
+		e.Locations = locations.Locations()
+	}
+	return e
+}
+
+// errPayload returns the payload of the error messages for err, an array of
+// errors if err joins several of them, e.g. with errors.Join
+func errPayload(err error) json.RawMessage {
+	var payload interface{} = newGraphQLError(err)
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		if errs := joined.Unwrap(); len(errs) > 1 {
+			list := make([]graphQLError, 0, len(errs))
+			for _, err := range errs {
+				list = append(list, newGraphQLError(err))
+			}
+			payload = list
+		}
+	}
+
+	b, _ := json.Marshal(payload)
+	return b
+}
@@ -0,0 +1,46 @@
+package connection
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+)
+
+// pathError is an error with a path and an extensions code
+type pathError struct{}
+
+func (pathError) Error() string {
+	return "not found"
+}
+
+func (pathError) Path() []interface{} {
+	return []interface{}{"user", 0, "name"}
+}
+
+func (pathError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": "NOT_FOUND"}
+}
+
+func TestErrPayload(t *testing.T) {
+	queryError := &gqlerrors.QueryError{
+		Message:    "cannot query field",
+		Locations:  []gqlerrors.Location{{Line: 1, Column: 3}},
+		Path:       []interface{}{"a"},
+		Extensions: map[string]interface{}{"code": "GRAPHQL_VALIDATION_FAILED"},
+	}
+	for _, tc := range []struct {
+		err      error
+		expected string
+	}{
+		{err: errors.New("boom"), expected: `{"message":"boom"}`},
+		{err: queryError, expected: `{"message":"cannot query field","locations":[{"line":1,"column":3}],"path":["a"],"extensions":{"code":"GRAPHQL_VALIDATION_FAILED"}}`},
+		{err: fmt.Errorf("resolving: %w", pathError{}), expected: `{"message":"resolving: not found","path":["user",0,"name"],"extensions":{"code":"NOT_FOUND"}}`},
+		{err: errors.Join(queryError, errors.New("boom")), expected: `[{"message":"cannot query field","locations":[{"line":1,"column":3}],"path":["a"],"extensions":{"code":"GRAPHQL_VALIDATION_FAILED"}},{"message":"boom"}]`},
+	} {
+		if got := string(errPayload(tc.err)); got != tc.expected {
+			t.Errorf("expected %s but instead got %s", tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// Conn is the handle to the connection passed to message handlers
+type Conn interface {
+	// Send queues an operation message of the given type to the client
+	Send(id string, msgType string, payload json.RawMessage)
+}
+
+// MessageHandler handles an incoming operation message of a custom type, id
+// and payload are the ones sent by the client and may be empty. The error it
+// returns, if any, is sent to the client in an error message with the id.
+type MessageHandler func(ctx context.Context, conn Conn, id string, payload json.RawMessage) error
+
+// HandleMessage registers the handler for operation messages of type msgType,
+// replacing any previously registered one. It can't override the handling of
+// the message types defined by the protocol, e.g. start or stop.
+func HandleMessage(msgType string, handler MessageHandler) Option {
+	return func(conn *connection) {
+		conn.handlers[operationMessageType(msgType)] = handler
+	}
+}
+
+type messageConn struct {
+	sendMessage sendMessageFunc
+}
+
+func (c messageConn) Send(id string, msgType string, payload json.RawMessage) {
+	c.sendMessage.send(id, operationMessageType(msgType), payload)
+}
+
+// PingHandler returns the payload of the pong answering a ping message of the
+// legacy protocol, whose payload may be empty
+type PingHandler func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error)
+
+// ReceiveHandler is told that the client received the event id, as sent in the
+// payload of a receive message
+type ReceiveHandler func(ctx context.Context, id string) error
+
+// OnPing sets the handler of ping messages, which by default are answered with
+// a pong echoing their payload. If fn returns an error the client is sent an
+// error message instead.
+func OnPing(fn PingHandler) Option {
+	return func(conn *connection) {
+		conn.onPing = fn
+	}
+}
+
+// OnReceive sets the handler of receive messages, which by default are
+// ignored. If fn returns an error the client is sent an error message.
+func OnReceive(fn ReceiveHandler) Option {
+	return func(conn *connection) {
+		conn.onReceive = fn
+	}
+}
+
+// PingQuery answers ping messages with the response of GraphQLService.Exec to
+// query, whose variables are the fields of the payload of the ping if it's an
+// object.
+func PingQuery(query string) Option {
+	return func(conn *connection) {
+		conn.onPing = func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+			var variables map[string]interface{}
+			// payloads which aren't objects don't make variables
+			_ = json.Unmarshal(payload, &variables)
+			return json.Marshal(conn.service.Exec(ctx, query, "", variables))
+		}
+	}
+}
+
+// ReceiveMutation handles receive messages by executing mutation with
+// GraphQLService.Exec, the ID of the event received being its $id variable,
+// e.g. mutation($id: ID!) { receive_socket_event(id: $id) }. The errors of the
+// response are sent to the client in an error message.
+func ReceiveMutation(mutation string) Option {
+	return func(conn *connection) {
+		conn.onReceive = func(ctx context.Context, id string) error {
+			response := conn.service.Exec(ctx, mutation, "", map[string]interface{}{"id": id})
+			errs := make([]error, 0, len(response.Errors))
+			for _, err := range response.Errors {
+				errs = append(errs, err)
+			}
+			return errors.Join(errs...)
+		}
+	}
+}
+
+// handlePing is the default handler for ping messages
+func (conn *connection) handlePing(ctx context.Context, c Conn, id string, payload json.RawMessage) error {
+	if conn.onPing == nil {
+		c.Send("", string(typePong), append(json.RawMessage(nil), payload...))
+		return nil
+	}
+
+	var pong json.RawMessage
+	var err error
+	if perr := conn.callService(ctx, id, func() {
+		pong, err = conn.onPing(ctx, payload)
+	}); perr != nil {
+		err = perr
+	}
+	if err != nil {
+		return err
+	}
+	c.Send("", string(typePong), pong)
+	return nil
+}
+
+// handleReceive is the default handler for receive messages
+func (conn *connection) handleReceive(ctx context.Context, c Conn, id string, payload json.RawMessage) error {
+	var rp receiveMessagePayload
+	if err := json.Unmarshal(payload, &rp); err != nil {
+		return err
+	}
+	if conn.onReceive == nil {
+		return nil
+	}
+
+	var err error
+	if perr := conn.callService(ctx, id, func() {
+		err = conn.onReceive(ctx, rp.ID)
+	}); perr != nil {
+		err = perr
+	}
+	return err
+}
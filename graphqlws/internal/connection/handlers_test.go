@@ -0,0 +1,89 @@
+package connection_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	graphql "github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// execService records the query and variables of the last call to Exec
+type execService struct {
+	gqlService
+	query     chan string
+	variables chan map[string]interface{}
+}
+
+func (s *execService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	s.query <- queryString
+	s.variables <- variables
+	if variables["id"] == "2" {
+		return &graphql.Response{Errors: []*gqlerrors.QueryError{{Message: "unknown event"}}}
+	}
+	return &graphql.Response{Data: []byte(`{"ok":true}`)}
+}
+
+func TestPingQuery(t *testing.T) {
+	svc := &execService{query: make(chan string, 1), variables: make(chan map[string]interface{}, 1)}
+	ws := newConnection()
+	go connection.Connect(ws, svc, context.Background(), connection.PingQuery("query($at: Int) { check(at: $at) }"))
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"ping","payload":{"at":1}}`},
+		{intention: expectation, operationMessage: `{"type":"pong","payload":{"data":{"ok":true}}}`},
+	})
+	if query := <-svc.query; query != "query($at: Int) { check(at: $at) }" {
+		t.Fatalf("expected the ping query but instead got %s", query)
+	}
+	if variables := <-svc.variables; variables["at"] != float64(1) {
+		t.Fatalf("expected the payload of the ping as variables but instead got %v", variables)
+	}
+	ws.in <- []byte(`{"type":"connection_terminate"}`)
+}
+
+func TestReceiveMutation(t *testing.T) {
+	svc := &execService{query: make(chan string, 2), variables: make(chan map[string]interface{}, 2)}
+	ws := newConnection()
+	go connection.Connect(ws, svc, context.Background(),
+		connection.ReceiveMutation("mutation($id: ID!) { receive_socket_event(id: $id) }"),
+	)
+
+	// only the failed mutation is answered
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"receive","payload":{"id":"1\"}"}}`},
+		{intention: clientSends, operationMessage: `{"id":"r","type":"receive","payload":{"id":"2"}}`},
+		{intention: expectation, operationMessage: `{"id":"r","type":"error","payload":{"message":"graphql: unknown event"}}`},
+	})
+	if query := <-svc.query; query != "mutation($id: ID!) { receive_socket_event(id: $id) }" {
+		t.Fatalf("expected the receive mutation but instead got %s", query)
+	}
+	if variables := <-svc.variables; variables["id"] != `1"}` {
+		t.Fatalf("expected the ID as a variable but instead got %v", variables)
+	}
+	ws.in <- []byte(`{"type":"connection_terminate"}`)
+}
+
+func TestOnReceive(t *testing.T) {
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(), context.Background(),
+		connection.OnReceive(func(ctx context.Context, id string) error {
+			return errors.New("unknown event " + id)
+		}),
+		connection.OnPing(func(ctx context.Context, payload json.RawMessage) (json.RawMessage, error) {
+			return json.RawMessage(`{"status":"ok"}`), nil
+		}),
+	)
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"ping"}`},
+		{intention: expectation, operationMessage: `{"type":"pong","payload":{"status":"ok"}}`},
+		{intention: clientSends, operationMessage: `{"id":"r","type":"receive","payload":{"id":"1"}}`},
+		{intention: expectation, operationMessage: `{"id":"r","type":"error","payload":{"message":"unknown event 1"}}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
@@ -0,0 +1,99 @@
+package connection
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// IDGenerator generates the socket ids carried by the contexts of operations
+type IDGenerator interface {
+	NewID() string
+}
+
+// IDGeneratorFunc is a function implementing IDGenerator
+type IDGeneratorFunc func() string
+
+// NewID calls f
+func (f IDGeneratorFunc) NewID() string {
+	return f()
+}
+
+// GenerateIDs sets the generator of the socket ids of operations, the default
+// is RandomIDs seeded with the time the process started
+func GenerateIDs(g IDGenerator) Option {
+	return func(conn *connection) {
+		conn.ids = g
+	}
+}
+
+var defaultIDs = RandomIDs(rand.NewSource(time.Now().UnixNano()))
+
+// ConnectionID identifies a connection, e.g. to correlate its logs, traces and
+// events
+type ConnectionID string
+
+// ConnectionIDFromContext returns the id of the connection ctx belongs to,
+// false if it doesn't belong to one
+func ConnectionIDFromContext(ctx context.Context) (ConnectionID, bool) {
+	conn, ok := ctx.Value(connectionKey).(*connection)
+	if !ok {
+		return "", false
+	}
+	return conn.id, true
+}
+
+// GenerateConnectionIDs sets the generator of the ids of connections, the
+// default is UUIDs
+func GenerateConnectionIDs(g IDGenerator) Option {
+	return func(conn *connection) {
+		conn.connIDs = g
+	}
+}
+
+// UUIDs is an IDGenerator of random (version 4) UUIDs
+var UUIDs IDGenerator = IDGeneratorFunc(newUUID)
+
+func newUUID() string {
+	var b [16]byte
+	cryptorand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// RandomIDs returns an IDGenerator of 64 alphanumerical characters drawn from
+// source, whose sequence of ids is reproducible when source is seeded with a
+// fixed value
+func RandomIDs(source rand.Source) IDGenerator {
+	r := rand.New(source)
+	var mu sync.Mutex
+
+	return IDGeneratorFunc(func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return randomString(r, 64)
+	})
+}
+
+func randomString(r *rand.Rand, length int) string {
+	digits := "0123456789"
+	all := "ABCDEFGHIJKLMNOPQRSTUVWXYZ" +
+		"abcdefghijklmnopqrstuvwxyz" +
+		digits
+	buf := make([]byte, length)
+	buf[0] = all[r.Intn(len(digits))]
+	for i := 1; i < length; i++ {
+		buf[i] = all[r.Intn(len(all))]
+	}
+	r.Shuffle(len(buf), func(i, j int) {
+		buf[i], buf[j] = buf[j], buf[i]
+	})
+	str := string(buf)
+
+	return str
+}
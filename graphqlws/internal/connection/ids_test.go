@@ -0,0 +1,99 @@
+package connection_test
+
+import (
+	"context"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"testing"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestRandomIDs(t *testing.T) {
+	a := connection.RandomIDs(rand.NewSource(1))
+	b := connection.RandomIDs(rand.NewSource(1))
+	for i := 0; i < 3; i++ {
+		if x, y := a.NewID(), b.NewID(); x != y || len(x) != 64 {
+			t.Fatalf("expected the same 64 characters ids but instead got %s and %s", x, y)
+		}
+	}
+}
+
+// socketIDService sends the socket ids of the operations it's subscribed to
+type socketIDService chan interface{}
+
+func (s socketIDService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	id, _ := connection.SocketIDFromContext(ctx)
+	s <- id
+	c := make(chan interface{})
+	close(c)
+	return c, nil
+}
+
+func (s socketIDService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+func TestGenerateIDs(t *testing.T) {
+	svc := make(socketIDService, 2)
+	var n int
+	ids := connection.IDGeneratorFunc(func() string {
+		n++
+		return "id-" + strconv.Itoa(n)
+	})
+	connection.HandleFrames(svc, [][]byte{
+		[]byte(`{"type":"connection_init","payload":{}}`),
+		[]byte(`[{"id":"a","type":"start","payload":{}},{"id":"b","type":"start","payload":{}}]`),
+	}, connection.GenerateIDs(ids))
+
+	for _, expected := range []string{"id-1", "id-2"} {
+		if got := <-svc; got != expected {
+			t.Fatalf("expected socket id %s but instead got %v", expected, got)
+		}
+	}
+}
+
+// connectionIDObserver sends the connection ids of the connections it
+// observes
+type connectionIDObserver chan connection.ConnectionID
+
+func (o connectionIDObserver) ConnectionStart(ctx context.Context, info connection.ConnectionInfo) context.Context {
+	id, _ := connection.ConnectionIDFromContext(ctx)
+	o <- id
+	return ctx
+}
+
+func (o connectionIDObserver) ConnectionEnd(ctx context.Context) {}
+
+func (o connectionIDObserver) OperationStart(ctx context.Context, info connection.OperationInfo) context.Context {
+	return ctx
+}
+
+func (o connectionIDObserver) OperationEnd(ctx context.Context, err error) {}
+
+func TestConnectionIDFromContext(t *testing.T) {
+	if _, ok := connection.ConnectionIDFromContext(context.Background()); ok {
+		t.Fatal("expected no connection id")
+	}
+
+	o := make(connectionIDObserver, 2)
+	for i := 0; i < 2; i++ {
+		connection.HandleFrames(newGQLService(), nil, connection.Observe(o))
+	}
+	a, b := <-o, <-o
+	if !uuidPattern.MatchString(string(a)) || a == b {
+		t.Fatalf("expected distinct UUIDs but instead got %s and %s", a, b)
+	}
+
+	connection.HandleFrames(newGQLService(), nil, connection.Observe(o), connection.GenerateConnectionIDs(connection.IDGeneratorFunc(func() string {
+		return "conn-1"
+	})))
+	if got := <-o; got != "conn-1" {
+		t.Fatalf("expected connection id conn-1 but instead got %s", got)
+	}
+}
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
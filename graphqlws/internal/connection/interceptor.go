@@ -0,0 +1,107 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// Interceptor intercepts the protocol events of a connection, e.g. to log,
+// audit or enforce quotas on them, or to rewrite payloads. Its callbacks are
+// all optional. Interceptors are chained in the order they were added, the
+// context returned by one and the payload or operation rewritten by one being
+// passed to the next, and in reverse order when operations and connections
+// end.
+type Interceptor struct {
+	// OnConnect is called with the connection_init payload before the
+	// connection is acknowledged, after the InitHandler if any. The context
+	// it returns is the one the operations run with, if it returns an error
+	// the connection is rejected as with an InitHandler.
+	OnConnect func(ctx context.Context, payload json.RawMessage) (context.Context, error)
+	// OnOperation is called before an operation starts, it may rewrite op.
+	// If it returns an error the operation fails with it.
+	OnOperation func(ctx context.Context, op *OperationInfo) error
+	// OnData is called with the payload of each data message of an
+	// operation before it's sent, it returns the payload to send, nil to
+	// drop the message. The payload is backed by a buffer reused once the
+	// message is written, it must be copied to be kept after the call, e.g.
+	// by an asynchronous audit log.
+	OnData func(ctx context.Context, id string, payload json.RawMessage) json.RawMessage
+	// OnComplete is called once an operation is done, with the error it
+	// failed with if any.
+	OnComplete func(ctx context.Context, id string, err error)
+	// OnDisconnect is called once the connection is closed, with the reason
+	// it was closed for.
+	OnDisconnect func(ctx context.Context, reason error)
+}
+
+// Intercept adds an Interceptor to the connection
+func Intercept(i Interceptor) Option {
+	return func(conn *connection) {
+		conn.interceptors = append(conn.interceptors, i)
+	}
+}
+
+// interceptConnect runs the OnConnect callbacks
+func (conn *connection) interceptConnect(ctx context.Context, payload json.RawMessage) (context.Context, error) {
+	for _, i := range conn.interceptors {
+		if i.OnConnect == nil {
+			continue
+		}
+		var err error
+		if ctx, err = i.OnConnect(ctx, payload); err != nil {
+			return nil, err
+		}
+	}
+	return ctx, nil
+}
+
+// interceptOperation runs the OnOperation callbacks, it returns the start
+// payload they rewrote
+func (conn *connection) interceptOperation(ctx context.Context, id string, osp startMessagePayload) (startMessagePayload, error) {
+	op := OperationInfo{
+		ID:            id,
+		OperationName: osp.OperationName,
+		Query:         osp.Query,
+		Variables:     osp.Variables,
+	}
+	for _, i := range conn.interceptors {
+		if i.OnOperation == nil {
+			continue
+		}
+		if err := i.OnOperation(ctx, &op); err != nil {
+			return osp, err
+		}
+	}
+	osp.OperationName, osp.Query, osp.Variables = op.OperationName, op.Query, op.Variables
+	return osp, nil
+}
+
+// interceptData runs the OnData callbacks, it returns nil if the message is
+// dropped
+func (conn *connection) interceptData(ctx context.Context, id string, payload json.RawMessage) json.RawMessage {
+	for _, i := range conn.interceptors {
+		if i.OnData == nil {
+			continue
+		}
+		if payload = i.OnData(ctx, id, payload); payload == nil {
+			return nil
+		}
+	}
+	return payload
+}
+
+func (conn *connection) interceptComplete(ctx context.Context, id string, err error) {
+	for n := len(conn.interceptors) - 1; n >= 0; n-- {
+		if fn := conn.interceptors[n].OnComplete; fn != nil {
+			fn(ctx, id, err)
+		}
+	}
+}
+
+func (conn *connection) interceptDisconnect(ctx context.Context, reason error) {
+	for n := len(conn.interceptors) - 1; n >= 0; n-- {
+		if fn := conn.interceptors[n].OnDisconnect; fn != nil {
+			fn(ctx, reason)
+		}
+	}
+}
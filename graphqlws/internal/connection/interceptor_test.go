@@ -0,0 +1,115 @@
+package connection_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestIntercept(t *testing.T) {
+	events := make(chan string, 16)
+	quota := connection.Interceptor{
+		OnConnect: func(ctx context.Context, payload json.RawMessage) (context.Context, error) {
+			events <- "connect " + string(payload)
+			return context.WithValue(ctx, userKey{}, "alice"), nil
+		},
+		OnOperation: func(ctx context.Context, op *connection.OperationInfo) error {
+			events <- fmt.Sprintf("operation %s %v", op.ID, ctx.Value(userKey{}))
+			if op.OperationName == "forbidden" {
+				return errors.New("quota exceeded")
+			}
+			op.OperationName = "rewritten"
+			return nil
+		},
+		OnComplete: func(ctx context.Context, id string, err error) {
+			events <- fmt.Sprintf("complete %s %v", id, err)
+		},
+		OnDisconnect: func(ctx context.Context, reason error) {
+			events <- fmt.Sprintf("disconnect %v", reason)
+		},
+	}
+	redact := connection.Interceptor{
+		OnData: func(ctx context.Context, id string, payload json.RawMessage) json.RawMessage {
+			if string(payload) == `{"data":"secret"}` {
+				return nil
+			}
+			return json.RawMessage(`{"data":"redacted"}`)
+		},
+		OnComplete: func(ctx context.Context, id string, err error) {
+			events <- "redact complete " + id
+		},
+	}
+
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(`{"data":"secret"}`, `{"data":"public"}`), context.Background(),
+		connection.Intercept(quota),
+		connection.Intercept(redact),
+	)
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{"token":"secret"}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{"operationName":"forbidden"}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"error","payload":{"message":"quota exceeded"}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"id":"b","type":"start","payload":{"operationName":"allowed"}}`},
+		{intention: expectation, operationMessage: `{"id":"b","type":"data","payload":{"data":"redacted"}}`},
+		{intention: expectation, operationMessage: `{"id":"b","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+
+	// the operation may end after the connection_terminate is handled
+	expected := []string{
+		`connect {"token":"secret"}`,
+		"operation a alice",
+		"operation b alice",
+		"complete b <nil>",
+		"disconnect connection terminated by the client",
+		"redact complete b",
+	}
+	var got []string
+	timeout := time.After(5 * time.Second)
+	for len(got) < len(expected) {
+		select {
+		case e := <-events:
+			got = append(got, e)
+		case <-timeout:
+			t.Fatalf("expected %v but instead got %v", expected, got)
+		}
+	}
+	sort.Strings(got[3:])
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected %v but instead got %v", expected, got)
+	}
+}
+
+func TestInterceptConnectRejected(t *testing.T) {
+	o := make(reasonObserver, 1)
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(), context.Background(),
+		connection.Intercept(connection.Interceptor{
+			OnConnect: func(ctx context.Context, payload json.RawMessage) (context.Context, error) {
+				return nil, errInvalidToken
+			},
+		}),
+		connection.Observe(o),
+	)
+
+	ws.in <- []byte(`{"type":"connection_init","payload":{}}`)
+	requireEqualJSON(t, `{"type":"connection_error","payload":{"message":"invalid token"}}`, <-ws.out)
+
+	select {
+	case got := <-o:
+		if !errors.Is(got, connection.ErrInitRejected) {
+			t.Fatalf("expected %v but instead got %v", connection.ErrInitRejected, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the connection to be closed")
+	}
+}
@@ -0,0 +1,120 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+)
+
+type keepAlive struct {
+	min, max time.Duration
+	// fallback is the interval used unless the client requests one, see
+	// KeepAlive
+	fallback time.Duration
+	interval time.Duration
+	stop     func()
+	// payload returns the payload of ka messages, see KeepAlivePayload
+	payload func(ctx context.Context) interface{}
+	// stopped is set once ka messages should no longer be sent, see Faults
+	stopped int32
+}
+
+// KeepAlive makes the server send ka messages every interval once the
+// connection is acknowledged, so that idle proxies and load balancers don't
+// drop connections running long-lived subscriptions. The interval is confirmed
+// in the connection_ack payload, clients may still request another one when
+// combined with KeepAliveRange.
+func KeepAlive(interval time.Duration) Option {
+	return func(conn *connection) {
+		conn.keepAlive.fallback = interval
+	}
+}
+
+// KeepAliveRange lets clients request the interval at which the server sends
+// ka messages, through the keepAlive field (in milliseconds) of the
+// connection_init payload. Requested intervals are clamped to [min, max] and
+// the resulting one is confirmed in the connection_ack payload.
+func KeepAliveRange(min, max time.Duration) Option {
+	return func(conn *connection) {
+		conn.keepAlive.min = min
+		conn.keepAlive.max = max
+	}
+}
+
+// KeepAlivePayload sets the function returning the payload of the ka messages
+// sent to a connection, marshaled to JSON at every tick, e.g. to piggyback the
+// server time or the remaining lifetime of the session. ka messages are sent
+// without payload when it returns nil or can't be marshaled.
+func KeepAlivePayload(fn func(ctx context.Context) interface{}) Option {
+	return func(conn *connection) {
+		conn.keepAlive.payload = fn
+	}
+}
+
+// negotiate sets the interval from the one requested by the client, no
+// keepalive is sent unless both the client and the server opt in or the
+// server sends them regardless.
+func (ka *keepAlive) negotiate(requested time.Duration) {
+	if requested <= 0 || ka.max <= 0 {
+		ka.interval = ka.fallback
+		return
+	}
+
+	switch {
+	case requested < ka.min:
+		ka.interval = ka.min
+	case requested > ka.max:
+		ka.interval = ka.max
+	default:
+		ka.interval = requested
+	}
+}
+
+// start sends ka messages every interval until ctx is done, replacing the
+// ticker of a previous connection_init if any.
+func (ka *keepAlive) start(ctx context.Context, clock Clock, spawn func(func()), sendMessage sendMessageFunc) {
+	if ka.stop != nil {
+		ka.stop()
+		ka.stop = nil
+	}
+	if ka.interval <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	ka.stop = cancel
+
+	interval := ka.interval
+	spawn(func() {
+		ticker := clock.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+				if atomic.LoadInt32(&ka.stopped) == 1 {
+					return
+				}
+				sendMessage.send("", typeConnectionKeepAlive, ka.payloadJSON(ctx))
+			}
+		}
+	})
+}
+
+func (ka *keepAlive) payloadJSON(ctx context.Context) json.RawMessage {
+	if ka.payload == nil {
+		return nil
+	}
+	payload := ka.payload(ctx)
+	if payload == nil {
+		return nil
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return nil
+	}
+	return b
+}
@@ -0,0 +1,74 @@
+package connection_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestKeepAlivePayload(t *testing.T) {
+	clock := graphqlwstest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(), context.Background(),
+		connection.UseClock(clock),
+		connection.KeepAliveRange(time.Second, time.Second),
+		connection.KeepAlivePayload(func(ctx context.Context) interface{} {
+			return map[string]interface{}{"serverTime": clock.Now().Unix()}
+		}),
+	)
+
+	ws.in <- []byte(`{"type":"connection_init","payload":{"keepAlive":1000}}`)
+	requireEqualJSON(t, `{"type":"connection_ack","payload":{"extensions":{"batching":true,"flowControl":true,"keepAlive":1000,"resume":true}}}`, <-ws.out)
+	for _, expected := range []string{
+		`{"type":"ka","payload":{"serverTime":1704067201}}`,
+		`{"type":"ka","payload":{"serverTime":1704067202}}`,
+	} {
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+		requireEqualJSON(t, expected, <-ws.out)
+	}
+
+	ws.in <- []byte(`{"type":"connection_terminate"}`)
+}
+
+func TestKeepAlive(t *testing.T) {
+	for name, tc := range map[string]struct {
+		init     string
+		interval time.Duration
+		ack      string
+	}{
+		"server interval": {
+			init:     `{}`,
+			interval: 30 * time.Second,
+			ack:      `{"type":"connection_ack","payload":{"extensions":{"batching":true,"flowControl":true,"keepAlive":30000,"resume":true}}}`,
+		},
+		"requested interval": {
+			init:     `{"keepAlive":10000}`,
+			interval: 10 * time.Second,
+			ack:      `{"type":"connection_ack","payload":{"extensions":{"batching":true,"flowControl":true,"keepAlive":10000,"resume":true}}}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			clock := graphqlwstest.NewFakeClock(time.Now())
+			ws := newConnection()
+			go connection.Connect(ws, newGQLService(), context.Background(),
+				connection.UseClock(clock),
+				connection.KeepAlive(30*time.Second),
+				connection.KeepAliveRange(time.Second, time.Minute),
+			)
+
+			ws.in <- []byte(`{"type":"connection_init","payload":` + tc.init + `}`)
+			requireEqualJSON(t, tc.ack, <-ws.out)
+			for i := 0; i < 2; i++ {
+				clock.BlockUntil(1)
+				clock.Advance(tc.interval)
+				requireEqualJSON(t, `{"type":"ka"}`, <-ws.out)
+			}
+
+			ws.in <- []byte(`{"type":"connection_terminate"}`)
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package connection
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// spawn runs fn in a goroutine tracked by the connection, see Wait. All the
+// goroutines started for a single connection must be, but for the ones shared
+// by several connections, e.g. those of a Multiplexer or a ResultCache, which
+// outlive them.
+func (conn *connection) spawn(fn func()) {
+	conn.goroutines.Add(1)
+	go func() {
+		defer conn.goroutines.Done()
+		fn()
+	}()
+}
+
+// OnOpen registers fn to be called with the context of the connection once
+// it's opened, before any message is read, e.g. to keep it for OperationCount
+// or Wait
+func OnOpen(fn func(ctx context.Context)) Option {
+	return func(conn *connection) {
+		conn.onOpen = append(conn.onOpen, fn)
+	}
+}
+
+// opened calls the OnOpen functions
+func (conn *connection) opened(ctx context.Context) {
+	for _, fn := range conn.onOpen {
+		fn(ctx)
+	}
+}
+
+// Wait blocks until the connection ctx belongs to is closed and all of its
+// goroutines have returned, including the one Connect reads in, so that none
+// leaks once its client is gone. It returns right away if ctx doesn't belong
+// to a connection, and must not be called from one of its goroutines, e.g. by
+// an InitHandler, which would never return.
+func Wait(ctx context.Context) {
+	conn, ok := ctx.Value(connectionKey).(*connection)
+	if !ok {
+		return
+	}
+	<-conn.ctx.Done()
+	conn.goroutines.Wait()
+}
+
+// StopOperation stops the operation id of the connection ctx belongs to like
+// a stop message does, but without sending the client anything more about it,
+// e.g. once a transport told it the operation failed. It returns false if
+// there's no such operation running.
+func StopOperation(ctx context.Context, id string) bool {
+	conn, ok := ctx.Value(connectionKey).(*connection)
+	if !ok {
+		return false
+	}
+	op, ok := conn.ops.loadAndDelete(id)
+	conn.session.remove(id)
+	if !ok {
+		return false
+	}
+	atomic.StoreInt32(&op.silenced, 1)
+	op.cancel()
+	op.done()
+	return true
+}
+
+// OperationCount returns the number of live operations of the connection ctx
+// belongs to, or 0 if ctx doesn't belong to a connection
+func OperationCount(ctx context.Context) int {
+	conn, ok := ctx.Value(connectionKey).(*connection)
+	if !ok {
+		return 0
+	}
+	return conn.ops.len()
+}
@@ -0,0 +1,80 @@
+package connection_test
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestWait(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	svc := blockingService{done: make(chan context.Context, 2)}
+	opened := make(chan context.Context, 1)
+	ws := newConnection()
+	go connection.Connect(ws, svc, context.Background(),
+		connection.OnOpen(func(ctx context.Context) { opened <- ctx }),
+	)
+	ctx := <-opened
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{"query":"subscription { a }"}}`},
+		{intention: clientSends, operationMessage: `{"id":"b","type":"start","payload":{"query":"subscription { b }"}}`},
+	})
+	requireOperationCount(t, ctx, 2)
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"id":"a","type":"stop"}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+	})
+	requireOperationCount(t, ctx, 1)
+
+	waited := make(chan struct{})
+	go func() {
+		defer close(waited)
+		connection.Wait(ctx)
+	}()
+	select {
+	case <-waited:
+		t.Fatal("expected Wait to block until the connection is closed")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	ws.in <- []byte(`{"type":"connection_terminate"}`)
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the goroutines of the connection to return")
+	}
+	if n := connection.OperationCount(ctx); n != 0 {
+		t.Fatalf("expected no operation but instead got %d", n)
+	}
+	for i := 0; i < 2; i++ {
+		<-svc.done
+	}
+	for range ws.out {
+	}
+	requireGoroutines(t, goroutines)
+}
+
+func TestWaitWithoutConnection(t *testing.T) {
+	connection.Wait(context.Background())
+	if n := connection.OperationCount(context.Background()); n != 0 {
+		t.Fatalf("expected no operation but instead got %d", n)
+	}
+}
+
+func requireOperationCount(t *testing.T, ctx context.Context, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for connection.OperationCount(ctx) != n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d operations but instead got %d", n, connection.OperationCount(ctx))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,40 @@
+package connection
+
+import "context"
+
+// Limiter caps how many GraphQLService.Subscribe calls may be in flight at the
+// same time across all the connections sharing it, further calls wait for one
+// of them to return.
+type Limiter struct {
+	slots chan struct{}
+}
+
+// NewLimiter returns a limiter allowing n concurrent Subscribe calls, it
+// panics if n isn't positive.
+func NewLimiter(n int) *Limiter {
+	if n <= 0 {
+		panic("connection: non-positive limit for NewLimiter")
+	}
+	return &Limiter{slots: make(chan struct{}, n)}
+}
+
+// SubscribeLimiter makes the connection's Subscribe calls go through l
+func SubscribeLimiter(l *Limiter) Option {
+	return func(conn *connection) {
+		conn.subscribeLimiter = l
+	}
+}
+
+// acquire waits for a slot until ctx is done, in which case it returns false
+func (l *Limiter) acquire(ctx context.Context) bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (l *Limiter) release() {
+	<-l.slots
+}
@@ -0,0 +1,90 @@
+package connection
+
+import "sync/atomic"
+
+// OperationLimit limits how many operations may be running at the same time
+// across all the connections sharing it. Unlike with a Budget, operations
+// started beyond the limit are rejected right away.
+type OperationLimit struct {
+	max     int64
+	running int64
+}
+
+// NewOperationLimit returns a limit of n running operations
+func NewOperationLimit(n int) *OperationLimit {
+	return &OperationLimit{max: int64(n)}
+}
+
+// LimitOperations makes new operations count against l, those started beyond
+// it are rejected with an error whose extensions code is
+// OPERATION_LIMIT_EXCEEDED
+func LimitOperations(l *OperationLimit) Option {
+	return func(conn *connection) {
+		conn.opLimit = l
+	}
+}
+
+// MaxOperations limits to n the number of operations running at the same time
+// on the connection, those started beyond it are rejected with an error whose
+// extensions code is OPERATION_LIMIT_EXCEEDED
+func MaxOperations(n int) Option {
+	return func(conn *connection) {
+		conn.connLimit = NewOperationLimit(n)
+	}
+}
+
+// acquireLimits counts a new operation against the limits of the connection,
+// the returned func must be called once the operation is done.
+func (conn *connection) acquireLimits() (func(), error) {
+	if !conn.connLimit.acquire() {
+		return nil, &limitError{limit: conn.connLimit.max, scope: "connection"}
+	}
+	if !conn.opLimit.acquire() {
+		conn.connLimit.release()
+		return nil, &limitError{limit: conn.opLimit.max, scope: "server"}
+	}
+
+	return func() {
+		conn.connLimit.release()
+		conn.opLimit.release()
+	}, nil
+}
+
+// acquire counts a new operation unless it would exceed the limit, a nil limit
+// doesn't limit anything
+func (l *OperationLimit) acquire() bool {
+	if l == nil {
+		return true
+	}
+	if atomic.AddInt64(&l.running, 1) > l.max {
+		atomic.AddInt64(&l.running, -1)
+		return false
+	}
+	return true
+}
+
+func (l *OperationLimit) release() {
+	if l != nil {
+		atomic.AddInt64(&l.running, -1)
+	}
+}
+
+// limitError is returned to clients starting an operation beyond a limit of
+// the number of running operations, scope tells whether the limit is the one
+// of the connection or of the server
+type limitError struct {
+	limit int64
+	scope string
+}
+
+func (e *limitError) Error() string {
+	return "too many running operations"
+}
+
+func (e *limitError) Extensions() map[string]interface{} {
+	return map[string]interface{}{
+		"code":  "OPERATION_LIMIT_EXCEEDED",
+		"limit": e.limit,
+		"scope": e.scope,
+	}
+}
@@ -0,0 +1,68 @@
+package connection_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestMaxOperations(t *testing.T) {
+	ws := newConnection()
+	go connection.Connect(ws, &gqlService{payloads: make(chan interface{})}, context.Background(), connection.MaxOperations(1))
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{}}`},
+		{intention: clientSends, operationMessage: `{"id":"b","type":"start","payload":{}}`},
+		{intention: expectation, operationMessage: `{"id":"b","type":"error","payload":{"message":"too many running operations","extensions":{"code":"OPERATION_LIMIT_EXCEEDED","limit":1,"scope":"connection"}}}`},
+		{intention: expectation, operationMessage: `{"id":"b","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"stop"}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"id":"c","type":"start","payload":{}}`},
+		{intention: clientSends, operationMessage: `{"id":"c","type":"stop"}`},
+		{intention: expectation, operationMessage: `{"id":"c","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
+
+func TestLimitOperations(t *testing.T) {
+	limit := connection.NewOperationLimit(1)
+	svc := &gqlService{payloads: make(chan interface{})}
+
+	first := newConnection()
+	go connection.Connect(first, svc, context.Background(), connection.LimitOperations(limit))
+	first.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{}}`},
+		// the operation is running once a stop of another one is answered
+		{intention: clientSends, operationMessage: `{"id":"z","type":"stop"}`},
+		{intention: expectation, operationMessage: `{"id":"z","type":"complete"}`},
+	})
+
+	second := newConnection()
+	go connection.Connect(second, svc, context.Background(), connection.LimitOperations(limit))
+	second.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"error","payload":{"message":"too many running operations","extensions":{"code":"OPERATION_LIMIT_EXCEEDED","limit":1,"scope":"server"}}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+
+	first.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
+
+func TestNewLimiterSize(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected NewLimiter to panic with a limit of 0")
+		}
+	}()
+	connection.NewLimiter(0)
+}
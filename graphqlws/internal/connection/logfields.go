@@ -0,0 +1,34 @@
+package connection
+
+import "context"
+
+// ContextWithLogFields returns a copy of ctx carrying the given key-value
+// pairs on top of the ones already carried by ctx, replacing the values of
+// existing keys. They are meant to be included in every log line emitted for
+// the connection or operation ctx belongs to, e.g. so that observers tracing
+// it can add the trace and span ids logs are correlated with.
+func ContextWithLogFields(ctx context.Context, keyvals ...interface{}) context.Context {
+	parent := LogFieldsFromContext(ctx)
+	fields := make([]interface{}, len(parent), len(parent)+len(keyvals))
+	copy(fields, parent)
+
+next:
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		for j := 0; j+1 < len(fields); j += 2 {
+			if fields[j] == keyvals[i] {
+				fields[j+1] = keyvals[i+1]
+				continue next
+			}
+		}
+		fields = append(fields, keyvals[i], keyvals[i+1])
+	}
+
+	return context.WithValue(ctx, logFieldsKey, fields)
+}
+
+// LogFieldsFromContext returns the key-value pairs added to ctx with
+// ContextWithLogFields
+func LogFieldsFromContext(ctx context.Context) []interface{} {
+	fields, _ := ctx.Value(logFieldsKey).([]interface{})
+	return fields
+}
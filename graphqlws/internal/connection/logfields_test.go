@@ -0,0 +1,27 @@
+package connection_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestContextWithLogFields(t *testing.T) {
+	ctx := connection.ContextWithLogFields(context.Background(), "trace_id", 1, "span_id", 2)
+	opCtx := connection.ContextWithLogFields(ctx, "span_id", 3, "operation_id", "a-id")
+
+	for _, tt := range []struct {
+		ctx      context.Context
+		expected []interface{}
+	}{
+		{context.Background(), nil},
+		{ctx, []interface{}{"trace_id", 1, "span_id", 2}},
+		{opCtx, []interface{}{"trace_id", 1, "span_id", 3, "operation_id", "a-id"}},
+	} {
+		if got := connection.LogFieldsFromContext(tt.ctx); !reflect.DeepEqual(tt.expected, got) {
+			t.Fatalf("expected %v but instead got %v", tt.expected, got)
+		}
+	}
+}
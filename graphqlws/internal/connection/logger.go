@@ -0,0 +1,63 @@
+package connection
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Log makes the connection log its lifecycle to l as structured events, with
+// the id of the connection, the id of the operation if any and the log fields
+// of the context: connect and close at the info level, init, start, data,
+// stop and complete at the debug level, the errors sent to the client at the
+// info level and the errors reported to the ErrorReporter at the error level.
+func Log(l *slog.Logger) Option {
+	return func(conn *connection) {
+		conn.logger = l
+	}
+}
+
+// log logs event for the operation operationID, if any, with the key-value
+// pairs of args
+func (conn *connection) log(ctx context.Context, level slog.Level, event string, operationID string, args ...interface{}) {
+	if conn.logger == nil || !conn.logger.Enabled(ctx, level) {
+		return
+	}
+
+	fields := LogFieldsFromContext(ctx)
+	attrs := make([]interface{}, 0, 4+len(args)+len(fields))
+	attrs = append(attrs, "connection_id", string(conn.id))
+	if operationID != "" {
+		attrs = append(attrs, "operation_id", operationID)
+	}
+	attrs = append(attrs, args...)
+	attrs = append(attrs, fields...)
+	conn.logger.Log(ctx, level, event, attrs...)
+}
+
+// logWrite logs the message written to the client, if it's worth it
+func (conn *connection) logWrite(msg *operationMessage) {
+	if conn.logger == nil {
+		return
+	}
+
+	switch msg.Type {
+	case typeData:
+		conn.log(conn.ctx, slog.LevelDebug, "data", msg.ID)
+	case typeComplete:
+		conn.log(conn.ctx, slog.LevelDebug, "complete", msg.ID)
+	case typeError, typeConnectionError:
+		conn.log(conn.ctx, slog.LevelInfo, "error", msg.ID, "payload", string(msg.Payload))
+	}
+}
+
+// logConnect logs the connection is connected
+func (conn *connection) logConnect(ctx context.Context) {
+	conn.log(ctx, slog.LevelInfo, "connect", "")
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,104 @@
+package connection_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// fieldsObserver adds a log field to the connection context
+type fieldsObserver struct {
+	reasonObserver
+}
+
+func (o fieldsObserver) ConnectionStart(ctx context.Context, info connection.ConnectionInfo) context.Context {
+	return connection.ContextWithLogFields(ctx, "trace_id", "t1")
+}
+
+// logBuffer is a bytes.Buffer the connection may log to while it's read
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestLog(t *testing.T) {
+	var buf logBuffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{
+		Level: slog.LevelDebug,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+	o := fieldsObserver{make(reasonObserver, 1)}
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(`{"data":1}`), context.Background(),
+		connection.Log(logger),
+		connection.GenerateConnectionIDs(graphqlwstest.SequentialIDs("conn-")),
+		connection.Observe(o),
+	)
+
+	ws.in <- []byte(`{"type":"connection_init","payload":{}}`)
+	requireEqualJSON(t, connectionACK, <-ws.out)
+	ws.in <- []byte(`{"id":"a","type":"start","payload":{"operationName":"tick"}}`)
+	requireEqualJSON(t, `{"id":"a","type":"data","payload":{"data":1}}`, <-ws.out)
+	requireEqualJSON(t, `{"id":"a","type":"complete"}`, <-ws.out)
+	// messages are logged once written, i.e. possibly after they're received
+	for deadline := time.Now().Add(5 * time.Second); !strings.Contains(buf.String(), `"msg":"complete"`); {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the complete message to be logged")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	ws.in <- []byte(`{"type":"connection_terminate"}`)
+
+	select {
+	case <-o.reasonObserver:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the connection to be closed")
+	}
+
+	var got []map[string]interface{}
+	dec := json.NewDecoder(strings.NewReader(buf.String()))
+	for dec.More() {
+		var event map[string]interface{}
+		if err := dec.Decode(&event); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, event)
+	}
+	expected := []map[string]interface{}{
+		{"level": "INFO", "msg": "connect", "connection_id": "conn-1", "trace_id": "t1"},
+		{"level": "DEBUG", "msg": "init", "connection_id": "conn-1", "trace_id": "t1"},
+		{"level": "DEBUG", "msg": "start", "connection_id": "conn-1", "operation_id": "a", "operation_name": "tick", "trace_id": "t1"},
+		{"level": "DEBUG", "msg": "data", "connection_id": "conn-1", "operation_id": "a", "trace_id": "t1"},
+		{"level": "DEBUG", "msg": "complete", "connection_id": "conn-1", "operation_id": "a", "trace_id": "t1"},
+		{"level": "INFO", "msg": "close", "connection_id": "conn-1", "reason": "connection terminated by the client", "trace_id": "t1"},
+	}
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v but instead got %v", expected, got)
+	}
+}
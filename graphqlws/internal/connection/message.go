@@ -0,0 +1,146 @@
+package connection
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+// textMessage is the websocket text data message type, as in gorilla/websocket
+const textMessage = 1
+
+// messagePool recycles the messages of the data forwarding hot path, they are
+// released once written.
+var messagePool = sync.Pool{
+	New: func() interface{} { return &operationMessage{} },
+}
+
+func acquireMessage() *operationMessage {
+	return messagePool.Get().(*operationMessage)
+}
+
+func releaseMessage(msg *operationMessage) {
+	if msg.payloadBuf != nil {
+		payloadBufferPool.Put(msg.payloadBuf)
+	}
+	*msg = operationMessage{}
+	messagePool.Put(msg)
+}
+
+// payloadBuffer holds a marshaled payload, with a reusable encoder writing to
+// it since json.Marshal allocates the returned slice.
+type payloadBuffer struct {
+	bytes.Buffer
+	enc *json.Encoder
+}
+
+var payloadBufferPool = sync.Pool{
+	New: func() interface{} {
+		pb := &payloadBuffer{}
+		pb.enc = json.NewEncoder(&pb.Buffer)
+		return pb
+	},
+}
+
+// marshalPayload marshals the payload of msg, reusing pooled buffers which are
+// released along with msg.
+func (msg *operationMessage) marshalPayload(v interface{}) error {
+	if raw, ok := v.(json.RawMessage); ok {
+		msg.Payload = raw
+		return nil
+	}
+
+	pb := payloadBufferPool.Get().(*payloadBuffer)
+	pb.Reset()
+	if err := pb.enc.Encode(v); err != nil {
+		payloadBufferPool.Put(pb)
+		return err
+	}
+
+	msg.payloadBuf = pb
+	msg.Payload = bytes.TrimSuffix(pb.Bytes(), []byte("\n"))
+	return nil
+}
+
+var writeBufferPool = sync.Pool{
+	New: func() interface{} { return &bytes.Buffer{} },
+}
+
+// appendJSON serializes msg as json.Marshal would, without reflection and
+// without copying the already marshaled payload more than once.
+func (msg *operationMessage) appendJSON(buf *bytes.Buffer) error {
+	buf.WriteByte('{')
+	if msg.ID != "" {
+		buf.WriteString(`"id":`)
+		appendJSONString(buf, msg.ID)
+		buf.WriteByte(',')
+	}
+	if len(msg.Payload) > 0 {
+		buf.WriteString(`"payload":`)
+		if err := json.Compact(buf, msg.Payload); err != nil {
+			return err
+		}
+		buf.WriteByte(',')
+	}
+	buf.WriteString(`"type":`)
+	appendJSONString(buf, string(msg.Type))
+	if msg.EventID != "" {
+		buf.WriteString(`,"eventId":`)
+		appendJSONString(buf, msg.EventID)
+	}
+	if msg.Seq != 0 {
+		buf.WriteString(`,"seq":`)
+		buf.WriteString(strconv.FormatUint(msg.Seq, 10))
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+const hex = "0123456789abcdef"
+
+// appendJSONString writes s as a JSON string, escaping it like encoding/json
+// does except for HTML characters.
+func appendJSONString(buf *bytes.Buffer, s string) {
+	buf.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if b >= 0x20 && b != '"' && b != '\\' {
+				i++
+				continue
+			}
+			buf.WriteString(s[start:i])
+			switch b {
+			case '"', '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(b)
+			case '\n':
+				buf.WriteString(`\n`)
+			case '\r':
+				buf.WriteString(`\r`)
+			case '\t':
+				buf.WriteString(`\t`)
+			default:
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[b>>4])
+				buf.WriteByte(hex[b&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf.WriteString(s[start:i])
+			buf.WriteRune(utf8.RuneError)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	buf.WriteString(s[start:])
+	buf.WriteByte('"')
+}
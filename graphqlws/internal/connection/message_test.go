@@ -0,0 +1,32 @@
+package connection
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestOperationMessageAppendJSON(t *testing.T) {
+	for _, msg := range []*operationMessage{
+		{Type: typeConnectionAck},
+		{ID: "a-id", Type: typeComplete},
+		{ID: "a-id", Type: typeData, Payload: json.RawMessage(`{ "data": {"a": 1} }`), EventID: "1"},
+		{ID: "\"quoted\"\\\n\t\x01\xff é", Type: typeError, Payload: json.RawMessage(`{"message":"error"}`)},
+	} {
+		var expected bytes.Buffer
+		enc := json.NewEncoder(&expected)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(msg); err != nil {
+			t.Fatal(err)
+		}
+
+		var got bytes.Buffer
+		if err := msg.appendJSON(&got); err != nil {
+			t.Fatal(err)
+		}
+
+		if exp := bytes.TrimSuffix(expected.Bytes(), []byte("\n")); !bytes.Equal(exp, got.Bytes()) {
+			t.Fatalf("expected [%s] but instead got [%s]", exp, got.Bytes())
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// Multiplexer runs identical subscriptions once, so that N clients
+// subscribing to the same events don't call the service N times. It's shared
+// by the connections it's passed to with Multiplex: subscriptions are keyed by
+// the normalized query, operation name and variables only, unless scoped with
+// a key function.
+type Multiplexer struct {
+	scope func(ctx context.Context) string
+
+	mu        sync.Mutex
+	upstreams map[string]*upstream
+}
+
+// upstream is a subscription to the service shared by its listeners, it's
+// cancelled once the last of them leaves
+type upstream struct {
+	cancel func()
+	// ready is closed once the service was subscribed to, err being then set
+	// if that failed
+	ready     chan struct{}
+	err       error
+	listeners map[*listener]struct{}
+}
+
+// listener is a subscriber of an upstream, done is closed once it left
+type listener struct {
+	c    chan interface{}
+	done chan struct{}
+	stop func() bool
+}
+
+// NewMultiplexer returns a multiplexer of subscriptions. scope, if not nil,
+// returns a key that subscriptions are additionally scoped by, e.g. the
+// tenant or user they run for when their events depend on it.
+func NewMultiplexer(scope func(ctx context.Context) string) *Multiplexer {
+	return &Multiplexer{
+		scope:     scope,
+		upstreams: map[string]*upstream{},
+	}
+}
+
+// Multiplex makes the subscriptions of the connection go through m. Queries
+// and mutations aren't multiplexed.
+func Multiplex(m *Multiplexer) Option {
+	return func(conn *connection) {
+		conn.multiplexer = m
+	}
+}
+
+// subscribe joins the running subscription identical to osp if any, it
+// otherwise calls subscribe with a context only cancelled once all of its
+// subscribers left, and fans its payloads out to them. Subscribers joining
+// while the service is being subscribed to wait for the outcome.
+func (m *Multiplexer) subscribe(ctx context.Context, osp startMessagePayload, subscribe func(ctx context.Context) (<-chan interface{}, error)) (<-chan interface{}, error) {
+	key, ok := m.key(ctx, osp)
+	if !ok {
+		return subscribe(ctx)
+	}
+
+	l := &listener{c: make(chan interface{}), done: make(chan struct{})}
+	m.mu.Lock()
+	u, found := m.upstreams[key]
+	if !found {
+		upCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		u = &upstream{
+			cancel:    cancel,
+			ready:     make(chan struct{}),
+			listeners: map[*listener]struct{}{},
+		}
+		m.upstreams[key] = u
+		go m.run(upCtx, key, u, subscribe)
+	}
+	u.listeners[l] = struct{}{}
+	l.stop = context.AfterFunc(ctx, func() { m.leave(key, u, l) })
+	m.mu.Unlock()
+
+	select {
+	case <-u.ready:
+	case <-ctx.Done():
+		return nil, errOperationCancelled
+	}
+	if u.err != nil {
+		return nil, u.err
+	}
+	return l.c, nil
+}
+
+// run subscribes to the service and forwards the payloads to the listeners of
+// u until the subscription completes
+func (m *Multiplexer) run(ctx context.Context, key string, u *upstream, subscribe func(ctx context.Context) (<-chan interface{}, error)) {
+	payloads, err := subscribe(ctx)
+	if err != nil {
+		m.mu.Lock()
+		if m.upstreams[key] == u {
+			delete(m.upstreams, key)
+		}
+		u.err = err
+		m.mu.Unlock()
+		u.cancel()
+		close(u.ready)
+		return
+	}
+	close(u.ready)
+
+	var listeners []*listener
+	for p := range payloads {
+		m.mu.Lock()
+		listeners = listeners[:0]
+		for l := range u.listeners {
+			listeners = append(listeners, l)
+		}
+		m.mu.Unlock()
+
+		// the slowest listener paces the others
+		for _, l := range listeners {
+			select {
+			case l.c <- p:
+			case <-l.done:
+			}
+		}
+	}
+
+	m.mu.Lock()
+	if m.upstreams[key] == u {
+		delete(m.upstreams, key)
+	}
+	listeners = listeners[:0]
+	for l := range u.listeners {
+		listeners = append(listeners, l)
+	}
+	u.listeners = nil
+	m.mu.Unlock()
+	u.cancel()
+
+	for _, l := range listeners {
+		l.stop()
+		close(l.c)
+	}
+}
+
+// leave removes l from the listeners of u once its operation is done, the
+// subscription being cancelled if it was the last one
+func (m *Multiplexer) leave(key string, u *upstream, l *listener) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := u.listeners[l]; !ok {
+		return
+	}
+	delete(u.listeners, l)
+	close(l.done)
+	if len(u.listeners) > 0 {
+		return
+	}
+	if m.upstreams[key] == u {
+		delete(m.upstreams, key)
+	}
+	u.cancel()
+}
+
+// key returns the key of the operation, false if it isn't a subscription
+func (m *Multiplexer) key(ctx context.Context, osp startMessagePayload) (string, bool) {
+	if operationType(osp.Query, osp.OperationName) != operationSubscription {
+		return "", false
+	}
+	variables, err := json.Marshal(osp.Variables)
+	if err != nil {
+		return "", false
+	}
+
+	var scope string
+	if m.scope != nil {
+		scope = m.scope(ctx)
+	}
+	return strings.Join([]string{scope, osp.OperationName, normalizeDocument(osp.Query), string(variables)}, "\x00"), true
+}
@@ -0,0 +1,165 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// feed is a subscription to the payloads sent on its channel, completing on
+// nil
+type feed struct {
+	payloads  chan interface{}
+	calls     int32
+	cancelled chan struct{}
+	once      sync.Once
+}
+
+func newFeed() *feed {
+	return &feed{payloads: make(chan interface{}), cancelled: make(chan struct{})}
+}
+
+func (f *feed) subscribe(ctx context.Context) (<-chan interface{}, error) {
+	atomic.AddInt32(&f.calls, 1)
+	c := make(chan interface{})
+	go func() {
+		defer close(c)
+		for {
+			select {
+			case p := <-f.payloads:
+				if p == nil {
+					return
+				}
+				select {
+				case c <- p:
+				case <-ctx.Done():
+					f.once.Do(func() { close(f.cancelled) })
+					return
+				}
+			case <-ctx.Done():
+				f.once.Do(func() { close(f.cancelled) })
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+// receive expects every channel of cs to receive expected
+func receive(t *testing.T, expected interface{}, cs ...<-chan interface{}) {
+	t.Helper()
+	got := make(chan interface{}, len(cs))
+	for _, c := range cs {
+		go func(c <-chan interface{}) { got <- <-c }(c)
+	}
+	for range cs {
+		select {
+		case p := <-got:
+			if p != expected {
+				t.Fatalf("expected %v but instead got %v", expected, p)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %v", expected)
+		}
+	}
+}
+
+func TestMultiplexer(t *testing.T) {
+	m := NewMultiplexer(nil)
+	f := newFeed()
+
+	ctxA, cancelA := context.WithCancel(context.Background())
+	defer cancelA()
+	a, err := m.subscribe(ctxA, startMessagePayload{Query: "subscription { n }"}, f.subscribe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the same subscription, formatted differently
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	b, err := m.subscribe(ctxB, startMessagePayload{Query: "subscription {\n  n # count\n}"}, f.subscribe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls := atomic.LoadInt32(&f.calls); calls != 1 {
+		t.Fatalf("expected the service to be called once but instead it was called %d times", calls)
+	}
+	f.payloads <- 1
+	receive(t, 1, a, b)
+
+	// the subscription runs until its last subscriber leaves
+	cancelA()
+	f.payloads <- 2
+	receive(t, 2, b)
+	cancelB()
+	select {
+	case <-f.cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the subscription to be cancelled")
+	}
+
+	// later subscribers call the service again
+	f = newFeed()
+	c, err := m.subscribe(context.Background(), startMessagePayload{Query: "subscription { n }"}, f.subscribe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.payloads <- nil
+	if _, more := <-c; more {
+		t.Fatal("expected the subscription to be complete")
+	}
+}
+
+func TestMultiplexerKeys(t *testing.T) {
+	type tenantKey struct{}
+	m := NewMultiplexer(func(ctx context.Context) string {
+		tenant, _ := ctx.Value(tenantKey{}).(string)
+		return tenant
+	})
+	f := newFeed()
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), tenantKey{}, "a"))
+	defer cancel()
+
+	for _, osp := range []startMessagePayload{
+		{Query: "subscription { n }"},
+		{Query: "subscription { n }", Variables: map[string]interface{}{"x": 1}},
+		{Query: "subscription onN { n }", OperationName: "onN"},
+		// queries aren't multiplexed
+		{Query: "{ n }"},
+		{Query: "{ n }"},
+	} {
+		if _, err := m.subscribe(ctx, osp, f.subscribe); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// nor are subscriptions of other scopes
+	if _, err := m.subscribe(context.WithValue(ctx, tenantKey{}, "b"), startMessagePayload{Query: "subscription { n }"}, f.subscribe); err != nil {
+		t.Fatal(err)
+	}
+	if calls := atomic.LoadInt32(&f.calls); calls != 6 {
+		t.Fatalf("expected the service to be called 6 times but instead it was called %d times", calls)
+	}
+}
+
+func TestMultiplexerError(t *testing.T) {
+	m := NewMultiplexer(nil)
+	errFailed := errors.New("failed")
+	_, err := m.subscribe(context.Background(), startMessagePayload{Query: "subscription { n }"}, func(ctx context.Context) (<-chan interface{}, error) {
+		return nil, errFailed
+	})
+	if err != errFailed {
+		t.Fatalf("expected %v but instead got %v", errFailed, err)
+	}
+
+	// the failed subscription isn't shared with later subscribers
+	f := newFeed()
+	if _, err := m.subscribe(context.Background(), startMessagePayload{Query: "subscription { n }"}, f.subscribe); err != nil {
+		t.Fatal(err)
+	}
+	if calls := atomic.LoadInt32(&f.calls); calls != 1 {
+		t.Fatalf("expected the service to be called once but instead it was called %d times", calls)
+	}
+}
@@ -0,0 +1,152 @@
+package connection
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Observer is notified of the lifecycle of connections and of their
+// operations, e.g. to trace or meter them.
+//
+// ConnectionStart and OperationStart may return a context derived from ctx,
+// e.g. carrying a span, which is used from then on: operation contexts are
+// derived from the connection context and the matching ConnectionEnd and
+// OperationEnd are passed the returned context back.
+type Observer interface {
+	ConnectionStart(ctx context.Context, info ConnectionInfo) context.Context
+	ConnectionEnd(ctx context.Context)
+	OperationStart(ctx context.Context, info OperationInfo) context.Context
+	// OperationEnd is passed the error the operation failed with, if any, or
+	// the error of its context if it was stopped or its connection closed
+	OperationEnd(ctx context.Context, err error)
+}
+
+// ConnectionInfo describes a connection to an Observer
+type ConnectionInfo struct {
+	// RemoteAddr is the address of the client, if known
+	RemoteAddr net.Addr
+}
+
+// OperationInfo describes an operation to an Observer
+type OperationInfo struct {
+	ID            string
+	OperationName string
+	Query         string
+	Variables     map[string]interface{}
+}
+
+// MessageObserver is implemented by Observers also notified of every
+// operation message received from or sent to the client, e.g. to count them
+type MessageObserver interface {
+	// Message is passed the context of the connection
+	Message(ctx context.Context, info MessageInfo)
+}
+
+// MessageInfo describes an operation message to a MessageObserver
+type MessageInfo struct {
+	// Sent is set for messages sent to the client, unset for those received
+	Sent bool
+	Type string
+	ID   string
+	// PayloadSize is the size of the payload, in bytes
+	PayloadSize int
+}
+
+// SubscribeObserver is implemented by Observers also notified of how long
+// the calls to GraphQLService.Subscribe took
+type SubscribeObserver interface {
+	// Subscribed is passed the context of the operation and the error the
+	// call returned, if any
+	Subscribed(ctx context.Context, d time.Duration, err error)
+}
+
+// DataObserver is implemented by Observers also notified of every data
+// message of an operation, once it's queued for the client
+type DataObserver interface {
+	// OperationData is passed the context of the operation and the size of
+	// the payload, in bytes
+	OperationData(ctx context.Context, payloadSize int)
+}
+
+// Observe adds an Observer to the connection, observers are called in the
+// order they were added when starting and in reverse order when ending.
+func Observe(o Observer) Option {
+	return func(conn *connection) {
+		conn.observers = append(conn.observers, o)
+		if mo, ok := o.(MessageObserver); ok {
+			conn.msgObservers = append(conn.msgObservers, mo)
+		}
+		if so, ok := o.(SubscribeObserver); ok {
+			conn.subObservers = append(conn.subObservers, so)
+		}
+		if do, ok := o.(DataObserver); ok {
+			conn.dataObservers = append(conn.dataObservers, do)
+		}
+		if qo, ok := o.(QueueObserver); ok {
+			conn.queueObs = append(conn.queueObs, qo)
+		}
+	}
+}
+
+func (conn *connection) connectionStart(ctx context.Context) context.Context {
+	if len(conn.observers) == 0 {
+		return ctx
+	}
+
+	var info ConnectionInfo
+	if ws, ok := conn.ws.(interface{ RemoteAddr() net.Addr }); ok {
+		info.RemoteAddr = ws.RemoteAddr()
+	}
+	for _, o := range conn.observers {
+		ctx = o.ConnectionStart(ctx, info)
+	}
+	return ctx
+}
+
+func (conn *connection) connectionEnd(ctx context.Context) {
+	for i := len(conn.observers) - 1; i >= 0; i-- {
+		conn.observers[i].ConnectionEnd(ctx)
+	}
+}
+
+func (conn *connection) operationStart(ctx context.Context, id string, osp startMessagePayload) context.Context {
+	info := OperationInfo{
+		ID:            id,
+		OperationName: osp.OperationName,
+		Query:         osp.Query,
+		Variables:     osp.Variables,
+	}
+	for _, o := range conn.observers {
+		ctx = o.OperationStart(ctx, info)
+	}
+	return ctx
+}
+
+func (conn *connection) operationEnd(ctx context.Context, err error) {
+	for i := len(conn.observers) - 1; i >= 0; i-- {
+		conn.observers[i].OperationEnd(ctx, err)
+	}
+	if len(conn.interceptors) > 0 {
+		id, _ := OperationIDFromContext(ctx)
+		conn.interceptComplete(ctx, id, err)
+	}
+}
+
+func (conn *connection) messageObserved(ctx context.Context, info MessageInfo) {
+	for _, o := range conn.msgObservers {
+		o.Message(ctx, info)
+	}
+}
+
+func (conn *connection) subscribed(ctx context.Context, d time.Duration, err error) {
+	for _, o := range conn.subObservers {
+		o.Subscribed(ctx, d, err)
+	}
+}
+
+func (conn *connection) operationData(ctx context.Context, payloadSize int) {
+	for _, o := range conn.dataObservers {
+		o.OperationData(ctx, payloadSize)
+	}
+}
@@ -0,0 +1,129 @@
+package connection_test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+type observerKey struct{}
+
+// recordingObserver records the events it's notified of, checking that the
+// contexts it returned are passed back
+type recordingObserver struct {
+	events chan string
+}
+
+func (o *recordingObserver) ConnectionStart(ctx context.Context, info connection.ConnectionInfo) context.Context {
+	o.events <- "connection start"
+	return context.WithValue(ctx, observerKey{}, "connection")
+}
+
+func (o *recordingObserver) ConnectionEnd(ctx context.Context) {
+	o.events <- fmt.Sprintf("connection end %v", ctx.Value(observerKey{}))
+}
+
+func (o *recordingObserver) OperationStart(ctx context.Context, info connection.OperationInfo) context.Context {
+	o.events <- fmt.Sprintf("operation start %s %s %v", info.ID, info.OperationName, ctx.Value(observerKey{}))
+	return context.WithValue(ctx, observerKey{}, "operation")
+}
+
+func (o *recordingObserver) OperationEnd(ctx context.Context, err error) {
+	o.events <- fmt.Sprintf("operation end %v %v", ctx.Value(observerKey{}), err)
+}
+
+func TestObserver(t *testing.T) {
+	o := &recordingObserver{events: make(chan string, 8)}
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(`{"data":{}}`), context.Background(), connection.Observe(o))
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a-id","type":"start","payload":{"operationName":"a"}}`},
+		{intention: expectation, operationMessage: `{"id":"a-id","type":"data","payload":{"data":{}}}`},
+		{intention: expectation, operationMessage: `{"id":"a-id","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+
+	for _, expected := range []string{
+		"connection start",
+		"operation start a-id a connection",
+		"operation end operation <nil>",
+		"connection end connection",
+	} {
+		select {
+		case got := <-o.events:
+			if got != expected {
+				t.Fatalf("expected [%s] but instead got [%s]", expected, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected [%s] but instead got nothing", expected)
+		}
+	}
+}
+
+// messageObserver also records the messages, the Subscribe calls and the data
+// of the operations it's notified of
+type messageObserver struct {
+	recordingObserver
+}
+
+func (o *messageObserver) Message(ctx context.Context, info connection.MessageInfo) {
+	o.events <- fmt.Sprintf("message %t %s %s %d", info.Sent, info.Type, info.ID, info.PayloadSize)
+}
+
+func (o *messageObserver) Subscribed(ctx context.Context, d time.Duration, err error) {
+	o.events <- fmt.Sprintf("subscribed %v %v", ctx.Value(observerKey{}), err)
+}
+
+func (o *messageObserver) OperationData(ctx context.Context, payloadSize int) {
+	o.events <- fmt.Sprintf("data %v %d", ctx.Value(observerKey{}), payloadSize)
+}
+
+func TestMessageObserver(t *testing.T) {
+	o := &messageObserver{recordingObserver{events: make(chan string, 16)}}
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(`{"data":{}}`), context.Background(), connection.Observe(o))
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a-id","type":"start","payload":{"operationName":"a"}}`},
+		{intention: expectation, operationMessage: `{"id":"a-id","type":"data","payload":{"data":{}}}`},
+		{intention: expectation, operationMessage: `{"id":"a-id","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+
+	// messages are reported once written, possibly after the next one is
+	// received
+	expected := []string{
+		"data operation 11",
+		"message false connection_init  2",
+		"message false connection_terminate  0",
+		"message false start a-id 21",
+		"message true complete a-id 0",
+		"message true connection_ack  65",
+		"message true data a-id 11",
+		"subscribed operation <nil>",
+	}
+	var got []string
+	timeout := time.After(5 * time.Second)
+	for len(got) < len(expected) {
+		select {
+		case e := <-o.events:
+			if !strings.HasPrefix(e, "connection") && !strings.HasPrefix(e, "operation") {
+				got = append(got, e)
+			}
+		case <-timeout:
+			t.Fatalf("expected %v but instead got %v", expected, got)
+		}
+	}
+	sort.Strings(got)
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected %v but instead got %v", expected, got)
+	}
+}
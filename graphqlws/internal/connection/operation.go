@@ -0,0 +1,438 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+type operation struct {
+	id         string
+	acks       *ackWindow
+	cancel     func()
+	compressor Compressor
+	credits    *credits
+	priority   int
+
+	// release releases what the operation was admitted with, see hold
+	mu       sync.Mutex
+	release  func()
+	released bool
+	// topics the operation joined, see JoinTopic
+	topics map[string]struct{}
+
+	// sendMu orders the messages of the operation, completed is set once the
+	// client is told it's complete
+	sendMu    sync.Mutex
+	completed bool
+	// silenced is set once the operation is stopped by StopOperation, its
+	// messages then being dropped like those sent after complete
+	silenced int32
+}
+
+// hold keeps what the operation was admitted with, e.g. its slot of the
+// operation limits, until done is called. If it already was, e.g. because the
+// client stopped the operation while it was being admitted, it's released at
+// once.
+func (op *operation) hold(release func()) {
+	op.mu.Lock()
+	if !op.released {
+		op.release = release
+		release = nil
+	}
+	op.mu.Unlock()
+
+	if release != nil {
+		release()
+	}
+}
+
+// done releases what the operation was admitted with, so that another
+// operation can take its place as soon as the client is told it's complete
+func (op *operation) done() {
+	op.mu.Lock()
+	release := op.release
+	op.release, op.released = nil, true
+	op.mu.Unlock()
+
+	if release != nil {
+		release()
+	}
+}
+
+// PriorityFunc returns the priority of an operation from its start payload,
+// under backpressure messages of operations with a higher priority are written
+// first. The default priority is 0.
+type PriorityFunc func(ctx context.Context, query string, operationName string, variables map[string]interface{}) int
+
+// Prioritize sets the function used to assign a priority to new operations,
+// e.g. so that alerts are delivered before analytics tickers when the client
+// can't keep up.
+func Prioritize(fn PriorityFunc) Option {
+	return func(conn *connection) {
+		conn.prioritize = fn
+	}
+}
+
+// StartConcurrency sets how many operations may be starting, i.e. waiting for
+// GraphQLService.Subscribe to return, at the same time on a connection.
+//
+// With the default of 1 Subscribe is called from the read loop, so operations
+// are established strictly in the order they were started, which some services
+// require. Operations waiting for an OperationBudget are still established in
+// order but off the read loop. With n > 1 up to n operations are started in
+// parallel, further start messages being read once one of them has started,
+// and with n <= 0 there's no limit at all.
+func StartConcurrency(n int) Option {
+	return func(conn *connection) {
+		conn.startConcurrency = n
+		conn.startSem = nil
+		if n > 1 {
+			conn.startSem = make(chan struct{}, n)
+		}
+	}
+}
+
+var errOperationCancelled = errors.New("operation cancelled")
+
+// subscribe calls GraphQLService.Subscribe once allowed by the SubscribeHook,
+// the QueryValidators and the limiter, if any, or GraphQLService.Exec for
+// queries and mutations, whose response is then the single payload of the
+// operation. Queries may be answered by the ResultCache and subscriptions
+// shared by the Multiplexer instead, the events they missed being replayed
+// first from the EventStore. It returns errOperationCancelled if ctx is done
+// before that.
+func (conn *connection) subscribe(ctx context.Context, operationID string, osp startMessagePayload) (<-chan interface{}, error) {
+	ctx, err := conn.checkSubscribe(ctx, operationID, osp)
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.validateQuery(ctx, operationID, osp); err != nil {
+		return nil, err
+	}
+
+	if l := conn.subscribeLimiter; l != nil {
+		if !l.acquire(ctx) {
+			return nil, errOperationCancelled
+		}
+		defer l.release()
+	}
+
+	if err = conn.injectFaults(ctx); err != nil {
+		return nil, err
+	}
+
+	call := func(ctx context.Context) (c <-chan interface{}, err error) {
+		if perr := conn.callService(ctx, operationID, func() {
+			switch operationType(osp.Query, osp.OperationName) {
+			case operationQuery, operationMutation:
+				c = conn.exec(ctx, osp)
+			default:
+				c, err = conn.service.Subscribe(ctx, osp.Query, osp.OperationName, osp.Variables)
+			}
+		}); perr != nil {
+			err = perr
+		}
+		return c, err
+	}
+	subscribe := func(ctx context.Context) (<-chan interface{}, error) {
+		start := conn.clock.Now()
+		c, err := conn.withSubscribeTimeout(ctx, func() (<-chan interface{}, error) { return call(ctx) })
+		conn.subscribed(ctx, conn.clock.Now().Sub(start), err)
+		return c, err
+	}
+	if m := conn.multiplexer; m != nil {
+		direct := subscribe
+		subscribe = func(ctx context.Context) (<-chan interface{}, error) {
+			return m.subscribe(ctx, osp, direct)
+		}
+	}
+	if conn.results != nil {
+		return conn.results.subscribe(ctx, conn.clock, osp, func() (<-chan interface{}, error) { return subscribe(ctx) })
+	}
+	if stream := conn.events.streamOf(ctx, osp); stream != "" {
+		c, err := subscribe(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return conn.replay(ctx, operationID, stream, osp.LastEventID, c), nil
+	}
+	return subscribe(ctx)
+}
+
+// exec calls GraphQLService.Exec, it returns a closed channel holding the
+// response
+func (conn *connection) exec(ctx context.Context, osp startMessagePayload) <-chan interface{} {
+	c := make(chan interface{}, 1)
+	c <- conn.service.Exec(ctx, osp.Query, osp.OperationName, osp.Variables)
+	close(c)
+	return c
+}
+
+// operationPanicked fails op once its goroutine panicked, the connection is
+// closed once the client is told
+func (conn *connection) operationPanicked(sendMessage sendMessageFunc, op *operation) {
+	conn.session.remove(op.id)
+	conn.ops.remove(op)
+	op.cancel()
+	op.done()
+	op.send(sendMessage, &operationMessage{Type: typeError, Payload: errPayload(ErrServicePanicked)})
+	op.send(sendMessage, &operationMessage{
+		Type:      typeComplete,
+		delivered: conn.panicked,
+	})
+}
+
+// send queues a message for the operation with its priority. Complete is
+// always the last message of an operation: the ones sent after it, e.g. data
+// in flight when the client stopped the operation, are dropped.
+func (op *operation) send(sendMessage sendMessageFunc, msg *operationMessage) {
+	op.sendMu.Lock()
+	defer op.sendMu.Unlock()
+	if op.completed || atomic.LoadInt32(&op.silenced) == 1 {
+		// the client is told already
+		if msg.Type == typeComplete && msg.delivered != nil {
+			msg.delivered()
+		}
+		releaseMessage(msg)
+		return
+	}
+	op.completed = msg.Type == typeComplete
+
+	msg.ID = op.id
+	msg.priority = op.priority
+	sendMessage(msg)
+}
+
+// start starts the operation id with osp, it returns false when the
+// connection should be terminated.
+func (conn *connection) start(ctx context.Context, sendMessage sendMessageFunc, id string, osp startMessagePayload) bool {
+	conn.operationStarted()
+
+	opCtx, cancel := context.WithCancel(ctx)
+	uniqID := conn.ids.NewID()
+	opCtx = ContextWithSocketID(opCtx, uniqID)
+	opCtx = context.WithValue(opCtx, operationIDKey, id)
+	if osp.LastEventID != "" {
+		opCtx = context.WithValue(opCtx, lastEventIDKey, osp.LastEventID)
+	}
+	if osp.Extensions != nil && osp.Extensions.values != nil {
+		opCtx = context.WithValue(opCtx, extensionsKey, osp.Extensions.values)
+	}
+	opCtx = conn.operationStart(opCtx, id, osp)
+
+	op := &operation{id: id, cancel: cancel, compressor: conn.compressor}
+	if conn.prioritize != nil {
+		op.priority = conn.prioritize(opCtx, osp.Query, osp.OperationName, osp.Variables)
+	}
+	if osp.Credits != nil {
+		op.credits = newCredits(*osp.Credits)
+	}
+	if osp.Ack && conn.acks.Window > 0 {
+		op.acks = newAckWindow(conn.acks)
+	}
+	conn.ops.store(op)
+	// the connection may have been closed before op was stored, it then
+	// wasn't cancelled along with the others
+	if conn.ctx.Err() != nil {
+		cancel()
+	}
+	conn.session.add(id, osp)
+
+	if conn.startConcurrency == 1 && conn.budget == nil {
+		conn.startOperation(opCtx, sendMessage, op, osp)
+		return true
+	}
+	if conn.startConcurrency == 1 {
+		// waiting for the budget would block the read loop, and with it the
+		// stop message of the operation, so operations are started off it
+		// one after the other
+		prev, started := conn.startQueue, make(chan struct{})
+		conn.startQueue = started
+		conn.spawn(func() {
+			defer close(started)
+			if prev != nil {
+				<-prev
+			}
+			conn.startOperation(opCtx, sendMessage, op, osp)
+		})
+		return true
+	}
+
+	if conn.startSem != nil {
+		select {
+		case conn.startSem <- struct{}{}:
+		case <-ctx.Done():
+			conn.ops.remove(op)
+			cancel()
+			conn.operationEnd(opCtx, ctx.Err())
+			return false
+		}
+	}
+	conn.spawn(func() {
+		if conn.startSem != nil {
+			defer func() { <-conn.startSem }()
+		}
+		conn.startOperation(opCtx, sendMessage, op, osp)
+	})
+	return true
+}
+
+// startOperation subscribes to the operation and forwards its payloads to the
+// client until it completes or ctx is done.
+func (conn *connection) startOperation(ctx context.Context, sendMessage sendMessageFunc, op *operation, osp startMessagePayload) {
+	defer conn.recoverPanic(ctx, op.id, func() {
+		conn.operationPanicked(sendMessage, op)
+		conn.operationEnd(ctx, ErrServicePanicked)
+	})
+
+	// the operation is cancelled on every path not handing it over to the
+	// forwarding goroutine, which otherwise removes it once done
+	defer func() {
+		if ctx.Err() != nil {
+			conn.ops.remove(op)
+		}
+	}()
+
+	release, err := conn.admit(ctx)
+	if err != nil {
+		conn.session.remove(op.id)
+		conn.ops.remove(op)
+		op.cancel()
+		conn.operationEnd(ctx, err)
+		op.send(sendMessage, &operationMessage{Type: typeError, Payload: errPayload(err)})
+		op.send(sendMessage, &operationMessage{Type: typeComplete})
+		return
+	}
+	op.hold(release)
+
+	c, err := conn.subscribe(ctx, op.id, osp)
+	if err == errOperationCancelled {
+		op.done()
+		conn.operationEnd(ctx, ctx.Err())
+		return
+	}
+	if err != nil {
+		op.done()
+		conn.session.remove(op.id)
+		conn.ops.remove(op)
+		op.cancel()
+		conn.operationEnd(ctx, err)
+		op.send(sendMessage, &operationMessage{Type: typeError, Payload: errPayload(err)})
+		op.send(sendMessage, &operationMessage{Type: typeComplete})
+		return
+	}
+
+	conn.spawn(func() {
+		var endErr error
+		defer func() { conn.operationEnd(ctx, endErr) }()
+		defer conn.recoverPanic(ctx, op.id, func() {
+			endErr = ErrServicePanicked
+			conn.operationPanicked(sendMessage, op)
+		})
+		defer op.done()
+		defer conn.ops.remove(op)
+		defer op.cancel()
+
+		// messages are sent again until the client is told the operation is
+		// complete, never after
+		var unacknowledged <-chan struct{}
+		stopResending := func() {}
+		if op.acks != nil {
+			unacknowledged = op.acks.failed
+			if conn.acks.RetryAfter > 0 {
+				resendCtx, cancel := context.WithCancel(ctx)
+				resending := make(chan struct{})
+				conn.spawn(func() {
+					defer close(resending)
+					conn.resendUnacked(resendCtx, sendMessage, op)
+				})
+				stopResending = func() {
+					cancel()
+					<-resending
+				}
+			}
+		}
+		defer stopResending()
+		for {
+			select {
+			case <-ctx.Done():
+				endErr = ctx.Err()
+				return
+			case <-unacknowledged:
+				endErr = ErrNotAcknowledged
+				stopResending()
+				conn.operationUnacknowledged(sendMessage, op)
+				return
+			case payload, more := <-c:
+				if !more {
+					// the ID may be reused once the client is told the
+					// operation is complete
+					conn.session.remove(op.id)
+					conn.ops.remove(op)
+					stopResending()
+					op.send(sendMessage, &operationMessage{Type: typeComplete})
+					return
+				}
+
+				if op.credits != nil && !op.credits.acquire(ctx) {
+					endErr = ctx.Err()
+					return
+				}
+				if op.acks != nil && !op.acks.acquire(ctx) {
+					if endErr = ctx.Err(); endErr == nil {
+						endErr = ErrNotAcknowledged
+						stopResending()
+						conn.operationUnacknowledged(sendMessage, op)
+					}
+					return
+				}
+
+				msg := acquireMessage()
+				msg.Type = typeData
+				if d, ok := payload.(Delivery); ok {
+					msg.delivered, payload = d.Delivered, d.Payload
+					// acknowledged messages are sent until they are
+					if op.acks == nil {
+						msg.deadline = d.Deadline
+					}
+				}
+				if ev, ok := payload.(Event); ok {
+					msg.EventID, payload = ev.ID, ev.Payload
+					if op.acks == nil {
+						conn.session.advance(op.id, ev.ID)
+					}
+				}
+
+				err := msg.marshalPayload(payload)
+				if err == nil && len(conn.interceptors) > 0 {
+					// the interceptors may drop the message
+					if msg.Payload = conn.interceptData(ctx, op.id, msg.Payload); msg.Payload == nil {
+						releaseMessage(msg)
+						continue
+					}
+				}
+				if err == nil && conn.onData != nil {
+					msg.Payload, err = conn.hookData(ctx, op.id, msg.Payload)
+				}
+				if err == nil && op.compressor != nil {
+					msg.Payload, err = conn.compression.compress(op.compressor, msg.Payload)
+				}
+				if err != nil {
+					conn.reportError(ctx, op.id, err)
+					releaseMessage(msg)
+					op.send(sendMessage, &operationMessage{Type: typeError, Payload: errPayload(err)})
+					continue
+				}
+				if len(conn.dataObservers) > 0 {
+					conn.operationData(ctx, len(msg.Payload))
+				}
+				if op.acks != nil {
+					op.acks.track(msg, conn.clock.Now())
+				}
+				op.send(sendMessage, msg)
+			}
+		}
+	})
+}
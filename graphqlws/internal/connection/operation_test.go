@@ -0,0 +1,131 @@
+package connection_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestStopDropsDataInFlight(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	held := false
+	o := &recordingObserver{events: make(chan string, 8)}
+	svc := make(sequenceService, 2)
+	svc <- `{"data":{"n":1}}`
+	svc <- `{"data":{"n":2}}`
+	ws := newConnection()
+	go connection.Connect(ws, svc, context.Background(),
+		connection.Observe(o),
+		// the payload of the first operation is held until it's stopped
+		connection.OnData(func(ctx context.Context, payload json.RawMessage) (json.RawMessage, map[string]interface{}) {
+			if !held {
+				held = true
+				close(entered)
+				<-release
+			}
+			return payload, nil
+		}),
+	)
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{}}`},
+	})
+	<-entered
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"id":"a","type":"stop"}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+	})
+	close(release)
+	requireEvents(t, o.events, "connection start", "operation start a  connection")
+	// the operation ends with the error of its context or, if it sees its
+	// subscription closed first, none
+	select {
+	case <-o.events:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the operation to end")
+	}
+
+	// neither the data nor the complete of the stopped operation are sent
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"data","payload":{"data":{"n":2}}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
+
+func TestStartConcurrencyCancelled(t *testing.T) {
+	svc := startingService(make(chan string, 2))
+	opened := make(chan context.Context, 1)
+	connCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ws := newConnection()
+	go connection.Connect(ws, svc, connCtx,
+		connection.StartConcurrency(2),
+		connection.OnOpen(func(ctx context.Context) { opened <- ctx }),
+	)
+	ctx := <-opened
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{}}`},
+		{intention: clientSends, operationMessage: `{"id":"b","type":"start","payload":{}}`},
+	})
+	for i := 0; i < 2; i++ {
+		<-svc
+	}
+	// c waits for a or b to have started when the connection is closed
+	ws.in <- []byte(`{"id":"c","type":"start","payload":{}}`)
+	requireOperationCount(t, ctx, 3)
+	cancel()
+	requireOperationCount(t, ctx, 0)
+}
+
+// startingService doesn't return from Subscribe before its context is done,
+// it sends the id of the operations it's subscribing to
+type startingService chan string
+
+func (s startingService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	id, _ := connection.OperationIDFromContext(ctx)
+	s <- id
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (startingService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+// sequenceService answers each subscription with the next payload it holds
+type sequenceService chan string
+
+func (s sequenceService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	return newGQLService(<-s).payloads, nil
+}
+
+func (sequenceService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+func requireEvents(t *testing.T, events <-chan string, expected ...string) {
+	t.Helper()
+	for _, e := range expected {
+		select {
+		case got := <-events:
+			if got != e {
+				t.Fatalf("expected event %q but instead got %q", e, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected event %q", e)
+		}
+	}
+}
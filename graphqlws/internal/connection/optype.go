@@ -0,0 +1,142 @@
+package connection
+
+import "strings"
+
+// The types of GraphQL operations
+const (
+	operationQuery        = "query"
+	operationMutation     = "mutation"
+	operationSubscription = "subscription"
+)
+
+// operationType returns the type of the operation operationName of document,
+// or of its first operation if operationName is empty or names none of them,
+// and an empty string if document has no operation. Only the tokens outside
+// of selection sets, arguments and lists are looked at, so that document isn't
+// parsed beyond what's needed.
+func operationType(document string, operationName string) string {
+	var (
+		first    string
+		current  string
+		depth    int
+		inOp     bool
+		named    bool
+		fragment bool
+	)
+
+	for i := 0; i < len(document); {
+		c := document[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+			continue
+
+		case c == '#':
+			for i < len(document) && document[i] != '\n' && document[i] != '\r' {
+				i++
+			}
+			continue
+
+		case c == '"':
+			i = skipString(document, i)
+			named = false
+			continue
+
+		case isNameStart(c):
+			j := i + 1
+			for j < len(document) && isNameContinue(document[j]) {
+				j++
+			}
+			name := document[i:j]
+			i = j
+			if depth > 0 {
+				continue
+			}
+
+			if named {
+				named = false
+				if operationName != "" && name == operationName {
+					return current
+				}
+				continue
+			}
+			switch name {
+			case operationQuery, operationMutation, operationSubscription:
+				if !inOp && !fragment {
+					if first == "" {
+						first = name
+					}
+					if operationName == "" {
+						return name
+					}
+					current, inOp, named = name, true, true
+				}
+			case "fragment":
+				fragment = true
+			}
+			continue
+
+		case c == '{' || c == '(' || c == '[':
+			if depth == 0 && c == '{' {
+				switch {
+				case fragment:
+					fragment = false
+				case inOp:
+					inOp = false
+				default:
+					// shorthand query
+					if first == "" {
+						first = operationQuery
+					}
+					if operationName == "" {
+						return operationQuery
+					}
+				}
+			}
+			depth++
+
+		case c == '}' || c == ')' || c == ']':
+			if depth > 0 {
+				depth--
+			}
+		}
+		named = false
+		i++
+	}
+
+	return first
+}
+
+// skipString returns the index following the string starting at i, a block
+// string if it starts with """
+func skipString(document string, i int) int {
+	if strings.HasPrefix(document[i:], `"""`) {
+		for j := i + 3; j < len(document); j++ {
+			switch {
+			case strings.HasPrefix(document[j:], `\"""`):
+				j += 3
+			case strings.HasPrefix(document[j:], `"""`):
+				return j + 3
+			}
+		}
+		return len(document)
+	}
+
+	for j := i + 1; j < len(document); j++ {
+		switch document[j] {
+		case '\\':
+			j++
+		case '"', '\n', '\r':
+			return j + 1
+		}
+	}
+	return len(document)
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z'
+}
+
+func isNameContinue(c byte) bool {
+	return isNameStart(c) || c >= '0' && c <= '9'
+}
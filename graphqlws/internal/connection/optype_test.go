@@ -0,0 +1,26 @@
+package connection
+
+import "testing"
+
+func TestOperationType(t *testing.T) {
+	for _, tc := range []struct {
+		document      string
+		operationName string
+		expected      string
+	}{
+		{document: "subscription onMessage { message }", expected: "subscription"},
+		{document: "{ message }", expected: "query"},
+		{document: "# a query\nquery message { message }", expected: "query"},
+		{document: "mutation($id: ID!) { delete(id: $id) }", expected: "mutation"},
+		{document: `query { a(s: "subscription {") } subscription s { b }`, operationName: "s", expected: "subscription"},
+		{document: `query q { a } subscription s { b }`, operationName: "q", expected: "query"},
+		{document: `query q { a } subscription s { b }`, operationName: "unknown", expected: "query"},
+		{document: "fragment f on Query { query } subscription s { ...f }", expected: "subscription"},
+		{document: `query q($s: String = """a "" subscription""") { a }`, expected: "query"},
+		{document: "", expected: ""},
+	} {
+		if got := operationType(tc.document, tc.operationName); got != tc.expected {
+			t.Fatalf("expected %q for %q but instead got %q", tc.expected, tc.document, got)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package connection
+
+import (
+	"sort"
+	"sync"
+)
+
+// outboxCapacity is how many messages an operation may have queued before
+// sending blocks, i.e. until the write loop catches up
+const outboxCapacity = 1
+
+// outbox queues outgoing messages per operation and hands them to the write
+// loop by priority and, within the same priority, in round-robin order across
+// operations, so a very chatty subscription can't starve the other operations
+// sharing the connection.
+type outbox struct {
+	mu       sync.Mutex
+	capacity int
+	policy   OverflowPolicy
+	queues   map[string]*outboxQueue
+	// size counts the messages queued
+	size int
+	// pending holds, per priority, the queues with messages to be written in
+	// the order they will be served
+	pending map[int][]*outboxQueue
+	// priorities holds the keys of pending from highest to lowest
+	priorities []int
+	// ready is signaled when a message is pushed
+	ready chan struct{}
+	// free holds the queues no longer used, to be reused
+	free []*outboxQueue
+}
+
+type outboxQueue struct {
+	id       string
+	priority int
+	msgs     []*operationMessage
+	space    chan struct{}
+	// refs counts the pushes in progress, a queue is only recycled once it's
+	// empty and no push holds it
+	refs int
+}
+
+func newOutbox(capacity int, policy OverflowPolicy) *outbox {
+	return &outbox{
+		capacity: capacity,
+		policy:   policy,
+		queues:   map[string]*outboxQueue{},
+		pending:  map[int][]*outboxQueue{},
+		ready:    make(chan struct{}, 1),
+	}
+}
+
+// push queues msg, blocking while its operation's queue is full unless stop is
+// closed, in which case the message is dropped. Data messages are instead
+// handled according to the overflow policy while the queue is full. It returns
+// the message dropped on overflow if any and how many messages are queued.
+func (ob *outbox) push(msg *operationMessage, stop <-chan struct{}) (dropped *operationMessage, depth int) {
+	ob.mu.Lock()
+	q, ok := ob.queues[msg.ID]
+	if !ok {
+		q = ob.newQueue(msg.ID, msg.priority)
+		ob.queues[msg.ID] = q
+	}
+	q.refs++
+	ob.mu.Unlock()
+
+	if msg.Type == typeData && ob.policy != OverflowBlock {
+		select {
+		case q.space <- struct{}{}:
+		default:
+			return ob.overflow(q, msg)
+		}
+	} else {
+		select {
+		case <-stop:
+			ob.mu.Lock()
+			defer ob.mu.Unlock()
+			q.refs--
+			ob.recycle(q)
+			return nil, ob.size
+		case q.space <- struct{}{}:
+		}
+	}
+
+	ob.mu.Lock()
+	q.refs--
+	q.msgs = append(q.msgs, msg)
+	if len(q.msgs) == 1 {
+		ob.schedule(q)
+	}
+	ob.size++
+	depth = ob.size
+	ob.mu.Unlock()
+
+	select {
+	case ob.ready <- struct{}{}:
+	default:
+	}
+	return nil, depth
+}
+
+// overflow handles the data message msg pushed while the queue q is full, it
+// returns the message dropped
+func (ob *outbox) overflow(q *outboxQueue, msg *operationMessage) (*operationMessage, int) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	q.refs--
+
+	if ob.policy == OverflowDropOldest {
+		for i, queued := range q.msgs {
+			if queued.Type == typeData {
+				copy(q.msgs[i:], q.msgs[i+1:])
+				q.msgs[len(q.msgs)-1] = msg
+				return queued, ob.size
+			}
+		}
+	}
+	// the queue may hold no data message to drop, or none yet while pushes
+	// are in progress
+	ob.recycle(q)
+	return msg, ob.size
+}
+
+// pop returns the next message to be written, or nil if there's none.
+func (ob *outbox) pop() *operationMessage {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	for _, p := range ob.priorities {
+		pending := ob.pending[p]
+		if len(pending) == 0 {
+			continue
+		}
+
+		q := pending[0]
+		copy(pending, pending[1:])
+		pending[len(pending)-1] = nil
+		ob.pending[p] = pending[:len(pending)-1]
+
+		msg := q.msgs[0]
+		copy(q.msgs, q.msgs[1:])
+		q.msgs[len(q.msgs)-1] = nil
+		q.msgs = q.msgs[:len(q.msgs)-1]
+		<-q.space
+		ob.size--
+
+		if len(q.msgs) > 0 {
+			// back of the line, so every other operation with the same
+			// priority gets its turn first
+			ob.schedule(q)
+		} else {
+			ob.recycle(q)
+		}
+
+		return msg
+	}
+
+	return nil
+}
+
+// empty reports whether there's no message to be written
+func (ob *outbox) empty() bool {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+
+	for _, pending := range ob.pending {
+		if len(pending) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (ob *outbox) schedule(q *outboxQueue) {
+	if _, ok := ob.pending[q.priority]; !ok {
+		ob.priorities = append(ob.priorities, q.priority)
+		sort.Sort(sort.Reverse(sort.IntSlice(ob.priorities)))
+	}
+	ob.pending[q.priority] = append(ob.pending[q.priority], q)
+}
+
+func (ob *outbox) newQueue(id string, priority int) *outboxQueue {
+	if n := len(ob.free); n > 0 {
+		q := ob.free[n-1]
+		ob.free[n-1] = nil
+		ob.free = ob.free[:n-1]
+		q.id, q.priority = id, priority
+		return q
+	}
+
+	return &outboxQueue{
+		id:       id,
+		priority: priority,
+		space:    make(chan struct{}, ob.capacity),
+	}
+}
+
+// recycle removes q once it's no longer used
+func (ob *outbox) recycle(q *outboxQueue) {
+	if len(q.msgs) > 0 || q.refs > 0 || ob.queues[q.id] != q {
+		return
+	}
+
+	delete(ob.queues, q.id)
+	if len(ob.free) < maxFreeQueues {
+		ob.free = append(ob.free, q)
+	}
+}
+
+// maxFreeQueues bounds how many unused queues an outbox keeps for reuse
+const maxFreeQueues = 16
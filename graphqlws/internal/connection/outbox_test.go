@@ -0,0 +1,88 @@
+package connection
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOutboxRoundRobin(t *testing.T) {
+	ob := newOutbox(3, OverflowBlock)
+	stop := make(chan struct{})
+
+	for _, id := range []string{"a", "a", "a", "b", "c", "c"} {
+		ob.push(&operationMessage{ID: id, Type: typeData}, stop)
+	}
+
+	var got []string
+	for msg := ob.pop(); msg != nil; msg = ob.pop() {
+		got = append(got, msg.ID)
+	}
+
+	expected := []string{"a", "b", "c", "a", "c", "a"}
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v but instead got %v", expected, got)
+	}
+}
+
+func TestOutboxPriority(t *testing.T) {
+	ob := newOutbox(3, OverflowBlock)
+	stop := make(chan struct{})
+
+	ob.push(&operationMessage{ID: "low", Type: typeData, priority: -1}, stop)
+	ob.push(&operationMessage{ID: "a", Type: typeData}, stop)
+	ob.push(&operationMessage{ID: "high", Type: typeData, priority: 1}, stop)
+	ob.push(&operationMessage{ID: "a", Type: typeData}, stop)
+	ob.push(&operationMessage{ID: "high", Type: typeData, priority: 1}, stop)
+	ob.push(&operationMessage{ID: "b", Type: typeData}, stop)
+
+	var got []string
+	for msg := ob.pop(); msg != nil; msg = ob.pop() {
+		got = append(got, msg.ID)
+	}
+
+	expected := []string{"high", "high", "a", "b", "a", "low"}
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected %v but instead got %v", expected, got)
+	}
+}
+
+func TestOutboxOverflow(t *testing.T) {
+	for _, tc := range []struct {
+		policy   OverflowPolicy
+		dropped  []string
+		expected []string
+	}{
+		{policy: OverflowDropOldest, dropped: []string{"1", "2"}, expected: []string{"error", "3"}},
+		{policy: OverflowDropNewest, dropped: []string{"2", "3"}, expected: []string{"error", "1"}},
+	} {
+		ob := newOutbox(2, tc.policy)
+		stop := make(chan struct{})
+
+		var dropped []string
+		for _, msg := range []*operationMessage{
+			{ID: "a", Type: typeError, Payload: []byte("error")},
+			{ID: "a", Type: typeData, Payload: []byte("1")},
+			{ID: "a", Type: typeData, Payload: []byte("2")},
+			{ID: "a", Type: typeData, Payload: []byte("3")},
+		} {
+			m, depth := ob.push(msg, stop)
+			if m != nil {
+				dropped = append(dropped, string(m.Payload))
+			}
+			if depth > 2 {
+				t.Fatalf("expected at most 2 messages queued but instead got %d", depth)
+			}
+		}
+
+		var got []string
+		for msg := ob.pop(); msg != nil; msg = ob.pop() {
+			got = append(got, string(msg.Payload))
+		}
+		if !reflect.DeepEqual(tc.dropped, dropped) {
+			t.Fatalf("expected %v to be dropped but instead got %v", tc.dropped, dropped)
+		}
+		if !reflect.DeepEqual(tc.expected, got) {
+			t.Fatalf("expected %v but instead got %v", tc.expected, got)
+		}
+	}
+}
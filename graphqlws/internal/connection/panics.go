@@ -0,0 +1,129 @@
+package connection
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"runtime/debug"
+	"time"
+)
+
+// PanicPolicy is what happens when a call to the GraphQLService, i.e. Exec or
+// Subscribe, panics
+type PanicPolicy int
+
+const (
+	// PanicCrash resumes the panic, which crashes the process unless it's
+	// recovered further up, it's the default
+	PanicCrash PanicPolicy = iota
+	// PanicAsError fails the operation with an error
+	PanicAsError
+	// PanicCloseConnection closes the connection with the 1011 (internal
+	// error) close code, where the transport supports close codes, and
+	// ErrServicePanicked as the close reason
+	PanicCloseConnection
+)
+
+// ErrServicePanicked is the error operations fail with and connections are
+// closed for when a call to the GraphQLService panics, see ServicePanics, or
+// when a panic of a goroutine of the connection is recovered, see OnPanic
+var ErrServicePanicked = errors.New("internal error")
+
+// ServicePanics sets the policy for panics of calls to the GraphQLService.
+// Unless it's PanicCrash the panic is recovered and reported as a *PanicError
+// to the ErrorReporter, the client is only told about ErrServicePanicked.
+func ServicePanics(p PanicPolicy) Option {
+	return func(conn *connection) {
+		conn.panicPolicy = p
+	}
+}
+
+// PanicHandler is passed the panics recovered from the goroutines of a
+// connection, with the context and id of the operation the panic occurred
+// for, if any, see OnPanic
+type PanicHandler func(ctx context.Context, operationID string, err *PanicError)
+
+// OnPanic makes the connection recover the panics of its goroutines, e.g. of a
+// payload whose MarshalJSON panics, instead of crashing the process, and pass
+// them to fn, which may be nil. The operation which panicked, if any, fails
+// with ErrServicePanicked and the connection is closed with it as the close
+// reason and the 1011 (internal error) close code. Panics are also recovered,
+// without OnPanic, under a PanicPolicy other than PanicCrash.
+func OnPanic(fn PanicHandler) Option {
+	return func(conn *connection) {
+		conn.onPanic = fn
+		conn.recoverAll = true
+	}
+}
+
+// recoversPanics reports whether the panics of the goroutines of the
+// connection are recovered
+func (conn *connection) recoversPanics() bool {
+	return conn.recoverAll || conn.panicPolicy != PanicCrash
+}
+
+// panicked closes the connection once one of its goroutines panicked
+func (conn *connection) panicked() {
+	conn.closeWithCode(closeInternalError, ErrServicePanicked)
+}
+
+// callService calls fn, a call to the GraphQLService, and applies the panic
+// policy if it panics, in which case it returns ErrServicePanicked
+func (conn *connection) callService(ctx context.Context, operationID string, fn func()) (err error) {
+	if conn.panicPolicy == PanicCrash {
+		fn()
+		return nil
+	}
+
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+
+		conn.reportError(ctx, operationID, &PanicError{Value: r, Stack: debug.Stack()})
+		if conn.panicPolicy == PanicCloseConnection {
+			conn.closeWithCode(closeInternalError, ErrServicePanicked)
+		}
+		err = ErrServicePanicked
+	}()
+	fn()
+	return nil
+}
+
+const (
+	// closeMessage is the websocket close control message type, as in
+	// gorilla/websocket
+	closeMessage = 8
+	// closeInternalError is the close code of connections terminated by an
+	// unexpected condition
+	closeInternalError = 1011
+)
+
+// controlWriter is implemented by connections able to send control frames
+// concurrently with other writes, e.g. *websocket.Conn
+type controlWriter interface {
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+}
+
+// closeWithCode closes the connection for reason, sending a close frame with
+// code first if ws supports it
+func (conn *connection) closeWithCode(code int, reason error) {
+	conn.closeWithText(code, "", reason)
+}
+
+// closeWithText is like closeWithCode, the close frame holding text
+func (conn *connection) closeWithText(code int, text string, reason error) {
+	conn.setCloseReason(reason)
+	conn.writeClose(code, text)
+	conn.close()
+}
+
+// writeClose sends a close frame with code and text if ws supports it
+func (conn *connection) writeClose(code int, text string) {
+	if cw, ok := conn.ws.(controlWriter); ok {
+		data := binary.BigEndian.AppendUint16(nil, uint16(code))
+		data = append(data, text...)
+		cw.WriteControl(closeMessage, data, conn.clock.Now().Add(conn.writeTimeout))
+	}
+}
@@ -0,0 +1,96 @@
+package connection_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestServicePanicsAsError(t *testing.T) {
+	r := make(recordingReporter, 1)
+	ws := newConnection()
+	go connection.Connect(ws, panickingService{}, context.Background(),
+		connection.ReportErrors(r),
+		connection.ServicePanics(connection.PanicAsError),
+	)
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"error","payload":{"message":"internal error"}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+	})
+
+	got := <-r
+	var perr *connection.PanicError
+	if got.operationID != "a" || !errors.As(got.err, &perr) || perr.Value != "subscribe" {
+		t.Fatalf("expected the panic of operation a to be reported but instead got %+v", got)
+	}
+
+	ws.in <- []byte(`{"type":"connection_terminate"}`)
+}
+
+func TestServicePanicsCloseConnection(t *testing.T) {
+	o := make(reasonObserver, 1)
+	ws := newConnection()
+	go connection.Connect(ws, panickingService{}, context.Background(),
+		connection.Observe(o),
+		connection.ServicePanics(connection.PanicCloseConnection),
+	)
+
+	ws.in <- []byte(`{"type":"connection_init","payload":{}}`)
+	requireEqualJSON(t, connectionACK, <-ws.out)
+	ws.in <- []byte(`{"id":"a","type":"start","payload":{}}`)
+
+	select {
+	case got := <-o:
+		if !errors.Is(got, connection.ErrServicePanicked) {
+			t.Fatalf("expected %v but instead got %v", connection.ErrServicePanicked, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the connection to be closed")
+	}
+}
+
+// panickingPayload panics when marshaled
+type panickingPayload struct{}
+
+func (panickingPayload) MarshalJSON() ([]byte, error) {
+	panic("marshal")
+}
+
+func TestOnPanic(t *testing.T) {
+	o := make(reasonObserver, 1)
+	panics := make(chan *connection.PanicError, 1)
+	ws := newConnection()
+	go connection.Connect(ws, newGQLServiceWithPayloads(panickingPayload{}), context.Background(),
+		connection.Observe(o),
+		connection.OnPanic(func(ctx context.Context, operationID string, err *connection.PanicError) {
+			if operationID == "a" {
+				panics <- err
+			}
+		}),
+	)
+
+	ws.in <- []byte(`{"type":"connection_init","payload":{}}`)
+	requireEqualJSON(t, connectionACK, <-ws.out)
+	ws.in <- []byte(`{"id":"a","type":"start","payload":{}}`)
+	requireEqualJSON(t, `{"id":"a","type":"error","payload":{"message":"internal error"}}`, <-ws.out)
+	requireEqualJSON(t, `{"id":"a","type":"complete"}`, <-ws.out)
+
+	if got := <-panics; got.Value != "marshal" {
+		t.Fatalf("expected the panic of the payload but instead got %v", got.Value)
+	}
+	select {
+	case got := <-o:
+		if !errors.Is(got, connection.ErrServicePanicked) {
+			t.Fatalf("expected %v but instead got %v", connection.ErrServicePanicked, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the connection to be closed")
+	}
+}
@@ -0,0 +1,193 @@
+package connection
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrPersistedQueryNotFound is the error of the operations started with
+	// the hash of a document the PersistedQueryStore doesn't hold, clients
+	// then start them again with the document
+	ErrPersistedQueryNotFound = errors.New("PersistedQueryNotFound")
+	// ErrQueryNotAllowed is the error of the operations whose document isn't
+	// in the allow-list, see AllowList
+	ErrQueryNotAllowed = errors.New("query not allowed")
+
+	errPersistedQueryHashMismatch = errors.New("provided sha does not match query")
+)
+
+// PersistedQueryStore holds the documents of persisted queries by the hex
+// encoded SHA-256 hash of their text
+type PersistedQueryStore interface {
+	// Get returns the document with hash, false if there's none
+	Get(ctx context.Context, hash string) (query string, ok bool, err error)
+	Put(ctx context.Context, hash string, query string) error
+}
+
+// PersistedQueries implements Apollo's Automatic Persisted Queries: start
+// payloads may carry the hash of their document in
+// extensions.persistedQuery.sha256Hash instead of the document itself, which
+// is then looked up in store. If it isn't found the operation fails with
+// ErrPersistedQueryNotFound, whose extensions code is
+// PERSISTED_QUERY_NOT_FOUND, and the client starts it again with both the
+// document and its hash, the document being then saved to store.
+func PersistedQueries(store PersistedQueryStore) Option {
+	return func(conn *connection) {
+		conn.persisted = persistedQueries{store: store}
+	}
+}
+
+// AllowList only lets operations run documents held by store, which are sent
+// either in full or as their hash as with PersistedQueries. Other operations
+// fail with ErrQueryNotAllowed, whose extensions code is QUERY_NOT_ALLOWED,
+// and the documents sent by clients are never saved to store.
+func AllowList(store PersistedQueryStore) Option {
+	return func(conn *connection) {
+		conn.persisted = persistedQueries{store: store, strict: true}
+	}
+}
+
+// startExtensions are the extensions of a start payload
+type startExtensions struct {
+	PersistedQuery *persistedQueryExtension `json:"persistedQuery,omitempty"`
+	// values are all the extensions, see ExtensionsFromContext
+	values map[string]interface{}
+}
+
+func (e *startExtensions) UnmarshalJSON(data []byte) error {
+	// plain doesn't have this method
+	type plain startExtensions
+	if err := json.Unmarshal(data, (*plain)(e)); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &e.values)
+}
+
+type persistedQueryExtension struct {
+	Version    int    `json:"version"`
+	Sha256Hash string `json:"sha256Hash"`
+}
+
+// persistedQueryError is returned to clients whose operation's document
+// couldn't be resolved
+type persistedQueryError struct {
+	err  error
+	code string
+}
+
+func (e *persistedQueryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *persistedQueryError) Unwrap() error {
+	return e.err
+}
+
+func (e *persistedQueryError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+type persistedQueries struct {
+	store PersistedQueryStore
+	// strict is set for an allow-list
+	strict bool
+}
+
+// resolve sets the document of osp from the store if it only holds its hash,
+// or saves it otherwise. It returns an error if the operation may not run.
+func (pq persistedQueries) resolve(ctx context.Context, osp *startMessagePayload) error {
+	if pq.store == nil {
+		return nil
+	}
+	var hash string
+	if osp.Extensions != nil && osp.Extensions.PersistedQuery != nil {
+		hash = osp.Extensions.PersistedQuery.Sha256Hash
+	}
+
+	if osp.Query == "" && hash != "" {
+		query, ok, err := pq.store.Get(ctx, hash)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if pq.strict {
+				return &persistedQueryError{err: ErrQueryNotAllowed, code: "QUERY_NOT_ALLOWED"}
+			}
+			return &persistedQueryError{err: ErrPersistedQueryNotFound, code: "PERSISTED_QUERY_NOT_FOUND"}
+		}
+		osp.Query = query
+		return nil
+	}
+
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte(osp.Query)))
+	if hash != "" && hash != sum {
+		return &persistedQueryError{err: errPersistedQueryHashMismatch, code: "PERSISTED_QUERY_HASH_MISMATCH"}
+	}
+	switch {
+	case pq.strict:
+		_, ok, err := pq.store.Get(ctx, sum)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return &persistedQueryError{err: ErrQueryNotAllowed, code: "QUERY_NOT_ALLOWED"}
+		}
+	case hash != "":
+		return pq.store.Put(ctx, hash, osp.Query)
+	}
+	return nil
+}
+
+// MemoryPersistedQueryStore is a PersistedQueryStore keeping the documents in
+// memory
+type MemoryPersistedQueryStore struct {
+	limit int
+
+	mu      sync.Mutex
+	queries map[string]string
+	// order holds the hashes of the documents saved, oldest first
+	order []string
+}
+
+// NewMemoryPersistedQueryStore returns a MemoryPersistedQueryStore holding
+// queries, e.g. the allow-list, and up to limit documents saved by clients,
+// the oldest being dropped for newer ones. With limit <= 0 it only holds
+// queries.
+func NewMemoryPersistedQueryStore(limit int, queries ...string) *MemoryPersistedQueryStore {
+	s := &MemoryPersistedQueryStore{limit: limit, queries: make(map[string]string, len(queries))}
+	for _, q := range queries {
+		s.queries[fmt.Sprintf("%x", sha256.Sum256([]byte(q)))] = q
+	}
+	return s
+}
+
+// Get implements PersistedQueryStore
+func (s *MemoryPersistedQueryStore) Get(ctx context.Context, hash string) (string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q, ok := s.queries[hash]
+	return q, ok, nil
+}
+
+// Put implements PersistedQueryStore
+func (s *MemoryPersistedQueryStore) Put(ctx context.Context, hash string, query string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.queries[hash]; ok || s.limit <= 0 {
+		return nil
+	}
+
+	if len(s.order) == s.limit {
+		delete(s.queries, s.order[0])
+		s.order[0] = ""
+		s.order = s.order[1:]
+	}
+	s.queries[hash] = query
+	s.order = append(s.order, hash)
+	return nil
+}
@@ -0,0 +1,93 @@
+package connection_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// documentService answers operations with their document
+type documentService struct{}
+
+func (documentService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	payload, _ := json.Marshal(map[string]interface{}{"data": map[string]string{"document": document}})
+	c := make(chan interface{}, 1)
+	c <- json.RawMessage(payload)
+	close(c)
+	return c, nil
+}
+
+func (documentService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+func sha256Hex(s string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(s)))
+}
+
+func TestPersistedQueries(t *testing.T) {
+	hash := sha256Hex("subscription { a }")
+	ws := newConnection()
+	go connection.Connect(ws, documentService{}, context.Background(),
+		connection.PersistedQueries(connection.NewMemoryPersistedQueryStore(10)),
+	)
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: `{"type":"connection_ack","payload":{"extensions":{"batching":true,"flowControl":true,"persistedQueries":true,"resume":true}}}`},
+		// unknown yet
+		{intention: clientSends, operationMessage: `{"id":"1","type":"start","payload":{"extensions":{"persistedQuery":{"version":1,"sha256Hash":"` + hash + `"}}}}`},
+		{intention: expectation, operationMessage: `{"id":"1","type":"error","payload":{"message":"PersistedQueryNotFound","extensions":{"code":"PERSISTED_QUERY_NOT_FOUND"}}}`},
+		{intention: expectation, operationMessage: `{"id":"1","type":"complete"}`},
+		// saved along with the document
+		{intention: clientSends, operationMessage: `{"id":"1","type":"start","payload":{"query":"subscription { a }","extensions":{"persistedQuery":{"version":1,"sha256Hash":"` + hash + `"}}}}`},
+		{intention: expectation, operationMessage: `{"id":"1","type":"data","payload":{"data":{"document":"subscription { a }"}}}`},
+		{intention: expectation, operationMessage: `{"id":"1","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"id":"1","type":"start","payload":{"extensions":{"persistedQuery":{"version":1,"sha256Hash":"` + hash + `"}}}}`},
+		{intention: expectation, operationMessage: `{"id":"1","type":"data","payload":{"data":{"document":"subscription { a }"}}}`},
+		{intention: expectation, operationMessage: `{"id":"1","type":"complete"}`},
+		// the hash must be the one of the document
+		{intention: clientSends, operationMessage: `{"id":"2","type":"start","payload":{"query":"subscription { b }","extensions":{"persistedQuery":{"version":1,"sha256Hash":"` + hash + `"}}}}`},
+		{intention: expectation, operationMessage: `{"id":"2","type":"error","payload":{"message":"provided sha does not match query","extensions":{"code":"PERSISTED_QUERY_HASH_MISMATCH"}}}`},
+		{intention: expectation, operationMessage: `{"id":"2","type":"complete"}`},
+		// documents without hash run as usual
+		{intention: clientSends, operationMessage: `{"id":"3","type":"start","payload":{"query":"subscription { b }"}}`},
+		{intention: expectation, operationMessage: `{"id":"3","type":"data","payload":{"data":{"document":"subscription { b }"}}}`},
+		{intention: expectation, operationMessage: `{"id":"3","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
+
+func TestAllowList(t *testing.T) {
+	store := connection.NewMemoryPersistedQueryStore(10, "subscription { a }")
+	ws := newConnection()
+	go connection.Connect(ws, documentService{}, context.Background(), connection.AllowList(store))
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"1","type":"start","payload":{"extensions":{"persistedQuery":{"version":1,"sha256Hash":"` + sha256Hex("subscription { a }") + `"}}}}`},
+		{intention: expectation, operationMessage: `{"id":"1","type":"data","payload":{"data":{"document":"subscription { a }"}}}`},
+		{intention: expectation, operationMessage: `{"id":"1","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"id":"2","type":"start","payload":{"query":"subscription { a }"}}`},
+		{intention: expectation, operationMessage: `{"id":"2","type":"data","payload":{"data":{"document":"subscription { a }"}}}`},
+		{intention: expectation, operationMessage: `{"id":"2","type":"complete"}`},
+		// neither arbitrary documents nor new ones with their hash
+		{intention: clientSends, operationMessage: `{"id":"3","type":"start","payload":{"query":"subscription { b }"}}`},
+		{intention: expectation, operationMessage: `{"id":"3","type":"error","payload":{"message":"query not allowed","extensions":{"code":"QUERY_NOT_ALLOWED"}}}`},
+		{intention: expectation, operationMessage: `{"id":"3","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"id":"4","type":"start","payload":{"query":"subscription { b }","extensions":{"persistedQuery":{"version":1,"sha256Hash":"` + sha256Hex("subscription { b }") + `"}}}}`},
+		{intention: expectation, operationMessage: `{"id":"4","type":"error","payload":{"message":"query not allowed","extensions":{"code":"QUERY_NOT_ALLOWED"}}}`},
+		{intention: expectation, operationMessage: `{"id":"4","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+	if _, ok, _ := store.Get(context.Background(), sha256Hex("subscription { b }")); ok {
+		t.Fatal("expected the allow-list not to be extended")
+	}
+}
@@ -0,0 +1,164 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// pingMessage is the websocket ping control message type, as in
+// gorilla/websocket
+const pingMessage = 9
+
+// ErrPongTimeout means the client stopped answering the websocket pings of
+// the server, e.g. because its TCP connection is half-open, see PongWait
+var ErrPongTimeout = errors.New("pong timed out")
+
+// pinger is implemented by connections able to send pings and to time out
+// reads, e.g. *websocket.Conn
+type pinger interface {
+	controlWriter
+	SetReadDeadline(t time.Time) error
+	SetPongHandler(h func(appData string) error)
+}
+
+// pongReceiver is implemented by connections able to send pings whose frames
+// are read by the caller of Attach, e.g. those of the event loop
+type pongReceiver interface {
+	controlWriter
+	SetPongHandler(h func(appData string) error)
+}
+
+type pingPong struct {
+	wait   time.Duration
+	period time.Duration
+	// ws is set once pings are sent by Connect
+	ws pinger
+	// lastRead is when a frame or a pong was last read from an attached
+	// connection, in nanoseconds since the epoch, once pings are sent
+	lastRead int64
+}
+
+// PongWait makes the server send websocket pings and close the connection
+// with ErrPongTimeout when nothing, be it a pong or a message, is read from
+// the client within d, so that dead peers are detected without waiting for
+// the OS to give up on them. It only applies to websockets able to send pings,
+// i.e. not to custom transports. Attached connections, whose reads can't time
+// out, are closed at the first ping sent past d.
+func PongWait(d time.Duration) Option {
+	return func(conn *connection) {
+		conn.pingPong.wait = d
+	}
+}
+
+// PingPeriod sets the interval at which pings are sent, 9/10 of the PongWait
+// by default. It has to be shorter than the PongWait.
+func PingPeriod(d time.Duration) Option {
+	return func(conn *connection) {
+		conn.pingPong.period = d
+	}
+}
+
+// startPing sends pings until ctx is done, if enabled, and installs the pong
+// handler extending the read deadline
+func (conn *connection) startPing(ctx context.Context) {
+	p := &conn.pingPong
+	ws, ok := conn.ws.(pinger)
+	if p.wait <= 0 || !ok {
+		return
+	}
+	period := p.pingPeriod()
+
+	p.ws = ws
+	conn.extendRead()
+	ws.SetPongHandler(func(string) error {
+		conn.extendRead()
+		return nil
+	})
+
+	conn.spawn(func() {
+		ticker := conn.clock.NewTicker(period)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+				// a failed ping is noticed by the reader once its
+				// deadline is exceeded
+				ws.WriteControl(pingMessage, nil, conn.clock.Now().Add(conn.writeTimeout))
+			}
+		}
+	})
+}
+
+// startAttachedPing is startPing for attached connections: since their reads
+// can't time out, they're closed with ErrPongTimeout instead of being pinged
+// once nothing was read within the PongWait
+func (conn *connection) startAttachedPing(ctx context.Context) {
+	p := &conn.pingPong
+	ws, ok := conn.ws.(pongReceiver)
+	if p.wait <= 0 || !ok {
+		return
+	}
+	period := p.pingPeriod()
+
+	conn.extendRead()
+	ws.SetPongHandler(func(string) error {
+		conn.extendRead()
+		return nil
+	})
+
+	conn.spawn(func() {
+		ticker := conn.clock.NewTicker(period)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+				lastRead := time.Unix(0, atomic.LoadInt64(&p.lastRead))
+				if conn.clock.Now().Sub(lastRead) > p.wait {
+					conn.setCloseReason(ErrPongTimeout)
+					conn.close()
+					return
+				}
+				ws.WriteControl(pingMessage, nil, conn.clock.Now().Add(conn.writeTimeout))
+			}
+		}
+	})
+}
+
+// pingPeriod returns the interval at which pings are sent
+func (p *pingPong) pingPeriod() time.Duration {
+	if p.period <= 0 || p.period >= p.wait {
+		return p.wait * 9 / 10
+	}
+	return p.period
+}
+
+// extendRead extends the read deadline by the PongWait, if pings are sent
+func (conn *connection) extendRead() {
+	p := &conn.pingPong
+	if p.wait <= 0 {
+		return
+	}
+	atomic.StoreInt64(&p.lastRead, conn.clock.Now().UnixNano())
+	if p.ws != nil {
+		p.ws.SetReadDeadline(conn.clock.Now().Add(p.wait))
+	}
+}
+
+// readFailed returns the close reason of a connection whose read failed with
+// err
+func (conn *connection) readFailed(err error) error {
+	var netErr net.Error
+	if conn.pingPong.ws != nil && errors.As(err, &netErr) && netErr.Timeout() {
+		return wrapCloseReason(ErrPongTimeout, err)
+	}
+	return wrapCloseReason(ErrClientGone, err)
+}
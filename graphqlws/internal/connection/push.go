@@ -0,0 +1,100 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+)
+
+// Push sends a data message with id and payload, a GraphQL response, to the
+// client of the connection ctx belongs to, e.g. an administrative notice,
+// without going through the channel of an operation. The id may be that of a
+// running operation or one the client expects such messages on. Pushed
+// messages aren't acknowledged, see Acknowledge. It returns false if ctx
+// doesn't belong to a connection, or it isn't acknowledged yet or is closed,
+// or if its transport doesn't deliver data messages with id, see AcceptPushes.
+func Push(ctx context.Context, id string, payload json.RawMessage) bool {
+	conn, ok := ctx.Value(connectionKey).(*connection)
+	if !ok || !conn.pushable() || (conn.acceptPush != nil && !conn.acceptPush(id)) {
+		return false
+	}
+	conn.sendMessage(&operationMessage{ID: id, Type: typeData, Payload: payload})
+	return true
+}
+
+// AcceptPushes sets the function telling whether the transport of the
+// connection delivers data messages with id, those pushed with any other id
+// being refused by Push, e.g. when the protocol drops the messages of the
+// operations which aren't running.
+func AcceptPushes(fn func(id string) bool) Option {
+	return func(conn *connection) {
+		conn.acceptPush = fn
+	}
+}
+
+// JoinTopic joins the operation ctx belongs to to topic until it ends, so
+// that it's sent what's pushed to the topic with PushTopic. It returns false
+// if ctx doesn't belong to a running operation.
+func JoinTopic(ctx context.Context, topic string) bool {
+	op, ok := operationFromContext(ctx)
+	if !ok {
+		return false
+	}
+	op.mu.Lock()
+	if op.topics == nil {
+		op.topics = map[string]struct{}{}
+	}
+	op.topics[topic] = struct{}{}
+	op.mu.Unlock()
+	return true
+}
+
+// LeaveTopic makes the operation ctx belongs to leave topic, see JoinTopic
+func LeaveTopic(ctx context.Context, topic string) {
+	op, ok := operationFromContext(ctx)
+	if !ok {
+		return
+	}
+	op.mu.Lock()
+	delete(op.topics, topic)
+	op.mu.Unlock()
+}
+
+// PushTopic sends a data message with payload to each running operation of
+// the connection ctx belongs to which joined topic, with the id of the
+// operation, and returns how many there were
+func PushTopic(ctx context.Context, topic string, payload json.RawMessage) int {
+	conn, ok := ctx.Value(connectionKey).(*connection)
+	if !ok || !conn.pushable() {
+		return 0
+	}
+	n := 0
+	conn.ops.each(func(op *operation) {
+		op.mu.Lock()
+		_, joined := op.topics[topic]
+		op.mu.Unlock()
+		if joined {
+			op.send(conn.sendMessage, &operationMessage{Type: typeData, Payload: payload})
+			n++
+		}
+	})
+	return n
+}
+
+// pushable returns whether messages may be pushed to the client
+func (conn *connection) pushable() bool {
+	return atomic.LoadInt32(&conn.acked) == 1 && conn.ctx.Err() == nil
+}
+
+// operationFromContext returns the running operation ctx belongs to
+func operationFromContext(ctx context.Context) (*operation, bool) {
+	conn, ok := ctx.Value(connectionKey).(*connection)
+	if !ok {
+		return nil, false
+	}
+	id, ok := OperationIDFromContext(ctx)
+	if !ok {
+		return nil, false
+	}
+	return conn.ops.load(id)
+}
@@ -0,0 +1,81 @@
+package connection_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// topicService serves subscriptions which join the topic named by their
+// document, if any, and send nothing until their context is done
+type topicService struct{}
+
+func (topicService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	if document != "" && !connection.JoinTopic(ctx, document) {
+		panic("expected to join " + document)
+	}
+	c := make(chan interface{})
+	go func() {
+		<-ctx.Done()
+		close(c)
+	}()
+	return c, nil
+}
+
+func (topicService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+func TestPush(t *testing.T) {
+	opened := make(chan context.Context, 1)
+	ws := newConnection()
+	go connection.Connect(ws, topicService{}, context.Background(),
+		connection.OnOpen(func(ctx context.Context) { opened <- ctx }),
+	)
+	ctx := <-opened
+	notice := json.RawMessage(`{"data":{"notice":"logged out elsewhere"}}`)
+
+	if connection.Push(ctx, "notices", notice) {
+		t.Fatal("expected nothing to be pushed before the connection is acknowledged")
+	}
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{"query":"news"}}`},
+		{intention: clientSends, operationMessage: `{"id":"b","type":"start","payload":{"query":"sports"}}`},
+		{intention: clientSends, operationMessage: `{"id":"c","type":"start","payload":{}}`},
+	})
+	requireOperationCount(t, ctx, 3)
+
+	if !connection.Push(ctx, "notices", notice) {
+		t.Fatal("expected the notice to be pushed")
+	}
+	requireEqualJSON(t, `{"id":"notices","type":"data","payload":{"data":{"notice":"logged out elsewhere"}}}`, <-ws.out)
+
+	if n := connection.PushTopic(ctx, "news", json.RawMessage(`{"data":{"headline":"hello"}}`)); n != 1 {
+		t.Fatalf("expected 1 operation to be pushed to but instead got %d", n)
+	}
+	requireEqualJSON(t, `{"id":"a","type":"data","payload":{"data":{"headline":"hello"}}}`, <-ws.out)
+	if n := connection.PushTopic(ctx, "weather", json.RawMessage(`{"data":{}}`)); n != 0 {
+		t.Fatalf("expected no operation to be pushed to but instead got %d", n)
+	}
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"id":"a","type":"stop"}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+	})
+	requireOperationCount(t, ctx, 2)
+	if n := connection.PushTopic(ctx, "news", json.RawMessage(`{"data":{}}`)); n != 0 {
+		t.Fatalf("expected the stopped operation not to be pushed to but instead got %d", n)
+	}
+
+	ws.in <- []byte(`{"type":"connection_terminate"}`)
+	connection.Wait(ctx)
+	if connection.Push(ctx, "notices", notice) {
+		t.Fatal("expected nothing to be pushed once the connection is closed")
+	}
+}
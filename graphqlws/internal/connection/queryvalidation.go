@@ -0,0 +1,204 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"github.com/vektah/gqlparser/v2/parser"
+)
+
+var (
+	// ErrQueryTooDeep is the error of the operations whose selections are
+	// nested deeper than allowed, see MaxDepth
+	ErrQueryTooDeep = errors.New("query too deep")
+	// ErrQueryTooComplex is the error of the operations whose cost is higher
+	// than allowed, see MaxComplexity
+	ErrQueryTooComplex = errors.New("query too complex")
+)
+
+// QueryValidator checks the parsed document of an operation before it's
+// passed to the service, the operation fails with the error it returns, with
+// the extensions of errors implementing Extensions() map[string]interface{}.
+// The document isn't validated against the schema, which is left to the
+// service.
+type QueryValidator func(ctx context.Context, doc *ast.QueryDocument, operationName string, variables map[string]interface{}) error
+
+// ValidateQueries adds validators checking the documents of operations once
+// allowed by the SubscribeHook, if any. Documents that can't be parsed fail
+// with a GRAPHQL_PARSE_FAILED error without calling them.
+func ValidateQueries(validators ...QueryValidator) Option {
+	return func(conn *connection) {
+		conn.validators = append(conn.validators, validators...)
+	}
+}
+
+// ComplexityFunc returns the cost of a field given the complexity of its
+// selections, e.g. multiplied by the size of the list it returns
+type ComplexityFunc func(field *ast.Field, variables map[string]interface{}, childComplexity int) int
+
+// MaxDepth returns a QueryValidator rejecting the operations with fields
+// nested more than n levels deep, fragments included, with ErrQueryTooDeep
+// whose extensions code is QUERY_TOO_DEEP
+func MaxDepth(n int) QueryValidator {
+	return func(ctx context.Context, doc *ast.QueryDocument, operationName string, variables map[string]interface{}) error {
+		op := selectOperation(doc, operationName)
+		if op == nil {
+			return nil
+		}
+		depth := newSelectionWalker(doc, false, func(field *ast.Field, children int) int {
+			return 1 + children
+		}).walk(op.SelectionSet)
+		if depth > n {
+			return &queryValidationError{err: ErrQueryTooDeep, code: "QUERY_TOO_DEEP", detail: fmt.Sprintf("depth %d exceeds %d", depth, n)}
+		}
+		return nil
+	}
+}
+
+// MaxComplexity returns a QueryValidator rejecting the operations whose cost
+// is higher than max with ErrQueryTooComplex, whose extensions code is
+// QUERY_TOO_COMPLEX. The cost of each field is returned by fn, with a nil fn
+// it is 1 plus the complexity of its selections.
+func MaxComplexity(max int, fn ComplexityFunc) QueryValidator {
+	if fn == nil {
+		fn = func(field *ast.Field, variables map[string]interface{}, childComplexity int) int {
+			return 1 + childComplexity
+		}
+	}
+	return func(ctx context.Context, doc *ast.QueryDocument, operationName string, variables map[string]interface{}) error {
+		op := selectOperation(doc, operationName)
+		if op == nil {
+			return nil
+		}
+		cost := newSelectionWalker(doc, true, func(field *ast.Field, children int) int {
+			return fn(field, variables, children)
+		}).walk(op.SelectionSet)
+		if cost > max {
+			return &queryValidationError{err: ErrQueryTooComplex, code: "QUERY_TOO_COMPLEX", detail: fmt.Sprintf("complexity %d exceeds %d", cost, max)}
+		}
+		return nil
+	}
+}
+
+// queryValidationError is returned to clients whose operation's document was
+// rejected before it's passed to the service
+type queryValidationError struct {
+	err    error
+	code   string
+	detail string
+}
+
+func (e *queryValidationError) Error() string {
+	if e.detail == "" {
+		return e.err.Error()
+	}
+	return e.err.Error() + ": " + e.detail
+}
+
+func (e *queryValidationError) Unwrap() error {
+	return e.err
+}
+
+func (e *queryValidationError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": e.code}
+}
+
+// validateQuery parses the document of osp and calls the QueryValidators, if
+// any
+func (conn *connection) validateQuery(ctx context.Context, operationID string, osp startMessagePayload) error {
+	if len(conn.validators) == 0 {
+		return nil
+	}
+
+	doc, err := parser.ParseQuery(&ast.Source{Input: osp.Query})
+	if err != nil {
+		var gqlErr *gqlerror.Error
+		if errors.As(err, &gqlErr) {
+			// without the position prefixed
+			err = errors.New(gqlErr.Message)
+		}
+		return &queryValidationError{err: err, code: "GRAPHQL_PARSE_FAILED"}
+	}
+
+	if perr := conn.callService(ctx, operationID, func() {
+		for _, validate := range conn.validators {
+			if err = validate(ctx, doc, osp.OperationName, osp.Variables); err != nil {
+				return
+			}
+		}
+	}); perr != nil {
+		return perr
+	}
+	return err
+}
+
+// selectOperation returns the operation of doc that is run, nil if there's
+// none, which is left to the service to report
+func selectOperation(doc *ast.QueryDocument, operationName string) *ast.OperationDefinition {
+	if operationName == "" && len(doc.Operations) > 0 {
+		return doc.Operations[0]
+	}
+	return doc.Operations.ForName(operationName)
+}
+
+// selectionWalker sums up or takes the maximum of a value over the fields of
+// the selections of a document. The value of each fragment is only computed
+// once, so that documents spreading fragments many times over aren't costly
+// to check, and fragments spreading themselves count for nothing.
+type selectionWalker struct {
+	doc   *ast.QueryDocument
+	field func(field *ast.Field, children int) int
+	sum   bool
+
+	fragments map[string]int
+	walking   map[string]bool
+}
+
+func newSelectionWalker(doc *ast.QueryDocument, sum bool, field func(field *ast.Field, children int) int) *selectionWalker {
+	return &selectionWalker{doc: doc, field: field, sum: sum, fragments: map[string]int{}, walking: map[string]bool{}}
+}
+
+func (w *selectionWalker) walk(set ast.SelectionSet) int {
+	total := 0
+	for _, sel := range set {
+		v := 0
+		switch sel := sel.(type) {
+		case *ast.Field:
+			v = w.field(sel, w.walk(sel.SelectionSet))
+		case *ast.InlineFragment:
+			v = w.walk(sel.SelectionSet)
+		case *ast.FragmentSpread:
+			v = w.fragment(sel.Name)
+		}
+		switch {
+		case w.sum:
+			// saturating, so that costs doubling with each level of
+			// fragments don't overflow
+			if total += v; total < 0 || v < 0 {
+				total = math.MaxInt
+			}
+		case v > total:
+			total = v
+		}
+	}
+	return total
+}
+
+func (w *selectionWalker) fragment(name string) int {
+	if v, ok := w.fragments[name]; ok {
+		return v
+	}
+	f := w.doc.Fragments.ForName(name)
+	if f == nil || w.walking[name] {
+		return 0
+	}
+	w.walking[name] = true
+	v := w.walk(f.SelectionSet)
+	delete(w.walking, name)
+	w.fragments[name] = v
+	return v
+}
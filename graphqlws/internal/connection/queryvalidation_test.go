@@ -0,0 +1,90 @@
+package connection_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/parser"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestValidateQueries(t *testing.T) {
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(`{"data":"allowed"}`), context.Background(),
+		connection.ValidateQueries(connection.MaxDepth(2), connection.MaxComplexity(3, nil)),
+	)
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{"query":"subscription { a { b { c } } }"}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"error","payload":{"message":"query too deep: depth 3 exceeds 2","extensions":{"code":"QUERY_TOO_DEEP"}}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"id":"b","type":"start","payload":{"query":"subscription { a { ...F } } fragment F on A { b c d }"}}`},
+		{intention: expectation, operationMessage: `{"id":"b","type":"error","payload":{"message":"query too complex: complexity 4 exceeds 3","extensions":{"code":"QUERY_TOO_COMPLEX"}}}`},
+		{intention: expectation, operationMessage: `{"id":"b","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"id":"c","type":"start","payload":{"query":"subscription {"}}`},
+		{intention: expectation, operationMessage: `{"id":"c","type":"error","payload":{"message":"Expected Name, found <EOF>","extensions":{"code":"GRAPHQL_PARSE_FAILED"}}}`},
+		{intention: expectation, operationMessage: `{"id":"c","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"id":"d","type":"start","payload":{"query":"subscription { a { b } }"}}`},
+		{intention: expectation, operationMessage: `{"id":"d","type":"data","payload":{"data":"allowed"}}`},
+		{intention: expectation, operationMessage: `{"id":"d","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
+
+func TestMaxComplexity(t *testing.T) {
+	// each field returns as many items as its first argument
+	validate := connection.MaxComplexity(100, func(field *ast.Field, variables map[string]interface{}, childComplexity int) int {
+		n := 1
+		if arg := field.Arguments.ForName("first"); arg != nil {
+			v, err := arg.Value.Value(variables)
+			if err == nil {
+				n = int(v.(int64))
+			}
+		}
+		return n * (1 + childComplexity)
+	})
+
+	for _, tc := range []struct {
+		query string
+		err   error
+	}{
+		{query: `subscription { a(first: 10) { b(first: 9) } }`},
+		{query: `subscription { a(first: 10) { b(first: 10) } }`, err: connection.ErrQueryTooComplex},
+		{query: `subscription S($n: Int) { a(first: $n) { ... on A { b } } }`},
+	} {
+		doc, err := parser.ParseQuery(&ast.Source{Input: tc.query})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := validate(context.Background(), doc, "", map[string]interface{}{"n": int64(50)}); !errors.Is(err, tc.err) {
+			t.Errorf("%s: expected %v but instead got %v", tc.query, tc.err, err)
+		}
+	}
+}
+
+func TestMaxComplexityFragments(t *testing.T) {
+	// every fragment spreads the next one twice, its cost doubling each time
+	var b strings.Builder
+	b.WriteString("subscription { a { ...F0 } }")
+	for i := 0; i < 100; i++ {
+		b.WriteString(" fragment F" + strconv.Itoa(i) + " on A { a { ...F" + strconv.Itoa(i+1) + " } b { ...F" + strconv.Itoa(i+1) + " } }")
+	}
+	b.WriteString(" fragment F100 on A { c }")
+	doc, err := parser.ParseQuery(&ast.Source{Input: b.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := connection.MaxComplexity(1000, nil)(context.Background(), doc, "", nil); !errors.Is(err, connection.ErrQueryTooComplex) {
+		t.Fatalf("expected %v but instead got %v", connection.ErrQueryTooComplex, err)
+	}
+	if err := connection.MaxDepth(300)(context.Background(), doc, "", nil); err != nil {
+		t.Fatalf("expected a depth of 102 to be allowed but instead got %v", err)
+	}
+}
@@ -0,0 +1,164 @@
+package connection
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrRateLimited is the error of the messages sent beyond a rate limit, and
+// the close reason of the connections closed for it under RateLimitClose
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimitPolicy is what happens to the messages sent beyond a rate limit,
+// see RateLimits
+type RateLimitPolicy int
+
+const (
+	// RateLimitError drops the message, answering it with an error whose
+	// extensions code is RATE_LIMITED, it's the default
+	RateLimitError RateLimitPolicy = iota
+	// RateLimitClose closes the connection with the 4429 close code, where
+	// the transport supports close codes, and ErrRateLimited as the close
+	// reason
+	RateLimitClose
+)
+
+// MessageRate limits the client to perSecond incoming messages per second on
+// average, in bursts of up to burst messages. The stop and
+// connection_terminate messages are never limited, so that clients can always
+// release what they hold.
+func MessageRate(perSecond float64, burst int) Option {
+	return func(conn *connection) {
+		conn.rates.messages = newTokenBucket(perSecond, burst)
+	}
+}
+
+// StartRate limits the client to perMinute start messages per minute, in
+// bursts of up to perMinute messages, e.g. to survive clients starting and
+// stopping operations in a loop
+func StartRate(perMinute int) Option {
+	return func(conn *connection) {
+		conn.rates.starts = newTokenBucket(float64(perMinute)/60, perMinute)
+	}
+}
+
+// MaxInits limits to n the connection_init messages the client may send over
+// the lifetime of the connection
+func MaxInits(n int) Option {
+	return func(conn *connection) {
+		conn.rates.maxInits = n
+	}
+}
+
+// RateLimits sets what happens to the messages sent beyond the limits of
+// MessageRate, StartRate and MaxInits, the default is RateLimitError
+func RateLimits(policy RateLimitPolicy) Option {
+	return func(conn *connection) {
+		conn.rates.policy = policy
+	}
+}
+
+// rateLimits are only used by the reader of the connection, they aren't safe
+// for concurrent use
+type rateLimits struct {
+	messages *tokenBucket
+	starts   *tokenBucket
+	maxInits int
+	inits    int
+	policy   RateLimitPolicy
+}
+
+// allow tells whether msgType may be handled at now, counting it against the
+// limits
+func (r *rateLimits) allow(now time.Time, msgType operationMessageType) bool {
+	switch msgType {
+	case typeStop, typeConnectionTerminate:
+		return true
+	}
+	if !r.messages.take(now) {
+		return false
+	}
+	switch msgType {
+	case typeStart:
+		return r.starts.take(now)
+	case typeConnectionInit:
+		if r.maxInits <= 0 {
+			return true
+		}
+		r.inits++
+		return r.inits <= r.maxInits
+	}
+	return true
+}
+
+// rateLimited handles msg sent beyond a rate limit, it returns false when the
+// connection should be terminated
+func (conn *connection) rateLimited(sendMessage sendMessageFunc, msg operationMessage) bool {
+	if conn.rates.policy == RateLimitClose {
+		conn.closeWithText(int(CloseTooManyRequests), "Too many requests", ErrRateLimited)
+		return false
+	}
+
+	send := sendMessage.send
+	ep := errPayload(&rateLimitError{})
+	switch msg.Type {
+	case typeConnectionInit:
+		send("", typeConnectionError, ep)
+	case typeStart:
+		send(msg.ID, typeError, ep)
+		send(msg.ID, typeComplete, nil)
+	default:
+		send(msg.ID, typeError, ep)
+	}
+	return true
+}
+
+// rateLimitError is returned to clients sending messages beyond a rate limit
+type rateLimitError struct{}
+
+func (e *rateLimitError) Error() string {
+	return ErrRateLimited.Error()
+}
+
+func (e *rateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+func (e *rateLimitError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": "RATE_LIMITED"}
+}
+
+// tokenBucket allows rate events per second on average, in bursts of up to
+// burst events. A nil tokenBucket doesn't limit anything.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst)}
+}
+
+// take takes a token at now, it returns false if there's none left
+func (b *tokenBucket) take(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
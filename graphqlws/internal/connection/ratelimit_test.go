@@ -0,0 +1,84 @@
+package connection_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestStartRate(t *testing.T) {
+	clock := graphqlwstest.NewFakeClock(time.Now())
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(), context.Background(),
+		connection.UseClock(clock),
+		connection.StartRate(2),
+	)
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"id":"b","type":"start","payload":{}}`},
+		{intention: expectation, operationMessage: `{"id":"b","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"id":"c","type":"start","payload":{}}`},
+		{intention: expectation, operationMessage: `{"id":"c","type":"error","payload":{"message":"rate limit exceeded","extensions":{"code":"RATE_LIMITED"}}}`},
+		{intention: expectation, operationMessage: `{"id":"c","type":"complete"}`},
+		// stop is never limited
+		{intention: clientSends, operationMessage: `{"id":"c","type":"stop"}`},
+		{intention: expectation, operationMessage: `{"id":"c","type":"complete"}`},
+	})
+
+	// a start is allowed again every 30 seconds
+	clock.Advance(30 * time.Second)
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"id":"d","type":"start","payload":{}}`},
+		{intention: expectation, operationMessage: `{"id":"d","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"id":"e","type":"start","payload":{}}`},
+		{intention: expectation, operationMessage: `{"id":"e","type":"error","payload":{"message":"rate limit exceeded","extensions":{"code":"RATE_LIMITED"}}}`},
+		{intention: expectation, operationMessage: `{"id":"e","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
+
+func TestMaxInits(t *testing.T) {
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(), context.Background(), connection.MaxInits(1))
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: `{"type":"connection_error","payload":{"message":"rate limit exceeded","extensions":{"code":"RATE_LIMITED"}}}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
+
+func TestMessageRateClose(t *testing.T) {
+	o := make(reasonObserver, 1)
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(), context.Background(),
+		connection.UseClock(graphqlwstest.NewFakeClock(time.Now())),
+		connection.Observe(o),
+		connection.MessageRate(1, 2),
+		connection.RateLimits(connection.RateLimitClose),
+	)
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"id":"b","type":"start","payload":{}}`},
+	})
+
+	select {
+	case got := <-o:
+		if !errors.Is(got, connection.ErrRateLimited) {
+			t.Fatalf("expected %v but instead got %v", connection.ErrRateLimited, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the connection to be closed")
+	}
+}
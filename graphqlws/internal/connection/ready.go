@@ -0,0 +1,29 @@
+package connection
+
+import "time"
+
+// ReadyGate makes new operations be rejected while ready returns false, e.g.
+// while the caches of the service are warming up, so that clients connecting
+// during startup don't all hit Subscribe at once
+func ReadyGate(ready func() bool) Option {
+	return func(conn *connection) {
+		conn.ready = ready
+	}
+}
+
+var errNotReady = &notReadyError{}
+
+// notReadyError is returned to clients starting an operation before the
+// server is ready
+type notReadyError struct{}
+
+func (e *notReadyError) Error() string {
+	return "server is not ready, retry later"
+}
+
+func (e *notReadyError) Extensions() map[string]interface{} {
+	return map[string]interface{}{
+		"code":       "NOT_READY",
+		"retryAfter": int64(defaultRetryAfter / time.Millisecond),
+	}
+}
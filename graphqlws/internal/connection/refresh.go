@@ -0,0 +1,113 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// typeConnectionRefresh is the type of the messages clients send to
+	// refresh the authentication of their connection, see HandleRefresh
+	typeConnectionRefresh operationMessageType = "connection_refresh"
+	// typeConnectionRefreshed acknowledges a connection_refresh
+	typeConnectionRefreshed operationMessageType = "connection_refreshed"
+)
+
+var (
+	// ErrRefreshRejected means the refresh handler rejected a
+	// connection_refresh payload, it wraps the error it returned
+	ErrRefreshRejected = errors.New("connection_refresh rejected")
+	// ErrAuthExpired means the authentication of the connection expired
+	// before it was refreshed, see ContextWithAuthExpiry
+	ErrAuthExpired = errors.New("authentication expired")
+)
+
+// HandleRefresh lets clients refresh the authentication of their connection,
+// e.g. with a new token once theirs is about to expire, by sending a
+// connection_refresh message once it's acknowledged. Its payload is handled by
+// fn like a connection_init payload by the InitHandler: the context it returns
+// is the one the operations started from then on run with and the client is
+// sent connection_refreshed. If it returns an error the client is sent a
+// connection_error with it and the connection is closed with
+// ErrRefreshRejected, ending its operations.
+func HandleRefresh(fn InitHandler) Option {
+	return func(conn *connection) {
+		conn.onRefresh = fn
+	}
+}
+
+// ContextWithAuthExpiry returns a copy of ctx telling the connection its
+// authentication expires at t, it's meant to be returned by the InitHandler
+// or the refresh handler. Unless refreshed by then, see HandleRefresh, the
+// connection is closed with ErrAuthExpired and the 4403 close code, ending its
+// operations.
+func ContextWithAuthExpiry(ctx context.Context, t time.Time) context.Context {
+	return context.WithValue(ctx, authExpiryKey, t)
+}
+
+// handleRefresh handles a connection_refresh message, it returns false when
+// the connection should be terminated
+func (conn *connection) handleRefresh(ctx context.Context, sendMessage sendMessageFunc, msg operationMessage) bool {
+	if atomic.LoadInt32(&conn.acked) == 0 {
+		sendMessage.send("", typeConnectionError, errPayload(errNotInitialized))
+		return true
+	}
+
+	refreshCtx, err := conn.onRefresh(ctx, msg.Payload)
+	if err != nil {
+		conn.initErr = wrapCloseReason(ErrRefreshRejected, err)
+		sendMessage(&operationMessage{
+			Type:    typeConnectionError,
+			Payload: errPayload(err),
+			delivered: func() {
+				conn.setCloseReason(conn.initErr)
+				conn.close()
+			},
+		})
+		return true
+	}
+
+	conn.initCtx = refreshCtx
+	conn.armAuthExpiry(refreshCtx)
+	conn.log(ctx, slog.LevelDebug, "refresh", "")
+	sendMessage.send("", typeConnectionRefreshed, nil)
+	return true
+}
+
+// armAuthExpiry closes the connection once the authentication of ctx expires,
+// replacing the timer of a previous connection_init or connection_refresh
+func (conn *connection) armAuthExpiry(ctx context.Context) {
+	if conn.authExpiry != nil {
+		conn.authExpiry()
+		conn.authExpiry = nil
+	}
+	expiry, ok := ctx.Value(authExpiryKey).(time.Time)
+	if !ok {
+		return
+	}
+
+	stop := make(chan struct{})
+	timer := conn.clock.NewTimer(expiry.Sub(conn.clock.Now()))
+	conn.authExpiry = func() {
+		timer.Stop()
+		close(stop)
+	}
+	conn.spawn(func() {
+		defer timer.Stop()
+		select {
+		case <-timer.C():
+			// the authentication may have been refreshed as the timer
+			// fired
+			select {
+			case <-stop:
+			default:
+				conn.closeWithText(int(CloseForbidden), "Authentication expired", ErrAuthExpired)
+			}
+		case <-stop:
+		case <-conn.ctx.Done():
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package connection_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestRefresh(t *testing.T) {
+	for name, tc := range map[string]struct {
+		refresh  string
+		expected []string
+		reason   error
+	}{
+		"expired": {
+			reason: connection.ErrAuthExpired,
+		},
+		"refreshed": {
+			refresh:  `{"type":"connection_refresh","payload":{"token":"fresh"}}`,
+			expected: []string{`{"type":"connection_refreshed"}`},
+			reason:   connection.ErrAuthExpired,
+		},
+		"rejected": {
+			refresh:  `{"type":"connection_refresh","payload":{"token":"expired"}}`,
+			expected: []string{`{"type":"connection_error","payload":{"message":"invalid token"}}`},
+			reason:   connection.ErrRefreshRejected,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			clock := graphqlwstest.NewFakeClock(time.Now())
+			authenticate := func(ctx context.Context, payload json.RawMessage) (context.Context, error) {
+				var p struct {
+					Token string `json:"token"`
+				}
+				json.Unmarshal(payload, &p)
+				if p.Token == "expired" {
+					return nil, errInvalidToken
+				}
+				return connection.ContextWithAuthExpiry(ctx, clock.Now().Add(time.Minute)), nil
+			}
+			o := make(reasonObserver, 1)
+			ws := newConnection()
+			go connection.Connect(ws, newGQLService(), context.Background(),
+				connection.UseClock(clock),
+				connection.HandleInit(authenticate),
+				connection.HandleRefresh(authenticate),
+				connection.Observe(o),
+			)
+
+			ws.in <- []byte(`{"type":"connection_init","payload":{"token":"fresh"}}`)
+			requireEqualJSON(t, connectionACK, <-ws.out)
+			clock.BlockUntil(1)
+			if tc.refresh != "" {
+				clock.Advance(30 * time.Second)
+				ws.in <- []byte(tc.refresh)
+				for _, e := range tc.expected {
+					requireEqualJSON(t, e, <-ws.out)
+				}
+			}
+			if tc.reason == connection.ErrAuthExpired {
+				// the connection is kept until its authentication,
+				// refreshed or not, expires
+				clock.Advance(30 * time.Second)
+				select {
+				case got := <-o:
+					t.Fatalf("expected the connection to be kept but instead it was closed with %v", got)
+				case <-time.After(50 * time.Millisecond):
+				}
+				clock.Advance(time.Minute)
+			}
+
+			select {
+			case got := <-o:
+				if !errors.Is(got, tc.reason) {
+					t.Fatalf("expected %v but instead got %v", tc.reason, got)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("expected the connection to be closed")
+			}
+		})
+	}
+}
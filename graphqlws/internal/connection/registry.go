@@ -0,0 +1,113 @@
+package connection
+
+import "sync"
+
+// registryShards is the number of shards of an operation registry, so that
+// lookups for connections running hundreds of operations don't all contend on
+// a single mutex
+const registryShards = 16
+
+// registry holds the running operations of a connection by ID, it's safe for
+// concurrent use.
+type registry struct {
+	shards [registryShards]registryShard
+}
+
+type registryShard struct {
+	mu  sync.Mutex
+	ops map[string]*operation
+}
+
+func (r *registry) shard(id string) *registryShard {
+	// FNV-1a
+	h := uint32(2166136261)
+	for i := 0; i < len(id); i++ {
+		h ^= uint32(id[i])
+		h *= 16777619
+	}
+	return &r.shards[h%registryShards]
+}
+
+func (r *registry) store(op *operation) {
+	s := r.shard(op.id)
+	s.mu.Lock()
+	if s.ops == nil {
+		s.ops = map[string]*operation{}
+	}
+	s.ops[op.id] = op
+	s.mu.Unlock()
+}
+
+func (r *registry) load(id string) (*operation, bool) {
+	s := r.shard(id)
+	s.mu.Lock()
+	op, ok := s.ops[id]
+	s.mu.Unlock()
+	return op, ok
+}
+
+func (r *registry) loadAndDelete(id string) (*operation, bool) {
+	s := r.shard(id)
+	s.mu.Lock()
+	op, ok := s.ops[id]
+	if ok {
+		delete(s.ops, id)
+	}
+	s.mu.Unlock()
+	return op, ok
+}
+
+// remove deletes op, unless another operation has been stored with its ID since
+func (r *registry) remove(op *operation) {
+	s := r.shard(op.id)
+	s.mu.Lock()
+	if s.ops[op.id] == op {
+		delete(s.ops, op.id)
+	}
+	s.mu.Unlock()
+}
+
+// removeAll deletes and returns all the operations
+func (r *registry) removeAll() []*operation {
+	var ops []*operation
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.mu.Lock()
+		for id, op := range s.ops {
+			ops = append(ops, op)
+			delete(s.ops, id)
+		}
+		s.mu.Unlock()
+	}
+	return ops
+}
+
+// each calls fn for every operation, without holding any lock
+func (r *registry) each(fn func(op *operation)) {
+	var ops []*operation
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.mu.Lock()
+		ops = ops[:0]
+		for _, op := range s.ops {
+			ops = append(ops, op)
+		}
+		s.mu.Unlock()
+
+		for _, op := range ops {
+			fn(op)
+		}
+	}
+}
+
+// len returns the number of operations
+func (r *registry) len() int {
+	n := 0
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.mu.Lock()
+		n += len(s.ops)
+		s.mu.Unlock()
+	}
+	return n
+}
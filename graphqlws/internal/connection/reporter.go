@@ -0,0 +1,73 @@
+package connection
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+)
+
+// ErrorReporter is notified of panics and of errors that can't be reported to
+// the client, e.g. malformed frames or payloads that can't be marshaled.
+type ErrorReporter interface {
+	// ReportError is passed the context of the connection, or the context and
+	// id of the operation the error occurred for. Panics are reported as a
+	// *PanicError while the panicking goroutine is still unwinding, and then
+	// resumed.
+	ReportError(ctx context.Context, operationID string, err error)
+}
+
+// PanicError is a panic recovered from a service call, a handler or hook
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// ReportErrors sets the ErrorReporter of the connection
+func ReportErrors(r ErrorReporter) Option {
+	return func(conn *connection) {
+		conn.errorReporter = r
+	}
+}
+
+func (conn *connection) reportError(ctx context.Context, operationID string, err error) {
+	conn.log(ctx, slog.LevelError, "error", operationID, "error", err.Error())
+	if conn.errorReporter != nil {
+		conn.errorReporter.ReportError(ctx, operationID, err)
+	}
+}
+
+// recoverPanic is deferred by the goroutines of the connection to report
+// panics to the ErrorReporter. Unless they're recovered, see OnPanic, panics
+// are then resumed with a *PanicError so that they're only reported once on
+// their way up. Recovered panics are passed to the PanicHandler, if any, and
+// then to recovered, which cleans up after the goroutine.
+func (conn *connection) recoverPanic(ctx context.Context, operationID string, recovered func()) {
+	if conn.errorReporter == nil && !conn.recoversPanics() {
+		return
+	}
+
+	r := recover()
+	if r == nil {
+		return
+	}
+	err, ok := r.(*PanicError)
+	if !ok {
+		err = &PanicError{Value: r, Stack: debug.Stack()}
+		if conn.errorReporter != nil {
+			conn.errorReporter.ReportError(ctx, operationID, err)
+		}
+	}
+	if !conn.recoversPanics() {
+		panic(err)
+	}
+
+	if conn.onPanic != nil {
+		conn.onPanic(ctx, operationID, err)
+	}
+	recovered()
+}
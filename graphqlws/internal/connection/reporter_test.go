@@ -0,0 +1,84 @@
+package connection_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+type report struct {
+	operationID string
+	err         error
+}
+
+type recordingReporter chan report
+
+func (r recordingReporter) ReportError(ctx context.Context, operationID string, err error) {
+	r <- report{operationID: operationID, err: err}
+}
+
+type panickingService struct{}
+
+func (panickingService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	panic("subscribe")
+}
+
+func (panickingService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+func TestReportErrorsMalformedFrame(t *testing.T) {
+	r := make(recordingReporter, 1)
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(), context.Background(), connection.ReportErrors(r))
+	ws.in <- []byte(`{"type":`)
+
+	select {
+	case got := <-r:
+		if got.operationID != "" || got.err == nil {
+			t.Fatalf("unexpected report %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected an error to be reported")
+	}
+}
+
+func TestReportErrorsPanic(t *testing.T) {
+	r := make(recordingReporter, 2)
+	ws := newConnection()
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() { panicked <- recover() }()
+		connection.Connect(ws, panickingService{}, context.Background(), connection.ReportErrors(r))
+	}()
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a-id","type":"start","payload":{}}`},
+	})
+
+	var pe *connection.PanicError
+	select {
+	case v := <-panicked:
+		err, _ := v.(error)
+		if !errors.As(err, &pe) || pe.Value != "subscribe" {
+			t.Fatalf("expected the panic to be resumed but instead got %v", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a panic")
+	}
+
+	// reported once, for the operation
+	got := <-r
+	if got.operationID != "a-id" || got.err != pe {
+		t.Fatalf("unexpected report %+v", got)
+	}
+	if len(r) != 0 {
+		t.Fatalf("expected a single report but instead got %d more", len(r))
+	}
+}
@@ -0,0 +1,255 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ResultCache caches the results of queries for a short time, so that bursts
+// of identical queries, e.g. from dashboards reconnecting all at once, don't
+// all hit the service. It's shared by the connections it's passed to with
+// CacheResults: results are keyed by the normalized query, operation name and
+// variables only, unless scoped with a key function.
+type ResultCache struct {
+	ttl   time.Duration
+	scope func(ctx context.Context) string
+
+	mu        sync.Mutex
+	entries   map[string]*cacheEntry
+	lastSweep time.Time
+}
+
+// cacheEntry is the result of a query, complete once done is closed
+type cacheEntry struct {
+	done     chan struct{}
+	payloads []interface{}
+	// ok is set when payloads are the complete result of the query
+	ok      bool
+	expires time.Time
+}
+
+// NewResultCache returns a cache keeping the results of queries for ttl.
+// scope, if not nil, returns a key that results are additionally scoped by,
+// e.g. the tenant or user the query runs for when results depend on it.
+func NewResultCache(ttl time.Duration, scope func(ctx context.Context) string) *ResultCache {
+	return &ResultCache{
+		ttl:     ttl,
+		scope:   scope,
+		entries: map[string]*cacheEntry{},
+	}
+}
+
+// CacheResults makes the queries of the connection go through c. Mutations
+// and subscriptions aren't cached, nor are results including a Delivery.
+func CacheResults(c *ResultCache) Option {
+	return func(conn *connection) {
+		conn.results = c
+	}
+}
+
+// subscribe returns the cached result of the query if any, it otherwise calls
+// subscribe and caches its result once complete. Concurrent identical queries
+// wait for the result of the first one rather than calling subscribe.
+func (c *ResultCache) subscribe(ctx context.Context, clock Clock, osp startMessagePayload, subscribe func() (<-chan interface{}, error)) (<-chan interface{}, error) {
+	key, ok := c.key(ctx, osp)
+	if !ok {
+		return subscribe()
+	}
+
+	now := clock.Now()
+	c.mu.Lock()
+	e, found := c.entries[key]
+	if found && e.ok && now.After(e.expires) {
+		found = false
+	}
+	if !found {
+		c.sweep(now)
+		e = &cacheEntry{done: make(chan struct{})}
+		c.entries[key] = e
+	}
+	c.mu.Unlock()
+
+	if found {
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return nil, errOperationCancelled
+		}
+		if e.ok {
+			return replay(e.payloads), nil
+		}
+		return subscribe()
+	}
+
+	payloads, err := subscribe()
+	if err != nil {
+		c.fail(key, e)
+		return nil, err
+	}
+	return c.record(ctx, clock, key, e, payloads), nil
+}
+
+// record forwards payloads, recording them in e until they're complete
+func (c *ResultCache) record(ctx context.Context, clock Clock, key string, e *cacheEntry, payloads <-chan interface{}) <-chan interface{} {
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+		cacheable := true
+		for {
+			select {
+			case p, more := <-payloads:
+				if !more {
+					if !cacheable {
+						c.fail(key, e)
+						return
+					}
+					c.mu.Lock()
+					e.ok = true
+					e.expires = clock.Now().Add(c.ttl)
+					c.mu.Unlock()
+					close(e.done)
+					return
+				}
+				if _, ok := p.(Delivery); ok {
+					cacheable = false
+				}
+				e.payloads = append(e.payloads, p)
+
+				select {
+				case out <- p:
+				case <-ctx.Done():
+					c.fail(key, e)
+					return
+				}
+			case <-ctx.Done():
+				c.fail(key, e)
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// fail forgets the incomplete entry e, waiters then call the service
+func (c *ResultCache) fail(key string, e *cacheEntry) {
+	c.mu.Lock()
+	if c.entries[key] == e {
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+	close(e.done)
+}
+
+// sweep removes the expired entries, at most once per ttl, it's called with
+// mu held
+func (c *ResultCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < c.ttl {
+		return
+	}
+	c.lastSweep = now
+	for key, e := range c.entries {
+		if e.ok && now.After(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// key returns the cache key of the operation, false if it isn't a query
+func (c *ResultCache) key(ctx context.Context, osp startMessagePayload) (string, bool) {
+	query, ok := normalizeQuery(osp.Query)
+	if !ok {
+		return "", false
+	}
+	variables, err := json.Marshal(osp.Variables)
+	if err != nil {
+		return "", false
+	}
+
+	var scope string
+	if c.scope != nil {
+		scope = c.scope(ctx)
+	}
+	return strings.Join([]string{scope, osp.OperationName, query, string(variables)}, "\x00"), true
+}
+
+func replay(payloads []interface{}) <-chan interface{} {
+	c := make(chan interface{}, len(payloads))
+	for _, p := range payloads {
+		c <- p
+	}
+	close(c)
+	return c
+}
+
+// normalizeQuery returns the normalized query, see normalizeDocument, it
+// returns false unless query only has queries, i.e. it doesn't mention
+// mutations nor subscriptions.
+func normalizeQuery(query string) (string, bool) {
+	normalized := normalizeDocument(query)
+	for _, keyword := range []string{"mutation", "subscription"} {
+		if strings.Contains(normalized, keyword) {
+			return "", false
+		}
+	}
+	return normalized, true
+}
+
+// normalizeDocument collapses the insignificant whitespace, commas and
+// comments of document outside of strings
+func normalizeDocument(query string) string {
+	var b strings.Builder
+	// last is the last byte written
+	var last byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case ch == '#':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r' || ch == ',':
+		case ch == '"':
+			end := stringEnd(query, i)
+			b.WriteString(query[i:end])
+			i = end - 1
+			last = '"'
+		default:
+			// names must stay apart
+			if isNameByte(last) && isNameByte(ch) && !isNameByte(query[i-1]) {
+				b.WriteByte(' ')
+			}
+			b.WriteByte(ch)
+			last = ch
+		}
+	}
+
+	return b.String()
+}
+
+// stringEnd returns the index right after the string or block string starting
+// at i in query
+func stringEnd(query string, i int) int {
+	if strings.HasPrefix(query[i:], `"""`) {
+		if end := strings.Index(query[i+3:], `"""`); end >= 0 {
+			return i + 3 + end + 3
+		}
+		return len(query)
+	}
+
+	for j := i + 1; j < len(query); j++ {
+		switch query[j] {
+		case '\\':
+			j++
+		case '"':
+			return j + 1
+		}
+	}
+	return len(query)
+}
+
+func isNameByte(ch byte) bool {
+	return ch == '_' || ch >= '0' && ch <= '9' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+}
@@ -0,0 +1,72 @@
+package connection_test
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// countingService returns a result numbered after the calls to Subscribe and
+// Exec
+type countingService struct {
+	calls int32
+}
+
+func (s *countingService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	c := make(chan interface{}, 1)
+	c <- s.Exec(ctx, document, operationName, variableValues)
+	close(c)
+	return c, nil
+}
+
+func (s *countingService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	n := atomic.AddInt32(&s.calls, 1)
+	return &graphql.Response{Data: json.RawMessage(`{"n":` + strconv.Itoa(int(n)) + `}`)}
+}
+
+func TestCacheResults(t *testing.T) {
+	clock := graphqlwstest.NewFakeClock(time.Now())
+	svc := &countingService{}
+	cache := connection.NewResultCache(time.Second, nil)
+	ws := newConnection()
+	go connection.Connect(ws, svc, context.Background(), connection.UseClock(clock), connection.CacheResults(cache))
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{"query":"{ stats(range: \"1  d\") { n } }"}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"data","payload":{"data":{"n":1}}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+		// the same query, formatted differently
+		{intention: clientSends, operationMessage: `{"id":"b","type":"start","payload":{"query":"{\n  stats(range: \"1  d\") {\n    n # count\n  }\n}"}}`},
+		{intention: expectation, operationMessage: `{"id":"b","type":"data","payload":{"data":{"n":1}}}`},
+		{intention: expectation, operationMessage: `{"id":"b","type":"complete"}`},
+		// strings aren't normalized
+		{intention: clientSends, operationMessage: `{"id":"c","type":"start","payload":{"query":"{ stats(range: \"1 d\") { n } }"}}`},
+		{intention: expectation, operationMessage: `{"id":"c","type":"data","payload":{"data":{"n":2}}}`},
+		{intention: expectation, operationMessage: `{"id":"c","type":"complete"}`},
+		// subscriptions aren't cached
+		{intention: clientSends, operationMessage: `{"id":"d","type":"start","payload":{"query":"subscription { n }"}}`},
+		{intention: expectation, operationMessage: `{"id":"d","type":"data","payload":{"data":{"n":3}}}`},
+		{intention: expectation, operationMessage: `{"id":"d","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"id":"e","type":"start","payload":{"query":"subscription { n }"}}`},
+		{intention: expectation, operationMessage: `{"id":"e","type":"data","payload":{"data":{"n":4}}}`},
+		{intention: expectation, operationMessage: `{"id":"e","type":"complete"}`},
+	})
+
+	clock.Advance(2 * time.Second)
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"id":"f","type":"start","payload":{"query":"{ stats(range: \"1  d\") { n } }"}}`},
+		{intention: expectation, operationMessage: `{"id":"f","type":"data","payload":{"data":{"n":5}}}`},
+		{intention: expectation, operationMessage: `{"id":"f","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
@@ -0,0 +1,31 @@
+package connection
+
+import "context"
+
+type contextKey int
+
+const (
+	lastEventIDKey contextKey = iota
+	logFieldsKey
+	connectionKey
+	operationIDKey
+	socketIDKey
+	initPayloadKey
+	authExpiryKey
+	extensionsKey
+)
+
+// Event can be sent on the channel returned by GraphQLService.Subscribe instead
+// of a bare payload, the ID is then forwarded to the client as the eventId of
+// the data message so it can resume the stream from there after a reconnect.
+type Event struct {
+	ID      string
+	Payload interface{}
+}
+
+// LastEventIDFromContext returns the ID of the last event received by the
+// client, as sent in the lastEventId field of the start payload.
+func LastEventIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(lastEventIDKey).(string)
+	return id, ok
+}
@@ -0,0 +1,121 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// roundTrip measures the round-trip time to the client by sending it ping
+// messages it answers with pongs
+type roundTrip struct {
+	interval  time.Duration
+	onMeasure func(ctx context.Context, rtt time.Duration)
+	// enabled is set when the client opted in
+	enabled bool
+	stop    func()
+
+	mu     sync.Mutex
+	seq    int64
+	sentAt time.Time
+
+	// last is the last round-trip time measured, in nanoseconds
+	last int64
+}
+
+// pingMessagePayload is the payload of the pings sent by the server, which
+// clients echo back in their pong
+type pingMessagePayload struct {
+	Seq int64 `json:"seq"`
+}
+
+// MeasureRoundTrips lets clients opt in to round-trip time measurement with
+// "rtt": true in the connection_init payload. The server then sends them
+// {"type":"ping","payload":{"seq":n}} every interval, which they answer with
+// {"type":"pong","payload":{"seq":n}}, and the interval is confirmed in the
+// connection_ack payload. fn, if not nil, is called with each measure, e.g. to
+// record it as a metric; the last one is returned by RoundTripFromContext.
+func MeasureRoundTrips(interval time.Duration, fn func(ctx context.Context, rtt time.Duration)) Option {
+	return func(conn *connection) {
+		conn.roundTrip.interval = interval
+		conn.roundTrip.onMeasure = fn
+		conn.handlers[typePong] = conn.handlePong
+	}
+}
+
+// RoundTripFromContext returns the last round-trip time measured for the
+// connection ctx belongs to, false if there's none yet
+func RoundTripFromContext(ctx context.Context) (time.Duration, bool) {
+	conn, ok := ctx.Value(connectionKey).(*connection)
+	if !ok {
+		return 0, false
+	}
+	rtt := atomic.LoadInt64(&conn.roundTrip.last)
+	return time.Duration(rtt), rtt > 0
+}
+
+// negotiate enables the measurement if both the client and the server opted in
+func (rt *roundTrip) negotiate(requested bool) {
+	rt.enabled = requested && rt.interval > 0
+}
+
+// start sends a ping every interval until ctx is done, replacing the ticker of
+// a previous connection_init if any.
+func (rt *roundTrip) start(ctx context.Context, clock Clock, spawn func(func()), sendMessage sendMessageFunc) {
+	if rt.stop != nil {
+		rt.stop()
+		rt.stop = nil
+	}
+	if !rt.enabled {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	rt.stop = cancel
+
+	spawn(func() {
+		ticker := clock.NewTicker(rt.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+				rt.mu.Lock()
+				rt.seq++
+				rt.sentAt = clock.Now()
+				payload, _ := json.Marshal(pingMessagePayload{Seq: rt.seq})
+				rt.mu.Unlock()
+				sendMessage.send("", typePing, payload)
+			}
+		}
+	})
+}
+
+// handlePong measures the round-trip time of the last ping, earlier ones are
+// ignored
+func (conn *connection) handlePong(ctx context.Context, c Conn, id string, payload json.RawMessage) error {
+	var pong pingMessagePayload
+	if err := json.Unmarshal(payload, &pong); err != nil {
+		return nil
+	}
+
+	rt := &conn.roundTrip
+	rt.mu.Lock()
+	if pong.Seq != rt.seq || rt.sentAt.IsZero() {
+		rt.mu.Unlock()
+		return nil
+	}
+	rtt := conn.clock.Now().Sub(rt.sentAt)
+	rt.sentAt = time.Time{}
+	rt.mu.Unlock()
+
+	atomic.StoreInt64(&rt.last, int64(rtt))
+	if rt.onMeasure != nil {
+		rt.onMeasure(conn.ctx, rtt)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package connection_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestMeasureRoundTrips(t *testing.T) {
+	clock := graphqlwstest.NewFakeClock(time.Now())
+	measured := make(chan time.Duration, 1)
+	var ctx context.Context
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(), context.Background(),
+		connection.UseClock(clock),
+		connection.MeasureRoundTrips(time.Second, func(c context.Context, rtt time.Duration) {
+			ctx = c
+			measured <- rtt
+		}),
+	)
+
+	ws.in <- []byte(`{"type":"connection_init","payload":{"rtt":true}}`)
+	requireEqualJSON(t, `{"type":"connection_ack","payload":{"extensions":{"batching":true,"flowControl":true,"resume":true,"rtt":1000}}}`, <-ws.out)
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	requireEqualJSON(t, `{"type":"ping","payload":{"seq":1}}`, <-ws.out)
+
+	clock.Advance(40 * time.Millisecond)
+	ws.in <- []byte(`{"type":"pong","payload":{"seq":1}}`)
+	if rtt := <-measured; rtt != 40*time.Millisecond {
+		t.Fatalf("expected a round trip of 40ms but instead got %s", rtt)
+	}
+	if rtt, ok := connection.RoundTripFromContext(ctx); !ok || rtt != 40*time.Millisecond {
+		t.Fatalf("expected the context to carry a round trip of 40ms but instead got %s", rtt)
+	}
+
+	ws.in <- []byte(`{"type":"connection_terminate"}`)
+}
+
+func TestMeasureRoundTripsNotRequested(t *testing.T) {
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(), context.Background(), connection.MeasureRoundTrips(time.Millisecond, nil))
+
+	ws.in <- []byte(`{"type":"connection_init","payload":{}}`)
+	requireEqualJSON(t, connectionACK, <-ws.out)
+	ws.in <- []byte(`{"type":"connection_terminate"}`)
+}
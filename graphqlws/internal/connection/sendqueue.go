@@ -0,0 +1,82 @@
+package connection
+
+import (
+	"context"
+	"errors"
+)
+
+// OverflowPolicy is what happens to the data messages of an operation sent
+// while its outgoing queue is full, see SendQueue
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the operation until the queue has room, the
+	// default
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest data message queued to make room
+	OverflowDropOldest
+	// OverflowDropNewest drops the data message sent
+	OverflowDropNewest
+	// OverflowClose closes the connection with ErrQueueOverflow
+	OverflowClose
+)
+
+// ErrQueueOverflow means an operation sent a data message while its outgoing
+// queue was full under OverflowClose, i.e. the client didn't read fast enough
+var ErrQueueOverflow = errors.New("outgoing queue overflow")
+
+// closeTryAgainLater is the close code of connections closed because the
+// server is overloaded
+const closeTryAgainLater = 1013
+
+// SendQueue sets how many messages each operation may have queued for the
+// client and what happens to data messages sent while its queue is full, so
+// that a client not reading fast enough doesn't hold up the operations
+// producing them. Other messages, e.g. errors and completions, always block
+// until the queue has room.
+func SendQueue(capacity int, policy OverflowPolicy) Option {
+	return func(conn *connection) {
+		conn.queueSize = capacity
+		conn.overflow = policy
+	}
+}
+
+// QueueObserver is implemented by Observers also notified of the depth of
+// the outgoing queue of connections, see SendQueue
+type QueueObserver interface {
+	// Queued is passed the context of the connection and how many messages
+	// it has queued once a message is queued
+	Queued(ctx context.Context, depth int)
+	// Dropped is passed the context of the connection and the message
+	// dropped because its queue was full
+	Dropped(ctx context.Context, info MessageInfo)
+}
+
+func (conn *connection) newOutbox() *outbox {
+	capacity := conn.queueSize
+	if capacity <= 0 {
+		capacity = outboxCapacity
+	}
+	return newOutbox(capacity, conn.overflow)
+}
+
+// queued handles the outcome of queueing a message
+func (conn *connection) queued(dropped *operationMessage, depth int) {
+	for _, o := range conn.queueObs {
+		o.Queued(conn.ctx, depth)
+	}
+	if dropped == nil {
+		return
+	}
+
+	if len(conn.queueObs) > 0 {
+		info := MessageInfo{Sent: true, Type: string(dropped.Type), ID: dropped.ID, PayloadSize: len(dropped.Payload)}
+		for _, o := range conn.queueObs {
+			o.Dropped(conn.ctx, info)
+		}
+	}
+	releaseMessage(dropped)
+	if conn.overflow == OverflowClose {
+		conn.closeWithCode(closeTryAgainLater, ErrQueueOverflow)
+	}
+}
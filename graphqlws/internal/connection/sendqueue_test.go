@@ -0,0 +1,73 @@
+package connection_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// stalledConnection is a wsConnection whose client stops reading the messages
+// written after the first one
+type stalledConnection struct {
+	in     chan json.RawMessage
+	closed chan struct{}
+	writes int32
+}
+
+func (ws *stalledConnection) ReadMessage() (int, []byte, error) {
+	select {
+	case msg := <-ws.in:
+		return 1, msg, nil
+	case <-ws.closed:
+		return 0, nil, errors.New("closed")
+	}
+}
+
+func (ws *stalledConnection) WriteMessage(messageType int, data []byte) error {
+	if atomic.AddInt32(&ws.writes, 1) == 1 {
+		return nil
+	}
+	<-ws.closed
+	return errors.New("closed")
+}
+
+func (ws *stalledConnection) SetReadLimit(limit int64) {}
+
+func (ws *stalledConnection) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (ws *stalledConnection) Close() error {
+	close(ws.closed)
+	return nil
+}
+
+func TestSendQueueOverflowClose(t *testing.T) {
+	o := make(reasonObserver, 1)
+	ws := &stalledConnection{in: make(chan json.RawMessage), closed: make(chan struct{})}
+	payloads := make([]string, 10)
+	for i := range payloads {
+		payloads[i] = `{"data":"tick"}`
+	}
+	go connection.Connect(ws, newGQLService(payloads...), context.Background(),
+		connection.SendQueue(1, connection.OverflowClose),
+		connection.Observe(o),
+	)
+
+	ws.in <- json.RawMessage(`{"type":"connection_init","payload":{}}`)
+	ws.in <- json.RawMessage(`{"id":"a","type":"start","payload":{}}`)
+
+	select {
+	case got := <-o:
+		if !errors.Is(got, connection.ErrQueueOverflow) {
+			t.Fatalf("expected %v but instead got %v", connection.ErrQueueOverflow, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the connection to be closed")
+	}
+}
@@ -0,0 +1,238 @@
+package connection
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultSessionTTL is how long sessions are kept by default once saved, see
+// SessionTTL
+const DefaultSessionTTL = 5 * time.Minute
+
+// SubscriptionStore persists the sessions of connections, i.e. their running
+// operations and resume positions, so that clients reconnecting after a
+// restart of the server have them restored. Sessions aren't deleted when
+// clients never come back, stores should expire them once past their
+// ExpiresAt, see MemorySubscriptionStore.
+type SubscriptionStore interface {
+	SaveSession(ctx context.Context, token string, s Session) error
+	// LoadSession returns the session saved with token, false if there's none
+	LoadSession(ctx context.Context, token string) (s Session, ok bool, err error)
+	DeleteSession(ctx context.Context, token string) error
+}
+
+// Session is the state of a connection saved in a SubscriptionStore
+type Session struct {
+	Operations []SessionOperation `json:"operations"`
+	// ExpiresAt is when the session is no longer restored
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// SessionOperation is an operation of a Session, along with the ID of the
+// last event sent to the client if the service sends Event values
+type SessionOperation struct {
+	ID            string                 `json:"id"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	LastEventID   string                 `json:"lastEventId,omitempty"`
+}
+
+// PersistSessions lets clients opt in to sessions with "session": true in the
+// connection_init payload, the token of their session is then confirmed in
+// the connection_ack payload. Unless the client terminates it, the session is
+// saved to store when the connection is closed, e.g. because the server shuts
+// down, and restored when the client reconnects with the token as
+// "sessionToken" in the connection_init payload: its operations are started
+// again, with the ID of their last event as lastEventId.
+func PersistSessions(store SubscriptionStore) Option {
+	return func(conn *connection) {
+		conn.session.store = store
+	}
+}
+
+// SessionTTL sets how long sessions are restored once saved, by default
+// DefaultSessionTTL, clients reconnecting later are given a new session
+func SessionTTL(d time.Duration) Option {
+	return func(conn *connection) {
+		conn.session.ttl = d
+	}
+}
+
+// session tracks the operations of a connection persisting its session
+type session struct {
+	store SubscriptionStore
+	ttl   time.Duration
+
+	mu    sync.Mutex
+	token string
+	ops   map[string]*SessionOperation
+}
+
+// open starts the session requested by the client at now, restoring the one
+// saved with token if any and not expired. It returns the operations to start
+// again.
+func (s *session) open(ctx context.Context, requested bool, token string, now time.Time) (restored []SessionOperation, err error) {
+	if s.store == nil || (!requested && token == "") || s.currentToken() != "" {
+		return nil, nil
+	}
+
+	if token != "" {
+		var saved Session
+		var ok bool
+		if saved, ok, err = s.store.LoadSession(ctx, token); ok {
+			if ok = !saved.expired(now); ok {
+				restored = saved.Operations
+			}
+			err = s.store.DeleteSession(ctx, token)
+		}
+		if !ok {
+			token = ""
+		}
+	}
+	if token == "" {
+		token = newSessionToken()
+	}
+
+	s.mu.Lock()
+	s.token = token
+	s.ops = map[string]*SessionOperation{}
+	s.mu.Unlock()
+	return restored, err
+}
+
+func (s *session) currentToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token
+}
+
+func newSessionToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// add records the operation id started with osp
+func (s *session) add(id string, osp startMessagePayload) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ops != nil {
+		s.ops[id] = &SessionOperation{
+			ID:            id,
+			OperationName: osp.OperationName,
+			Query:         osp.Query,
+			Variables:     osp.Variables,
+			LastEventID:   osp.LastEventID,
+		}
+	}
+}
+
+// advance records eventID as the last event sent for the operation id
+func (s *session) advance(id string, eventID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if op, ok := s.ops[id]; ok {
+		op.LastEventID = eventID
+	}
+}
+
+// remove forgets the operation id, once it's stopped or complete
+func (s *session) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.ops, id)
+}
+
+// save saves the session once the connection is closed for reason at now,
+// unless the client terminated it
+func (s *session) save(ctx context.Context, reason error, now time.Time) error {
+	ttl := s.ttl
+	if ttl <= 0 {
+		ttl = DefaultSessionTTL
+	}
+
+	s.mu.Lock()
+	token := s.token
+	saved := Session{Operations: make([]SessionOperation, 0, len(s.ops)), ExpiresAt: now.Add(ttl)}
+	for _, op := range s.ops {
+		saved.Operations = append(saved.Operations, *op)
+	}
+	s.mu.Unlock()
+
+	switch {
+	case token == "":
+		return nil
+	case errors.Is(reason, ErrClientTerminated):
+		return s.store.DeleteSession(ctx, token)
+	}
+	sort.Slice(saved.Operations, func(i, j int) bool {
+		return saved.Operations[i].ID < saved.Operations[j].ID
+	})
+	return s.store.SaveSession(ctx, token, saved)
+}
+
+func (s Session) expired(now time.Time) bool {
+	return !s.ExpiresAt.IsZero() && !now.Before(s.ExpiresAt)
+}
+
+// MemorySubscriptionStore is a SubscriptionStore keeping the sessions in
+// memory, e.g. for tests or single instances surviving only reconnections.
+// Expired sessions are dropped as new ones are saved.
+type MemorySubscriptionStore struct {
+	mu       sync.Mutex
+	sessions map[string]Session
+	// order holds the tokens of the sessions in the order they were saved,
+	// possibly more than once or after being deleted
+	order []string
+}
+
+// NewMemorySubscriptionStore returns an empty MemorySubscriptionStore
+func NewMemorySubscriptionStore() *MemorySubscriptionStore {
+	return &MemorySubscriptionStore{sessions: map[string]Session{}}
+}
+
+// SaveSession implements SubscriptionStore
+func (s *MemorySubscriptionStore) SaveSession(ctx context.Context, token string, session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[token] = session
+	s.order = append(s.order, token)
+
+	// sessions saved last are expected to expire last
+	now := time.Now()
+	for len(s.order) > 0 {
+		oldest, ok := s.sessions[s.order[0]]
+		if ok && !oldest.expired(now) {
+			break
+		}
+		delete(s.sessions, s.order[0])
+		s.order[0] = ""
+		s.order = s.order[1:]
+	}
+	return nil
+}
+
+// LoadSession implements SubscriptionStore
+func (s *MemorySubscriptionStore) LoadSession(ctx context.Context, token string) (Session, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[token]
+	if ok && session.expired(time.Now()) {
+		return Session{}, false, nil
+	}
+	return session, ok, nil
+}
+
+// DeleteSession implements SubscriptionStore
+func (s *MemorySubscriptionStore) DeleteSession(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, token)
+	return nil
+}
@@ -0,0 +1,199 @@
+package connection_test
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+type memoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]connection.Session
+	saved    chan string
+}
+
+func (s *memoryStore) SaveSession(ctx context.Context, token string, session connection.Session) error {
+	s.mu.Lock()
+	s.sessions[token] = session
+	s.mu.Unlock()
+	s.saved <- token
+	return nil
+}
+
+func (s *memoryStore) LoadSession(ctx context.Context, token string) (connection.Session, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.sessions[token]
+	return session, ok, nil
+}
+
+func (s *memoryStore) DeleteSession(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, token)
+	return nil
+}
+
+// eventService sends an event and keeps the operation running, recording the
+// lastEventId operations are started with
+type eventService chan string
+
+func (s eventService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	lastEventID, _ := connection.LastEventIDFromContext(ctx)
+	s <- lastEventID
+
+	c := make(chan interface{}, 1)
+	c <- connection.Event{ID: "e1", Payload: json.RawMessage(`{"data":{}}`)}
+	return c, nil
+}
+
+func (s eventService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+func TestPersistSessions(t *testing.T) {
+	store := &memoryStore{sessions: map[string]connection.Session{}, saved: make(chan string, 1)}
+	svc := make(eventService, 1)
+
+	ctx, shutdown := context.WithCancel(context.Background())
+	ws := newConnection()
+	go connection.Connect(ws, svc, ctx, connection.PersistSessions(store))
+
+	ws.in <- []byte(`{"type":"connection_init","payload":{"session":true}}`)
+	var ack struct {
+		Payload struct {
+			Extensions struct {
+				Session string `json:"session"`
+			} `json:"extensions"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(<-ws.out, &ack); err != nil || ack.Payload.Extensions.Session == "" {
+		t.Fatalf("expected a session token in the ack but instead got %v", err)
+	}
+	token := ack.Payload.Extensions.Session
+
+	ws.in <- []byte(`{"id":"a","type":"start","payload":{"query":"subscription { events }"}}`)
+	<-svc
+	requireEqualJSON(t, `{"id":"a","type":"data","eventId":"e1","payload":{"data":{}}}`, <-ws.out)
+
+	shutdown()
+	select {
+	case saved := <-store.saved:
+		if saved != token {
+			t.Fatalf("expected the session %s to be saved but instead got %s", token, saved)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the session to be saved")
+	}
+
+	ws = newConnection()
+	go connection.Connect(ws, svc, context.Background(), connection.PersistSessions(store))
+	ws.in <- []byte(`{"type":"connection_init","payload":{"sessionToken":"` + token + `"}}`)
+	requireEqualJSON(t, `{"type":"connection_ack","payload":{"extensions":{"batching":true,"flowControl":true,"resume":true,"session":"`+token+`"}}}`, <-ws.out)
+	if lastEventID := <-svc; lastEventID != "e1" {
+		t.Fatalf("expected the operation to be restored after e1 but instead got %q", lastEventID)
+	}
+	requireEqualJSON(t, `{"id":"a","type":"data","eventId":"e1","payload":{"data":{}}}`, <-ws.out)
+
+	ws.in <- []byte(`{"type":"connection_terminate"}`)
+	<-ws.out
+	if _, ok, _ := store.LoadSession(context.Background(), token); ok {
+		t.Fatal("expected the terminated session to be deleted")
+	}
+}
+
+func TestSessionTTL(t *testing.T) {
+	store := &memoryStore{sessions: map[string]connection.Session{}, saved: make(chan string, 1)}
+	svc := make(eventService, 1)
+
+	ctx, shutdown := context.WithCancel(context.Background())
+	ws := newConnection()
+	go connection.Connect(ws, svc, ctx, connection.PersistSessions(store), connection.SessionTTL(time.Nanosecond))
+	ws.in <- []byte(`{"type":"connection_init","payload":{"session":true}}`)
+	<-ws.out
+	ws.in <- []byte(`{"id":"a","type":"start","payload":{"query":"subscription { events }"}}`)
+	<-svc
+	<-ws.out
+	shutdown()
+	token := <-store.saved
+
+	// the session expired, a new one is started without the operation
+	ws = newConnection()
+	go connection.Connect(ws, svc, context.Background(), connection.PersistSessions(store))
+	ws.in <- []byte(`{"type":"connection_init","payload":{"sessionToken":"` + token + `"}}`)
+	var ack struct {
+		Payload struct {
+			Extensions struct {
+				Session string `json:"session"`
+			} `json:"extensions"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(<-ws.out, &ack); err != nil || ack.Payload.Extensions.Session == token || ack.Payload.Extensions.Session == "" {
+		t.Fatalf("expected a new session token in the ack but instead got %q", ack.Payload.Extensions.Session)
+	}
+	if _, ok, _ := store.LoadSession(context.Background(), token); ok {
+		t.Fatal("expected the expired session to be deleted")
+	}
+	ws.in <- []byte(`{"type":"connection_terminate"}`)
+	for range ws.out {
+	}
+	select {
+	case lastEventID := <-svc:
+		t.Fatalf("expected no operation to be restored but instead got one after %q", lastEventID)
+	default:
+	}
+}
+
+func TestMemorySubscriptionStore(t *testing.T) {
+	ctx := context.Background()
+	store := connection.NewMemorySubscriptionStore()
+	live := connection.Session{Operations: []connection.SessionOperation{{ID: "a"}}, ExpiresAt: time.Now().Add(time.Hour)}
+	store.SaveSession(ctx, "expired", connection.Session{ExpiresAt: time.Now().Add(-time.Second)})
+	store.SaveSession(ctx, "live", live)
+
+	if _, ok, _ := store.LoadSession(ctx, "expired"); ok {
+		t.Fatal("expected the expired session not to be loaded")
+	}
+	if got, ok, _ := store.LoadSession(ctx, "live"); !ok || got.Operations[0].ID != "a" {
+		t.Fatalf("expected the live session but instead got %+v", got)
+	}
+	store.DeleteSession(ctx, "live")
+	if _, ok, _ := store.LoadSession(ctx, "live"); ok {
+		t.Fatal("expected the deleted session not to be loaded")
+	}
+}
+
+func TestPersistSessionsIntercepted(t *testing.T) {
+	store := &memoryStore{sessions: map[string]connection.Session{
+		"t": {Operations: []connection.SessionOperation{{ID: "a", Query: "subscription { events }", LastEventID: "e1"}}, ExpiresAt: time.Now().Add(time.Hour)},
+	}, saved: make(chan string, 1)}
+	svc := make(eventService, 1)
+	intercepted := make(chan string, 1)
+
+	ws := newConnection()
+	go connection.Connect(ws, svc, context.Background(), connection.PersistSessions(store), connection.Intercept(connection.Interceptor{
+		OnOperation: func(ctx context.Context, op *connection.OperationInfo) error {
+			intercepted <- op.ID
+			return nil
+		},
+	}))
+	ws.in <- []byte(`{"type":"connection_init","payload":{"sessionToken":"t"}}`)
+	<-ws.out
+	// the restored operation is started like those of the client
+	if id := <-intercepted; id != "a" {
+		t.Fatalf("expected the restored operation a to be intercepted but instead got %s", id)
+	}
+	if lastEventID := <-svc; lastEventID != "e1" {
+		t.Fatalf("expected the operation to be restored after e1 but instead got %q", lastEventID)
+	}
+	<-ws.out
+	ws.in <- []byte(`{"type":"connection_terminate"}`)
+	for range ws.out {
+	}
+}
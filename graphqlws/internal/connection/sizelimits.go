@@ -0,0 +1,57 @@
+package connection
+
+import "fmt"
+
+// envelopeSize is the room left in frames for the envelope of a message
+// whose payload has the largest size allowed by MessageSizeLimits
+const envelopeSize = 512
+
+// MessageSizeLimits limits the size in bytes of the payloads of incoming
+// messages by type, e.g. a small one for connection_init and a larger one for
+// start. Messages over the limit of their type are rejected: connection_init
+// with a connection_error, others with an error for their id, whose
+// extensions code is MESSAGE_TOO_LARGE. The read limit of frames is set to
+// fit the largest payload allowed.
+func MessageSizeLimits(limits map[string]int64) Option {
+	return func(conn *connection) {
+		conn.sizeLimits = make(map[operationMessageType]int64, len(limits))
+		var largest int64
+		for msgType, limit := range limits {
+			conn.sizeLimits[operationMessageType(msgType)] = limit
+			if limit > largest {
+				largest = limit
+			}
+		}
+		if largest > 0 {
+			conn.ws.SetReadLimit(largest + envelopeSize)
+		}
+	}
+}
+
+// checkSize returns an error if the payload of msg exceeds the limit of its
+// type
+func (conn *connection) checkSize(msg operationMessage) error {
+	limit, ok := conn.sizeLimits[msg.Type]
+	if !ok || int64(len(msg.Payload)) <= limit {
+		return nil
+	}
+	return &sizeError{msgType: msg.Type, limit: limit}
+}
+
+// sizeError is returned to clients sending a message over the limit of its
+// type
+type sizeError struct {
+	msgType operationMessageType
+	limit   int64
+}
+
+func (e *sizeError) Error() string {
+	return fmt.Sprintf("%s payload exceeds %d bytes", e.msgType, e.limit)
+}
+
+func (e *sizeError) Extensions() map[string]interface{} {
+	return map[string]interface{}{
+		"code":  "MESSAGE_TOO_LARGE",
+		"limit": e.limit,
+	}
+}
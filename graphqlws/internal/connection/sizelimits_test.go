@@ -0,0 +1,28 @@
+package connection_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+func TestMessageSizeLimits(t *testing.T) {
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(), context.Background(), connection.MessageSizeLimits(map[string]int64{
+		"connection_init": 16,
+		"start":           64,
+	}))
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{"token":"0123456789"}}`},
+		{intention: expectation, operationMessage: `{"type":"connection_error","payload":{"message":"connection_init payload exceeds 16 bytes","extensions":{"code":"MESSAGE_TOO_LARGE","limit":16}}}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{"query":"subscription { aVeryLongFieldName anotherVeryLongFieldName }"}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"error","payload":{"message":"start payload exceeds 64 bytes","extensions":{"code":"MESSAGE_TOO_LARGE","limit":64}}}`},
+		{intention: clientSends, operationMessage: `{"id":"b","type":"start","payload":{"query":"subscription { a }"}}`},
+		{intention: expectation, operationMessage: `{"id":"b","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
@@ -0,0 +1,62 @@
+package connection
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+const (
+	// closeServiceRestart is the close code of connections closed by the
+	// server, e.g. on shutdown, which clients should reconnect
+	closeServiceRestart = 1012
+	// maxCloseText is the maximum length of the text of a close frame
+	maxCloseText = 123
+)
+
+// SteeringHints tell clients where they should connect, e.g. to migrate
+// connections in a controlled way during scaling events
+type SteeringHints struct {
+	// Region is the preferred region
+	Region string `json:"region,omitempty"`
+	// Instance is the preferred instance
+	Instance string `json:"instance,omitempty"`
+	// ReconnectURL is the URL to reconnect to
+	ReconnectURL string `json:"reconnectUrl,omitempty"`
+}
+
+// Steer sets the function returning the steering hints of a connection, if
+// any, from its context. They're sent as the steering extension of the
+// connection_ack payload and, when the server closes the connection, e.g. on
+// shutdown, as the JSON text of a close frame with the 1012 (service restart)
+// close code where the transport supports close frames and the text fits.
+func Steer(fn func(ctx context.Context) *SteeringHints) Option {
+	return func(conn *connection) {
+		conn.steer = fn
+	}
+}
+
+func (conn *connection) steeringHints() *SteeringHints {
+	if conn.steer == nil {
+		return nil
+	}
+	return conn.steer(conn.ctx)
+}
+
+// writeSteeringClose sends a close frame with the steering hints of the
+// connection when it's closed by the server for reason
+func (conn *connection) writeSteeringClose(reason error) {
+	if !errors.Is(reason, context.Canceled) && !errors.Is(reason, context.DeadlineExceeded) && !errors.Is(reason, ErrServerShutdown) {
+		return
+	}
+	hints := conn.steeringHints()
+	if hints == nil {
+		return
+	}
+
+	text, err := json.Marshal(hints)
+	if err != nil || len(text) > maxCloseText {
+		text = nil
+	}
+	conn.writeClose(closeServiceRestart, string(text))
+}
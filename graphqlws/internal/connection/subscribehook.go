@@ -0,0 +1,38 @@
+package connection
+
+import "context"
+
+// SubscribeHook is called before an operation is passed to the service, e.g.
+// to enforce per-operation authorization, an allow-list of queries or
+// complexity limits. The service is called with the context it returns, if it
+// returns an error the operation fails with it instead, with the extensions of
+// errors implementing Extensions() map[string]interface{}. The extensions of
+// the start payload, if any, are returned by ExtensionsFromContext(ctx).
+type SubscribeHook func(ctx context.Context, operationID string, query string, operationName string, variables map[string]interface{}) (context.Context, error)
+
+// OnSubscribe sets the hook called before operations are passed to the
+// service
+func OnSubscribe(fn SubscribeHook) Option {
+	return func(conn *connection) {
+		conn.onSubscribe = fn
+	}
+}
+
+// checkSubscribe calls the SubscribeHook if any, it returns the context the
+// service is then called with
+func (conn *connection) checkSubscribe(ctx context.Context, operationID string, osp startMessagePayload) (context.Context, error) {
+	if conn.onSubscribe == nil {
+		return ctx, nil
+	}
+
+	hookCtx, err := ctx, error(nil)
+	if perr := conn.callService(ctx, operationID, func() {
+		hookCtx, err = conn.onSubscribe(ctx, operationID, osp.Query, osp.OperationName, osp.Variables)
+	}); perr != nil {
+		return nil, perr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return hookCtx, nil
+}
@@ -0,0 +1,66 @@
+package connection_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// forbiddenError is an error with an extensions code
+type forbiddenError struct{}
+
+func (forbiddenError) Error() string {
+	return "forbidden"
+}
+
+func (forbiddenError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": "FORBIDDEN"}
+}
+
+func TestOnSubscribe(t *testing.T) {
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(`{"data":"allowed"}`), context.Background(),
+		connection.OnSubscribe(func(ctx context.Context, operationID string, query string, operationName string, variables map[string]interface{}) (context.Context, error) {
+			if operationName == "secret" {
+				return nil, forbiddenError{}
+			}
+			return ctx, nil
+		}),
+	)
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{"query":"subscription secret { secret }","operationName":"secret"}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"error","payload":{"message":"forbidden","extensions":{"code":"FORBIDDEN"}}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"id":"b","type":"start","payload":{"query":"subscription public { public }","operationName":"public"}}`},
+		{intention: expectation, operationMessage: `{"id":"b","type":"data","payload":{"data":"allowed"}}`},
+		{intention: expectation, operationMessage: `{"id":"b","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
+
+func TestOnSubscribeExtensions(t *testing.T) {
+	ws := newConnection()
+	go connection.Connect(ws, newGQLService(`{"data":"allowed"}`), context.Background(),
+		connection.OnSubscribe(func(ctx context.Context, operationID string, query string, operationName string, variables map[string]interface{}) (context.Context, error) {
+			extensions, _ := connection.ExtensionsFromContext(ctx)
+			if extensions["client"] != "web" {
+				return nil, forbiddenError{}
+			}
+			return ctx, nil
+		}),
+	)
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{"query":"subscription { a }"}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"error","payload":{"message":"forbidden","extensions":{"code":"FORBIDDEN"}}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"id":"b","type":"start","payload":{"query":"subscription { b }","extensions":{"client":"web"}}}`},
+		{intention: expectation, operationMessage: `{"id":"b","type":"data","payload":{"data":"allowed"}}`},
+		{intention: expectation, operationMessage: `{"id":"b","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
@@ -0,0 +1,88 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrSubscribeTimeout is the error of the operations whose call to the
+// service didn't return in time, see SubscribeTimeout
+var ErrSubscribeTimeout = errors.New("subscribe timed out")
+
+// SubscribeTimeout bounds to d the calls to GraphQLService.Subscribe, or Exec
+// for queries and mutations, so that a hanging service doesn't hold
+// operations forever. Operations whose call doesn't return in time are
+// cancelled and fail with an error wrapping ErrSubscribeTimeout, whose
+// extensions code is SUBSCRIBE_TIMEOUT. Subscriptions may still wait as long
+// as needed for their events once Subscribe returned.
+func SubscribeTimeout(d time.Duration) Option {
+	return func(conn *connection) {
+		conn.subTimeout = d
+	}
+}
+
+// subscribeTimeoutError is returned to clients whose operation timed out
+type subscribeTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *subscribeTimeoutError) Error() string {
+	return ErrSubscribeTimeout.Error()
+}
+
+func (e *subscribeTimeoutError) Unwrap() error {
+	return ErrSubscribeTimeout
+}
+
+func (e *subscribeTimeoutError) Extensions() map[string]interface{} {
+	return map[string]interface{}{
+		"code":    "SUBSCRIBE_TIMEOUT",
+		"timeout": int64(e.timeout / time.Millisecond),
+	}
+}
+
+// subscribeResult is what a call to the service returned
+type subscribeResult struct {
+	c   <-chan interface{}
+	err error
+}
+
+// withSubscribeTimeout returns what call, the call to the service for the
+// operation of ctx, returns, unless it doesn't return within the subscribe
+// timeout or before ctx is done. The channel it returns late is then drained,
+// the operation being cancelled.
+func (conn *connection) withSubscribeTimeout(ctx context.Context, call func() (<-chan interface{}, error)) (<-chan interface{}, error) {
+	if conn.subTimeout <= 0 {
+		return call()
+	}
+
+	done := make(chan subscribeResult, 1)
+	conn.spawn(func() {
+		c, err := call()
+		done <- subscribeResult{c: c, err: err}
+	})
+
+	timer := conn.clock.NewTimer(conn.subTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.c, r.err
+	case <-timer.C():
+		conn.spawn(func() { drainLate(done) })
+		return nil, &subscribeTimeoutError{timeout: conn.subTimeout}
+	case <-ctx.Done():
+		conn.spawn(func() { drainLate(done) })
+		return nil, errOperationCancelled
+	}
+}
+
+// drainLate drains the channel returned by a call given up on
+func drainLate(done <-chan subscribeResult) {
+	r := <-done
+	if r.c == nil {
+		return
+	}
+	for range r.c {
+	}
+}
@@ -0,0 +1,52 @@
+package connection_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// hangingService never returns from Subscribe before its context is done
+type hangingService struct {
+	cancelled chan struct{}
+}
+
+func (s *hangingService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	<-ctx.Done()
+	close(s.cancelled)
+	return nil, ctx.Err()
+}
+
+func (s *hangingService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+func TestSubscribeTimeout(t *testing.T) {
+	clock := graphqlwstest.NewFakeClock(time.Now())
+	svc := &hangingService{cancelled: make(chan struct{})}
+	ws := newConnection()
+	go connection.Connect(ws, svc, context.Background(),
+		connection.UseClock(clock),
+		connection.SubscribeTimeout(time.Second),
+	)
+
+	ws.in <- []byte(`{"type":"connection_init","payload":{}}`)
+	requireEqualJSON(t, connectionACK, <-ws.out)
+	ws.in <- []byte(`{"id":"a","type":"start","payload":{"query":"subscription { hang }"}}`)
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	requireEqualJSON(t, `{"id":"a","type":"error","payload":{"message":"subscribe timed out","extensions":{"code":"SUBSCRIBE_TIMEOUT","timeout":1000}}}`, <-ws.out)
+	requireEqualJSON(t, `{"id":"a","type":"complete"}`, <-ws.out)
+
+	select {
+	case <-svc.cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the operation context to be cancelled")
+	}
+	ws.in <- []byte(`{"type":"connection_terminate"}`)
+}
@@ -0,0 +1,62 @@
+package connection
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// VariablesDecoder decodes the variables of the operations, data being the
+// JSON object of the start payload
+type VariablesDecoder func(data json.RawMessage) (map[string]interface{}, error)
+
+// DecodeVariables sets the decoder of the variables of the operations, which
+// by default are decoded by encoding/json, numbers then being float64s, e.g.
+// to keep 64-bit integer ids intact, see UseNumber
+func DecodeVariables(fn VariablesDecoder) Option {
+	return func(conn *connection) {
+		conn.varDecoder = fn
+	}
+}
+
+// UseNumber decodes the numbers of the variables of the operations as
+// json.Numbers, as with json.Decoder.UseNumber
+func UseNumber() Option {
+	return DecodeVariables(decodeNumbers)
+}
+
+func decodeNumbers(data json.RawMessage) (map[string]interface{}, error) {
+	var variables map[string]interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&variables); err != nil {
+		return nil, err
+	}
+	return variables, nil
+}
+
+// decodeStart decodes the payload of a start message, the variables with the
+// decoder of the connection if any
+func (conn *connection) decodeStart(payload json.RawMessage, osp *startMessagePayload) error {
+	if conn.varDecoder == nil {
+		return json.Unmarshal(payload, osp)
+	}
+
+	// the variables field shadows the one of startMessagePayload
+	var raw struct {
+		startMessagePayload
+		Variables json.RawMessage `json:"variables"`
+	}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return err
+	}
+	*osp = raw.startMessagePayload
+	if len(raw.Variables) == 0 || bytes.Equal(raw.Variables, []byte("null")) {
+		return nil
+	}
+	variables, err := conn.varDecoder(raw.Variables)
+	if err != nil {
+		return err
+	}
+	osp.Variables = variables
+	return nil
+}
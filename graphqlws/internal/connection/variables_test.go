@@ -0,0 +1,87 @@
+package connection_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// variablesService sends the variables of its subscriptions on variables
+type variablesService struct {
+	variables chan map[string]interface{}
+}
+
+func (s variablesService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	s.variables <- variableValues
+	c := make(chan interface{})
+	close(c)
+	return c, nil
+}
+
+func (variablesService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+func TestDecodeVariables(t *testing.T) {
+	for name, tc := range map[string]struct {
+		options  []connection.Option
+		payload  string
+		expected map[string]interface{}
+		err      string
+	}{
+		"default": {
+			payload:  `{"variables":{"id":9007199254740993}}`,
+			expected: map[string]interface{}{"id": float64(9007199254740992)},
+		},
+		"numbers": {
+			options:  []connection.Option{connection.UseNumber()},
+			payload:  `{"variables":{"id":9007199254740993,"ids":[1,2.5],"name":"a"}}`,
+			expected: map[string]interface{}{"id": json.Number("9007199254740993"), "ids": []interface{}{json.Number("1"), json.Number("2.5")}, "name": "a"},
+		},
+		"no variables": {
+			options: []connection.Option{connection.UseNumber()},
+			payload: `{"variables":null}`,
+		},
+		"custom decoder": {
+			options: []connection.Option{connection.DecodeVariables(func(data json.RawMessage) (map[string]interface{}, error) {
+				return map[string]interface{}{"raw": string(data)}, nil
+			})},
+			payload:  `{"variables":{"id":1}}`,
+			expected: map[string]interface{}{"raw": `{"id":1}`},
+		},
+		"decoder failure": {
+			options: []connection.Option{connection.DecodeVariables(func(data json.RawMessage) (map[string]interface{}, error) {
+				return nil, errors.New("invalid variables")
+			})},
+			payload: `{"variables":{"id":1}}`,
+			err:     `{"type":"connection_error","id":"a","payload":{"message":"invalid payload for type: start"}}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			svc := variablesService{variables: make(chan map[string]interface{}, 1)}
+			ws := newConnection()
+			go connection.Connect(ws, svc, context.Background(), tc.options...)
+
+			ws.test(t, []message{
+				{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+				{intention: expectation, operationMessage: connectionACK},
+				{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":` + tc.payload + `}`},
+			})
+			if tc.err != "" {
+				requireEqualJSON(t, tc.err, <-ws.out)
+			} else {
+				if got := <-svc.variables; !reflect.DeepEqual(got, tc.expected) {
+					t.Fatalf("expected %#v but instead got %#v", tc.expected, got)
+				}
+				requireEqualJSON(t, `{"id":"a","type":"complete"}`, <-ws.out)
+			}
+			ws.in <- []byte(`{"type":"connection_terminate"}`)
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package connection
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// ContextWriter is implemented by the transports able to abort a write when a
+// context is done, e.g. those built on nhooyr.io/websocket. The connection
+// writes to them with a context done once the write deadline is past or the
+// connection is closed, instead of calling SetWriteDeadline first.
+type ContextWriter interface {
+	WriteMessageContext(ctx context.Context, messageType int, data []byte) error
+}
+
+// writer writes the messages queued in an outbox to the transport, along with
+// the messages coalesced with them, it's only used by one goroutine at a time
+type writer struct {
+	conn  *connection
+	out   *outbox
+	batch []*operationMessage
+}
+
+// writeFrom writes msg and the messages coalesced with it, it returns false
+// if the write failed, the failure being recorded as the close reason of the
+// connection. Its context is then cancelled with that reason as its cause, so
+// that the operations learn why their client is gone.
+func (w *writer) writeFrom(ctx context.Context, msg *operationMessage) bool {
+	w.batch = w.conn.coalesce(ctx, msg, w.out, w.batch)
+	err := w.conn.write(ctx, w.batch...)
+	clear(w.batch)
+	if err != nil {
+		w.conn.setCloseReason(wrapCloseReason(ErrWriteFailed, err))
+		return false
+	}
+	return true
+}
+
+// write writes msgs in a single frame, but for the ones which went stale
+// while queued, see Delivery. The write has to be done within the write
+// timeout of the connection, and before the deadline of the messages if
+// they're due earlier.
+func (conn *connection) write(ctx context.Context, msgs ...*operationMessage) error {
+	defer func() {
+		for _, msg := range msgs {
+			releaseMessage(msg)
+		}
+	}()
+
+	now := conn.clock.Now()
+	deadline := now.Add(conn.writeTimeout)
+	stale := 0
+	for _, msg := range msgs {
+		switch {
+		case msg.deadline.IsZero():
+		case !now.Before(msg.deadline):
+			stale++
+		case msg.deadline.Before(deadline):
+			deadline = msg.deadline
+		}
+	}
+	live := msgs
+	if stale > 0 {
+		live = make([]*operationMessage, 0, len(msgs)-stale)
+		for _, msg := range msgs {
+			if !msg.deadline.IsZero() && !now.Before(msg.deadline) {
+				conn.log(ctx, slog.LevelDebug, "stale", msg.ID)
+				continue
+			}
+			live = append(live, msg)
+		}
+	}
+	if len(live) == 0 {
+		return nil
+	}
+
+	buf := writeBufferPool.Get().(*bytes.Buffer)
+	defer writeBufferPool.Put(buf)
+
+	buf.Reset()
+	if len(live) > 1 {
+		buf.WriteByte('[')
+	}
+	for i, msg := range live {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := msg.appendJSON(buf); err != nil {
+			return err
+		}
+	}
+	if len(live) > 1 {
+		buf.WriteByte(']')
+	}
+	if atomic.CompareAndSwapInt32(&conn.failWrite, 1, 0) {
+		return ErrInjectedFault
+	}
+
+	if err := conn.writeFrame(ctx, deadline.Sub(now), buf.Bytes()); err != nil {
+		return err
+	}
+	for _, msg := range live {
+		conn.logWrite(msg)
+		if len(conn.msgObservers) > 0 {
+			conn.messageObserved(conn.ctx, MessageInfo{Sent: true, Type: string(msg.Type), ID: msg.ID, PayloadSize: len(msg.Payload)})
+		}
+
+		if msg.delivered != nil {
+			msg.delivered()
+		}
+	}
+	return nil
+}
+
+// writeFrame writes data to the transport within timeout, with a context done
+// once ctx is if the transport is a ContextWriter. The timeout is measured
+// with the real clock by such transports, with the clock of the connection
+// otherwise.
+func (conn *connection) writeFrame(ctx context.Context, timeout time.Duration, data []byte) error {
+	if cw, ok := conn.ws.(ContextWriter); ok {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return cw.WriteMessageContext(ctx, textMessage, data)
+	}
+
+	if err := conn.ws.SetWriteDeadline(conn.clock.Now().Add(timeout)); err != nil {
+		return err
+	}
+	return conn.ws.WriteMessage(textMessage, data)
+}
@@ -0,0 +1,107 @@
+package connection_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// contextConnection is a wsConnection written to with a context
+type contextConnection struct {
+	*wsConnection
+	// deadlines receives whether the context of each write had a deadline
+	deadlines chan bool
+}
+
+func (ws *contextConnection) WriteMessageContext(ctx context.Context, messageType int, data []byte) error {
+	_, ok := ctx.Deadline()
+	ws.deadlines <- ok
+	return ws.WriteMessage(messageType, data)
+}
+
+func TestContextWriter(t *testing.T) {
+	ws := &contextConnection{wsConnection: newConnection(), deadlines: make(chan bool, 1)}
+	go connection.Connect(ws, newGQLService(), context.Background())
+
+	ws.in <- []byte(`{"type":"connection_init","payload":{}}`)
+	if !<-ws.deadlines {
+		t.Fatal("expected the write to have a deadline")
+	}
+	requireEqualJSON(t, connectionACK, <-ws.out)
+	ws.in <- []byte(`{"type":"connection_terminate"}`)
+}
+
+func TestDeliveryDeadline(t *testing.T) {
+	clock := graphqlwstest.NewFakeClock(time.Now())
+	ws := newConnection()
+	go connection.Connect(ws, newGQLServiceWithPayloads(
+		connection.Delivery{Payload: json.RawMessage(`{"data":{"n":1}}`), Deadline: clock.Now()},
+		connection.Delivery{Payload: json.RawMessage(`{"data":{"n":2}}`), Deadline: clock.Now().Add(time.Second)},
+	), context.Background(), connection.UseClock(clock))
+
+	ws.test(t, []message{
+		{intention: clientSends, operationMessage: `{"type":"connection_init","payload":{}}`},
+		{intention: expectation, operationMessage: connectionACK},
+		{intention: clientSends, operationMessage: `{"id":"a","type":"start","payload":{}}`},
+		// the first payload went stale before it was written
+		{intention: expectation, operationMessage: `{"id":"a","type":"data","payload":{"data":{"n":2}}}`},
+		{intention: expectation, operationMessage: `{"id":"a","type":"complete"}`},
+		{intention: clientSends, operationMessage: `{"type":"connection_terminate"}`},
+	})
+}
+
+// causeService sends payloads until its subscription's context is done, it
+// then sends the cause on causes
+type causeService struct {
+	causes chan error
+}
+
+func (s causeService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	c := make(chan interface{})
+	go func() {
+		for {
+			select {
+			case c <- json.RawMessage(`{"data":{}}`):
+			case <-ctx.Done():
+				s.causes <- context.Cause(ctx)
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+func (causeService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+func TestWriteFailureCause(t *testing.T) {
+	faults := connection.NewFaults()
+	faults.FailNextWrite("op-1")
+	svc := causeService{causes: make(chan error, 1)}
+	ws := newConnection()
+	go connection.Connect(ws, svc, context.Background(),
+		connection.GenerateIDs(graphqlwstest.SequentialIDs("op-")),
+		connection.InjectFaults(faults),
+	)
+
+	ws.in <- []byte(`{"type":"connection_init","payload":{}}`)
+	requireEqualJSON(t, connectionACK, <-ws.out)
+	ws.in <- []byte(`{"id":"a","type":"start","payload":{"query":"subscription { a }"}}`)
+
+	select {
+	case got := <-svc.causes:
+		if !errors.Is(got, connection.ErrWriteFailed) {
+			t.Fatalf("expected the subscription to learn that the write failed but instead got %v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the subscription to be cancelled")
+	}
+}
@@ -0,0 +1,143 @@
+package eventloop
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+)
+
+// wsConn adapts a gobwas/ws server side connection to the interface used by
+// the connection package.
+type wsConn struct {
+	conn      net.Conn
+	onClose   func()
+	closeOnce sync.Once
+
+	// writeMu serializes frame writes between the connection's writer and the
+	// replies to control frames sent by the reader
+	writeMu sync.Mutex
+
+	readLimit int64
+	// onPong is only accessed by the reader once set
+	onPong func(appData string) error
+}
+
+func newWSConn(conn net.Conn, onClose func()) *wsConn {
+	return &wsConn{conn: conn, onClose: onClose}
+}
+
+// readFrame reads the next data frame, handling control frames in between. It
+// returns a nil frame if there was only a control frame to read.
+func (c *wsConn) readFrame() ([]byte, error) {
+	rd := wsutil.Reader{
+		Source:       c.conn,
+		State:        ws.StateServerSide,
+		CheckUTF8:    true,
+		MaxFrameSize: c.readLimit,
+	}
+
+	hdr, err := rd.NextFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	if hdr.OpCode == ws.OpPong && c.onPong != nil {
+		appData, err := ioutil.ReadAll(&rd)
+		if err != nil {
+			return nil, err
+		}
+		return nil, c.onPong(string(appData))
+	}
+
+	if hdr.OpCode.IsControl() {
+		var reply bytes.Buffer
+		handleErr := wsutil.ControlFrameHandler(&reply, ws.StateServerSide)(hdr, &rd)
+		if reply.Len() > 0 {
+			c.writeMu.Lock()
+			_, err = c.conn.Write(reply.Bytes())
+			c.writeMu.Unlock()
+		}
+		if handleErr != nil {
+			return nil, handleErr
+		}
+		return nil, err
+	}
+
+	return ioutil.ReadAll(&rd)
+}
+
+// readFrameWithin is readFrame failing if the frame isn't read within timeout,
+// if positive
+func (c *wsConn) readFrameWithin(timeout time.Duration) ([]byte, error) {
+	if timeout <= 0 {
+		return c.readFrame()
+	}
+	if err := c.conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	frame, err := c.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	return frame, c.conn.SetReadDeadline(time.Time{})
+}
+
+func (c *wsConn) ReadMessage() (int, []byte, error) {
+	for {
+		frame, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		if frame != nil {
+			return int(ws.OpText), frame, nil
+		}
+	}
+}
+
+func (c *wsConn) WriteMessage(messageType int, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return wsutil.WriteServerMessage(c.conn, ws.OpCode(messageType), data)
+}
+
+// WriteControl writes a control frame, e.g. a ping, along with the other
+// writes
+func (c *wsConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.conn.SetWriteDeadline(deadline); err != nil {
+		return err
+	}
+	return ws.WriteFrame(c.conn, ws.NewFrame(ws.OpCode(messageType), true, data))
+}
+
+// SetPongHandler sets the handler called with the payload of the pongs read
+func (c *wsConn) SetPongHandler(h func(appData string) error) {
+	c.onPong = h
+}
+
+func (c *wsConn) SetReadLimit(limit int64) {
+	c.readLimit = limit
+}
+
+func (c *wsConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *wsConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+func (c *wsConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		c.onClose()
+		err = c.conn.Close()
+	})
+	return err
+}
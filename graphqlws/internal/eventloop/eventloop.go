@@ -0,0 +1,136 @@
+// Package eventloop serves websocket connections from an epoll/kqueue based
+// event loop instead of a read goroutine per connection, which dominates memory
+// usage with hundreds of thousands of mostly idle subscriptions.
+package eventloop
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/mailru/easygo/netpoll"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// DefaultFrameTimeout is how long a worker waits for the rest of a frame by
+// default, see Loop.SetFrameTimeout
+const DefaultFrameTimeout = 10 * time.Second
+
+// Loop polls the connections it serves and handles their incoming frames on a
+// fixed pool of workers.
+type Loop struct {
+	poller       netpoll.Poller
+	tasks        chan func()
+	frameTimeout time.Duration
+}
+
+// New starts a loop with the given number of workers, it fails on operating
+// systems without epoll or kqueue.
+func New(workers int) (*Loop, error) {
+	poller, err := netpoll.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Loop{
+		poller:       poller,
+		tasks:        make(chan func()),
+		frameTimeout: DefaultFrameTimeout,
+	}
+	for i := 0; i < workers; i++ {
+		go l.work()
+	}
+
+	return l, nil
+}
+
+// SetFrameTimeout sets how long a worker waits for the rest of a frame once
+// its first bytes arrived, the connections which don't send it in time are
+// closed so that stalled clients can't hold the workers. It applies to the
+// connections served afterwards, d <= 0 meaning no timeout.
+func (l *Loop) SetFrameTimeout(d time.Duration) {
+	l.frameTimeout = d
+}
+
+func (l *Loop) work() {
+	for task := range l.tasks {
+		task()
+	}
+}
+
+// Upgrade upgrades the HTTP request to a websocket connection speaking the
+// given subprotocol.
+func (l *Loop) Upgrade(w http.ResponseWriter, r *http.Request, subprotocol string) (net.Conn, error) {
+	upgrader := ws.HTTPUpgrader{
+		Protocol: func(p string) bool { return p == subprotocol },
+	}
+
+	conn, rw, hs, err := upgrader.Upgrade(r, w)
+	if err != nil {
+		return nil, err
+	}
+
+	// clients must wait for the handshake response before sending frames, so
+	// there should be nothing buffered that the poller wouldn't notice
+	if rw.Reader.Buffered() > 0 || hs.Protocol != subprotocol {
+		conn.Close()
+		return nil, errors.New("eventloop: invalid websocket handshake")
+	}
+
+	return conn, nil
+}
+
+// Serve registers the connection with the loop and returns immediately, its
+// frames are then handled as they arrive until it's closed.
+func (l *Loop) Serve(conn net.Conn, svc connection.GraphQLService, ctx context.Context, options ...connection.Option) error {
+	desc, err := netpoll.HandleReadOnce(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	// the callback may close the connection before Start returns, while it's
+	// still using desc
+	started := make(chan struct{})
+	wc := newWSConn(conn, func() {
+		<-started
+		l.poller.Stop(desc)
+		desc.Close()
+	})
+	handleFrame, closeWith := connection.Attach(wc, svc, ctx, options...)
+	timeout := l.frameTimeout
+
+	err = l.poller.Start(desc, func(ev netpoll.Event) {
+		if ev&(netpoll.EventReadHup|netpoll.EventHup|netpoll.EventErr) != 0 {
+			closeWith(connection.ErrClientGone)
+			return
+		}
+
+		l.tasks <- func() {
+			frame, err := wc.readFrameWithin(timeout)
+			if err != nil {
+				closeWith(fmt.Errorf("%w: %v", connection.ErrClientGone, err))
+				return
+			}
+
+			if frame != nil && !handleFrame(json.RawMessage(frame)) {
+				return
+			}
+
+			if err := l.poller.Resume(desc); err != nil {
+				closeWith(nil)
+			}
+		}
+	})
+	close(started)
+	if err != nil {
+		closeWith(nil)
+	}
+	return err
+}
@@ -0,0 +1,133 @@
+package eventloop_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/eventloop"
+)
+
+type gqlService struct{}
+
+func (gqlService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	c := make(chan interface{}, 1)
+	c <- map[string]interface{}{"data": map[string]interface{}{"hello": "world"}}
+	close(c)
+	return c, nil
+}
+
+func (gqlService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+func TestLoop(t *testing.T) {
+	l, err := eventloop.New(2)
+	if err != nil {
+		t.Skip(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := l.Upgrade(w, r, "graphql-ws")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if err := l.Serve(conn, gqlService{}, context.Background()); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+	ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	for _, msg := range []string{
+		`{"type":"connection_init","payload":{}}`,
+		`{"type":"start","id":"a-id","payload":{}}`,
+	} {
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, expected := range []string{
+		`{"payload":{"extensions":{"batching":true,"flowControl":true,"resume":true}},"type":"connection_ack"}`,
+		`{"id":"a-id","payload":{"data":{"hello":"world"}},"type":"data"}`,
+		`{"id":"a-id","type":"complete"}`,
+	} {
+		_, got, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.TrimSpace(string(got)) != expected {
+			t.Fatalf("expected [%s] but instead got [%s]", expected, got)
+		}
+	}
+}
+
+func TestLoopStalledFrame(t *testing.T) {
+	l, err := eventloop.New(1)
+	if err != nil {
+		t.Skip(err)
+	}
+	l.SetFrameTimeout(50 * time.Millisecond)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := l.Upgrade(w, r, "graphql-ws")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if err := l.Serve(conn, gqlService{}, context.Background()); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	stalled, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Close()
+	// the header of a masked text frame of 10 bytes, followed by only 2 of them
+	partial := []byte{0x81, 0x80 | 10, 1, 2, 3, 4, '{', '"'}
+	if _, err := stalled.UnderlyingConn().Write(partial); err != nil {
+		t.Fatal(err)
+	}
+
+	// the single worker is released once the stalled frame times out
+	ws, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"connection_init","payload":{}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ws.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+
+	stalled.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := stalled.ReadMessage(); err == nil {
+		t.Fatal("expected the stalled connection to be closed")
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Fatal("expected the stalled connection to be closed but instead it timed out")
+	}
+}
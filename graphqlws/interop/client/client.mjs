@@ -0,0 +1,69 @@
+// Subscribes to the Counter subscription of the server at the URL given as
+// first argument with the client library given as second argument, exiting
+// with 1 unless it gets 1, 2 and 3 and then completes.
+import WebSocket from "ws";
+import { createClient } from "graphql-ws";
+import { SubscriptionClient } from "subscriptions-transport-ws";
+
+const [url, library] = process.argv.slice(2);
+const request = { query: "subscription Counter { counter }", operationName: "Counter" };
+const expected = [1, 2, 3];
+
+function collect(values, reject) {
+  return (result) => {
+    if (result.errors) {
+      reject(new Error(JSON.stringify(result.errors)));
+      return;
+    }
+    values.push(result.data.counter);
+  };
+}
+
+// subscriptions-transport-ws speaks the graphql-ws subprotocol
+function subscriptionsTransportWs() {
+  const client = new SubscriptionClient(url, { reconnect: false }, WebSocket);
+  return new Promise((resolve, reject) => {
+    const values = [];
+    client.request(request).subscribe({
+      next: collect(values, reject),
+      error: reject,
+      complete: () => {
+        client.close();
+        resolve(values);
+      },
+    });
+  });
+}
+
+// graphql-ws speaks the graphql-transport-ws subprotocol
+function graphqlWs() {
+  const client = createClient({ url, webSocketImpl: WebSocket, retryAttempts: 0 });
+  return new Promise((resolve, reject) => {
+    const values = [];
+    client.subscribe(request, {
+      next: collect(values, reject),
+      error: reject,
+      complete: () => {
+        client.dispose();
+        resolve(values);
+      },
+    });
+  });
+}
+
+const clients = {
+  "subscriptions-transport-ws": subscriptionsTransportWs,
+  "graphql-ws": graphqlWs,
+};
+
+try {
+  const values = await clients[library]();
+  if (JSON.stringify(values) !== JSON.stringify(expected)) {
+    throw new Error(`expected ${JSON.stringify(expected)} but instead got ${JSON.stringify(values)}`);
+  }
+  console.log(`${library}: ok`);
+  process.exit(0);
+} catch (err) {
+  console.error(`${library}: ${err instanceof Error ? err.message : JSON.stringify(err)}`);
+  process.exit(1);
+}
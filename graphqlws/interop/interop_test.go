@@ -0,0 +1,50 @@
+//go:build interop
+// +build interop
+
+// Package interop runs the official JS clients against a server to catch
+// interoperability regressions. It needs docker and is only built with the
+// interop build tag, e.g. go test -tags interop ./graphqlws/interop/
+package interop_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+)
+
+type authValidator struct{}
+
+func (authValidator) CheckAuth(r *http.Request, ctx context.Context) (context.Context, error) {
+	return ctx, nil
+}
+
+func TestInterop(t *testing.T) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker is needed to run the JS clients")
+	}
+
+	svc := graphqlwstest.NewMockService().On("Counter",
+		graphqlwstest.Data(map[string]int{"counter": 1}),
+		graphqlwstest.Data(map[string]int{"counter": 2}),
+		graphqlwstest.Data(map[string]int{"counter": 3}),
+		graphqlwstest.Complete(),
+	)
+	srv := httptest.NewServer(graphqlws.NewServer(context.Background(), svc, http.NotFoundHandler(), authValidator{}))
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	for _, library := range []string{"subscriptions-transport-ws", "graphql-ws"} {
+		t.Run(library, func(t *testing.T) {
+			cmd := exec.Command("docker", "compose", "run", "--rm", "client", url, library)
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("%v\n%s", err, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package graphqlws
+
+import (
+	"context"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// Wait blocks until the connection ctx belongs to is closed and all the
+// goroutines it started have returned, e.g. for tests to check none leaks once
+// the client is gone. It returns right away if ctx doesn't belong to a
+// connection, and must not be called by the handlers of the connection
+// itself, e.g. its InitHandler, which would never return.
+func Wait(ctx context.Context) {
+	connection.Wait(ctx)
+}
+
+// OperationCount returns the number of live operations of the connection ctx
+// belongs to, see Server.OperationCount for those of all the connections
+func OperationCount(ctx context.Context) int {
+	return connection.OperationCount(ctx)
+}
@@ -0,0 +1,21 @@
+package graphqlws
+
+import (
+	"context"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// ContextWithLogFields returns a copy of ctx carrying the given key-value
+// pairs, which are meant to be included in every log line emitted for the
+// connection or operation ctx belongs to. Observers tracing connections and
+// operations use it to add the ids logs are correlated with traces by.
+func ContextWithLogFields(ctx context.Context, keyvals ...interface{}) context.Context {
+	return connection.ContextWithLogFields(ctx, keyvals...)
+}
+
+// LogFieldsFromContext returns the key-value pairs added to ctx with
+// ContextWithLogFields
+func LogFieldsFromContext(ctx context.Context) []interface{} {
+	return connection.LogFieldsFromContext(ctx)
+}
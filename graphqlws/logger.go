@@ -0,0 +1,20 @@
+package graphqlws
+
+import (
+	"log/slog"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// WithLogger makes connections log their lifecycle to l as structured events:
+// connect and close, with the reason the connection was closed for, at the
+// info level, init, start, data, stop and complete at the debug level, the
+// errors sent to clients at the info level and the errors also reported to the
+// ErrorReporter at the error level. Events carry the connection_id and
+// operation_id fields along with the log fields of the context, see
+// ContextWithLogFields.
+func WithLogger(l *slog.Logger) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.Log(l))
+	}
+}
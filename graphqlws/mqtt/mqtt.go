@@ -0,0 +1,195 @@
+//go:build mqtt
+// +build mqtt
+
+// Package mqtt bridges GraphQL subscriptions to MQTT, republishing their
+// results to MQTT topics. It's only built with the mqtt build tag, so that
+// depending on graphqlws doesn't pull in the MQTT client.
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+// Operation is a subscription whose results are published to Topic
+type Operation struct {
+	Topic         string
+	Query         string
+	OperationName string
+	Variables     map[string]interface{}
+}
+
+// Bridge runs subscriptions and publishes each of their results, a GraphQL
+// response, to the topic of the operation. Operations are either configured
+// with Publish or, if a control topic is set, started and stopped by
+// publishing start and stop operation messages to it, with the topic to
+// publish to as their id.
+type Bridge struct {
+	client  paho.Client
+	qos     byte
+	retain  bool
+	control string
+	ops     []Operation
+}
+
+// Option configures a Bridge
+type Option func(b *Bridge)
+
+// QoS sets the quality of service results are published and the control
+// topic is subscribed with, the default is 0
+func QoS(qos byte) Option {
+	return func(b *Bridge) {
+		b.qos = qos
+	}
+}
+
+// Retain publishes results as retained messages, so that clients subscribing
+// to a topic get its latest result right away
+func Retain() Option {
+	return func(b *Bridge) {
+		b.retain = true
+	}
+}
+
+// Control lets operations be started and stopped by publishing operation
+// messages to topic, e.g.
+// {"type":"start","id":"devices/42/config","payload":{"query":"subscription ..."}}
+func Control(topic string) Option {
+	return func(b *Bridge) {
+		b.control = topic
+	}
+}
+
+// Publish starts op when the bridge is served
+func Publish(op Operation) Option {
+	return func(b *Bridge) {
+		b.ops = append(b.ops, op)
+	}
+}
+
+// New returns a Bridge publishing with client, which must be connected
+func New(client paho.Client, options ...Option) *Bridge {
+	b := &Bridge{client: client}
+	for _, opt := range options {
+		opt(b)
+	}
+	return b
+}
+
+// Serve runs the operations with the service and options of s until ctx is
+// done or subscribing to the control topic fails.
+func (b *Bridge) Serve(ctx context.Context, s *graphqlws.Server) error {
+	t := &transport{
+		bridge: b,
+		in:     make(chan []byte, len(b.ops)+1),
+		closed: make(chan struct{}),
+	}
+
+	t.in <- []byte(`{"type":"connection_init","payload":{}}`)
+	for _, op := range b.ops {
+		msg, err := json.Marshal(map[string]interface{}{
+			"id":   op.Topic,
+			"type": "start",
+			"payload": map[string]interface{}{
+				"query":         op.Query,
+				"operationName": op.OperationName,
+				"variables":     op.Variables,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		t.in <- msg
+	}
+
+	if b.control != "" {
+		token := b.client.Subscribe(b.control, b.qos, func(_ paho.Client, msg paho.Message) {
+			select {
+			case t.in <- msg.Payload():
+			case <-t.closed:
+			}
+		})
+		if token.Wait(); token.Error() != nil {
+			return token.Error()
+		}
+		defer b.client.Unsubscribe(b.control)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		t.Close()
+	}()
+
+	s.Serve(ctx, t)
+	return nil
+}
+
+var errClosed = errors.New("mqtt: bridge closed")
+
+// transport feeds the operation messages of the bridge to the connection and
+// publishes the results
+type transport struct {
+	bridge        *Bridge
+	in            chan []byte
+	closed        chan struct{}
+	closeOnce     sync.Once
+	writeDeadline time.Time
+}
+
+func (t *transport) ReadMessage() (int, []byte, error) {
+	select {
+	case msg := <-t.in:
+		return 1, msg, nil
+	case <-t.closed:
+		return 0, nil, errClosed
+	}
+}
+
+func (t *transport) WriteMessage(messageType int, data []byte) error {
+	var msg struct {
+		ID      string          `json:"id"`
+		Type    string          `json:"type"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return err
+	}
+
+	var payload []byte
+	switch msg.Type {
+	case "data":
+		payload = msg.Payload
+	case "error":
+		payload, _ = json.Marshal(map[string][]json.RawMessage{"errors": {msg.Payload}})
+	default:
+		// acks, completions and keepalives aren't published
+		return nil
+	}
+
+	token := t.bridge.client.Publish(msg.ID, t.bridge.qos, t.bridge.retain, payload)
+	if !token.WaitTimeout(time.Until(t.writeDeadline)) {
+		return errors.New("mqtt: publish timed out")
+	}
+	return token.Error()
+}
+
+func (t *transport) SetReadLimit(limit int64) {}
+
+func (t *transport) SetWriteDeadline(deadline time.Time) error {
+	t.writeDeadline = deadline
+	return nil
+}
+
+func (t *transport) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	return nil
+}
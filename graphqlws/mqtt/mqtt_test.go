@@ -0,0 +1,126 @@
+//go:build mqtt
+// +build mqtt
+
+package mqtt_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/mqtt"
+)
+
+type gqlService struct{}
+
+func (gqlService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	c := make(chan interface{}, 1)
+	c <- map[string]interface{}{"data": map[string]interface{}{"operation": operationName}}
+	close(c)
+	return c, nil
+}
+
+func (gqlService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+type authValidator struct{}
+
+func (authValidator) CheckAuth(r *http.Request, ctx context.Context) (context.Context, error) {
+	return ctx, nil
+}
+
+type token struct{}
+
+func (token) Wait() bool                     { return true }
+func (token) WaitTimeout(time.Duration) bool { return true }
+func (token) Done() <-chan struct{}          { return nil }
+func (token) Error() error                   { return nil }
+
+type published struct {
+	topic   string
+	retain  bool
+	payload string
+}
+
+// fakeClient records publications and hands out the handler of the control
+// topic, the rest of paho.Client isn't used by the bridge
+type fakeClient struct {
+	paho.Client
+
+	published  chan published
+	subscribed chan paho.MessageHandler
+}
+
+func (c *fakeClient) Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token {
+	c.published <- published{topic, retained, string(payload.([]byte))}
+	return token{}
+}
+
+func (c *fakeClient) Subscribe(topic string, qos byte, callback paho.MessageHandler) paho.Token {
+	c.subscribed <- callback
+	return token{}
+}
+
+func (c *fakeClient) Unsubscribe(topics ...string) paho.Token {
+	return token{}
+}
+
+type message struct {
+	paho.Message
+	payload []byte
+}
+
+func (m message) Payload() []byte {
+	return m.payload
+}
+
+func TestBridge(t *testing.T) {
+	client := &fakeClient{
+		published:  make(chan published, 2),
+		subscribed: make(chan paho.MessageHandler, 1),
+	}
+	b := mqtt.New(client,
+		mqtt.Retain(),
+		mqtt.Control("control"),
+		mqtt.Publish(mqtt.Operation{
+			Topic:         "devices/1",
+			Query:         "subscription configured { config }",
+			OperationName: "configured",
+		}),
+	)
+	s := graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), authValidator{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- b.Serve(ctx, s)
+	}()
+
+	handler := <-client.subscribed
+	handler(client, message{payload: []byte(`{"id":"devices/2","type":"start","payload":{"query":"subscription controlled { config }","operationName":"controlled"}}`)})
+
+	got := map[string]published{}
+	for i := 0; i < 2; i++ {
+		p := <-client.published
+		got[p.topic] = p
+	}
+	for topic, expected := range map[string]string{
+		"devices/1": `{"data":{"operation":"configured"}}`,
+		"devices/2": `{"data":{"operation":"controlled"}}`,
+	} {
+		if got[topic].payload != expected || !got[topic].retain {
+			t.Errorf("expected [%s] to be retained on %s but instead got %+v", expected, topic, got[topic])
+		}
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
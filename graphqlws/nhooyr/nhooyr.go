@@ -0,0 +1,199 @@
+//go:build nhooyr
+// +build nhooyr
+
+// Package nhooyr upgrades websocket connections with nhooyr.io/websocket,
+// e.g. for its context-aware API and per-message compression, see
+// graphqlws.WithWebSocketBackend. It's only built with the nhooyr build tag,
+// so that depending on graphqlws doesn't pull in nhooyr.io/websocket.
+package nhooyr
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"nhooyr.io/websocket"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+// The websocket control message types, as in gorilla/websocket
+const (
+	closeMessage = 8
+	pingMessage  = 9
+)
+
+var errSubprotocol = errors.New("nhooyr: subprotocol not negotiated")
+
+type backend struct {
+	options websocket.AcceptOptions
+}
+
+// Backend returns a graphqlws.WebSocketBackend accepting the requests with
+// options, which may be nil, e.g. to set the CompressionMode or the
+// OriginPatterns. Its Subprotocols are ignored in favor of
+// graphqlws.WithProtocols.
+func Backend(options *websocket.AcceptOptions) graphqlws.WebSocketBackend {
+	b := &backend{}
+	if options != nil {
+		b.options = *options
+	}
+	return b
+}
+
+func (b *backend) Upgrade(w http.ResponseWriter, r *http.Request, protocol string) (graphqlws.WebSocket, error) {
+	options := b.options
+	options.Subprotocols = nil
+	if protocol != "" {
+		options.Subprotocols = []string{protocol}
+	}
+
+	c, err := websocket.Accept(w, r, &options)
+	if err != nil {
+		return nil, err
+	}
+	if c.Subprotocol() != protocol {
+		c.CloseNow()
+		return nil, errSubprotocol
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &wsConn{conn: c, ctx: ctx, cancel: cancel}, nil
+}
+
+// wsConn adapts a nhooyr.io/websocket connection to graphqlws.WebSocket, its
+// deadlines being translated to the contexts of the reads and writes
+type wsConn struct {
+	conn *websocket.Conn
+	// ctx is cancelled once the read deadline is exceeded, which closes the
+	// connection
+	ctx    context.Context
+	cancel func()
+
+	mu        sync.Mutex
+	readTimer *time.Timer
+	timedOut  bool
+	onPong    func(appData string) error
+
+	// writeDeadline is only accessed by the writer
+	writeDeadline time.Time
+}
+
+func (c *wsConn) ReadMessage() (int, []byte, error) {
+	typ, p, err := c.conn.Read(c.ctx)
+	if err != nil {
+		c.mu.Lock()
+		timedOut := c.timedOut
+		c.mu.Unlock()
+		if timedOut {
+			return 0, nil, os.ErrDeadlineExceeded
+		}
+		return 0, nil, err
+	}
+	return int(typ), p, nil
+}
+
+func (c *wsConn) WriteMessage(messageType int, data []byte) error {
+	ctx := c.ctx
+	if !c.writeDeadline.IsZero() {
+		var cancel func()
+		ctx, cancel = context.WithDeadline(ctx, c.writeDeadline)
+		defer cancel()
+	}
+	return c.conn.Write(ctx, websocket.MessageType(messageType), data)
+}
+
+// WriteMessageContext implements graphqlws.ContextWriter, the write being
+// aborted once ctx is done
+func (c *wsConn) WriteMessageContext(ctx context.Context, messageType int, data []byte) error {
+	return c.conn.Write(ctx, websocket.MessageType(messageType), data)
+}
+
+// WriteControl closes the connection with the code and reason of a close
+// frame, waiting for the close handshake until deadline, or sends a ping
+// whose pong is passed to the pong handler once received
+func (c *wsConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	switch messageType {
+	case closeMessage:
+		code, reason := websocket.StatusNoStatusRcvd, ""
+		if len(data) >= 2 {
+			code, reason = websocket.StatusCode(binary.BigEndian.Uint16(data)), string(data[2:])
+		}
+		done := make(chan error, 1)
+		go func() { done <- c.conn.Close(code, reason) }()
+
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		select {
+		case err := <-done:
+			return err
+		case <-timer.C:
+			return os.ErrDeadlineExceeded
+		}
+
+	case pingMessage:
+		// the pong is read by the reader, Ping returns once it was
+		go func() {
+			if err := c.conn.Ping(c.ctx); err != nil {
+				return
+			}
+			c.mu.Lock()
+			onPong := c.onPong
+			c.mu.Unlock()
+			if onPong != nil {
+				onPong(string(data))
+			}
+		}()
+		return nil
+	}
+	return errors.New("nhooyr: unsupported control message")
+}
+
+func (c *wsConn) SetReadLimit(limit int64) {
+	c.conn.SetReadLimit(limit)
+}
+
+// SetReadDeadline arms the timer closing the connection once t is past, the
+// pending read then failing with a timeout
+func (c *wsConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.readTimer != nil {
+		c.readTimer.Stop()
+		c.readTimer = nil
+	}
+	if !t.IsZero() {
+		c.readTimer = time.AfterFunc(time.Until(t), func() {
+			c.mu.Lock()
+			c.timedOut = true
+			c.mu.Unlock()
+			c.cancel()
+		})
+	}
+	return nil
+}
+
+func (c *wsConn) SetPongHandler(h func(appData string) error) {
+	c.mu.Lock()
+	c.onPong = h
+	c.mu.Unlock()
+}
+
+func (c *wsConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline = t
+	return nil
+}
+
+func (c *wsConn) Close() error {
+	c.mu.Lock()
+	if c.readTimer != nil {
+		c.readTimer.Stop()
+	}
+	c.mu.Unlock()
+	c.cancel()
+	return c.conn.CloseNow()
+}
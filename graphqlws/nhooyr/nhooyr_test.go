@@ -0,0 +1,173 @@
+//go:build nhooyr
+// +build nhooyr
+
+package nhooyr_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/nhooyr"
+)
+
+type gqlService struct{}
+
+func (gqlService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	c := make(chan interface{}, 1)
+	c <- map[string]interface{}{"data": map[string]interface{}{"operation": operationName}}
+	close(c)
+	return c, nil
+}
+
+func (gqlService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+// closeObserver receives the close reasons of connections
+type closeObserver chan error
+
+func (o closeObserver) ConnectionStart(ctx context.Context, info graphqlws.ConnectionInfo) context.Context {
+	return ctx
+}
+
+func (o closeObserver) ConnectionEnd(ctx context.Context) {
+	o <- graphqlws.CloseReason(ctx)
+}
+
+func (o closeObserver) OperationStart(ctx context.Context, info graphqlws.OperationInfo) context.Context {
+	return ctx
+}
+
+func (o closeObserver) OperationEnd(ctx context.Context, err error) {}
+
+func dial(t *testing.T, url string, protocol string) *websocket.Conn {
+	t.Helper()
+	dialer := websocket.Dialer{Subprotocols: []string{protocol}}
+	ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ws.Subprotocol() != protocol {
+		t.Fatalf("expected %s but instead got %s", protocol, ws.Subprotocol())
+	}
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return ws
+}
+
+func exchange(t *testing.T, ws *websocket.Conn, send string, expected ...string) {
+	t.Helper()
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(send)); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range expected {
+		_, got, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != e {
+			t.Fatalf("expected %s but instead got %s", e, got)
+		}
+	}
+}
+
+func TestBackend(t *testing.T) {
+	o := make(closeObserver, 1)
+	s := graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), nil,
+		graphqlws.WithWebSocketBackend(nhooyr.Backend(nil)),
+		graphqlws.WithObserver(o),
+	)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	t.Run("graphql-ws", func(t *testing.T) {
+		ws := dial(t, srv.URL, graphqlws.ProtocolGraphQLWS)
+		defer ws.Close()
+
+		exchange(t, ws, `{"type":"connection_init","payload":{}}`, `{"payload":{"extensions":{"batching":true,"flowControl":true,"resume":true}},"type":"connection_ack"}`)
+		exchange(t, ws, `{"id":"1","type":"start","payload":{"query":"subscription onMessage { message }","operationName":"onMessage"}}`,
+			`{"id":"1","payload":{"data":{"operation":"onMessage"}},"type":"data"}`,
+			`{"id":"1","type":"complete"}`,
+		)
+		exchange(t, ws, `{"type":"connection_terminate"}`)
+		if reason := <-o; !errors.Is(reason, graphqlws.ErrClientTerminated) {
+			t.Fatalf("expected %v but instead got %v", graphqlws.ErrClientTerminated, reason)
+		}
+	})
+
+	t.Run("graphql-transport-ws", func(t *testing.T) {
+		ws := dial(t, srv.URL, graphqlws.ProtocolGraphQLTransportWS)
+		defer ws.Close()
+
+		exchange(t, ws, `{"type":"ping"}`, `{"type":"pong"}`)
+		exchange(t, ws, `{"type":"connection_init"}`, `{"type":"connection_ack"}`)
+		exchange(t, ws, `{"id":"1","type":"subscribe","payload":{"query":"subscription onMessage { message }","operationName":"onMessage"}}`,
+			`{"id":"1","type":"next","payload":{"data":{"operation":"onMessage"}}}`,
+			`{"id":"1","type":"complete"}`,
+		)
+
+		// protocol violations are closed with their close code
+		exchange(t, ws, `{"type":"connection_init"}`)
+		_, _, err := ws.ReadMessage()
+		var ce *websocket.CloseError
+		if !errors.As(err, &ce) || ce.Code != int(graphqlws.CloseTooManyInits) {
+			t.Fatalf("expected close code %d but instead got %v", graphqlws.CloseTooManyInits, err)
+		}
+		<-o
+	})
+}
+
+func TestBackendPongWait(t *testing.T) {
+	for name, answer := range map[string]bool{"answering pings": true, "not answering pings": false} {
+		t.Run(name, func(t *testing.T) {
+			o := make(closeObserver, 1)
+			s := graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), nil,
+				graphqlws.WithWebSocketBackend(nhooyr.Backend(nil)),
+				graphqlws.WithObserver(o),
+				graphqlws.WithPongWait(100*time.Millisecond),
+				graphqlws.WithPingPeriod(20*time.Millisecond),
+			)
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+
+			ws := dial(t, srv.URL, graphqlws.ProtocolGraphQLWS)
+			defer ws.Close()
+			if !answer {
+				ws.SetPingHandler(func(string) error { return nil })
+			}
+			// pings are only handled while reading
+			go func() {
+				for {
+					if _, _, err := ws.ReadMessage(); err != nil {
+						return
+					}
+				}
+			}()
+
+			if answer {
+				select {
+				case reason := <-o:
+					t.Fatalf("expected the connection to be kept but instead it was closed with %v", reason)
+				case <-time.After(500 * time.Millisecond):
+				}
+				return
+			}
+			select {
+			case reason := <-o:
+				if !errors.Is(reason, graphqlws.ErrPongTimeout) {
+					t.Fatalf("expected %v but instead got %v", graphqlws.ErrPongTimeout, reason)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("expected the connection to be closed")
+			}
+		})
+	}
+}
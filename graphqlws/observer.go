@@ -0,0 +1,44 @@
+package graphqlws
+
+import (
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// Observer is notified of the lifecycle of connections and operations, see
+// the datadog package for an implementation
+type Observer = connection.Observer
+
+// ConnectionInfo describes a connection to an Observer
+type ConnectionInfo = connection.ConnectionInfo
+
+// OperationInfo describes an operation to an Observer
+type OperationInfo = connection.OperationInfo
+
+// MessageObserver is implemented by Observers also notified of every operation
+// message received from or sent to clients
+type MessageObserver = connection.MessageObserver
+
+// MessageInfo describes an operation message to a MessageObserver
+type MessageInfo = connection.MessageInfo
+
+// SubscribeObserver is implemented by Observers also notified of how long the
+// calls to the Subscribe method of the service took
+type SubscribeObserver = connection.SubscribeObserver
+
+// DataObserver is implemented by Observers also notified of every data message
+// of the operations
+type DataObserver = connection.DataObserver
+
+// QueueObserver is implemented by Observers also notified of the depth of the
+// outgoing queues of connections and of the messages dropped when they're
+// full, see WithSendQueue
+type QueueObserver = connection.QueueObserver
+
+// WithObserver adds an Observer to every connection. Observers are notified in
+// the order they were added, and in reverse order when connections and
+// operations end.
+func WithObserver(o Observer) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.Observe(o))
+	}
+}
@@ -0,0 +1,128 @@
+//go:build otel
+// +build otel
+
+// Package otel provides a graphqlws.Observer tracing connections and
+// operations with OpenTelemetry. It's only built with the otel build tag, so
+// that depending on graphqlws doesn't pull in the OpenTelemetry SDK.
+package otel
+
+import (
+	"context"
+	"errors"
+
+	otelgo "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+const (
+	instrumentationName = "github.com/samodenis/graphql-transport-ws/graphqlws/otel"
+
+	connectionSpan = "graphqlws.connection"
+	operationSpan  = "graphqlws.operation"
+	dataEvent      = "graphqlws.data"
+
+	// the log attributes logs are correlated with traces by
+	logKeyTraceID = "trace_id"
+	logKeySpanID  = "span_id"
+)
+
+type observer struct {
+	provider trace.TracerProvider
+	tracer   trace.Tracer
+}
+
+// Option configures the Observer
+type Option func(o *observer)
+
+// WithTracerProvider sets the TracerProvider the spans are created with, the
+// global one by default
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *observer) {
+		o.provider = tp
+	}
+}
+
+// Observer returns a graphqlws.Observer starting a span for each connection,
+// with a child span for each of its operations recording an event for each
+// of their data messages. The operation spans are carried by the operation
+// contexts passed to the GraphQLService, so the spans of resolvers are
+// children of them.
+func Observer(options ...Option) graphqlws.Observer {
+	o := &observer{}
+	for _, option := range options {
+		option(o)
+	}
+	if o.provider == nil {
+		o.provider = otelgo.GetTracerProvider()
+	}
+	o.tracer = o.provider.Tracer(instrumentationName)
+	return o
+}
+
+func (o *observer) ConnectionStart(ctx context.Context, info graphqlws.ConnectionInfo) context.Context {
+	opts := []trace.SpanStartOption{trace.WithSpanKind(trace.SpanKindServer)}
+	if info.RemoteAddr != nil {
+		opts = append(opts, trace.WithAttributes(attribute.String("client.address", info.RemoteAddr.String())))
+	}
+	if id, ok := graphqlws.ConnectionIDFromContext(ctx); ok {
+		opts = append(opts, trace.WithAttributes(attribute.String("graphqlws.connection_id", string(id))))
+	}
+
+	ctx, span := o.tracer.Start(ctx, connectionSpan, opts...)
+	return withLogFields(ctx, span)
+}
+
+func (o *observer) ConnectionEnd(ctx context.Context) {
+	trace.SpanFromContext(ctx).End()
+}
+
+func (o *observer) OperationStart(ctx context.Context, info graphqlws.OperationInfo) context.Context {
+	name := info.OperationName
+	if name == "" {
+		name = operationSpan
+	}
+
+	attrs := []attribute.KeyValue{
+		attribute.String("graphql.operation.id", info.ID),
+		attribute.String("graphql.operation.name", info.OperationName),
+		attribute.String("graphql.document", info.Query),
+	}
+	if socketID, ok := graphqlws.SocketIDFromContext(ctx); ok {
+		attrs = append(attrs, attribute.String("graphqlws.socket_id", socketID))
+	}
+
+	ctx, span := o.tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attrs...))
+	return withLogFields(ctx, span)
+}
+
+func (o *observer) OperationData(ctx context.Context, payloadSize int) {
+	trace.SpanFromContext(ctx).AddEvent(dataEvent, trace.WithAttributes(attribute.Int("graphqlws.payload_size", payloadSize)))
+}
+
+func (o *observer) OperationEnd(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+
+	// operations stopped by the client or closed with their connection aren't
+	// failures
+	if err != nil && !errors.Is(err, context.Canceled) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// withLogFields adds the trace and span ids of span to the log fields of ctx
+func withLogFields(ctx context.Context, span trace.Span) context.Context {
+	sc := span.SpanContext()
+	if !sc.IsValid() {
+		return ctx
+	}
+	return graphqlws.ContextWithLogFields(ctx,
+		logKeyTraceID, sc.TraceID().String(),
+		logKeySpanID, sc.SpanID().String(),
+	)
+}
@@ -0,0 +1,90 @@
+//go:build otel
+// +build otel
+
+package otel_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/otel"
+)
+
+func TestObserver(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	o := otel.Observer(otel.WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))))
+
+	connCtx := o.ConnectionStart(context.Background(), graphqlws.ConnectionInfo{})
+	opCtx := o.OperationStart(graphqlws.ContextWithSocketID(connCtx, "a-socket"), graphqlws.OperationInfo{
+		ID:            "a-id",
+		OperationName: "onMessage",
+		Query:         "subscription onMessage { message }",
+	})
+	o.(graphqlws.DataObserver).OperationData(opCtx, 42)
+	o.OperationEnd(opCtx, errors.New("failed"))
+	o.ConnectionEnd(connCtx)
+
+	spans := sr.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans but instead got %d", len(spans))
+	}
+
+	op, conn := spans[0], spans[1]
+	if op.Parent().SpanID() != conn.SpanContext().SpanID() {
+		t.Fatalf("expected the operation span to be a child of the connection span")
+	}
+	if op.Name() != "onMessage" {
+		t.Fatalf("expected onMessage but instead got %s", op.Name())
+	}
+	attrs := map[attribute.Key]string{}
+	for _, kv := range op.Attributes() {
+		attrs[kv.Key] = kv.Value.Emit()
+	}
+	for key, expected := range map[attribute.Key]string{
+		"graphql.operation.id":   "a-id",
+		"graphql.operation.name": "onMessage",
+		"graphqlws.socket_id":    "a-socket",
+	} {
+		if got := attrs[key]; got != expected {
+			t.Fatalf("expected attribute %s to be [%s] but instead got [%s]", key, expected, got)
+		}
+	}
+	if events := op.Events(); len(events) != 2 || events[0].Name != "graphqlws.data" {
+		t.Fatalf("expected a data event and the error but instead got %v", events)
+	}
+	if op.Status().Code != codes.Error || op.Status().Description != "failed" {
+		t.Fatalf("expected the operation span to have failed but instead got %v", op.Status())
+	}
+	if conn.Status().Code != codes.Unset {
+		t.Fatalf("expected no error on the connection span but instead got %v", conn.Status())
+	}
+
+	expected := []interface{}{
+		"trace_id", op.SpanContext().TraceID().String(),
+		"span_id", op.SpanContext().SpanID().String(),
+	}
+	if got := graphqlws.LogFieldsFromContext(opCtx); !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected log fields %v but instead got %v", expected, got)
+	}
+}
+
+func TestObserverCancelledOperation(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	o := otel.Observer(otel.WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))))
+
+	opCtx := o.OperationStart(context.Background(), graphqlws.OperationInfo{ID: "a-id"})
+	o.OperationEnd(opCtx, context.Canceled)
+
+	spans := sr.Ended()
+	if len(spans) != 1 || spans[0].Name() != "graphqlws.operation" || spans[0].Status().Code != codes.Unset {
+		t.Fatalf("expected an unnamed operation span not failed but instead got %v", spans)
+	}
+}
@@ -0,0 +1,48 @@
+package graphqlws
+
+import (
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// PanicPolicy is what happens when a call to the service, i.e. Exec or
+// Subscribe, panics, see WithServicePanics
+type PanicPolicy = connection.PanicPolicy
+
+// The policies for panics of service calls
+const (
+	PanicCrash           = connection.PanicCrash
+	PanicAsError         = connection.PanicAsError
+	PanicCloseConnection = connection.PanicCloseConnection
+)
+
+// ErrServicePanicked is the error operations fail with and connections are
+// closed for when a call to the service panics, or a goroutine of the
+// connection when recovered, see WithPanicHandler
+var ErrServicePanicked = connection.ErrServicePanicked
+
+// WithServicePanics sets the policy for panics of calls to the service: by
+// default they're resumed and crash the process, PanicAsError fails the
+// operation instead and PanicCloseConnection closes the connection with the
+// 1011 close code. The panic value is passed to the ErrorReporter either way,
+// as a *PanicError.
+func WithServicePanics(p PanicPolicy) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.ServicePanics(p))
+	}
+}
+
+// PanicHandler is passed the panics recovered from the goroutines of a
+// connection, see WithPanicHandler
+type PanicHandler = connection.PanicHandler
+
+// WithPanicHandler makes connections recover the panics of their goroutines,
+// e.g. of a payload whose MarshalJSON panics, instead of crashing the process,
+// and pass them to fn, which may be nil. The operation which panicked, if any,
+// fails with ErrServicePanicked and the connection is then closed with the
+// 1011 close code. Panics are also recovered, without a PanicHandler, under a
+// PanicPolicy other than PanicCrash.
+func WithPanicHandler(fn PanicHandler) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.OnPanic(fn))
+	}
+}
@@ -0,0 +1,49 @@
+package graphqlws
+
+import (
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+var (
+	// ErrPersistedQueryNotFound is the error of the operations started with
+	// the hash of an unknown document, see WithPersistedQueries
+	ErrPersistedQueryNotFound = connection.ErrPersistedQueryNotFound
+	// ErrQueryNotAllowed is the error of the operations whose document isn't
+	// in the allow-list, see WithQueryAllowList
+	ErrQueryNotAllowed = connection.ErrQueryNotAllowed
+)
+
+// PersistedQueryStore holds the documents of persisted queries by the hex
+// encoded SHA-256 hash of their text
+type PersistedQueryStore = connection.PersistedQueryStore
+
+// MemoryPersistedQueryStore is a PersistedQueryStore keeping the documents in
+// memory
+type MemoryPersistedQueryStore = connection.MemoryPersistedQueryStore
+
+// NewMemoryPersistedQueryStore returns a MemoryPersistedQueryStore holding
+// queries and up to limit documents saved by clients
+func NewMemoryPersistedQueryStore(limit int, queries ...string) *MemoryPersistedQueryStore {
+	return connection.NewMemoryPersistedQueryStore(limit, queries...)
+}
+
+// WithPersistedQueries supports Apollo's Automatic Persisted Queries: start
+// payloads may only carry the hash of their document in
+// extensions.persistedQuery.sha256Hash, which is then looked up in store. If
+// it isn't found the operation fails with ErrPersistedQueryNotFound, with the
+// extensions code PERSISTED_QUERY_NOT_FOUND, and the client starts it again
+// with both the document and its hash, the document being then saved.
+func WithPersistedQueries(store PersistedQueryStore) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.PersistedQueries(store))
+	}
+}
+
+// WithQueryAllowList only lets operations run the documents held by store,
+// sent either in full or as their hash. Other operations fail with
+// ErrQueryNotAllowed, with the extensions code QUERY_NOT_ALLOWED.
+func WithQueryAllowList(store PersistedQueryStore) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.AllowList(store))
+	}
+}
@@ -0,0 +1,74 @@
+//go:build redis
+// +build redis
+
+// Package redis is a PersistedQueryStore keeping the documents of persisted
+// queries in Redis, see graphqlws.WithPersistedQueries. It's only built with
+// the redis build tag, so that depending on graphqlws doesn't pull in the
+// Redis client.
+package redis
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+type store struct {
+	client goredis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+// Option configures a store
+type Option func(s *store)
+
+// Prefix sets the prefix of the keys of the documents, graphqlws:apq: by
+// default
+func Prefix(prefix string) Option {
+	return func(s *store) {
+		s.prefix = prefix
+	}
+}
+
+// TTL makes the documents saved expire once not used for d, by default they
+// don't
+func TTL(d time.Duration) Option {
+	return func(s *store) {
+		s.ttl = d
+	}
+}
+
+// New returns a PersistedQueryStore keeping each document under the key made
+// of the prefix and its hash
+func New(client goredis.UniversalClient, options ...Option) graphqlws.PersistedQueryStore {
+	s := &store{client: client, prefix: "graphqlws:apq:"}
+	for _, opt := range options {
+		opt(s)
+	}
+	return s
+}
+
+func (s *store) Get(ctx context.Context, hash string) (string, bool, error) {
+	var query string
+	var err error
+	if s.ttl > 0 {
+		query, err = s.client.GetEx(ctx, s.prefix+hash, s.ttl).Result()
+	} else {
+		query, err = s.client.Get(ctx, s.prefix+hash).Result()
+	}
+	if errors.Is(err, goredis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return query, true, nil
+}
+
+func (s *store) Put(ctx context.Context, hash string, query string) error {
+	return s.client.Set(ctx, s.prefix+hash, query, s.ttl).Err()
+}
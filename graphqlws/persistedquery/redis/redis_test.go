@@ -0,0 +1,47 @@
+//go:build redis
+// +build redis
+
+package redis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/persistedquery/redis"
+)
+
+func TestStore(t *testing.T) {
+	s := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	defer client.Close()
+	store := redis.New(client, redis.TTL(time.Minute))
+
+	ctx := context.Background()
+	if _, ok, err := store.Get(ctx, "abc"); ok || err != nil {
+		t.Fatalf("expected no document but instead got %v, %v", ok, err)
+	}
+	if err := store.Put(ctx, "abc", "subscription { a }"); err != nil {
+		t.Fatal(err)
+	}
+	if query, ok, err := store.Get(ctx, "abc"); !ok || err != nil || query != "subscription { a }" {
+		t.Fatalf("expected the document but instead got %q, %v, %v", query, ok, err)
+	}
+
+	// getting the document extends its TTL
+	s.FastForward(30 * time.Second)
+	if _, ok, _ := store.Get(ctx, "abc"); !ok {
+		t.Fatal("expected the document to be kept")
+	}
+	s.FastForward(45 * time.Second)
+	if _, ok, _ := store.Get(ctx, "abc"); !ok {
+		t.Fatal("expected the document to be kept once used")
+	}
+	s.FastForward(2 * time.Minute)
+	if _, ok, _ := store.Get(ctx, "abc"); ok {
+		t.Fatal("expected the document to expire")
+	}
+}
@@ -0,0 +1,171 @@
+//go:build prometheus
+// +build prometheus
+
+// Package prometheus provides Prometheus metrics of the connections and
+// operations served by graphqlws. It's only built with the prometheus build
+// tag, so that depending on graphqlws doesn't pull in the client library.
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	promclient "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+const namespace = "graphqlws"
+
+type observer struct {
+	connections     promclient.Gauge
+	closed          *promclient.CounterVec
+	operations      promclient.Gauge
+	messages        *promclient.CounterVec
+	payloadBytes    *promclient.HistogramVec
+	subscribeTiming *promclient.HistogramVec
+	queueDepth      promclient.Histogram
+	dropped         *promclient.CounterVec
+}
+
+// WithMetrics registers the metrics of the connections with reg and returns
+// the option collecting them, it panics if they can't be registered, as
+// prometheus.MustRegister does. The metrics are:
+//
+//   - graphqlws_connections_active, the number of live connections
+//   - graphqlws_connections_closed_total, by the reason connections were
+//     closed for, e.g. write_failed when writing to the client failed
+//   - graphqlws_operations_active, the number of running operations
+//   - graphqlws_messages_total, by direction (received or sent) and type
+//   - graphqlws_message_payload_bytes, by direction and type
+//   - graphqlws_subscribe_duration_seconds, the latency of the calls to the
+//     Subscribe method of the service, by result (ok or error)
+//   - graphqlws_send_queue_depth, the number of messages a connection has
+//     queued for the client once a message is queued
+//   - graphqlws_messages_dropped_total, by type, the messages dropped because
+//     their outgoing queue was full, see graphqlws.WithSendQueue
+func WithMetrics(reg promclient.Registerer) graphqlws.Option {
+	o := &observer{
+		connections: promclient.NewGauge(promclient.GaugeOpts{
+			Namespace: namespace,
+			Name:      "connections_active",
+			Help:      "Number of live connections.",
+		}),
+		closed: promclient.NewCounterVec(promclient.CounterOpts{
+			Namespace: namespace,
+			Name:      "connections_closed_total",
+			Help:      "Number of closed connections, by the reason they were closed for.",
+		}, []string{"reason"}),
+		operations: promclient.NewGauge(promclient.GaugeOpts{
+			Namespace: namespace,
+			Name:      "operations_active",
+			Help:      "Number of running operations.",
+		}),
+		messages: promclient.NewCounterVec(promclient.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_total",
+			Help:      "Number of operation messages, by direction and type.",
+		}, []string{"direction", "type"}),
+		payloadBytes: promclient.NewHistogramVec(promclient.HistogramOpts{
+			Namespace: namespace,
+			Name:      "message_payload_bytes",
+			Help:      "Size of the payloads of operation messages, by direction and type.",
+			Buckets:   promclient.ExponentialBuckets(64, 4, 8),
+		}, []string{"direction", "type"}),
+		subscribeTiming: promclient.NewHistogramVec(promclient.HistogramOpts{
+			Namespace: namespace,
+			Name:      "subscribe_duration_seconds",
+			Help:      "Latency of the calls to the Subscribe method of the service, by result.",
+			Buckets:   promclient.DefBuckets,
+		}, []string{"result"}),
+		queueDepth: promclient.NewHistogram(promclient.HistogramOpts{
+			Namespace: namespace,
+			Name:      "send_queue_depth",
+			Help:      "Number of messages queued for the client of a connection, once a message is queued.",
+			Buckets:   promclient.ExponentialBuckets(1, 2, 10),
+		}),
+		dropped: promclient.NewCounterVec(promclient.CounterOpts{
+			Namespace: namespace,
+			Name:      "messages_dropped_total",
+			Help:      "Number of operation messages dropped because their outgoing queue was full, by type.",
+		}, []string{"type"}),
+	}
+	reg.MustRegister(o.connections, o.closed, o.operations, o.messages, o.payloadBytes, o.subscribeTiming, o.queueDepth, o.dropped)
+	return graphqlws.WithObserver(o)
+}
+
+func (o *observer) ConnectionStart(ctx context.Context, info graphqlws.ConnectionInfo) context.Context {
+	o.connections.Inc()
+	return ctx
+}
+
+func (o *observer) ConnectionEnd(ctx context.Context) {
+	o.connections.Dec()
+	o.closed.WithLabelValues(closeReason(graphqlws.CloseReason(ctx))).Inc()
+}
+
+func (o *observer) OperationStart(ctx context.Context, info graphqlws.OperationInfo) context.Context {
+	o.operations.Inc()
+	return ctx
+}
+
+func (o *observer) OperationEnd(ctx context.Context, err error) {
+	o.operations.Dec()
+}
+
+func (o *observer) Message(ctx context.Context, info graphqlws.MessageInfo) {
+	direction := "received"
+	if info.Sent {
+		direction = "sent"
+	}
+	o.messages.WithLabelValues(direction, info.Type).Inc()
+	o.payloadBytes.WithLabelValues(direction, info.Type).Observe(float64(info.PayloadSize))
+}
+
+func (o *observer) Subscribed(ctx context.Context, d time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	o.subscribeTiming.WithLabelValues(result).Observe(d.Seconds())
+}
+
+func (o *observer) Queued(ctx context.Context, depth int) {
+	o.queueDepth.Observe(float64(depth))
+}
+
+func (o *observer) Dropped(ctx context.Context, info graphqlws.MessageInfo) {
+	o.dropped.WithLabelValues(info.Type).Inc()
+}
+
+// closeReasons are the label values of the reasons connections are closed for
+var closeReasons = []struct {
+	err   error
+	label string
+}{
+	{graphqlws.ErrClientGone, "client_gone"},
+	{graphqlws.ErrClientTerminated, "client_terminated"},
+	{graphqlws.ErrMalformedFrame, "malformed_frame"},
+	{graphqlws.ErrWriteFailed, "write_failed"},
+	{graphqlws.ErrNoOperation, "no_operation"},
+	{graphqlws.ErrInitRejected, "init_rejected"},
+	{graphqlws.ErrInitTimeout, "init_timeout"},
+	{graphqlws.ErrQueueOverflow, "queue_overflow"},
+	{graphqlws.ErrPongTimeout, "pong_timeout"},
+	{graphqlws.ErrRefreshRejected, "refresh_rejected"},
+	{graphqlws.ErrAuthExpired, "auth_expired"},
+	{graphqlws.ErrRateLimited, "rate_limited"},
+	{graphqlws.ErrServerShutdown, "server_shutdown"},
+	{context.Canceled, "server"},
+	{context.DeadlineExceeded, "server"},
+}
+
+func closeReason(err error) string {
+	for _, r := range closeReasons {
+		if errors.Is(err, r.err) {
+			return r.label
+		}
+	}
+	return "other"
+}
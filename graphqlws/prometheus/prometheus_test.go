@@ -0,0 +1,96 @@
+//go:build prometheus
+// +build prometheus
+
+package prometheus_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	promclient "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/prometheus"
+)
+
+type authValidator struct{}
+
+func (authValidator) CheckAuth(r *http.Request, ctx context.Context) (context.Context, error) {
+	return ctx, nil
+}
+
+// value returns the value of the counter or gauge, or the sample count of the
+// histogram, named name whose labels are labels
+func value(t *testing.T, reg *promclient.Registry, name string, labels map[string]string) float64 {
+	t.Helper()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+	metrics:
+		for _, m := range f.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if labels[l.GetName()] != l.GetValue() {
+					continue metrics
+				}
+			}
+			switch {
+			case m.Counter != nil:
+				return m.Counter.GetValue()
+			case m.Gauge != nil:
+				return m.Gauge.GetValue()
+			case m.Histogram != nil:
+				return float64(m.Histogram.GetSampleCount())
+			}
+		}
+	}
+	t.Fatalf("expected a %s metric labeled %v", name, labels)
+	return 0
+}
+
+func TestWithMetrics(t *testing.T) {
+	reg := promclient.NewRegistry()
+	svc := graphqlwstest.NewMockService().On("ticks", graphqlwstest.Data(1), graphqlwstest.Complete())
+	s := graphqlws.NewServer(context.Background(), svc, http.NotFoundHandler(), authValidator{}, prometheus.WithMetrics(reg))
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	c := graphqlwstest.Dial(t, srv.URL, nil)
+	c.Init(nil)
+	c.Start("1", "subscription ticks { tick }", "ticks", nil)
+	c.CompletedWithin("1", 5*time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		labels   map[string]string
+		expected float64
+	}{
+		{name: "graphqlws_connections_active", expected: 0},
+		{name: "graphqlws_connections_closed_total", labels: map[string]string{"reason": "server_shutdown"}, expected: 1},
+		{name: "graphqlws_messages_total", labels: map[string]string{"direction": "received", "type": "start"}, expected: 1},
+		{name: "graphqlws_messages_total", labels: map[string]string{"direction": "sent", "type": "data"}, expected: 1},
+		{name: "graphqlws_message_payload_bytes", labels: map[string]string{"direction": "sent", "type": "data"}, expected: 1},
+		{name: "graphqlws_subscribe_duration_seconds", labels: map[string]string{"result": "ok"}, expected: 1},
+	} {
+		if got := value(t, reg, tc.name, tc.labels); got != tc.expected {
+			t.Fatalf("expected %s%v to be %v but instead got %v", tc.name, tc.labels, tc.expected, got)
+		}
+	}
+	if got := value(t, reg, "graphqlws_send_queue_depth", nil); got == 0 {
+		t.Fatal("expected the depth of the send queue to be observed")
+	}
+}
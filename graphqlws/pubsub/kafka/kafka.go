@@ -0,0 +1,313 @@
+//go:build kafka
+// +build kafka
+
+// Package kafka is an event bridge over Kafka topics, see the pubsub package,
+// so that subscriptions can stream the records of a topic straight to
+// clients. It's only built with the kafka build tag, so that depending on
+// graphqlws doesn't pull in the Kafka client.
+package kafka
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/pubsub"
+)
+
+// finalCommitTimeout bounds the commit of the offsets acknowledged by the time
+// a subscription stops
+const finalCommitTimeout = 5 * time.Second
+
+// GroupFunc returns the consumer group of a subscription to topic, e.g.
+// derived from the user and the operation name found in ctx, or an empty
+// string to consume without a group
+type GroupFunc func(ctx context.Context, topic string) string
+
+// Bridge publishes to and consumes from Kafka topics, its subscriptions
+// consuming every partition of their topic
+type Bridge struct {
+	brokers  []string
+	opts     []kgo.Opt
+	group    GroupFunc
+	oldest   bool
+	onError  func(topic string, err error)
+	producer *kgo.Client
+}
+
+// Option configures a Bridge
+type Option func(b *Bridge)
+
+// ClientOptions adds options to the clients of the bridge, e.g. to set up TLS
+// or SASL
+func ClientOptions(opts ...kgo.Opt) Option {
+	return func(b *Bridge) {
+		b.opts = append(b.opts, opts...)
+	}
+}
+
+// Group makes subscriptions consume in the consumer groups named by fn,
+// committing the offset of each record once it's acknowledged, i.e. delivered
+// to the client when subscribed to with pubsub.Payloads, and all the records
+// before it in its partition are too. Subscribing again to a group resumes
+// from there, so records are delivered at least once across reconnections and
+// server restarts. Subscriptions sharing a group share its partitions, so its
+// name should be unique to a subscriber.
+func Group(fn GroupFunc) Option {
+	return func(b *Bridge) {
+		b.group = fn
+	}
+}
+
+// FromOldest makes subscriptions without committed offsets start from the
+// oldest records of their topic instead of the records produced from then on
+func FromOldest() Option {
+	return func(b *Bridge) {
+		b.oldest = true
+	}
+}
+
+// OnError sets the function the fetch and commit errors of the subscriptions
+// to topics are passed to, e.g. to log them
+func OnError(fn func(topic string, err error)) Option {
+	return func(b *Bridge) {
+		b.onError = fn
+	}
+}
+
+// New returns a bridge to the Kafka cluster of the given seed brokers, it
+// should be closed once done
+func New(brokers []string, options ...Option) (*Bridge, error) {
+	b := &Bridge{brokers: brokers}
+	for _, opt := range options {
+		opt(b)
+	}
+
+	producer, err := kgo.NewClient(b.clientOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	b.producer = producer
+	return b, nil
+}
+
+func (b *Bridge) clientOptions(opts ...kgo.Opt) []kgo.Opt {
+	options := make([]kgo.Opt, 0, 1+len(b.opts)+len(opts))
+	options = append(options, kgo.SeedBrokers(b.brokers...))
+	options = append(options, b.opts...)
+	return append(options, opts...)
+}
+
+// Publish produces a record holding payload to topic, it returns once the
+// record is acknowledged by the brokers
+func (b *Bridge) Publish(ctx context.Context, topic string, payload []byte) error {
+	return b.producer.ProduceSync(ctx, &kgo.Record{Topic: topic, Value: payload}).FirstErr()
+}
+
+// Subscribe consumes the records of topic until ctx is done, with a consumer
+// group if any, see Group
+func (b *Bridge) Subscribe(ctx context.Context, topic string) (<-chan pubsub.Message, error) {
+	reset := kgo.NewOffset().AtEnd()
+	if b.oldest {
+		reset = kgo.NewOffset().AtStart()
+	}
+	opts := []kgo.Opt{kgo.ConsumeTopics(topic), kgo.ConsumeResetOffset(reset)}
+
+	var a *acks
+	if b.group != nil {
+		if group := b.group(ctx, topic); group != "" {
+			a = &acks{partitions: map[partition]*partitionAcks{}, ready: make(chan struct{}, 1)}
+			opts = append(opts,
+				kgo.ConsumerGroup(group),
+				kgo.DisableAutoCommit(),
+				kgo.OnPartitionsRevoked(func(ctx context.Context, cl *kgo.Client, revoked map[string][]int32) {
+					// the records acknowledged are committed while the
+					// partitions are still owned
+					b.report(topic, a.flush(ctx, cl))
+					a.forget(revoked)
+				}),
+				kgo.OnPartitionsLost(func(ctx context.Context, cl *kgo.Client, lost map[string][]int32) {
+					a.forget(lost)
+				}),
+			)
+		}
+	}
+
+	cl, err := kgo.NewClient(b.clientOptions(opts...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	c := make(chan pubsub.Message)
+	go func() {
+		defer close(c)
+		defer cl.Close()
+
+		if a == nil {
+			b.poll(ctx, cl, topic, nil, c)
+			return
+		}
+		stop := make(chan struct{})
+		committed := make(chan struct{})
+		go func() {
+			defer close(committed)
+			b.commit(cl, topic, a, stop)
+		}()
+		b.poll(ctx, cl, topic, a, c)
+		close(stop)
+		<-committed
+	}()
+	return c, nil
+}
+
+// poll forwards the records of cl to c until ctx is done, tracking their
+// acknowledgements with a if not nil
+func (b *Bridge) poll(ctx context.Context, cl *kgo.Client, topic string, a *acks, c chan<- pubsub.Message) {
+	for {
+		fetches := cl.PollFetches(ctx)
+		if fetches.IsClientClosed() || ctx.Err() != nil {
+			return
+		}
+		fetches.EachError(func(_ string, _ int32, err error) {
+			b.report(topic, err)
+		})
+
+		for iter := fetches.RecordIter(); !iter.Done(); {
+			r := iter.Next()
+			msg := pubsub.Message{Topic: r.Topic, Payload: r.Value}
+			if a != nil {
+				a.track(r)
+				msg.Ack = func() { a.ack(r) }
+			}
+			select {
+			case c <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// commit commits the offsets acknowledged with a as they are until stop is
+// closed, and then once more
+func (b *Bridge) commit(cl *kgo.Client, topic string, a *acks, stop <-chan struct{}) {
+	for {
+		select {
+		case <-a.ready:
+			b.report(topic, a.flush(context.Background(), cl))
+		case <-stop:
+			ctx, cancel := context.WithTimeout(context.Background(), finalCommitTimeout)
+			defer cancel()
+			b.report(topic, a.flush(ctx, cl))
+			return
+		}
+	}
+}
+
+func (b *Bridge) report(topic string, err error) {
+	if err != nil && b.onError != nil {
+		b.onError(topic, err)
+	}
+}
+
+// Close closes the producer of the bridge, the subscriptions stop with their
+// context
+func (b *Bridge) Close() {
+	b.producer.Close()
+}
+
+type partition struct {
+	topic     string
+	partition int32
+}
+
+// acks tracks the acknowledgements of the records of a subscription, so that
+// the offset of a record is only committed once it and all the records before
+// it in its partition are acknowledged
+type acks struct {
+	// commitMu serializes the commits, so that they're never rewound
+	commitMu sync.Mutex
+
+	mu         sync.Mutex
+	partitions map[partition]*partitionAcks
+	// ready holds a value once there's something to commit
+	ready chan struct{}
+}
+
+type partitionAcks struct {
+	// pending holds the records forwarded and not acknowledged yet, in order,
+	// and acked the offsets of those which are
+	pending []*kgo.Record
+	acked   map[int64]bool
+	// commit is the last record to commit, if any
+	commit *kgo.Record
+}
+
+func (a *acks) track(r *kgo.Record) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := partition{r.Topic, r.Partition}
+	p := a.partitions[key]
+	if p == nil {
+		p = &partitionAcks{acked: map[int64]bool{}}
+		a.partitions[key] = p
+	}
+	p.pending = append(p.pending, r)
+}
+
+func (a *acks) ack(r *kgo.Record) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	p := a.partitions[partition{r.Topic, r.Partition}]
+	if p == nil {
+		// the partition was revoked in between
+		return
+	}
+	p.acked[r.Offset] = true
+	advanced := false
+	for len(p.pending) > 0 && p.acked[p.pending[0].Offset] {
+		delete(p.acked, p.pending[0].Offset)
+		p.commit, p.pending = p.pending[0], p.pending[1:]
+		advanced = true
+	}
+	if advanced {
+		select {
+		case a.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// flush commits the records acknowledged since the last commit
+func (a *acks) flush(ctx context.Context, cl *kgo.Client) error {
+	a.commitMu.Lock()
+	defer a.commitMu.Unlock()
+
+	var rs []*kgo.Record
+	a.mu.Lock()
+	for _, p := range a.partitions {
+		if p.commit != nil {
+			rs = append(rs, p.commit)
+			p.commit = nil
+		}
+	}
+	a.mu.Unlock()
+
+	if len(rs) == 0 {
+		return nil
+	}
+	return cl.CommitRecords(ctx, rs...)
+}
+
+// forget forgets the partitions no longer consumed
+func (a *acks) forget(partitions map[string][]int32) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for topic, ps := range partitions {
+		for _, p := range ps {
+			delete(a.partitions, partition{topic, p})
+		}
+	}
+}
@@ -0,0 +1,105 @@
+//go:build kafka
+// +build kafka
+
+package kafka_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/pubsub"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/pubsub/kafka"
+)
+
+func runCluster(t *testing.T) []string {
+	t.Helper()
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, "orders"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cluster.Close)
+	return cluster.ListenAddrs()
+}
+
+func expectMessage(t *testing.T, c <-chan pubsub.Message, payload string) pubsub.Message {
+	t.Helper()
+	select {
+	case msg := <-c:
+		if msg.Topic != "orders" || string(msg.Payload) != payload {
+			t.Fatalf("expected %s on orders but instead got %s on %s", payload, msg.Payload, msg.Topic)
+		}
+		return msg
+	case <-time.After(10 * time.Second):
+		t.Fatalf("expected %s", payload)
+		return pubsub.Message{}
+	}
+}
+
+func TestBridge(t *testing.T) {
+	b, err := kafka.New(runCluster(t), kafka.FromOldest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := b.Publish(ctx, "orders", []byte(`{"data":{"n":1}}`)); err != nil {
+		t.Fatal(err)
+	}
+	c, err := b.Subscribe(ctx, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg := expectMessage(t, c, `{"data":{"n":1}}`); msg.Ack != nil {
+		t.Fatal("expected the record not to be acknowledged without a consumer group")
+	}
+
+	cancel()
+	for range c {
+	}
+}
+
+func TestBridgeGroup(t *testing.T) {
+	b, err := kafka.New(runCluster(t),
+		kafka.FromOldest(),
+		kafka.Group(func(ctx context.Context, topic string) string { return "client-1" }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	for _, payload := range []string{`{"data":{"n":1}}`, `{"data":{"n":2}}`, `{"data":{"n":3}}`} {
+		if err := b.Publish(context.Background(), "orders", []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err := b.Subscribe(ctx, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := expectMessage(t, c, `{"data":{"n":1}}`)
+	second := expectMessage(t, c, `{"data":{"n":2}}`)
+	expectMessage(t, c, `{"data":{"n":3}}`)
+	// the offset of the second record is only committed once the first one
+	// is acknowledged too, the third one isn't
+	second.Ack()
+	first.Ack()
+	cancel()
+	for range c {
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	c, err = b.Subscribe(ctx, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, c, `{"data":{"n":3}}`)
+}
@@ -0,0 +1,213 @@
+package pubsub
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// SlowPolicy is what happens to the events published to a subscriber of a
+// Memory whose buffer is full
+type SlowPolicy int
+
+// The policies for slow subscribers
+const (
+	// Block makes Publish wait for the subscriber
+	Block SlowPolicy = iota
+	// DropNewest drops the event for the subscriber
+	DropNewest
+	// DropOldest drops the oldest event buffered for the subscriber to make
+	// room for the new one
+	DropOldest
+	// Disconnect ends the subscription, which completes the operation
+	Disconnect
+)
+
+type memoryConfig struct {
+	buffer int
+	policy SlowPolicy
+}
+
+// MemoryOption configures a Memory
+type MemoryOption func(c *memoryConfig)
+
+// Buffer sets how many events are buffered for each subscriber, 16 by default
+func Buffer(n int) MemoryOption {
+	return func(c *memoryConfig) {
+		c.buffer = n
+	}
+}
+
+// OnSlow sets what happens to the events published to subscribers whose buffer
+// is full, Block by default
+func OnSlow(p SlowPolicy) MemoryOption {
+	return func(c *memoryConfig) {
+		c.policy = p
+	}
+}
+
+// Memory delivers the events published to topics to the subscribers of the
+// same process, e.g. for a single instance or for tests. Topics are made of
+// segments separated by dots, and the topics subscribed to may hold wildcards:
+// * matches a single segment, e.g. rooms.*.messages, and a trailing > the
+// remaining ones, e.g. rooms.>.
+//
+// The channels of a Memory[interface{}] can be returned straight from
+// GraphQLService.Subscribe.
+type Memory[T any] struct {
+	config memoryConfig
+
+	mu   sync.RWMutex
+	subs map[string]map[*memorySub[T]]struct{}
+}
+
+// memorySub is a subscriber, done is closed once it's gone and c once no more
+// events are sent to it
+type memorySub[T any] struct {
+	c    chan T
+	done chan struct{}
+	once sync.Once
+
+	// mu serializes the sends with closing c
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewMemory returns an in-memory PubSub of events of type T
+func NewMemory[T any](options ...MemoryOption) *Memory[T] {
+	config := memoryConfig{buffer: 16}
+	for _, opt := range options {
+		opt(&config)
+	}
+	return &Memory[T]{config: config, subs: map[string]map[*memorySub[T]]struct{}{}}
+}
+
+// Subscribe returns a channel of the events published to the topics matching
+// topic until ctx is done, the channel is then closed
+func (m *Memory[T]) Subscribe(ctx context.Context, topic string) <-chan T {
+	s := &memorySub[T]{c: make(chan T, m.config.buffer), done: make(chan struct{})}
+
+	m.mu.Lock()
+	subs := m.subs[topic]
+	if subs == nil {
+		subs = map[*memorySub[T]]struct{}{}
+		m.subs[topic] = subs
+	}
+	subs[s] = struct{}{}
+	m.mu.Unlock()
+
+	context.AfterFunc(ctx, func() { m.unsubscribe(topic, s) })
+	return s.c
+}
+
+// Publish sends event to the subscribers of topic, under the Block policy it
+// returns ctx.Err() if ctx is done before they all received it
+func (m *Memory[T]) Publish(ctx context.Context, topic string, event T) error {
+	type subscription struct {
+		topic string
+		sub   *memorySub[T]
+	}
+	var subs []subscription
+	m.mu.RLock()
+	for pattern, ss := range m.subs {
+		if !matchTopic(pattern, topic) {
+			continue
+		}
+		for s := range ss {
+			subs = append(subs, subscription{pattern, s})
+		}
+	}
+	m.mu.RUnlock()
+
+	for _, s := range subs {
+		if !m.send(ctx, s.sub, event) {
+			m.unsubscribe(s.topic, s.sub)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send sends event to s according to the SlowPolicy, it returns false if s
+// should be disconnected
+func (m *Memory[T]) send(ctx context.Context, s *memorySub[T], event T) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return true
+	}
+
+	select {
+	case s.c <- event:
+		return true
+	default:
+	}
+
+	switch m.config.policy {
+	case DropNewest:
+	case DropOldest:
+		for {
+			select {
+			case <-s.c:
+			default:
+			}
+			select {
+			case s.c <- event:
+				return true
+			default:
+			}
+		}
+	case Disconnect:
+		return false
+	default:
+		select {
+		case s.c <- event:
+		case <-s.done:
+		case <-ctx.Done():
+		}
+	}
+	return true
+}
+
+func (m *Memory[T]) unsubscribe(topic string, s *memorySub[T]) {
+	m.mu.Lock()
+	if subs := m.subs[topic]; subs != nil {
+		delete(subs, s)
+		if len(subs) == 0 {
+			delete(m.subs, topic)
+		}
+	}
+	m.mu.Unlock()
+
+	// a send blocked on s gives up before c is closed
+	s.once.Do(func() {
+		close(s.done)
+		s.mu.Lock()
+		s.closed = true
+		close(s.c)
+		s.mu.Unlock()
+	})
+}
+
+// matchTopic reports whether topic matches pattern, see Memory
+func matchTopic(pattern string, topic string) bool {
+	if pattern == topic {
+		return true
+	}
+	if !strings.ContainsAny(pattern, "*>") {
+		return false
+	}
+
+	ps, ts := strings.Split(pattern, "."), strings.Split(topic, ".")
+	for i, p := range ps {
+		if p == ">" && i == len(ps)-1 {
+			return len(ts) > i
+		}
+		if i == len(ts) || (p != "*" && p != ts[i]) {
+			return false
+		}
+	}
+	return len(ps) == len(ts)
+}
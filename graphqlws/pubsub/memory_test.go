@@ -0,0 +1,130 @@
+package pubsub_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/pubsub"
+)
+
+func expectEvents(t *testing.T, c <-chan int, events ...int) {
+	t.Helper()
+	for _, expected := range events {
+		select {
+		case event := <-c:
+			if event != expected {
+				t.Fatalf("expected %d but instead got %d", expected, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected %d", expected)
+		}
+	}
+}
+
+func expectNoEvent(t *testing.T, c <-chan int) {
+	t.Helper()
+	select {
+	case event, more := <-c:
+		if more {
+			t.Fatalf("unexpected %d", event)
+		}
+	default:
+	}
+}
+
+func TestMemory(t *testing.T) {
+	m := pubsub.NewMemory[int]()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	exact := m.Subscribe(ctx, "rooms.1.messages")
+	single := m.Subscribe(ctx, "rooms.*.messages")
+	rest := m.Subscribe(ctx, "rooms.>")
+	for i, topic := range []string{"rooms.1.messages", "rooms.2.messages", "rooms.2.members", "rooms", "users.1.messages"} {
+		if err := m.Publish(ctx, topic, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectEvents(t, exact, 0)
+	expectEvents(t, single, 0, 1)
+	expectEvents(t, rest, 0, 1, 2)
+	for _, c := range []<-chan int{exact, single, rest} {
+		expectNoEvent(t, c)
+	}
+
+	// the channels are closed with the subscriptions
+	cancel()
+	for _, c := range []<-chan int{exact, single, rest} {
+		for range c {
+		}
+	}
+	if err := m.Publish(context.Background(), "rooms.1.messages", 5); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemorySlowPolicies(t *testing.T) {
+	tests := []struct {
+		policy   pubsub.SlowPolicy
+		expected []int
+		closed   bool
+	}{
+		{policy: pubsub.DropNewest, expected: []int{0, 1}},
+		{policy: pubsub.DropOldest, expected: []int{2, 3}},
+		{policy: pubsub.Disconnect, expected: []int{0, 1}, closed: true},
+	}
+	for _, tt := range tests {
+		m := pubsub.NewMemory[int](pubsub.Buffer(2), pubsub.OnSlow(tt.policy))
+		ctx, cancel := context.WithCancel(context.Background())
+		c := m.Subscribe(ctx, "events")
+		for i := 0; i < 4; i++ {
+			if err := m.Publish(ctx, "events", i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		expectEvents(t, c, tt.expected...)
+		select {
+		case _, more := <-c:
+			if more || !tt.closed {
+				t.Fatalf("policy %d: unexpected closing of the subscription", tt.policy)
+			}
+		default:
+			if tt.closed {
+				t.Fatalf("policy %d: expected the subscription to be closed", tt.policy)
+			}
+		}
+		cancel()
+	}
+}
+
+func TestMemoryBlock(t *testing.T) {
+	m := pubsub.NewMemory[int](pubsub.Buffer(1))
+	c := m.Subscribe(context.Background(), "events")
+	if err := m.Publish(context.Background(), "events", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Publish waits for the subscriber
+	published := make(chan error)
+	go func() { published <- m.Publish(context.Background(), "events", 1) }()
+	select {
+	case <-published:
+		t.Fatal("expected Publish to wait for the subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+	expectEvents(t, c, 0)
+	if err := <-published; err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, c, 1)
+
+	// or until its context is done
+	if err := m.Publish(context.Background(), "events", 2); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := m.Publish(ctx, "events", 3); err != context.DeadlineExceeded {
+		t.Fatalf("expected %v but instead got %v", context.DeadlineExceeded, err)
+	}
+}
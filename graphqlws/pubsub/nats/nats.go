@@ -0,0 +1,112 @@
+//go:build nats
+// +build nats
+
+// Package nats is an event bridge over NATS JetStream, see the pubsub
+// package. It's only built with the nats build tag, so that depending on
+// graphqlws doesn't pull in the NATS client.
+package nats
+
+import (
+	"context"
+	"time"
+
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/pubsub"
+)
+
+// DurableFunc returns the name of the durable consumer of a subscription to
+// topic, e.g. derived from the user and the operation name found in ctx, or an
+// empty string for an ephemeral consumer
+type DurableFunc func(ctx context.Context, topic string) string
+
+type bridge struct {
+	js      jetstream.JetStream
+	stream  string
+	durable DurableFunc
+	ackWait time.Duration
+}
+
+// Option configures a bridge
+type Option func(b *bridge)
+
+// Durable makes subscriptions consume with the durable consumers named by fn,
+// which keep track of the events acknowledged across server restarts and
+// reconnections. The events published while no one was subscribed, or which
+// weren't delivered to the client, are then delivered once subscribed again,
+// at least once. Subscriptions sharing a durable consumer share its events,
+// so its name should be unique to a subscriber.
+func Durable(fn DurableFunc) Option {
+	return func(b *bridge) {
+		b.durable = fn
+	}
+}
+
+// AckWait sets how long the events not acknowledged are waited for before
+// being redelivered, 30s by default
+func AckWait(d time.Duration) Option {
+	return func(b *bridge) {
+		b.ackWait = d
+	}
+}
+
+// New returns an event bridge publishing to and consuming from stream, whose
+// subjects must cover the topics. Topics are subjects, which may hold the *
+// and > wildcards when subscribed to. Events are acknowledged with the Ack of
+// their Message, i.e. once delivered to the client when subscribed to with
+// pubsub.Payloads, and redelivered otherwise, see AckWait.
+//
+// By default subscriptions consume with ephemeral consumers delivering the
+// events published from then on, removed by JetStream once inactive.
+func New(js jetstream.JetStream, stream string, options ...Option) pubsub.PubSub {
+	b := &bridge{js: js, stream: stream}
+	for _, opt := range options {
+		opt(b)
+	}
+	return b
+}
+
+func (b *bridge) Publish(ctx context.Context, topic string, payload []byte) error {
+	_, err := b.js.Publish(ctx, topic, payload)
+	return err
+}
+
+func (b *bridge) Subscribe(ctx context.Context, topic string) (<-chan pubsub.Message, error) {
+	config := jetstream.ConsumerConfig{
+		FilterSubject: topic,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		DeliverPolicy: jetstream.DeliverNewPolicy,
+		AckWait:       b.ackWait,
+	}
+	if b.durable != nil {
+		config.Durable = b.durable(ctx, topic)
+	}
+	consumer, err := b.js.CreateOrUpdateConsumer(ctx, b.stream, config)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := consumer.Messages()
+	if err != nil {
+		return nil, err
+	}
+
+	c := make(chan pubsub.Message)
+	go func() {
+		defer close(c)
+		defer messages.Stop()
+		for {
+			msg, err := messages.Next(jetstream.NextContext(ctx))
+			if err != nil {
+				// the iterator itself reconnects, it only fails once
+				// stopped or ctx is done
+				return
+			}
+			select {
+			case c <- pubsub.Message{Topic: msg.Subject(), Payload: msg.Data(), Ack: func() { msg.Ack() }}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return c, nil
+}
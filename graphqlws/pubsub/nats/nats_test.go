@@ -0,0 +1,127 @@
+//go:build nats
+// +build nats
+
+package nats_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natsclient "github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/pubsub"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/pubsub/nats"
+)
+
+// runJetStream starts a NATS server with JetStream and the stream EVENTS of
+// the events.> subjects
+func runJetStream(t *testing.T) jetstream.JetStream {
+	t.Helper()
+	ns, err := server.NewServer(&server.Options{Port: -1, JetStream: true, StoreDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go ns.Start()
+	t.Cleanup(ns.Shutdown)
+	if !ns.ReadyForConnections(5 * time.Second) {
+		t.Fatal("expected the NATS server to start")
+	}
+
+	nc, err := natsclient.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := js.CreateStream(context.Background(), jetstream.StreamConfig{Name: "EVENTS", Subjects: []string{"events.>"}}); err != nil {
+		t.Fatal(err)
+	}
+	return js
+}
+
+func expectMessage(t *testing.T, c <-chan pubsub.Message, topic string, payload string) pubsub.Message {
+	t.Helper()
+	select {
+	case msg := <-c:
+		if msg.Topic != topic || string(msg.Payload) != payload {
+			t.Fatalf("expected %s on %s but instead got %s on %s", payload, topic, msg.Payload, msg.Topic)
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected %s on %s", payload, topic)
+		return pubsub.Message{}
+	}
+}
+
+func TestBridge(t *testing.T) {
+	b := nats.New(runJetStream(t), "EVENTS")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := b.Subscribe(ctx, "events.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Publish(ctx, "events.a", []byte(`{"data":{"n":1}}`)); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, c, "events.a", `{"data":{"n":1}}`).Ack()
+
+	cancel()
+	for range c {
+	}
+}
+
+func TestBridgeDurable(t *testing.T) {
+	b := nats.New(runJetStream(t), "EVENTS",
+		nats.Durable(func(ctx context.Context, topic string) string { return "client-1" }),
+		nats.AckWait(100*time.Millisecond),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c, err := b.Subscribe(ctx, "events.a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Publish(ctx, "events.a", []byte(`{"data":{"n":1}}`)); err != nil {
+		t.Fatal(err)
+	}
+	// not acknowledged, as if the client had gone before its delivery
+	expectMessage(t, c, "events.a", `{"data":{"n":1}}`)
+	cancel()
+	for range c {
+	}
+
+	// published while no one is subscribed
+	if err := b.Publish(context.Background(), "events.a", []byte(`{"data":{"n":2}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	c, err = b.Subscribe(ctx, "events.a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the event not acknowledged is redelivered once the AckWait is over,
+	// possibly after the other one
+	pending := map[string]bool{`{"data":{"n":1}}`: true, `{"data":{"n":2}}`: true}
+	for len(pending) > 0 {
+		select {
+		case msg := <-c:
+			if !pending[string(msg.Payload)] {
+				t.Fatalf("unexpected %s", msg.Payload)
+			}
+			delete(pending, string(msg.Payload))
+			msg.Ack()
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %v", pending)
+		}
+	}
+}
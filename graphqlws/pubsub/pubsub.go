@@ -0,0 +1,81 @@
+// Package pubsub is the API of the event bridges carrying the events of
+// subscriptions between the instances of a server, so that clients connected
+// to any instance behind a load balancer receive the events published by the
+// others. Its implementations live in subpackages, e.g. pubsub/redis.
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+// Message is an event published to a topic
+type Message struct {
+	// Topic is the topic the event was published to, which may differ from
+	// the topic subscribed to when the latter is a pattern
+	Topic   string
+	Payload []byte
+	// Ack, if not nil, acknowledges the event once delivered, bridges
+	// delivering events at least once redeliver those which aren't
+	Ack func()
+}
+
+// Publisher publishes events to topics
+type Publisher interface {
+	Publish(ctx context.Context, topic string, payload []byte) error
+}
+
+// Subscriber delivers the events published to topics
+type Subscriber interface {
+	// Subscribe returns a channel of the events published to topic until ctx
+	// is done, the channel is then closed
+	Subscribe(ctx context.Context, topic string) (<-chan Message, error)
+}
+
+// PubSub is implemented by the event bridges both publishing and delivering
+// events
+type PubSub interface {
+	Publisher
+	Subscriber
+}
+
+// Payloads subscribes to topic with s, it returns a channel of the payloads
+// of the events meant to be returned from GraphQLService.Subscribe. Payloads
+// are expected to be JSON encoded GraphQL responses, as published with
+// PublishResponse, and are forwarded as is. Events to acknowledge are so once
+// written to the client, as a graphqlws.Delivery.
+func Payloads(ctx context.Context, s Subscriber, topic string) (<-chan interface{}, error) {
+	messages, err := s.Subscribe(ctx, topic)
+	if err != nil {
+		return nil, err
+	}
+
+	c := make(chan interface{})
+	go func() {
+		defer close(c)
+		for msg := range messages {
+			var payload interface{} = json.RawMessage(msg.Payload)
+			if msg.Ack != nil {
+				payload = graphqlws.Delivery{Payload: payload, Delivered: msg.Ack}
+			}
+			select {
+			case c <- payload:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return c, nil
+}
+
+// PublishResponse publishes the JSON encoding of response, e.g. a
+// *graphql.Response, to topic with p
+func PublishResponse(ctx context.Context, p Publisher, topic string, response interface{}) error {
+	payload, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	return p.Publish(ctx, topic, payload)
+}
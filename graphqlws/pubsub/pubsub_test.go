@@ -0,0 +1,55 @@
+package pubsub_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/pubsub"
+)
+
+// chanPubSub delivers the events published to any topic to its subscriber
+type chanPubSub chan pubsub.Message
+
+func (c chanPubSub) Publish(ctx context.Context, topic string, payload []byte) error {
+	c <- pubsub.Message{Topic: topic, Payload: payload}
+	return nil
+}
+
+func (c chanPubSub) Subscribe(ctx context.Context, topic string) (<-chan pubsub.Message, error) {
+	return c, nil
+}
+
+func TestPayloads(t *testing.T) {
+	ps := make(chanPubSub, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	c, err := pubsub.Payloads(ctx, ps, "messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pubsub.PublishResponse(ctx, ps, "messages", map[string]interface{}{"data": map[string]int{"n": 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if payload, ok := (<-c).(json.RawMessage); !ok || string(payload) != `{"data":{"n":1}}` {
+		t.Fatalf("expected the published response but instead got %v", payload)
+	}
+
+	// events to acknowledge are so once delivered
+	acked := make(chan struct{})
+	ps <- pubsub.Message{Topic: "messages", Payload: []byte(`{"data":{"n":2}}`), Ack: func() { close(acked) }}
+	d, ok := (<-c).(graphqlws.Delivery)
+	if payload, _ := d.Payload.(json.RawMessage); !ok || string(payload) != `{"data":{"n":2}}` {
+		t.Fatalf("expected a delivery of the published response but instead got %v", d)
+	}
+	d.Delivered()
+	<-acked
+
+	// the payloads end with the subscription
+	close(ps)
+	if _, more := <-c; more {
+		t.Fatal("expected the payloads to be closed")
+	}
+}
@@ -0,0 +1,139 @@
+//go:build redis
+// +build redis
+
+// Package redis is an event bridge over Redis Pub/Sub, see the pubsub
+// package. It's only built with the redis build tag, so that depending on
+// graphqlws doesn't pull in the Redis client.
+package redis
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/pubsub"
+)
+
+// maxReconnectDelay bounds the delay between reconnection attempts, which
+// doubles after each failure
+const maxReconnectDelay = 30 * time.Second
+
+type bridge struct {
+	client         goredis.UniversalClient
+	reconnectDelay time.Duration
+	onError        func(topic string, err error)
+}
+
+// Option configures a bridge
+type Option func(b *bridge)
+
+// ReconnectDelay sets the delay before resubscribing once the connection of a
+// subscription is lost, 100ms by default. It doubles after each failed
+// attempt up to 30s, and is reset once the subscription is restored.
+func ReconnectDelay(d time.Duration) Option {
+	return func(b *bridge) {
+		b.reconnectDelay = d
+	}
+}
+
+// OnError sets the function the errors of the subscriptions to topics are
+// passed to, e.g. to log them. The events published while the connection of
+// a subscription is lost aren't delivered, as Redis Pub/Sub doesn't keep them.
+func OnError(fn func(topic string, err error)) Option {
+	return func(b *bridge) {
+		b.onError = fn
+	}
+}
+
+// New returns an event bridge publishing and subscribing with client. Topics
+// holding glob-style special characters, i.e. *, ? or [, are patterns
+// subscribed to with PSUBSCRIBE, and the Topic of the messages received is
+// then the channel they were published to.
+func New(client goredis.UniversalClient, options ...Option) pubsub.PubSub {
+	b := &bridge{client: client, reconnectDelay: 100 * time.Millisecond}
+	for _, opt := range options {
+		opt(b)
+	}
+	return b
+}
+
+func (b *bridge) Publish(ctx context.Context, topic string, payload []byte) error {
+	return b.client.Publish(ctx, topic, payload).Err()
+}
+
+// Subscribe subscribes to topic, the subscription is restored whenever its
+// connection is lost until ctx is done
+func (b *bridge) Subscribe(ctx context.Context, topic string) (<-chan pubsub.Message, error) {
+	var ps *goredis.PubSub
+	if isPattern(topic) {
+		ps = b.client.PSubscribe(ctx, topic)
+	} else {
+		ps = b.client.Subscribe(ctx, topic)
+	}
+	// the confirmation tells whether the subscription succeeded
+	if _, err := ps.Receive(ctx); err != nil {
+		ps.Close()
+		return nil, err
+	}
+
+	c := make(chan pubsub.Message)
+	go func() {
+		defer close(c)
+		// reads are only interrupted by closing the subscription
+		stop := context.AfterFunc(ctx, func() { ps.Close() })
+		defer func() {
+			if stop() {
+				ps.Close()
+			}
+		}()
+		b.receive(ctx, topic, ps, c)
+	}()
+	return c, nil
+}
+
+// receive forwards the messages of ps to c until ctx is done. Receiving again
+// after an error reconnects and resubscribes.
+func (b *bridge) receive(ctx context.Context, topic string, ps *goredis.PubSub, c chan<- pubsub.Message) {
+	delay := b.reconnectDelay
+	for {
+		msg, err := ps.Receive(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if b.onError != nil {
+				b.onError(topic, err)
+			}
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			}
+			if delay *= 2; delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+			continue
+		}
+
+		switch msg := msg.(type) {
+		case *goredis.Subscription:
+			// resubscribed
+			delay = b.reconnectDelay
+		case *goredis.Message:
+			delay = b.reconnectDelay
+			select {
+			case c <- pubsub.Message{Topic: msg.Channel, Payload: []byte(msg.Payload)}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+func isPattern(topic string) bool {
+	return strings.ContainsAny(topic, "*?[")
+}
@@ -0,0 +1,138 @@
+//go:build redis
+// +build redis
+
+package redis_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/pubsub"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/pubsub/redis"
+)
+
+func expectMessage(t *testing.T, c <-chan pubsub.Message, expected pubsub.Message) {
+	t.Helper()
+	select {
+	case msg := <-c:
+		if msg.Topic != expected.Topic || string(msg.Payload) != string(expected.Payload) {
+			t.Fatalf("expected %s on %s but instead got %s on %s", expected.Payload, expected.Topic, msg.Payload, msg.Topic)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected %s on %s", expected.Payload, expected.Topic)
+	}
+}
+
+// publishSubscribed publishes payload to topic once it has a subscriber
+func publishSubscribed(t *testing.T, client *goredis.Client, topic string, payload string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n, err := client.Publish(context.Background(), topic, payload).Result()
+		if err == nil && n > 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %s to have a subscriber", topic)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBridge(t *testing.T) {
+	s := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	defer client.Close()
+	b := redis.New(client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := b.Subscribe(ctx, "messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	patterns, err := b.Subscribe(ctx, "rooms.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Publish(ctx, "messages", []byte(`{"data":{"n":1}}`)); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, c, pubsub.Message{Topic: "messages", Payload: []byte(`{"data":{"n":1}}`)})
+	if err := b.Publish(ctx, "rooms.1", []byte(`{"data":{"n":2}}`)); err != nil {
+		t.Fatal(err)
+	}
+	expectMessage(t, patterns, pubsub.Message{Topic: "rooms.1", Payload: []byte(`{"data":{"n":2}}`)})
+
+	cancel()
+	for range c {
+	}
+	for range patterns {
+	}
+}
+
+func TestBridgeReconnect(t *testing.T) {
+	s := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	defer client.Close()
+	errs := make(chan error, 100)
+	b := redis.New(client, redis.ReconnectDelay(10*time.Millisecond), redis.OnError(func(topic string, err error) {
+		errs <- err
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := b.Subscribe(ctx, "messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Close()
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the subscription to fail")
+	}
+	if err := s.Restart(); err != nil {
+		t.Fatal(err)
+	}
+
+	publishSubscribed(t, client, "messages", `{"data":{"n":1}}`)
+	expectMessage(t, c, pubsub.Message{Topic: "messages", Payload: []byte(`{"data":{"n":1}}`)})
+}
+
+func TestPayloads(t *testing.T) {
+	s := miniredis.RunT(t)
+	client := goredis.NewClient(&goredis.Options{Addr: s.Addr()})
+	defer client.Close()
+	b := redis.New(client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := pubsub.Payloads(ctx, b, "messages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pubsub.PublishResponse(ctx, b, "messages", map[string]interface{}{"data": map[string]int{"n": 1}}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case payload := <-c:
+		if raw, ok := payload.(json.RawMessage); !ok || string(raw) != `{"data":{"n":1}}` {
+			t.Fatalf("expected the published response but instead got %v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a payload")
+	}
+
+	cancel()
+	for range c {
+	}
+}
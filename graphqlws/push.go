@@ -0,0 +1,67 @@
+package graphqlws
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// Push sends a data message with id and payload, a JSON encoded GraphQL
+// response, to the client of the connection ctx belongs to, bypassing the
+// channels returned by the service, e.g. to tell it it's been logged out
+// elsewhere. The id may be that of a running operation or one the client
+// expects such messages on, but with ProtocolGraphQLTransportWS, whose clients
+// only expect messages for the operations they run, it must be a running
+// one. It returns false if ctx doesn't belong to a connection, or it isn't
+// acknowledged yet or is closed, or if the message isn't delivered because of
+// its id. See ConnectionManager to push to connections by id, subject or topic.
+func Push(ctx context.Context, id string, payload json.RawMessage) bool {
+	return connection.Push(ctx, id, payload)
+}
+
+// JoinTopic joins the operation ctx belongs to, e.g. the context passed to the
+// Subscribe method of the service, to topic until it ends, so that it's sent
+// what's pushed to the topic with ConnectionManager.PushTopic. It returns
+// false if ctx doesn't belong to a running operation.
+func JoinTopic(ctx context.Context, topic string) bool {
+	return connection.JoinTopic(ctx, topic)
+}
+
+// LeaveTopic makes the operation ctx belongs to leave topic, see JoinTopic
+func LeaveTopic(ctx context.Context, topic string) {
+	connection.LeaveTopic(ctx, topic)
+}
+
+// Push pushes a data message with id and payload to the live connection
+// connID, see Push, it returns false if there's no such connection
+func (m *ConnectionManager) Push(connID ConnectionID, id string, payload json.RawMessage) bool {
+	_, ctx, ok := m.lookup(connID)
+	return ok && connection.Push(ctx, id, payload)
+}
+
+// PushSubject pushes a data message with id and payload to all the live
+// connections belonging to subject, see WithConnectionSubject, and returns how
+// many there were
+func (m *ConnectionManager) PushSubject(subject string, id string, payload json.RawMessage) int {
+	n := 0
+	m.each(func(c *serverConn, ctx context.Context) bool {
+		if c.subject == subject && connection.Push(ctx, id, payload) {
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// PushTopic pushes a data message with payload to all the running operations
+// which joined topic, see JoinTopic, each with its own id, and returns how
+// many there were
+func (m *ConnectionManager) PushTopic(topic string, payload json.RawMessage) int {
+	n := 0
+	m.each(func(c *serverConn, ctx context.Context) bool {
+		n += connection.PushTopic(ctx, topic, payload)
+		return true
+	})
+	return n
+}
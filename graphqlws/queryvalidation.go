@@ -0,0 +1,47 @@
+package graphqlws
+
+import (
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+var (
+	// ErrQueryTooDeep is the error of the operations whose selections are
+	// nested deeper than allowed, see MaxQueryDepth
+	ErrQueryTooDeep = connection.ErrQueryTooDeep
+	// ErrQueryTooComplex is the error of the operations whose cost is higher
+	// than allowed, see MaxQueryComplexity
+	ErrQueryTooComplex = connection.ErrQueryTooComplex
+)
+
+// QueryValidator checks the parsed document of an operation before it's
+// passed to the service, see WithQueryValidators
+type QueryValidator = connection.QueryValidator
+
+// ComplexityFunc returns the cost of a field given the complexity of its
+// selections, see MaxQueryComplexity
+type ComplexityFunc = connection.ComplexityFunc
+
+// MaxQueryDepth returns a QueryValidator rejecting the operations with fields
+// nested more than n levels deep with ErrQueryTooDeep, with the extensions
+// code QUERY_TOO_DEEP
+func MaxQueryDepth(n int) QueryValidator {
+	return connection.MaxDepth(n)
+}
+
+// MaxQueryComplexity returns a QueryValidator rejecting the operations whose
+// cost is higher than max with ErrQueryTooComplex, with the extensions code
+// QUERY_TOO_COMPLEX. The cost of each field is returned by fn, with a nil fn
+// it is 1 plus the complexity of its selections.
+func MaxQueryComplexity(max int, fn ComplexityFunc) QueryValidator {
+	return connection.MaxComplexity(max, fn)
+}
+
+// WithQueryValidators checks the documents of operations with validators
+// before they're passed to the service, e.g. to reject abusive subscriptions
+// with MaxQueryDepth and MaxQueryComplexity. Documents that can't be parsed
+// fail with the extensions code GRAPHQL_PARSE_FAILED.
+func WithQueryValidators(validators ...QueryValidator) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.ValidateQueries(validators...))
+	}
+}
@@ -0,0 +1,52 @@
+package graphqlws
+
+import (
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// RateLimitPolicy is what happens to the messages sent beyond a rate limit,
+// see WithRateLimitPolicy
+type RateLimitPolicy = connection.RateLimitPolicy
+
+// The rate limit policies
+const (
+	RateLimitError = connection.RateLimitError
+	RateLimitClose = connection.RateLimitClose
+)
+
+// WithMessageRate limits each client to perSecond incoming messages per
+// second on average, in bursts of up to burst messages. The stop and
+// connection_terminate messages are never limited.
+func WithMessageRate(perSecond float64, burst int) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.MessageRate(perSecond, burst))
+	}
+}
+
+// WithStartRate limits each client to perMinute start messages, i.e.
+// subscribe messages with ProtocolGraphQLTransportWS, per minute, e.g. to
+// survive buggy clients starting and stopping operations in a loop
+func WithStartRate(perMinute int) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.StartRate(perMinute))
+	}
+}
+
+// WithMaxInits limits to n the connection_init messages each client may send
+// over the lifetime of its connection
+func WithMaxInits(n int) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.MaxInits(n))
+	}
+}
+
+// WithRateLimitPolicy sets what happens to the messages sent beyond the
+// limits of WithMessageRate, WithStartRate and WithMaxInits: by default they
+// are dropped and answered with an error whose extensions code is
+// RATE_LIMITED, under RateLimitClose the connection is closed with
+// ErrRateLimited and the CloseTooManyRequests close code instead.
+func WithRateLimitPolicy(policy RateLimitPolicy) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.RateLimits(policy))
+	}
+}
@@ -0,0 +1,32 @@
+package graphqlws
+
+import (
+	"context"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// ErrorReporter is notified of panics and of errors that can't be reported to
+// the client, see the sentry package for an implementation
+type ErrorReporter = connection.ErrorReporter
+
+// PanicError is a panic recovered from a service call, a handler or hook
+type PanicError = connection.PanicError
+
+// WithErrorReporter sets the ErrorReporter of every connection, it's also
+// passed the errors of the connections which couldn't be served, e.g. polled by
+// the EventLoop. Panics are still resumed once reported, unless they're
+// recovered, see WithServicePanics and WithPanicHandler.
+func WithErrorReporter(r ErrorReporter) Option {
+	return func(h *handler) {
+		h.errorReporter = r
+		h.connOptions = append(h.connOptions, connection.ReportErrors(r))
+	}
+}
+
+// reportError reports the errors of connections which couldn't be served
+func (h *handler) reportError(ctx context.Context, err error) {
+	if h.errorReporter != nil {
+		h.errorReporter.ReportError(ctx, "", err)
+	}
+}
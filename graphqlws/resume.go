@@ -0,0 +1,48 @@
+package graphqlws
+
+import (
+	"context"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// Event wraps a subscription payload with an ID that is forwarded to the
+// client, which can then send it back as lastEventId to resume the stream.
+type Event = connection.Event
+
+// LastEventIDFromContext returns the lastEventId sent by the client when
+// starting the operation, if any. Services use it in Subscribe to resume the
+// stream right after that event.
+func LastEventIDFromContext(ctx context.Context) (string, bool) {
+	return connection.LastEventIDFromContext(ctx)
+}
+
+// EventStore records the events of subscriptions so that those missed by
+// resuming clients are replayed, see WithEventStore
+type EventStore = connection.EventStore
+
+// StreamFunc returns the stream of events of a subscription, see
+// WithEventStore
+type StreamFunc = connection.StreamFunc
+
+// MemoryEventStore is an EventStore keeping the latest events of each stream
+// in memory
+type MemoryEventStore = connection.MemoryEventStore
+
+// NewMemoryEventStore returns a MemoryEventStore keeping the latest limit
+// events of each stream
+func NewMemoryEventStore(limit int) *MemoryEventStore {
+	return connection.NewMemoryEventStore(limit)
+}
+
+// WithEventStore records the Event values sent on subscriptions to store, in
+// the stream returned by fn, so that clients resuming with a lastEventId, e.g.
+// after losing their network for a while, are first sent the events they
+// missed and then the live ones. With a nil fn subscriptions share a stream
+// when they have the same document, operation name and variables, i.e. their
+// events are assumed to be the same for every client.
+func WithEventStore(store EventStore, fn StreamFunc) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.ReplayEvents(store, fn))
+	}
+}
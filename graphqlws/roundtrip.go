@@ -0,0 +1,26 @@
+package graphqlws
+
+import (
+	"context"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// WithRoundTripMeasurement lets clients opt in to round-trip time measurement
+// by sending {"rtt": true} in the connection_init payload, the server then
+// sends them {"type":"ping","payload":{"seq":n}} every interval, which they
+// answer with a pong echoing the payload. fn, if not nil, is called with each
+// measure, e.g. to record it as a metric.
+func WithRoundTripMeasurement(interval time.Duration, fn func(ctx context.Context, rtt time.Duration)) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.MeasureRoundTrips(interval, fn))
+	}
+}
+
+// RoundTripFromContext returns the last round-trip time measured for the
+// connection ctx belongs to, ctx being the context of the connection or of one
+// of its operations, false if there's none yet
+func RoundTripFromContext(ctx context.Context) (time.Duration, bool) {
+	return connection.RoundTripFromContext(ctx)
+}
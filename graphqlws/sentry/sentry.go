@@ -0,0 +1,64 @@
+//go:build sentry
+// +build sentry
+
+// Package sentry provides a graphqlws.ErrorReporter sending panics and errors
+// to Sentry. It's only built with the sentry build tag, so that depending on
+// graphqlws doesn't pull in the Sentry SDK.
+package sentry
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	sentrygo "github.com/getsentry/sentry-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+// flushTimeout bounds how long reporting a panic waits for the event to be
+// sent, since the process is likely about to crash
+const flushTimeout = 2 * time.Second
+
+type reporter struct {
+	hub *sentrygo.Hub
+}
+
+// Reporter returns a graphqlws.ErrorReporter capturing errors with the hub of
+// the context they occurred in, if any, or else with hub, or the current hub
+// if hub is nil. Events are tagged with the connection, operation and socket
+// ids.
+func Reporter(hub *sentrygo.Hub) graphqlws.ErrorReporter {
+	return &reporter{hub: hub}
+}
+
+func (r *reporter) ReportError(ctx context.Context, operationID string, err error) {
+	hub := sentrygo.GetHubFromContext(ctx)
+	if hub == nil {
+		hub = r.hub
+	}
+	if hub == nil {
+		hub = sentrygo.CurrentHub()
+	}
+	hub = hub.Clone()
+
+	hub.ConfigureScope(func(scope *sentrygo.Scope) {
+		if operationID != "" {
+			scope.SetTag("graphqlws.operation_id", operationID)
+		}
+		if id, ok := graphqlws.ConnectionIDFromContext(ctx); ok {
+			scope.SetTag("graphqlws.connection_id", string(id))
+		}
+		if socketID, ok := graphqlws.SocketIDFromContext(ctx); ok {
+			scope.SetTag("graphqlws.socket_id", socketID)
+		}
+	})
+
+	var pe *graphqlws.PanicError
+	if errors.As(err, &pe) {
+		hub.RecoverWithContext(ctx, pe.Value)
+		hub.Flush(flushTimeout)
+		return
+	}
+	hub.CaptureException(err)
+}
@@ -0,0 +1,58 @@
+//go:build sentry
+// +build sentry
+
+package sentry_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	sentrygo "github.com/getsentry/sentry-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/sentry"
+)
+
+func newHub(t *testing.T, events *[]*sentrygo.Event) *sentrygo.Hub {
+	client, err := sentrygo.NewClient(sentrygo.ClientOptions{
+		BeforeSend: func(event *sentrygo.Event, hint *sentrygo.EventHint) *sentrygo.Event {
+			*events = append(*events, event)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sentrygo.NewHub(client, sentrygo.NewScope())
+}
+
+func TestReporter(t *testing.T) {
+	var events []*sentrygo.Event
+	r := sentry.Reporter(newHub(t, &events))
+
+	ctx := graphqlws.ContextWithSocketID(context.Background(), "a-socket")
+	r.ReportError(ctx, "a-id", errors.New("failed"))
+	r.ReportError(ctx, "", &graphqlws.PanicError{Value: "boom"})
+
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events but instead got %d", len(events))
+	}
+
+	if got := events[0].Exception[0].Value; got != "failed" {
+		t.Fatalf("expected the error to be captured but instead got [%s]", got)
+	}
+	if got := events[0].Tags["graphqlws.operation_id"]; got != "a-id" {
+		t.Fatalf("expected the operation id tag but instead got [%s]", got)
+	}
+	if got := events[0].Tags["graphqlws.socket_id"]; got != "a-socket" {
+		t.Fatalf("expected the socket id tag but instead got [%s]", got)
+	}
+
+	if got := events[1].Message; got != "boom" {
+		t.Fatalf("expected the panic to be captured but instead got [%s]", got)
+	}
+	if _, ok := events[1].Tags["graphqlws.operation_id"]; ok {
+		t.Fatal("expected no operation id tag for a connection error")
+	}
+}
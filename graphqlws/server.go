@@ -0,0 +1,321 @@
+package graphqlws
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// Server serves GraphQL over websockets and keeps track of the live
+// connections
+type Server struct {
+	authValidator AuthValidator
+	connCount     connCounter
+	conns         connRegistry
+	drain         context.Context
+	shutdown      context.CancelFunc
+	h             handler
+	httpHandler   http.Handler
+	nextID        uint64
+	notReady      int32
+	releasing     int64
+	rootCtx       context.Context
+	svc           connection.GraphQLService
+}
+
+// NewServer returns a Server, requests which don't ask for one of the
+// subprotocols it speaks, see WithProtocols, are served by httpHandler
+func NewServer(rootCtx context.Context, svc connection.GraphQLService, httpHandler http.Handler, authValidator AuthValidator, options ...Option) *Server {
+	s := &Server{
+		authValidator: authValidator,
+		httpHandler:   httpHandler,
+		rootCtx:       rootCtx,
+		svc:           svc,
+	}
+	s.drain, s.shutdown = context.WithCancel(context.Background())
+	for _, opt := range options {
+		opt(&s.h)
+	}
+	if s.h.authValidator != nil {
+		s.authValidator = s.h.authValidator
+	}
+	return s
+}
+
+// SetReady sets whether the server is ready to start operations, servers are
+// ready unless told otherwise. While not ready connections are still accepted
+// and initialized but new operations are rejected with an error whose
+// extensions code is NOT_READY, e.g. until the caches of the service are warm.
+func (s *Server) SetReady(ready bool) {
+	var notReady int32
+	if !ready {
+		notReady = 1
+	}
+	atomic.StoreInt32(&s.notReady, notReady)
+}
+
+// Ready returns whether the server is ready to start operations, see SetReady
+func (s *Server) Ready() bool {
+	return atomic.LoadInt32(&s.notReady) == 0
+}
+
+// shutdownPollInterval is how often Shutdown checks whether all the
+// connections are closed
+const shutdownPollInterval = 10 * time.Millisecond
+
+// Shutdown gracefully shuts the connections of the server down, e.g. before a
+// rolling deploy replaces the instance: new websocket connections are refused
+// with 503 Service Unavailable and new operations rejected with
+// ErrServerShutdown, while the running operations are stopped and their
+// clients told they're complete. Connections are closed once those messages
+// are written, with a close frame with the 1001 (going away) close code, or
+// the steering hints if any, where the transport supports close frames.
+//
+// Shutdown returns once all the connections are closed and their goroutines
+// have returned, or ctx is done, in which case the remaining connections are
+// closed right away and the error of ctx is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdown()
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for s.conns.len() > 0 || atomic.LoadInt64(&s.releasing) > 0 {
+		select {
+		case <-ctx.Done():
+			s.conns.each(func(c *serverConn) { c.cancel() })
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// shuttingDown returns whether Shutdown was called
+func (s *Server) shuttingDown() bool {
+	return s.drain.Err() != nil
+}
+
+// ConnectionCount returns the number of live connections
+func (s *Server) ConnectionCount() int {
+	return s.conns.len()
+}
+
+// OperationCount returns the number of live operations of all the live
+// connections
+func (s *Server) OperationCount() int {
+	n := 0
+	s.conns.each(func(c *serverConn) {
+		if ctx, ok := c.ctx.Load().(context.Context); ok {
+			n += connection.OperationCount(ctx)
+		}
+	})
+	return n
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	protocol := s.h.negotiate(r)
+	if protocol == "" {
+		// Fallback to HTTP
+		s.httpHandler.ServeHTTP(w, r)
+		return
+	}
+	if s.shuttingDown() {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	release, ok := s.limitConnection(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, err := s.checkAuth(r)
+	if err != nil {
+		release()
+		s.rejectAuth(w, err)
+		return
+	}
+	if s.h.eventLoop != nil && protocol == ProtocolGraphQLWS {
+		conn, err := s.h.eventLoop.Upgrade(w, r, protocol)
+		if err != nil {
+			release()
+			return
+		}
+		ctx, options, untrack := s.track(ctx, release)
+		if err := s.h.eventLoop.Serve(conn, s.svc, ctx, options...); err != nil {
+			// the connection may have been closed before being attached, and
+			// then without closing as tracked
+			untrack()
+			s.h.reportError(ctx, err)
+		}
+		return
+	}
+
+	conn, err := s.h.upgradeWebSocket(w, r, protocol)
+	if err != nil {
+		release()
+		return
+	}
+
+	ctx, options, _ := s.track(ctx, release)
+	if protocol == ProtocolGraphQLTransportWS {
+		tc := newTransportWSConn(conn)
+		go connection.Connect(tc, s.svc, ctx, append(options, tc.options()...)...)
+		return
+	}
+	go connection.Connect(conn, s.svc, ctx, options...)
+}
+
+// track registers a new connection, it returns the context and the options
+// the connection should be started with so it's unregistered once closed,
+// after calling release if any, and the func unregistering it right away if
+// it couldn't be started
+func (s *Server) track(ctx context.Context, release func()) (context.Context, []connection.Option, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	c := &serverConn{
+		id:          atomic.AddUint64(&s.nextID, 1),
+		cancel:      cancel,
+		connectedAt: time.Now(),
+	}
+	if r, ok := RequestFromContext(ctx); ok {
+		c.remoteAddr = r.RemoteAddr
+	}
+	if s.h.subject != nil {
+		c.subject = s.h.subject(ctx)
+	}
+	s.conns.add(c)
+
+	options := make([]connection.Option, 0, len(s.h.connOptions)+4)
+	options = append(options, s.h.connOptions...)
+	options = append(options, connection.ReadyGate(s.Ready), connection.DrainOn(s.drain))
+	options = append(options, connection.OnOpen(func(ctx context.Context) {
+		c.ctx.Store(ctx)
+		s.conns.index(ctx, c)
+	}))
+	var once sync.Once
+	untrack := func() {
+		once.Do(func() {
+			if release != nil {
+				release()
+			}
+			// the goroutines of the connection are still returning, Shutdown
+			// waits for them
+			if ctx, ok := c.ctx.Load().(context.Context); ok {
+				atomic.AddInt64(&s.releasing, 1)
+				go func() {
+					connection.Wait(ctx)
+					atomic.AddInt64(&s.releasing, -1)
+				}()
+			}
+			s.conns.remove(c)
+			cancel()
+		})
+	}
+	options = append(options, connection.OnClose(untrack))
+	return ctx, options, untrack
+}
+
+// serverConn is a live connection tracked by a Server
+type serverConn struct {
+	id          uint64
+	cancel      func()
+	connectedAt time.Time
+	remoteAddr  string
+	subject     string
+	// ctx is the context of the connection once opened
+	ctx atomic.Value
+}
+
+const connRegistryShards = 64
+
+// connRegistry holds the live connections of a Server. It's sharded so that
+// connecting, disconnecting and walking over tens of thousands of connections
+// don't all serialize on a single lock.
+type connRegistry struct {
+	shards [connRegistryShards]connRegistryShard
+	// byID indexes the opened connections by ConnectionID
+	byID sync.Map
+}
+
+type connRegistryShard struct {
+	mu    sync.RWMutex
+	conns map[uint64]*serverConn
+}
+
+func (r *connRegistry) shard(id uint64) *connRegistryShard {
+	return &r.shards[id%connRegistryShards]
+}
+
+func (r *connRegistry) add(c *serverConn) {
+	s := r.shard(c.id)
+	s.mu.Lock()
+	if s.conns == nil {
+		s.conns = map[uint64]*serverConn{}
+	}
+	s.conns[c.id] = c
+	s.mu.Unlock()
+}
+
+func (r *connRegistry) remove(c *serverConn) {
+	s := r.shard(c.id)
+	s.mu.Lock()
+	delete(s.conns, c.id)
+	s.mu.Unlock()
+
+	if ctx, ok := c.ctx.Load().(context.Context); ok {
+		if id, ok := connection.ConnectionIDFromContext(ctx); ok {
+			r.byID.CompareAndDelete(id, c)
+		}
+	}
+}
+
+// index indexes c, opened with ctx, by its ConnectionID
+func (r *connRegistry) index(ctx context.Context, c *serverConn) {
+	if id, ok := connection.ConnectionIDFromContext(ctx); ok {
+		r.byID.Store(id, c)
+	}
+}
+
+// lookup returns the opened connection id
+func (r *connRegistry) lookup(id ConnectionID) (*serverConn, bool) {
+	v, ok := r.byID.Load(id)
+	if !ok {
+		return nil, false
+	}
+	return v.(*serverConn), true
+}
+
+func (r *connRegistry) len() int {
+	n := 0
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.mu.RLock()
+		n += len(s.conns)
+		s.mu.RUnlock()
+	}
+	return n
+}
+
+// each calls fn for every live connection. Shards are visited one at a time
+// and fn is called without holding any lock, so fn may be slow or close the
+// connection.
+func (r *connRegistry) each(fn func(c *serverConn)) {
+	var conns []*serverConn
+	for i := range r.shards {
+		s := &r.shards[i]
+		s.mu.RLock()
+		conns = conns[:0]
+		for _, c := range s.conns {
+			conns = append(conns, c)
+		}
+		s.mu.RUnlock()
+
+		for _, c := range conns {
+			fn(c)
+		}
+	}
+}
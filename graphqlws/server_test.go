@@ -0,0 +1,551 @@
+package graphqlws_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/graphqlwstest"
+)
+
+type gqlService struct{}
+
+func (gqlService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	c := make(chan interface{})
+	close(c)
+	return c, nil
+}
+
+func (gqlService) Exec(ctx context.Context, queryString string, operationName string, variables map[string]interface{}) *graphql.Response {
+	return &graphql.Response{}
+}
+
+type authValidator struct{}
+
+func (authValidator) CheckAuth(r *http.Request, ctx context.Context) (context.Context, error) {
+	return ctx, nil
+}
+
+// rejectingValidator rejects all the requests with err
+type rejectingValidator struct {
+	err error
+}
+
+func (v rejectingValidator) CheckAuth(r *http.Request, ctx context.Context) (context.Context, error) {
+	return nil, v.err
+}
+
+func TestServerAuthFailure(t *testing.T) {
+	for name, tc := range map[string]struct {
+		validator graphqlws.AuthValidator
+		options   []graphqlws.Option
+		status    int
+		body      string
+	}{
+		"default status": {
+			validator: rejectingValidator{err: errors.New("invalid token")},
+			status:    http.StatusUnauthorized,
+			body:      "Unauthorized\n",
+		},
+		"configured status": {
+			validator: rejectingValidator{err: errors.New("invalid token")},
+			options:   []graphqlws.Option{graphqlws.WithAuthFailureStatus(http.StatusForbidden)},
+			status:    http.StatusForbidden,
+			body:      "Forbidden\n",
+		},
+		"status of the error": {
+			validator: rejectingValidator{err: &graphqlws.AuthError{StatusCode: http.StatusTooManyRequests, Body: "slow down"}},
+			options:   []graphqlws.Option{graphqlws.WithAuthFailureStatus(http.StatusForbidden)},
+			status:    http.StatusTooManyRequests,
+			body:      "slow down\n",
+		},
+		"validator option": {
+			options: []graphqlws.Option{graphqlws.WithAuthValidator(graphqlws.BearerToken(verifyToken))},
+			status:  http.StatusUnauthorized,
+			body:    "Unauthorized\n",
+		},
+		"no validator": {
+			status: http.StatusSwitchingProtocols,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), tc.validator, tc.options...))
+			defer srv.Close()
+
+			dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+			ws, resp, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+			if err == nil {
+				defer ws.Close()
+			}
+			if resp == nil || resp.StatusCode != tc.status {
+				t.Fatalf("expected status %d but instead got %v", tc.status, err)
+			}
+			if tc.body == "" {
+				return
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if string(body) != tc.body {
+				t.Fatalf("expected %q but instead got %q", tc.body, body)
+			}
+		})
+	}
+}
+
+func TestServerConnectionCount(t *testing.T) {
+	s := graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), authValidator{})
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+	var conns []*websocket.Conn
+	for i := 0; i < 3; i++ {
+		ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns = append(conns, ws)
+	}
+	waitConnectionCount(t, s, 3)
+
+	for _, ws := range conns {
+		ws.Close()
+	}
+	waitConnectionCount(t, s, 0)
+}
+
+func waitConnectionCount(t *testing.T, s *graphqlws.Server, expected int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.ConnectionCount() != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d connections but instead got %d", expected, s.ConnectionCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func waitOperationCount(t *testing.T, s *graphqlws.Server, expected int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.OperationCount() != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d operations but instead got %d", expected, s.OperationCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServerCloseGracePeriod(t *testing.T) {
+	for name, terminate := range map[string]func(ws *websocket.Conn, cancel func()) error{
+		"by the client": func(ws *websocket.Conn, cancel func()) error {
+			return ws.WriteMessage(websocket.TextMessage, []byte(`{"type":"connection_terminate"}`))
+		},
+		"by the server": func(ws *websocket.Conn, cancel func()) error {
+			cancel()
+			return nil
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			// the grace period outlasts waitConnectionCount, so that the
+			// connection is only gone in time if the client acknowledged
+			s := graphqlws.NewServer(ctx, gqlService{}, http.NotFoundHandler(), authValidator{}, graphqlws.WithCloseGracePeriod(time.Minute))
+			srv := httptest.NewServer(s)
+			defer srv.Close()
+
+			dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+			ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ws.Close()
+			waitConnectionCount(t, s, 1)
+
+			if err := terminate(ws, cancel); err != nil {
+				t.Fatal(err)
+			}
+			_, _, err = ws.ReadMessage()
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				t.Fatalf("expected a normal closure but instead got %v", err)
+			}
+			waitConnectionCount(t, s, 0)
+		})
+	}
+}
+
+// closeObserver receives the close reasons of connections
+type closeObserver chan error
+
+func (o closeObserver) ConnectionStart(ctx context.Context, info graphqlws.ConnectionInfo) context.Context {
+	return ctx
+}
+
+func (o closeObserver) ConnectionEnd(ctx context.Context) {
+	o <- graphqlws.CloseReason(ctx)
+}
+
+func (o closeObserver) OperationStart(ctx context.Context, info graphqlws.OperationInfo) context.Context {
+	return ctx
+}
+
+func (o closeObserver) OperationEnd(ctx context.Context, err error) {}
+
+func TestServerPongWait(t *testing.T) {
+	for name, answer := range map[string]bool{"answering pings": true, "not answering pings": false} {
+		t.Run(name, func(t *testing.T) { testServerPongWait(t, answer) })
+		t.Run(name+" on an event loop", func(t *testing.T) {
+			l, err := graphqlws.NewEventLoop(1)
+			if err != nil {
+				t.Skip(err)
+			}
+			testServerPongWait(t, answer, graphqlws.WithEventLoop(l))
+		})
+	}
+}
+
+func testServerPongWait(t *testing.T, answer bool, options ...graphqlws.Option) {
+	o := make(closeObserver, 1)
+	s := graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), authValidator{},
+		append([]graphqlws.Option{
+			graphqlws.WithObserver(o),
+			graphqlws.WithPongWait(100 * time.Millisecond),
+			graphqlws.WithPingPeriod(20 * time.Millisecond),
+		}, options...)...,
+	)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+	ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if !answer {
+		ws.SetPingHandler(func(string) error { return nil })
+	}
+	// pings are only handled while reading
+	go func() {
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	if answer {
+		select {
+		case reason := <-o:
+			t.Fatalf("expected the connection to be kept but instead it was closed with %v", reason)
+		case <-time.After(500 * time.Millisecond):
+		}
+		return
+	}
+	select {
+	case reason := <-o:
+		if !errors.Is(reason, graphqlws.ErrPongTimeout) {
+			t.Fatalf("expected %v but instead got %v", graphqlws.ErrPongTimeout, reason)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the connection to be closed")
+	}
+}
+
+func TestServerSetReady(t *testing.T) {
+	s := graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), authValidator{})
+	s.SetReady(false)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	c := graphqlwstest.Dial(t, srv.URL, nil)
+	c.Init(nil)
+	c.Start("1", "subscription { warm }", "", nil)
+	c.CompletedWithin("1", 5*time.Second)
+	if msgs := c.Messages("1"); msgs[0].Type != "error" || !strings.Contains(string(msgs[0].Payload), `"code":"NOT_READY"`) {
+		t.Fatalf("expected the operation to be rejected as not ready but instead got %+v", msgs)
+	}
+
+	s.SetReady(true)
+	c.Start("2", "subscription { warm }", "", nil)
+	c.CompletedWithin("2", 5*time.Second)
+	if msgs := c.Messages("2"); len(msgs) != 1 {
+		t.Fatalf("expected the operation to complete but instead got %+v", msgs)
+	}
+}
+
+func TestServerShutdown(t *testing.T) {
+	svc := graphqlwstest.NewMockService().On("ticks", graphqlwstest.Data(1), graphqlwstest.Wait(time.Hour))
+	s := graphqlws.NewServer(context.Background(), svc, http.NotFoundHandler(), authValidator{})
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	c := graphqlwstest.Dial(t, srv.URL, nil)
+	c.Init(nil)
+	c.Start("1", "subscription ticks { tick }", "ticks", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.ReceivedDataMatching(ctx, "1", graphqlwstest.JSONEq(`{"data":1}`))
+
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c.CompletedWithin("1", 5*time.Second)
+	c.ClosedWithCode(ctx, websocket.CloseGoingAway)
+	if got := s.ConnectionCount(); got != 0 {
+		t.Fatalf("expected 0 connections but instead got %d", got)
+	}
+
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+	_, resp, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected new connections to be refused but instead got %v", err)
+	}
+}
+
+type panickingService struct {
+	gqlService
+}
+
+func (panickingService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	panic("subscribe")
+}
+
+func TestServerServicePanicsCloseConnection(t *testing.T) {
+	s := graphqlws.NewServer(context.Background(), panickingService{}, http.NotFoundHandler(), authValidator{}, graphqlws.WithServicePanics(graphqlws.PanicCloseConnection))
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	c := graphqlwstest.Dial(t, srv.URL, nil)
+	c.Init(nil)
+	c.Start("1", "subscription { panic }", "", nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c.ClosedWithCode(ctx, websocket.CloseInternalServerErr)
+}
+
+// chanTransport is a Transport reading from in and writing to out
+type chanTransport struct {
+	in  chan []byte
+	out chan []byte
+}
+
+func (t *chanTransport) ReadMessage() (int, []byte, error) {
+	data, ok := <-t.in
+	if !ok {
+		return 0, nil, io.EOF
+	}
+	return websocket.TextMessage, data, nil
+}
+
+func (t *chanTransport) WriteMessage(messageType int, data []byte) error {
+	t.out <- append([]byte(nil), data...)
+	return nil
+}
+
+func (t *chanTransport) SetReadLimit(limit int64) {}
+
+func (t *chanTransport) SetWriteDeadline(deadline time.Time) error {
+	return nil
+}
+
+func (t *chanTransport) Close() error {
+	return nil
+}
+
+func TestServerServe(t *testing.T) {
+	s := graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), authValidator{})
+	tr := &chanTransport{in: make(chan []byte, 2), out: make(chan []byte, 2)}
+	tr.in <- []byte(`{"type":"connection_init","payload":{}}`)
+	tr.in <- []byte(`{"id":"a-id","type":"start","payload":{}}`)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.Serve(context.Background(), tr)
+	}()
+
+	for _, expected := range []string{
+		`{"payload":{"extensions":{"batching":true,"flowControl":true,"resume":true}},"type":"connection_ack"}`,
+		`{"id":"a-id","type":"complete"}`,
+	} {
+		if got := string(<-tr.out); got != expected {
+			t.Fatalf("expected [%s] but instead got [%s]", expected, got)
+		}
+	}
+
+	close(tr.in)
+	<-done
+	waitConnectionCount(t, s, 0)
+}
+
+func TestServerOperationCount(t *testing.T) {
+	s := graphqlws.NewServer(context.Background(), blockingService{}, http.NotFoundHandler(), authValidator{})
+	tr := &chanTransport{in: make(chan []byte, 3), out: make(chan []byte, 3)}
+	tr.in <- []byte(`{"type":"connection_init","payload":{}}`)
+	tr.in <- []byte(`{"id":"a","type":"start","payload":{}}`)
+	tr.in <- []byte(`{"id":"b","type":"start","payload":{}}`)
+	go s.Serve(context.Background(), tr)
+
+	waitOperationCount(t, s, 2)
+
+	close(tr.in)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.OperationCount(); n != 0 {
+		t.Fatalf("expected no operation but instead got %d", n)
+	}
+}
+
+func TestServerWithUpgrader(t *testing.T) {
+	upgrader := &websocket.Upgrader{
+		CheckOrigin:  func(r *http.Request) bool { return r.Header.Get("Origin") == "https://example.com" },
+		Subprotocols: []string{"unused"},
+	}
+	s := graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), authValidator{}, graphqlws.WithUpgrader(upgrader))
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+	for origin, expected := range map[string]int{
+		"https://example.com": http.StatusSwitchingProtocols,
+		"https://evil.com":    http.StatusForbidden,
+	} {
+		ws, resp, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), http.Header{"Origin": {origin}})
+		if resp == nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != expected {
+			t.Fatalf("expected %d but instead got %d for %s", expected, resp.StatusCode, origin)
+		}
+		if ws != nil {
+			if ws.Subprotocol() != "graphql-ws" {
+				t.Fatalf("expected graphql-ws but instead got %s", ws.Subprotocol())
+			}
+			ws.Close()
+		}
+	}
+}
+
+func TestServerConnectionLimits(t *testing.T) {
+	s := graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), authValidator{},
+		graphqlws.WithMaxConnections(3),
+		graphqlws.WithMaxConnectionsPerKey(2, func(r *http.Request) string { return r.Header.Get("X-Api-Key") }),
+	)
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"graphql-ws"}}
+	dial := func(key string, status int) *websocket.Conn {
+		t.Helper()
+		ws, resp, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), http.Header{"X-Api-Key": {key}})
+		if resp == nil || resp.StatusCode != status {
+			t.Fatalf("expected status %d for %s but instead got %v", status, key, err)
+		}
+		return ws
+	}
+
+	a1 := dial("a", http.StatusSwitchingProtocols)
+	dial("a", http.StatusSwitchingProtocols).Close()
+	waitConnectionCount(t, s, 1)
+	a2 := dial("a", http.StatusSwitchingProtocols)
+	dial("a", http.StatusTooManyRequests)
+	b := dial("b", http.StatusSwitchingProtocols)
+	dial("c", http.StatusServiceUnavailable)
+
+	for _, ws := range []*websocket.Conn{a1, a2, b} {
+		ws.Close()
+	}
+	waitConnectionCount(t, s, 0)
+	dial("c", http.StatusSwitchingProtocols).Close()
+}
+
+func TestForwardedFor(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	if got := graphqlws.ForwardedFor(1)(r); got != "10.0.0.1" {
+		t.Fatalf("expected the remote address without the header but instead got %s", got)
+	}
+
+	r.Header.Add("X-Forwarded-For", "1.1.1.1, 2.2.2.2")
+	r.Header.Add("X-Forwarded-For", "3.3.3.3")
+	for trusted, expected := range map[int]string{1: "3.3.3.3", 2: "2.2.2.2", 3: "1.1.1.1", 4: "10.0.0.1"} {
+		if got := graphqlws.ForwardedFor(trusted)(r); got != expected {
+			t.Errorf("expected %s behind %d proxies but instead got %s", expected, trusted, got)
+		}
+	}
+}
+
+// pipeHijacker is an http.ResponseWriter hijacked into a net.Pipe, which has
+// no file descriptor to be polled
+type pipeHijacker struct {
+	http.ResponseWriter
+	conn net.Conn
+}
+
+func (w pipeHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.conn, bufio.NewReadWriter(bufio.NewReader(w.conn), bufio.NewWriter(w.conn)), nil
+}
+
+// reportedErrors is an ErrorReporter sending the errors reported to it
+type reportedErrors chan error
+
+func (r reportedErrors) ReportError(ctx context.Context, operationID string, err error) {
+	r <- err
+}
+
+func TestServerEventLoopServeFailure(t *testing.T) {
+	l, err := graphqlws.NewEventLoop(1)
+	if err != nil {
+		t.Skip(err)
+	}
+	reported := make(reportedErrors, 1)
+	s := graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), authValidator{},
+		graphqlws.WithEventLoop(l),
+		graphqlws.WithMaxConnections(1),
+		graphqlws.WithErrorReporter(reported),
+	)
+
+	serve := func() {
+		t.Helper()
+		server, client := net.Pipe()
+		defer client.Close()
+		go io.Copy(io.Discard, client)
+
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Connection", "Upgrade")
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Sec-WebSocket-Version", "13")
+		r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		r.Header.Set("Sec-WebSocket-Protocol", "graphql-ws")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(pipeHijacker{ResponseWriter: w, conn: server}, r)
+		if w.Code == http.StatusServiceUnavailable {
+			t.Fatal("expected the slot of the connection to be released")
+		}
+		select {
+		case <-reported:
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the error to be reported")
+		}
+		waitConnectionCount(t, s, 0)
+	}
+	// the second connection only gets a slot if the first released it
+	serve()
+	serve()
+}
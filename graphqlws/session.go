@@ -0,0 +1,52 @@
+package graphqlws
+
+import (
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// SubscriptionStore persists the sessions of connections across restarts of
+// the server, see WithSubscriptionStore
+type SubscriptionStore = connection.SubscriptionStore
+
+// Session is the state of a connection saved in a SubscriptionStore
+type Session = connection.Session
+
+// SessionOperation is an operation of a Session
+type SessionOperation = connection.SessionOperation
+
+// WithSubscriptionStore lets clients opt in to sessions persisted in store
+// with {"session": true} in the connection_init payload, the token of their
+// session is then confirmed in the connection_ack payload. Unless terminated
+// by the client, sessions are saved when their connection is closed, e.g. on
+// shutdown, and restored when the client reconnects with {"sessionToken":
+// token}: their operations are started again with the ID of their last event
+// as lastEventId.
+func WithSubscriptionStore(store SubscriptionStore) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.PersistSessions(store))
+	}
+}
+
+// DefaultSessionTTL is how long sessions are restored once saved by default,
+// see WithSessionTTL
+const DefaultSessionTTL = connection.DefaultSessionTTL
+
+// WithSessionTTL sets how long sessions are restored once saved, clients
+// reconnecting later are given a new session. Stores should expire the
+// sessions past their ExpiresAt, which are never restored.
+func WithSessionTTL(d time.Duration) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.SessionTTL(d))
+	}
+}
+
+// MemorySubscriptionStore is a SubscriptionStore keeping the sessions in
+// memory, which only survive reconnections to the same instance
+type MemorySubscriptionStore = connection.MemorySubscriptionStore
+
+// NewMemorySubscriptionStore returns an empty MemorySubscriptionStore
+func NewMemorySubscriptionStore() *MemorySubscriptionStore {
+	return connection.NewMemorySubscriptionStore()
+}
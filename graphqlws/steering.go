@@ -0,0 +1,22 @@
+package graphqlws
+
+import (
+	"context"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// SteeringHints tell clients where they should connect, see WithSteeringHints
+type SteeringHints = connection.SteeringHints
+
+// WithSteeringHints sets the function returning the steering hints of a
+// connection from its context, e.g. the preferred region or a URL to
+// reconnect to during scaling events. They're sent as the steering extension
+// of the connection_ack payload and, when the server closes the connection,
+// e.g. on shutdown, as the JSON text of a close frame with the 1012 (service
+// restart) close code.
+func WithSteeringHints(fn func(ctx context.Context) *SteeringHints) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.Steer(fn))
+	}
+}
@@ -0,0 +1,37 @@
+package graphqlws
+
+import (
+	"context"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// Transport carries the operation messages of a connection, it's implemented
+// by *websocket.Conn and lets the protocol be served over other transports,
+// e.g. by the mqtt package.
+type Transport interface {
+	// ReadMessage returns the next incoming frame, it's called by a single
+	// goroutine and an error closes the connection
+	ReadMessage() (messageType int, p []byte, err error)
+	// WriteMessage writes an outgoing frame, it's called by a single
+	// goroutine which sets the deadline of the write with SetWriteDeadline
+	WriteMessage(messageType int, data []byte) error
+	SetReadLimit(limit int64)
+	SetWriteDeadline(t time.Time) error
+	Close() error
+}
+
+// ContextWriter may be implemented by a Transport able to abort a write when a
+// context is done, it's then written to with a context done once the write
+// deadline is past or the connection is closed, instead of with
+// SetWriteDeadline and WriteMessage
+type ContextWriter = connection.ContextWriter
+
+// Serve serves a connection over t with the service and options of s until
+// it's closed. There's no HTTP request to check, so ctx should carry whatever
+// AuthValidator would have added to the root context.
+func (s *Server) Serve(ctx context.Context, t Transport) {
+	ctx, options, _ := s.track(ctx, nil)
+	connection.Connect(t, s.svc, ctx, options...)
+}
@@ -0,0 +1,349 @@
+package graphqlws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+const (
+	// ProtocolGraphQLWS is the legacy subprotocol spoken by e.g.
+	// subscriptions-transport-ws
+	ProtocolGraphQLWS = "graphql-ws"
+	// ProtocolGraphQLTransportWS is the subprotocol spoken by e.g. graphql-ws
+	ProtocolGraphQLTransportWS = "graphql-transport-ws"
+)
+
+// WithProtocols restricts the subprotocols the handler accepts, by default
+// both ProtocolGraphQLWS and ProtocolGraphQLTransportWS. Each connection
+// speaks the first of the subprotocols offered by the client which is
+// allowed, requests offering none of them are served by the HTTP handler.
+// Connections speaking ProtocolGraphQLTransportWS aren't served by the event
+// loop if any.
+func WithProtocols(protocols ...string) Option {
+	return func(h *handler) {
+		h.protocols = protocols
+	}
+}
+
+var defaultProtocols = []string{ProtocolGraphQLWS, ProtocolGraphQLTransportWS}
+
+// negotiate returns the subprotocol to speak with the client sending r, an
+// empty string if it offers none of the allowed ones
+func (h *handler) negotiate(r *http.Request) string {
+	allowed := h.protocols
+	if allowed == nil {
+		allowed = defaultProtocols
+	}
+	for _, offered := range websocket.Subprotocols(r) {
+		for _, protocol := range allowed {
+			if offered == protocol {
+				return protocol
+			}
+		}
+	}
+	return ""
+}
+
+// transportPingType is the type of the operation messages translated from the
+// ping messages of ProtocolGraphQLTransportWS, ping being already taken by
+// the legacy protocol
+const transportPingType = "transport_ping"
+
+// transportPingOption answers the translated ping messages with a pong
+var transportPingOption = connection.HandleMessage(transportPingType, func(ctx context.Context, conn connection.Conn, id string, payload json.RawMessage) error {
+	conn.Send("", "pong", payload)
+	return nil
+})
+
+// transportWSCloseTimeout bounds the writes of the close frames sent by the
+// reader
+const transportWSCloseTimeout = time.Second
+
+// transportWSConn translates between ProtocolGraphQLTransportWS spoken by the
+// client and the operation messages handled by the connection
+type transportWSConn struct {
+	ws WebSocket
+	// initialized is only accessed by the reader
+	initialized bool
+
+	mu    sync.Mutex
+	acked bool
+	// ctx is the context of the connection once opened
+	ctx context.Context
+	// active holds the ids of the running operations, stopped the ids of
+	// those completed by the client whose complete message isn't sent back
+	active  map[string]bool
+	stopped map[string]bool
+}
+
+func newTransportWSConn(ws WebSocket) *transportWSConn {
+	return &transportWSConn{ws: ws, active: map[string]bool{}, stopped: map[string]bool{}}
+}
+
+// options returns the options of the connection c is the transport of
+func (c *transportWSConn) options() []connection.Option {
+	return []connection.Option{
+		transportPingOption,
+		noCoalescing,
+		connection.AcceptPushes(c.isActive),
+		connection.OnOpen(func(ctx context.Context) {
+			c.mu.Lock()
+			c.ctx = ctx
+			c.mu.Unlock()
+		}),
+	}
+}
+
+// transportWSMessage is a message of ProtocolGraphQLTransportWS, or the
+// operation message translated from one
+type transportWSMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// ReadMessage reads messages until one translates to an operation message,
+// closing the connection with the matching close code on protocol violations
+func (c *transportWSConn) ReadMessage() (int, []byte, error) {
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		var msg transportWSMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return 0, nil, c.closeWith(CloseBadRequest, "Invalid message received")
+		}
+
+		om, err := c.translate(&msg)
+		if err != nil {
+			return 0, nil, err
+		}
+		if om != nil {
+			data, err := json.Marshal(om)
+			return websocket.TextMessage, data, err
+		}
+	}
+}
+
+func (c *transportWSConn) translate(msg *transportWSMessage) (*transportWSMessage, error) {
+	switch msg.Type {
+	case "connection_init":
+		if c.initialized {
+			return nil, c.closeWith(CloseTooManyInits, "Too many initialisation requests")
+		}
+		c.initialized = true
+		payload := msg.Payload
+		if len(payload) == 0 || string(payload) == "null" {
+			payload = json.RawMessage("{}")
+		}
+		return &transportWSMessage{Type: "connection_init", Payload: withoutFields(payload, extensionInitFields...)}, nil
+
+	case "ping":
+		return &transportWSMessage{Type: transportPingType, Payload: msg.Payload}, nil
+
+	case "pong":
+		return nil, nil
+
+	case "subscribe":
+		if msg.ID == "" {
+			return nil, c.closeWith(CloseBadRequest, "Invalid message received")
+		}
+
+		c.mu.Lock()
+		acked, exists := c.acked, c.active[msg.ID]
+		if acked && !exists {
+			c.active[msg.ID] = true
+		}
+		c.mu.Unlock()
+
+		if !acked {
+			return nil, c.closeWith(CloseUnauthorized, "Unauthorized")
+		}
+		if exists {
+			return nil, c.closeWith(CloseSubscriberExists, fmt.Sprintf("Subscriber for %s already exists", msg.ID))
+		}
+		return &transportWSMessage{ID: msg.ID, Type: "start", Payload: withoutFields(msg.Payload, extensionStartFields...)}, nil
+
+	case "complete":
+		c.mu.Lock()
+		active := c.active[msg.ID]
+		if active {
+			delete(c.active, msg.ID)
+			c.stopped[msg.ID] = true
+		}
+		c.mu.Unlock()
+
+		if !active {
+			return nil, nil
+		}
+		return &transportWSMessage{ID: msg.ID, Type: "stop"}, nil
+
+	default:
+		return nil, c.closeWith(CloseBadRequest, "Invalid message received")
+	}
+}
+
+// The protocol extensions are only spoken with ProtocolGraphQLWS, the fields
+// of the payloads opting in to them are dropped from those of
+// ProtocolGraphQLTransportWS, and the extensions aren't advertised in its ack
+var (
+	extensionInitFields  = []string{"coalesce", "compression", "keepAlive", "rtt", "session", "sessionToken"}
+	extensionStartFields = []string{"ack", "credits", "lastEventId"}
+)
+
+// withoutFields returns payload without fields if it's an object
+func withoutFields(payload json.RawMessage, fields ...string) json.RawMessage {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &obj); err != nil || obj == nil {
+		return payload
+	}
+	n := len(obj)
+	for _, f := range fields {
+		delete(obj, f)
+	}
+	if len(obj) == n {
+		return payload
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return payload
+	}
+	return b
+}
+
+// errorList returns the errors of the payload of an error message, which holds
+// either an error or an array of them
+func errorList(payload json.RawMessage) []json.RawMessage {
+	var errs []json.RawMessage
+	if err := json.Unmarshal(payload, &errs); err != nil {
+		return []json.RawMessage{payload}
+	}
+	return errs
+}
+
+// closeWith sends a close frame with code and reason, it returns the error the
+// reader then fails with
+func (c *transportWSConn) closeWith(code CloseCode, reason string) error {
+	c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(int(code), reason), time.Now().Add(transportWSCloseTimeout))
+	return &CloseError{Code: code, Reason: reason}
+}
+
+// WriteMessage translates an operation message to the message, if any, the
+// client expects
+func (c *transportWSConn) WriteMessage(messageType int, data []byte) error {
+	var om transportWSMessage
+	if err := json.Unmarshal(data, &om); err != nil {
+		return err
+	}
+
+	switch om.Type {
+	case "connection_ack":
+		c.mu.Lock()
+		c.acked = true
+		c.mu.Unlock()
+		payload := withoutFields(om.Payload, "extensions")
+		if string(payload) == "{}" {
+			payload = nil
+		}
+		return c.write(&transportWSMessage{Type: "connection_ack", Payload: payload})
+
+	case "connection_error":
+		return c.ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(int(CloseForbidden), "Forbidden"), time.Now().Add(transportWSCloseTimeout))
+
+	case "ka":
+		return c.write(&transportWSMessage{Type: "ping", Payload: om.Payload})
+
+	case "pong":
+		return c.write(&transportWSMessage{Type: "pong", Payload: om.Payload})
+
+	case "data":
+		if c.isActive(om.ID) {
+			return c.write(&transportWSMessage{ID: om.ID, Type: "next", Payload: om.Payload})
+		}
+
+	case "error":
+		// operations are done once they failed, the complete message which
+		// follows isn't sent and the ones still running are stopped, so that
+		// the client can reuse their id
+		if c.finish(om.ID) {
+			c.mu.Lock()
+			ctx := c.ctx
+			c.mu.Unlock()
+			if ctx != nil {
+				connection.StopOperation(ctx, om.ID)
+			}
+			payload, _ := json.Marshal(errorList(om.Payload))
+			return c.write(&transportWSMessage{ID: om.ID, Type: "error", Payload: payload})
+		}
+
+	case "complete":
+		if c.finish(om.ID) {
+			return c.write(&transportWSMessage{ID: om.ID, Type: "complete"})
+		}
+	}
+
+	// the other messages have no counterpart
+	return nil
+}
+
+func (c *transportWSConn) isActive(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.active[id]
+}
+
+// finish forgets the operation id, it returns whether it was running rather
+// than stopped by the client
+func (c *transportWSConn) finish(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped[id] {
+		delete(c.stopped, id)
+		return false
+	}
+	active := c.active[id]
+	delete(c.active, id)
+	return active
+}
+
+func (c *transportWSConn) write(msg *transportWSMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.ws.WriteMessage(websocket.TextMessage, data)
+}
+
+func (c *transportWSConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	return c.ws.WriteControl(messageType, data, deadline)
+}
+
+func (c *transportWSConn) SetReadLimit(limit int64) {
+	c.ws.SetReadLimit(limit)
+}
+
+func (c *transportWSConn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+func (c *transportWSConn) SetPongHandler(h func(appData string) error) {
+	c.ws.SetPongHandler(h)
+}
+
+func (c *transportWSConn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
+
+func (c *transportWSConn) Close() error {
+	return c.ws.Close()
+}
@@ -0,0 +1,337 @@
+package graphqlws_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+func dialProtocols(t *testing.T, url string, protocols ...string) *websocket.Conn {
+	t.Helper()
+	dialer := websocket.Dialer{Subprotocols: protocols}
+	ws, _, err := dialer.Dial("ws"+strings.TrimPrefix(url, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return ws
+}
+
+// exchange sends send, if any, and expects the expected messages in reply
+func exchange(t *testing.T, ws *websocket.Conn, send string, expected ...string) {
+	t.Helper()
+	if send != "" {
+		if err := ws.WriteMessage(websocket.TextMessage, []byte(send)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, e := range expected {
+		_, got, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != e {
+			t.Fatalf("expected %s but instead got %s", e, got)
+		}
+	}
+}
+
+// expectClose expects the connection to be closed with code
+func expectClose(t *testing.T, ws *websocket.Conn, code int) {
+	t.Helper()
+	_, _, err := ws.ReadMessage()
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) || ce.Code != code {
+		t.Fatalf("expected close code %d but instead got %v", code, err)
+	}
+}
+
+const transportWSAck = `{"type":"connection_ack"}`
+
+func TestServerGraphQLTransportWS(t *testing.T) {
+	srv := httptest.NewServer(graphqlws.NewServer(context.Background(), absintheService{}, http.NotFoundHandler(), authValidator{}))
+	defer srv.Close()
+
+	ws := dialProtocols(t, srv.URL, "graphql-transport-ws")
+	defer ws.Close()
+	if ws.Subprotocol() != "graphql-transport-ws" {
+		t.Fatalf("expected graphql-transport-ws but instead got %s", ws.Subprotocol())
+	}
+
+	exchange(t, ws, `{"type":"ping","payload":{"at":1}}`, `{"type":"pong","payload":{"at":1}}`)
+	exchange(t, ws, `{"type":"connection_init"}`, transportWSAck)
+	exchange(t, ws, `{"id":"1","type":"subscribe","payload":{"query":"subscription onMessage { message }","operationName":"onMessage"}}`,
+		`{"id":"1","type":"next","payload":{"data":{"operation":"onMessage"}}}`,
+		`{"id":"1","type":"complete"}`,
+	)
+	exchange(t, ws, `{"id":"2","type":"subscribe","payload":{"query":"subscription onMessage { message }","operationName":"onMessage"}}`,
+		`{"id":"2","type":"next","payload":{"data":{"operation":"onMessage"}}}`,
+		`{"id":"2","type":"complete"}`,
+	)
+	// completing an operation that is done is a no-op
+	exchange(t, ws, `{"id":"1","type":"complete"}`)
+	exchange(t, ws, `{"type":"ping"}`, `{"type":"pong"}`)
+}
+
+func TestServerGraphQLTransportWSErrors(t *testing.T) {
+	srv := httptest.NewServer(graphqlws.NewServer(context.Background(), &blockingService{}, http.NotFoundHandler(), authValidator{}))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name     string
+		messages []string
+		code     int
+	}{
+		{
+			name:     "subscribe before ack",
+			messages: []string{`{"id":"1","type":"subscribe","payload":{"query":"subscription { message }"}}`},
+			code:     4401,
+		},
+		{
+			name:     "second init",
+			messages: []string{`{"type":"connection_init"}`, `{"type":"connection_init"}`},
+			code:     4429,
+		},
+		{
+			name: "duplicate id",
+			messages: []string{
+				`{"type":"connection_init"}`,
+				`{"id":"1","type":"subscribe","payload":{"query":"subscription { message }"}}`,
+				`{"id":"1","type":"subscribe","payload":{"query":"subscription { message }"}}`,
+			},
+			code: 4409,
+		},
+		{
+			name:     "invalid message",
+			messages: []string{`{"type":"start"}`},
+			code:     4400,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ws := dialProtocols(t, srv.URL, "graphql-transport-ws")
+			defer ws.Close()
+
+			for i, msg := range tc.messages {
+				exchange(t, ws, msg)
+				if i == 0 && msg == `{"type":"connection_init"}` {
+					exchange(t, ws, "", transportWSAck)
+				}
+			}
+			expectClose(t, ws, tc.code)
+		})
+	}
+}
+
+// blockingService serves subscriptions which never send anything
+type blockingService struct {
+	gqlService
+}
+
+func (blockingService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	c := make(chan interface{})
+	go func() {
+		<-ctx.Done()
+		close(c)
+	}()
+	return c, nil
+}
+
+func TestServerProtocolNegotiation(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		options  []graphqlws.Option
+		offered  []string
+		expected string
+		rejected bool
+	}{
+		{name: "legacy", offered: []string{"graphql-ws"}, expected: "graphql-ws"},
+		{name: "client preference", offered: []string{"graphql-transport-ws", "graphql-ws"}, expected: "graphql-transport-ws"},
+		{
+			name:     "restricted",
+			options:  []graphqlws.Option{graphqlws.WithProtocols(graphqlws.ProtocolGraphQLWS)},
+			offered:  []string{"graphql-transport-ws", "graphql-ws"},
+			expected: "graphql-ws",
+		},
+		{
+			name:     "none allowed",
+			options:  []graphqlws.Option{graphqlws.WithProtocols(graphqlws.ProtocolGraphQLTransportWS)},
+			offered:  []string{"graphql-ws"},
+			rejected: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), authValidator{}, tc.options...))
+			defer srv.Close()
+
+			dialer := websocket.Dialer{Subprotocols: tc.offered}
+			ws, resp, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+			if tc.rejected {
+				if err == nil || resp.StatusCode != http.StatusNotFound {
+					t.Fatalf("expected the request to be served by the HTTP handler but instead got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ws.Close()
+			if ws.Subprotocol() != tc.expected {
+				t.Fatalf("expected %s but instead got %s", tc.expected, ws.Subprotocol())
+			}
+		})
+	}
+}
+
+func TestServerConnectionInitTimeout(t *testing.T) {
+	srv := httptest.NewServer(graphqlws.NewServer(context.Background(), gqlService{}, http.NotFoundHandler(), authValidator{}, graphqlws.WithConnectionInitTimeout(10*time.Millisecond)))
+	defer srv.Close()
+
+	ws := dialProtocols(t, srv.URL, "graphql-transport-ws")
+	defer ws.Close()
+	_, _, err := ws.ReadMessage()
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) || ce.Code != 4408 || ce.Text != "Connection initialisation timeout" {
+		t.Fatalf("expected close code 4408 with its reason but instead got %v", err)
+	}
+}
+
+// closingService closes the connection of the operations it's asked for
+type closingService struct {
+	gqlService
+}
+
+func (closingService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	graphqlws.Close(ctx, graphqlws.CloseForbidden, "token expired")
+	return nil, ctx.Err()
+}
+
+func TestServerClose(t *testing.T) {
+	o := make(closeObserver, 1)
+	srv := httptest.NewServer(graphqlws.NewServer(context.Background(), closingService{}, http.NotFoundHandler(), authValidator{}, graphqlws.WithObserver(o)))
+	defer srv.Close()
+
+	ws := dialProtocols(t, srv.URL, "graphql-transport-ws")
+	defer ws.Close()
+	exchange(t, ws, `{"type":"connection_init"}`, transportWSAck)
+	if err := ws.WriteMessage(websocket.TextMessage, []byte(`{"id":"1","type":"subscribe","payload":{"query":"subscription { close }"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := ws.ReadMessage()
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) || ce.Code != 4403 || ce.Text != "token expired" {
+		t.Fatalf("expected close code 4403 with token expired but instead got %v", err)
+	}
+
+	var reason *graphqlws.CloseError
+	if got := <-o; !errors.As(got, &reason) || reason.Code != graphqlws.CloseForbidden {
+		t.Fatalf("expected a close error with code %d but instead got %v", graphqlws.CloseForbidden, got)
+	}
+}
+
+// failingService fails the operations with several errors
+type failingService struct {
+	gqlService
+}
+
+func (failingService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	return nil, errors.Join(errors.New("first"), errors.New("second"))
+}
+
+func TestServerGraphQLTransportWSErrorList(t *testing.T) {
+	srv := httptest.NewServer(graphqlws.NewServer(context.Background(), failingService{}, http.NotFoundHandler(), authValidator{}))
+	defer srv.Close()
+
+	ws := dialProtocols(t, srv.URL, "graphql-transport-ws")
+	defer ws.Close()
+	exchange(t, ws, `{"type":"connection_init"}`, transportWSAck)
+	exchange(t, ws, `{"id":"1","type":"subscribe","payload":{"query":"subscription { fail }"}}`,
+		`{"id":"1","type":"error","payload":[{"message":"first"},{"message":"second"}]}`,
+	)
+}
+
+func TestServerGraphQLTransportWSWithoutExtensions(t *testing.T) {
+	srv := httptest.NewServer(graphqlws.NewServer(context.Background(), absintheService{}, http.NotFoundHandler(), authValidator{},
+		graphqlws.WithKeepAlive(time.Hour),
+		graphqlws.WithKeepAliveRange(time.Millisecond, time.Hour),
+	))
+	defer srv.Close()
+
+	ws := dialProtocols(t, srv.URL, "graphql-transport-ws")
+	defer ws.Close()
+	// neither keepAlive is negotiated nor the extensions advertised
+	exchange(t, ws, `{"type":"connection_init","payload":{"keepAlive":10,"token":"secret"}}`, transportWSAck)
+	// the operation isn't held back waiting for credits
+	exchange(t, ws, `{"id":"1","type":"subscribe","payload":{"query":"subscription onMessage { message }","operationName":"onMessage","credits":0,"ack":true}}`,
+		`{"id":"1","type":"next","payload":{"data":{"operation":"onMessage"}}}`,
+		`{"id":"1","type":"complete"}`,
+	)
+}
+
+// unmarshalableService sends a payload which can't be marshaled and keeps the
+// operation running
+type unmarshalableService struct {
+	gqlService
+}
+
+func (unmarshalableService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	c := make(chan interface{}, 1)
+	c <- func() {}
+	go func() {
+		<-ctx.Done()
+		close(c)
+	}()
+	return c, nil
+}
+
+func TestServerGraphQLTransportWSReuseFailedID(t *testing.T) {
+	srv := httptest.NewServer(graphqlws.NewServer(context.Background(), unmarshalableService{}, http.NotFoundHandler(), authValidator{}))
+	defer srv.Close()
+
+	ws := dialProtocols(t, srv.URL, "graphql-transport-ws")
+	defer ws.Close()
+	exchange(t, ws, `{"type":"connection_init"}`, transportWSAck)
+	failed := `{"id":"1","type":"error","payload":[{"message":"json: unsupported type: func()"}]}`
+	exchange(t, ws, `{"id":"1","type":"subscribe","payload":{"query":"subscription { fail }"}}`, failed)
+	// the failed operation was stopped, its id is free
+	exchange(t, ws, `{"id":"1","type":"subscribe","payload":{"query":"subscription { fail }"}}`, failed)
+}
+
+// startedService keeps its operations running and passes their context on
+type startedService struct {
+	gqlService
+	started chan context.Context
+}
+
+func (s startedService) Subscribe(ctx context.Context, document string, operationName string, variableValues map[string]interface{}) (<-chan interface{}, error) {
+	s.started <- ctx
+	return blockingService{}.Subscribe(ctx, document, operationName, variableValues)
+}
+
+func TestServerGraphQLTransportWSPush(t *testing.T) {
+	svc := startedService{started: make(chan context.Context, 1)}
+	srv := httptest.NewServer(graphqlws.NewServer(context.Background(), svc, http.NotFoundHandler(), authValidator{}))
+	defer srv.Close()
+
+	ws := dialProtocols(t, srv.URL, "graphql-transport-ws")
+	defer ws.Close()
+	exchange(t, ws, `{"type":"connection_init"}`, transportWSAck)
+	exchange(t, ws, `{"id":"1","type":"subscribe","payload":{"query":"subscription { a }"}}`)
+	ctx := <-svc.started
+
+	if graphqlws.Push(ctx, "2", json.RawMessage(`{"data":{}}`)) {
+		t.Fatal("expected a push to an operation the client isn't running to fail")
+	}
+	if !graphqlws.Push(ctx, "1", json.RawMessage(`{"data":{}}`)) {
+		t.Fatal("expected a push to a running operation to succeed")
+	}
+	exchange(t, ws, "", `{"id":"1","type":"next","payload":{"data":{}}}`)
+}
@@ -0,0 +1,31 @@
+package graphqlws
+
+import (
+	"net/http"
+
+	"github.com/gorilla/websocket"
+)
+
+// WithUpgrader sets the upgrader of websocket connections, e.g. to check the
+// origin of requests, size the read and write buffers or enable per-message
+// compression. By default connections are upgraded whatever their origin,
+// which is only safe when the AuthValidator doesn't rely on cookies. Its
+// Subprotocols are ignored in favor of WithProtocols, and it doesn't apply to
+// connections served by an event loop.
+func WithUpgrader(u *websocket.Upgrader) Option {
+	return func(h *handler) {
+		upgrader := *u
+		upgrader.Subprotocols = nil
+		h.upgrader = &upgrader
+	}
+}
+
+// upgrade upgrades the connection with the upgrader set with WithUpgrader,
+// speaking the subprotocol set as the Sec-Websocket-Protocol responseHeader if
+// any
+func (h *handler) upgrade(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (*websocket.Conn, error) {
+	if h.upgrader != nil {
+		return h.upgrader.Upgrade(w, r, responseHeader)
+	}
+	return upgrader.Upgrade(w, r, responseHeader)
+}
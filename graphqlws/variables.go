@@ -0,0 +1,28 @@
+package graphqlws
+
+import (
+	"github.com/samodenis/graphql-transport-ws/graphqlws/internal/connection"
+)
+
+// VariablesDecoder decodes the variables of the operations from the JSON
+// object of their start payload, see WithVariablesDecoder
+type VariablesDecoder = connection.VariablesDecoder
+
+// WithVariablesDecoder sets the decoder of the variables of the operations,
+// which by default are decoded by encoding/json, numbers then being float64s
+// which can't hold every 64-bit integer, see WithNumberVariables. The
+// operations whose variables fail to decode are rejected like those whose
+// payload isn't valid JSON.
+func WithVariablesDecoder(fn VariablesDecoder) Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.DecodeVariables(fn))
+	}
+}
+
+// WithNumberVariables decodes the numbers of the variables of the operations
+// as json.Numbers, e.g. for 64-bit integer ids to survive the transport
+func WithNumberVariables() Option {
+	return func(h *handler) {
+		h.connOptions = append(h.connOptions, connection.UseNumber())
+	}
+}
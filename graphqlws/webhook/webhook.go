@@ -0,0 +1,288 @@
+// Package webhook provides a graphqlws.Observer posting signed JSON webhooks
+// when connections open and close and when operations start and stop, so that
+// external systems, e.g. billing or presence, can react to them.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+)
+
+// The types of the events
+const (
+	ConnectionOpen    = "connection.open"
+	ConnectionClose   = "connection.close"
+	SubscriptionStart = "subscription.start"
+	SubscriptionStop  = "subscription.stop"
+)
+
+const (
+	// SignatureHeader carries the hex encoded HMAC-SHA256 of the body, keyed
+	// with the secret and prefixed with sha256=
+	SignatureHeader = "X-Graphqlws-Signature"
+	// EventHeader carries the type of the event
+	EventHeader = "X-Graphqlws-Event"
+)
+
+// Event is the JSON body of a webhook
+type Event struct {
+	Type          string    `json:"type"`
+	Time          time.Time `json:"time"`
+	ConnectionID  string    `json:"connectionId"`
+	RemoteAddr    string    `json:"remoteAddr,omitempty"`
+	OperationID   string    `json:"operationId,omitempty"`
+	OperationName string    `json:"operationName,omitempty"`
+	// Error is the error a subscription failed with, stopped subscriptions
+	// have none
+	Error string `json:"error,omitempty"`
+}
+
+// Emitter is a graphqlws.Observer posting an Event to a URL for each
+// connection and operation lifecycle change. Events are queued and posted in
+// order by a single goroutine, so that a slow endpoint doesn't hold up
+// connections; events are dropped when the queue is full.
+type Emitter struct {
+	url     string
+	secret  []byte
+	client  *http.Client
+	retries int
+	backoff time.Duration
+	onError func(Event, error)
+	done    chan struct{}
+
+	// mu guards closing queue against emitting to it
+	mu     sync.RWMutex
+	queue  chan Event
+	closed bool
+}
+
+// Option configures an Emitter
+type Option func(e *Emitter)
+
+// Client sets the client webhooks are posted with, the default is
+// http.DefaultClient
+func Client(client *http.Client) Option {
+	return func(e *Emitter) {
+		e.client = client
+	}
+}
+
+// Retries sets how many times a webhook is retried after the endpoint failed
+// to accept it, waiting backoff before the first retry and doubling it after
+// each, the defaults are 3 and a second
+func Retries(retries int, backoff time.Duration) Option {
+	return func(e *Emitter) {
+		e.retries = retries
+		e.backoff = backoff
+	}
+}
+
+// QueueSize sets how many events can wait to be posted, the default is 1024
+func QueueSize(size int) Option {
+	return func(e *Emitter) {
+		e.queue = make(chan Event, size)
+	}
+}
+
+// OnError sets a function called with the events that were dropped, either
+// because the queue was full or because they couldn't be posted
+func OnError(fn func(Event, error)) Option {
+	return func(e *Emitter) {
+		e.onError = fn
+	}
+}
+
+// ErrQueueFull is passed to the OnError function for events dropped because
+// too many were waiting to be posted
+var ErrQueueFull = errors.New("webhook: queue full")
+
+// ErrClosed is passed to the OnError function for events emitted after the
+// Emitter was closed
+var ErrClosed = errors.New("webhook: emitter closed")
+
+// New returns an Emitter posting webhooks signed with secret to url, it must
+// be closed to stop posting them.
+func New(url string, secret []byte, options ...Option) *Emitter {
+	e := &Emitter{
+		url:     url,
+		secret:  secret,
+		client:  http.DefaultClient,
+		retries: 3,
+		backoff: time.Second,
+		onError: func(Event, error) {},
+		done:    make(chan struct{}),
+	}
+	for _, opt := range options {
+		opt(e)
+	}
+	if e.queue == nil {
+		e.queue = make(chan Event, 1024)
+	}
+
+	go e.run()
+	return e
+}
+
+// Close stops the Emitter once the queued events have been posted, events
+// emitted afterwards are dropped.
+func (e *Emitter) Close() {
+	e.mu.Lock()
+	if !e.closed {
+		e.closed = true
+		close(e.queue)
+	}
+	e.mu.Unlock()
+	<-e.done
+}
+
+func (e *Emitter) run() {
+	defer close(e.done)
+	for event := range e.queue {
+		if err := e.post(event); err != nil {
+			e.onError(event, err)
+		}
+	}
+}
+
+// post posts event, retrying on network errors, 429 and 5xx responses
+func (e *Emitter) post(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	mac := hmac.New(sha256.New, e.secret)
+	mac.Write(body)
+	signature := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	backoff := e.backoff
+	for attempt := 0; ; attempt++ {
+		retry, err := e.send(event.Type, body, signature)
+		if err == nil || !retry || attempt >= e.retries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+func (e *Emitter) send(eventType string, body []byte, signature string) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, eventType)
+	req.Header.Set(SignatureHeader, signature)
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("webhook: %s", resp.Status)
+	default:
+		return false, fmt.Errorf("webhook: %s", resp.Status)
+	}
+}
+
+// emit queues event without blocking
+func (e *Emitter) emit(event Event) {
+	event.Time = time.Now().UTC()
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		e.onError(event, ErrClosed)
+		return
+	}
+	select {
+	case e.queue <- event:
+	default:
+		e.onError(event, ErrQueueFull)
+	}
+}
+
+type connectionKey struct{}
+
+// connectionInfo is carried by the connection context, so that the events of
+// its operations can refer to it
+type connectionInfo struct {
+	id         string
+	remoteAddr string
+}
+
+func (e *Emitter) ConnectionStart(ctx context.Context, info graphqlws.ConnectionInfo) context.Context {
+	conn := &connectionInfo{id: connectionID(ctx)}
+	if info.RemoteAddr != nil {
+		conn.remoteAddr = info.RemoteAddr.String()
+	}
+	e.emit(Event{Type: ConnectionOpen, ConnectionID: conn.id, RemoteAddr: conn.remoteAddr})
+	return context.WithValue(ctx, connectionKey{}, conn)
+}
+
+func (e *Emitter) ConnectionEnd(ctx context.Context) {
+	if conn, ok := ctx.Value(connectionKey{}).(*connectionInfo); ok {
+		e.emit(Event{Type: ConnectionClose, ConnectionID: conn.id, RemoteAddr: conn.remoteAddr})
+	}
+}
+
+type operationKey struct{}
+
+func (e *Emitter) OperationStart(ctx context.Context, info graphqlws.OperationInfo) context.Context {
+	event := Event{Type: SubscriptionStart, OperationID: info.ID, OperationName: info.OperationName}
+	if conn, ok := ctx.Value(connectionKey{}).(*connectionInfo); ok {
+		event.ConnectionID = conn.id
+		event.RemoteAddr = conn.remoteAddr
+	}
+	e.emit(event)
+	return context.WithValue(ctx, operationKey{}, event)
+}
+
+func (e *Emitter) OperationEnd(ctx context.Context, err error) {
+	event, ok := ctx.Value(operationKey{}).(Event)
+	if !ok {
+		return
+	}
+	event.Type = SubscriptionStop
+	// operations stopped by the client or closed with their connection
+	// didn't fail
+	if err != nil && !errors.Is(err, context.Canceled) {
+		event.Error = err.Error()
+	}
+	e.emit(event)
+}
+
+// connectionID returns the id of the connection ctx belongs to, a random one
+// if it doesn't belong to one
+func connectionID(ctx context.Context) string {
+	if id, ok := graphqlws.ConnectionIDFromContext(ctx); ok {
+		return string(id)
+	}
+	return newID()
+}
+
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b[:])
+}
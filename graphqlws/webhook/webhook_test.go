@@ -0,0 +1,100 @@
+package webhook_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/samodenis/graphql-transport-ws/graphqlws"
+	"github.com/samodenis/graphql-transport-ws/graphqlws/webhook"
+)
+
+var secret = []byte("secret")
+
+func TestEmitter(t *testing.T) {
+	events := make(chan webhook.Event, 4)
+	failed := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first webhook is retried
+		if !failed {
+			failed = true
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, secret)
+		mac.Write(body)
+		if expected := "sha256=" + hex.EncodeToString(mac.Sum(nil)); r.Header.Get(webhook.SignatureHeader) != expected {
+			t.Errorf("expected signature %s but instead got %s", expected, r.Header.Get(webhook.SignatureHeader))
+		}
+
+		var event webhook.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Error(err)
+		}
+		if r.Header.Get(webhook.EventHeader) != event.Type {
+			t.Errorf("expected event header %s but instead got %s", event.Type, r.Header.Get(webhook.EventHeader))
+		}
+		events <- event
+	}))
+	defer srv.Close()
+
+	e := webhook.New(srv.URL, secret, webhook.Retries(1, time.Millisecond))
+	var o graphqlws.Observer = e
+
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234}
+	ctx := o.ConnectionStart(context.Background(), graphqlws.ConnectionInfo{RemoteAddr: addr})
+	opCtx := o.OperationStart(ctx, graphqlws.OperationInfo{ID: "1", OperationName: "onMessage"})
+	o.OperationEnd(opCtx, errors.New("failed"))
+	o.ConnectionEnd(ctx)
+	e.Close()
+	close(events)
+
+	var got []webhook.Event
+	for event := range events {
+		got = append(got, event)
+	}
+	if len(got) != 4 {
+		t.Fatalf("expected 4 events but instead got %d", len(got))
+	}
+	for i, expected := range []webhook.Event{
+		{Type: webhook.ConnectionOpen, ConnectionID: got[0].ConnectionID, RemoteAddr: "127.0.0.1:1234"},
+		{Type: webhook.SubscriptionStart, ConnectionID: got[0].ConnectionID, RemoteAddr: "127.0.0.1:1234", OperationID: "1", OperationName: "onMessage"},
+		{Type: webhook.SubscriptionStop, ConnectionID: got[0].ConnectionID, RemoteAddr: "127.0.0.1:1234", OperationID: "1", OperationName: "onMessage", Error: "failed"},
+		{Type: webhook.ConnectionClose, ConnectionID: got[0].ConnectionID, RemoteAddr: "127.0.0.1:1234"},
+	} {
+		expected.Time = got[i].Time
+		if got[i] != expected || got[i].ConnectionID == "" || got[i].Time.IsZero() {
+			t.Errorf("expected %+v but instead got %+v", expected, got[i])
+		}
+	}
+}
+
+func TestEmitterDropsFailedEvents(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	var dropped []error
+	e := webhook.New(srv.URL, secret, webhook.OnError(func(event webhook.Event, err error) {
+		dropped = append(dropped, err)
+	}))
+	e.ConnectionStart(context.Background(), graphqlws.ConnectionInfo{})
+	e.Close()
+	e.ConnectionStart(context.Background(), graphqlws.ConnectionInfo{})
+
+	if len(dropped) != 2 || dropped[1] != webhook.ErrClosed {
+		t.Fatalf("expected a rejected and a closed event but instead got %v", dropped)
+	}
+}
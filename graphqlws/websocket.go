@@ -0,0 +1,69 @@
+package graphqlws
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// WebSocket is a server side websocket connection, as upgraded by a
+// WebSocketBackend. It's implemented by *websocket.Conn of gorilla/websocket,
+// whose message types and close payloads the other implementations use too.
+type WebSocket interface {
+	Transport
+	// WriteControl writes a close or ping frame before deadline, it may be
+	// called concurrently with WriteMessage
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	// SetReadDeadline makes the pending and later reads fail with a timeout
+	// once t is past, it's extended whenever a pong is received
+	SetReadDeadline(t time.Time) error
+	// SetPongHandler sets the function called by the reader with the payload
+	// of the pongs it receives
+	SetPongHandler(h func(appData string) error)
+}
+
+// WebSocketBackend upgrades the requests to websocket connections, see
+// WithWebSocketBackend and the gobwas and nhooyr packages
+type WebSocketBackend interface {
+	// Upgrade upgrades r to a websocket speaking protocol, none if it's
+	// empty, the error response being written by Upgrade if it fails
+	Upgrade(w http.ResponseWriter, r *http.Request, protocol string) (WebSocket, error)
+}
+
+// WithWebSocketBackend sets the backend upgrading the requests to websocket
+// connections, gorilla/websocket by default, e.g. so that connections are
+// served by nhooyr.io/websocket or gobwas/ws instead. The upgrader set with
+// WithUpgrader and WithCloseGracePeriod only apply to gorilla/websocket, and
+// the event loop if any still serves ProtocolGraphQLWS.
+func WithWebSocketBackend(b WebSocketBackend) Option {
+	return func(h *handler) {
+		h.wsBackend = b
+	}
+}
+
+var errSubprotocol = errors.New("graphqlws: subprotocol not negotiated")
+
+// upgradeWebSocket upgrades r with the WebSocketBackend if any, otherwise with
+// gorilla/websocket and the upgrader set with WithUpgrader
+func (h *handler) upgradeWebSocket(w http.ResponseWriter, r *http.Request, protocol string) (WebSocket, error) {
+	if h.wsBackend != nil {
+		return h.wsBackend.Upgrade(w, r, protocol)
+	}
+
+	var responseHeader http.Header
+	if protocol != "" {
+		responseHeader = http.Header{"Sec-Websocket-Protocol": {protocol}}
+	}
+	ws, err := h.upgrade(w, r, responseHeader)
+	if err != nil {
+		return nil, err
+	}
+	if ws.Subprotocol() != protocol {
+		ws.Close()
+		return nil, errSubprotocol
+	}
+	if h.closeGrace > 0 {
+		return newGracefulConn(ws, h.closeGrace), nil
+	}
+	return ws, nil
+}